@@ -6,24 +6,154 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
 // RunParams holds user-supplied options for the wrapper.
 type RunParams struct {
-	LogPath      string
-	OtelFile     string
-	TargetCmd    []string
-	FlushTimeout time.Duration
+	LogPath           string
+	OtelFile          string
+	TargetCmd         []string
+	FlushTimeout      time.Duration // wait this long for the uploads on exit
+	UploadTimeout     time.Duration // bound of each upload, at most FlushTimeout; 0 means DefaultUploadTimeout
+	ControlFile       string
+	StrictTimestamps  bool
+	ExplicitOKStatus  bool
+	StreamingDecode   bool
+	InvocationCutoff  bool
+	CommentPrefix     string
+	MaxRuntime        time.Duration
+	FlushSpanCount    int
+	FlushLogCount     int
+	ExitCodeMode      string
+	ForwarderVersion  bool
+	SynthesizeIDs     bool
+	TraceParent       string
+	NoExec            bool
+	OnDuplicate       string
+	SpanNameFields    []string
+	EventSummary      bool
+	StacktraceFields  []string
+	ResolveLogSpans   bool
+	InProgressAfter   time.Duration // upload snapshots of spans open this long; 0 disables
+	SpoolDir          string        // persist batches until uploaded and replay them on the next run; "" disables
+	SpoolMaxBytes     int64         // bound of SpoolDir; 0 means DefaultSpoolMaxBytes
+	Cutoff            string        // CutoffNow or CutoffNone; "" means CutoffNone with NoExec and CutoffNow otherwise
+	FlushInterval     time.Duration // upload buffered records this often; 0 means DefaultFlushInterval
+	BatchSize         int           // upload once this many lines are buffered; 0 means DefaultBatchSize
+	FinalFlushRetries int           // retry the final upload to failed forwarders, each time waiting FlushTimeout longer
+	CancelDrainLimit  int           // on cancel, buffer up to this many queued lines before the final flush; 0 means DefaultCancelDrainLimit, negative drops them
+	FlushOnSignal     bool          // flush immediately on flushSignals (SIGUSR1; none on Windows)
+	DryRun            bool          // decode but only count the records, ignoring forward rules and exporters
+	ElapsedUnit       string        // unit of the elapsed field giving end times; "" means ElapsedUnitAuto
+	MarkReplayed      bool          // with NoExec, stamp dbt.replayed=true on every record
+	ReplayID          string        // with MarkReplayed, also stamp dbt.replay_id
+	StatsFile         string        // write the run statistics as JSON to this file, or to Stdout for "-"; "" disables
+	Since             time.Time     // Forward and Replay skip records older than this; zero forwards all
+}
+
+const (
+	// ExitCodeMaxRuntimeExceeded is returned when dbt is stopped by the
+	// max runtime watchdog, matching timeout(1).
+	ExitCodeMaxRuntimeExceeded = 124
+	// maxRuntimeKillDelay is how long dbt may take to exit after SIGTERM
+	// before it is killed.
+	maxRuntimeKillDelay = 10 * time.Second
+	// ExitCodeForwardFailed is returned in forwarder-aware mode when dbt
+	// succeeded but some OTEL data could not be forwarded.
+	ExitCodeForwardFailed = 3
+)
+
+// Exit code modes select how Run turns dbt's result into its own exit code.
+const (
+	// ExitCodeModePassthrough returns dbt's exit code.
+	ExitCodeModePassthrough = "passthrough"
+	// ExitCodeModeAlwaysZero returns 0 whatever happened, for CI where
+	// neither dbt nor telemetry should fail the pipeline.
+	ExitCodeModeAlwaysZero = "always-zero"
+	// ExitCodeModeForwarderAware returns dbt's exit code, or
+	// ExitCodeForwardFailed if dbt succeeded but forwarding failed.
+	ExitCodeModeForwarderAware = "forwarder-aware"
+)
+
+// ValidExitCodeMode reports whether mode is a known exit code mode.
+func ValidExitCodeMode(mode string) bool {
+	switch mode {
+	case ExitCodeModePassthrough, ExitCodeModeAlwaysZero, ExitCodeModeForwarderAware:
+		return true
+	}
+	return false
+}
+
+// Defaults of RunParams.FlushInterval, RunParams.BatchSize,
+// RunParams.CancelDrainLimit and RunParams.UploadTimeout.
+const (
+	DefaultFlushInterval    = 5 * time.Second
+	DefaultBatchSize        = 100
+	DefaultCancelDrainLimit = 10000
+	DefaultUploadTimeout    = 30 * time.Second
+)
+
+// uploadTimeout is capped by the flush timeout, as exporters wait for
+// uploads in flight when they are stopped on exit.
+func (p RunParams) uploadTimeout() time.Duration {
+	timeout := DefaultUploadTimeout
+	if p.UploadTimeout > 0 {
+		timeout = p.UploadTimeout
+	}
+	if p.FlushTimeout > 0 && p.FlushTimeout < timeout {
+		return p.FlushTimeout
+	}
+	return timeout
+}
+
+func (p RunParams) flushInterval() time.Duration {
+	if p.FlushInterval > 0 {
+		return p.FlushInterval
+	}
+	return DefaultFlushInterval
+}
+
+func (p RunParams) batchSize() int {
+	if p.BatchSize > 0 {
+		return p.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (p RunParams) cancelDrainLimit() int {
+	if p.CancelDrainLimit == 0 {
+		return DefaultCancelDrainLimit
+	}
+	return max(p.CancelDrainLimit, 0)
+}
+
+// Cutoffs select which records of the OTEL file are forwarded by their time.
+const (
+	// CutoffNow skips records older than the start of the run, left in the
+	// file by earlier dbt runs.
+	CutoffNow = "now"
+	// CutoffNone forwards every record, for replaying an archived file.
+	CutoffNone = "none"
+)
+
+// ValidCutoff reports whether cutoff is a known cutoff.
+func ValidCutoff(cutoff string) bool {
+	return cutoff == CutoffNow || cutoff == CutoffNone
 }
 
 // App owns the application lifecycle for the dbt OTEL forwarder.
@@ -34,6 +164,19 @@ type App struct {
 	Stdin   io.Reader
 	Environ func() []string
 	Logger  *slog.Logger
+	// Now is the clock for the start time cutoff, the decoders, the debouncer
+	// and finding the OTEL file. It defaults to time.Now; tests fix it for
+	// reproducible runs.
+	Now func() time.Time
+
+	forwardFailed atomic.Bool
+	inFlight      *inFlightGate
+	linesRead     atomic.Int64 // lines read from the OTEL file in this run
+	spool         *spool
+	flushed       atomic.Int64  // records uploaded by every forwarder
+	pending       atomic.Int64  // records not yet uploaded by every forwarder
+	stats         *runStats     // statistics for StatsFile; nil collects none
+	flushRequests chan struct{} // out-of-band flushes requested by requestFlush
 }
 
 // New returns an App with sensible defaults for CLI execution.
@@ -48,16 +191,52 @@ func New(ctx context.Context, cfg *Config) (*App, error) {
 		Stdin:   os.Stdin,
 		Environ: os.Environ,
 		Logger:  slog.Default(),
+		Now:     time.Now,
+
+		flushRequests: make(chan struct{}, 1),
 	}, nil
 }
 
+// forwarderConfig returns the config with stdout exporters writing to the
+// App's Stdout or Stderr rather than the process's.
+func (a *App) forwarderConfig() *Config {
+	cfg := *a.cfg
+	cfg.Exporters = maps.Clone(a.cfg.Exporters)
+	for name, expCfg := range cfg.Exporters {
+		if (expCfg.Type != "stdout" && expCfg.Type != "debug") || expCfg.Stdout.Writer != nil {
+			continue
+		}
+		expCfg.Stdout.Writer = a.Stdout
+		if expCfg.Stdout.Output == StdoutOutputStderr {
+			expCfg.Stdout.Writer = a.Stderr
+		}
+		cfg.Exporters[name] = expCfg
+	}
+	return &cfg
+}
+
 // Run executes the wrapper: invoke dbt, then forward the OTEL log.
 func (a *App) Run(ctx context.Context, params RunParams) int {
-	if len(params.TargetCmd) == 0 {
+	if len(params.TargetCmd) == 0 && !params.NoExec {
 		fmt.Fprintln(a.Stderr, "no command specified")
 		return 1
 	}
-	forwarders := NewForwarders(ctx, a.cfg)
+	if len(params.TargetCmd) > 0 && params.NoExec {
+		a.Logger.Warn("no-exec mode, ignoring the command", "cmd", params.TargetCmd)
+	}
+	started := a.Now()
+	if params.StatsFile != "" {
+		a.stats = newRunStats()
+	}
+	var forwarders []*Forwarder
+	var dryRun *dryRunExporter
+	if params.DryRun {
+		dryRun = newDryRunExporter()
+		forwarders = a.dryRunForwarders(ctx, dryRun)
+	} else {
+		forwarders = newForwarders(ctx, a.forwarderConfig(), a.stats)
+	}
+	a.inFlight = newInFlightGate(a.cfg.MaxInFlightBytes)
 	defer func() {
 		stopCtx, stopCancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer stopCancel()
@@ -67,6 +246,8 @@ func (a *App) Run(ctx context.Context, params RunParams) int {
 			}
 		}
 	}()
+	// Warm up exporter connections while dbt starts up.
+	go a.warmup(ctx, forwarders)
 	logDir := params.LogPath
 	otelFile := params.OtelFile
 	otelPath := otelFile
@@ -84,40 +265,66 @@ func (a *App) Run(ctx context.Context, params RunParams) int {
 	if !hasEnv(env, "DBT_LOG_PATH") && logDir != "" {
 		env = append(env, fmt.Sprintf("DBT_LOG_PATH=%s", logDir))
 	}
-	// Record the start time for cutoff (to skip old logs from previous runs)
-	startTimeNano := uint64(time.Now().UnixNano())
+	// Record the start time for cutoff (to skip old logs from previous runs).
+	// Without dbt the whole file is forwarded unless asked otherwise.
+	startTimeNano := uint64(a.Now().UnixNano())
+	if params.Cutoff == CutoffNone || (params.Cutoff == "" && params.NoExec) {
+		startTimeNano = 0
+	}
 
 	// Channel for streaming log lines from tail goroutine to flush goroutine
-	lines := make(chan string, 1000)
+	lines := make(chan otelLine, 1000)
+	// tailDone is closed once nothing sends to lines anymore
+	tailDone := make(chan struct{})
+	// tailStopped is closed once the file is no longer followed
+	tailStopped := tailDone
 	var wg sync.WaitGroup
+	if params.SpoolDir != "" && !params.DryRun {
+		a.startSpool(forwarders, params, &wg)
+	}
+	if params.FlushOnSignal {
+		defer a.handleFlushSignals()()
+	}
 	tailCtx, tailCancel := context.WithCancel(ctx)
 	defer tailCancel()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.tailOTELFile(tailCtx, otelPath, lines)
-	}()
+	if params.StreamingDecode {
+		close(tailDone)
+		tailStopped = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(tailStopped)
+			a.streamAndUpload(tailCtx, otelPath, forwarders, startTimeNano, params)
+		}()
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(tailDone)
+			a.tailOTELFile(tailCtx, otelPath, lines, params.NoExec)
+		}()
 
-	// Start flush and upload goroutine
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := a.flushAndUpload(ctx, lines, forwarders, startTimeNano, params); err != nil {
-			a.Logger.Warn("OTEL upload failed", "error", err)
-		}
-	}()
+		// Start flush and upload goroutine
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.flushAndUpload(ctx, lines, forwarders, startTimeNano, params); err != nil {
+				a.Logger.Warn("OTEL upload failed", "error", err)
+			}
+		}()
+	}
 
-	// Execute dbt command
-	a.Logger.Debug("executing dbt command", "cmd", params.TargetCmd)
-	cmd := exec.CommandContext(ctx, params.TargetCmd[0], params.TargetCmd[1:]...)
-	cmd.Env = env
-	cmd.Stdout = a.Stdout
-	cmd.Stderr = a.Stderr
-	cmd.Stdin = a.Stdin
-	cmdErr := cmd.Run()
-	time.Sleep(100 * time.Millisecond) // wait a bit for file writes to settle
+	var cmdErr error
+	var timedOut bool
+	if params.NoExec {
+		timedOut = a.waitForTail(ctx, tailStopped, params.MaxRuntime)
+	} else {
+		timedOut, cmdErr = a.runCommand(ctx, env, params)
+		time.Sleep(100 * time.Millisecond) // wait a bit for file writes to settle
+	}
 	tailCancel()
-	// Close lines channel to signal tail completion
+	// Close lines channel to signal tail completion, once the tail stopped sending
+	<-tailDone
 	close(lines)
 	a.Logger.Debug("dbt command finished, waiting for upload completion")
 
@@ -128,30 +335,177 @@ func (a *App) Run(ctx context.Context, params RunParams) int {
 		close(done)
 	}()
 
-	select {
-	case <-done:
-		a.Logger.Debug("OTEL upload goroutines completed")
-	case <-time.After(params.FlushTimeout):
-		a.Logger.Warn("OTEL upload goroutines did not complete within timeout, proceeding anyway")
+	// Each final flush retry may take another FlushTimeout, so the wait is
+	// extended as many times.
+	for extension := 0; ; extension++ {
+		select {
+		case <-done:
+			a.Logger.Debug("OTEL upload goroutines completed")
+		case <-time.After(params.FlushTimeout):
+			if extension < params.FinalFlushRetries {
+				a.Logger.Info("OTEL upload goroutines still running, extending the flush timeout",
+					"extension", extension+1, "max_extensions", params.FinalFlushRetries)
+				continue
+			}
+			a.Logger.Warn("OTEL upload goroutines did not complete within timeout, proceeding anyway",
+				"flushed_records", a.flushed.Load(), "pending_records", a.pending.Load())
+			a.forwardFailed.Store(true)
+		}
+		break
+	}
+	if pending := a.pending.Load(); pending > 0 {
+		a.Logger.Warn("not all records were flushed", "flushed_records", a.flushed.Load(), "pending_records", pending)
+	} else {
+		a.Logger.Debug("all records flushed", "flushed_records", a.flushed.Load())
+	}
+	if a.linesRead.Load() == 0 {
+		a.warnNoOTELLines(otelPath, env)
+	}
+	if dryRun != nil {
+		dryRun.printSummary(a.Stderr)
 	}
 
-	if cmdErr != nil {
+	code := 0
+	switch {
+	case timedOut && params.NoExec:
+		fmt.Fprintf(a.Stderr, "reading the OTEL file exceeded max runtime of %s\n", params.MaxRuntime)
+		code = ExitCodeMaxRuntimeExceeded
+	case timedOut:
+		fmt.Fprintf(a.Stderr, "dbt command exceeded max runtime of %s\n", params.MaxRuntime)
+		code = ExitCodeMaxRuntimeExceeded
+	case cmdErr != nil:
 		if exitErr, ok := cmdErr.(*exec.ExitError); ok {
-			return exitErr.ExitCode()
+			code = exitErr.ExitCode()
+		} else {
+			fmt.Fprintf(a.Stderr, "dbt command failed: %v\n", cmdErr)
+			code = 1
+		}
+	default:
+		a.Logger.Debug("OTEL forwarder completed successfully")
+	}
+	code = a.exitCode(code, params.ExitCodeMode)
+	if params.StatsFile != "" {
+		a.writeStats(params.StatsFile, started, code)
+	}
+	return code
+}
+
+// warnNoOTELLines explains a run that forwarded nothing because the OTEL file
+// was never written, which usually means dbt wrote it somewhere else or not
+// at all.
+func (a *App) warnNoOTELLines(path string, env []string) {
+	_, err := os.Stat(path)
+	a.Logger.Warn("no lines were read from the OTEL file, so no telemetry was forwarded; "+
+		"check that the dbt version honors DBT_OTEL_FILE_NAME and DBT_LOG_PATH, "+
+		"and that --log-path and --otel-file point where dbt writes",
+		"path", path,
+		"file_exists", err == nil,
+		"DBT_OTEL_FILE_NAME", envValue(env, "DBT_OTEL_FILE_NAME"),
+		"DBT_LOG_PATH", envValue(env, "DBT_LOG_PATH"),
+	)
+}
+
+// runCommand executes the dbt command, enforcing MaxRuntime. It reports
+// whether the command was stopped because it ran too long.
+func (a *App) runCommand(ctx context.Context, env []string, params RunParams) (bool, error) {
+	a.Logger.Debug("executing dbt command", "cmd", params.TargetCmd)
+	cmdCtx := ctx
+	if params.MaxRuntime > 0 {
+		var cmdCancel context.CancelFunc
+		cmdCtx, cmdCancel = context.WithTimeout(ctx, params.MaxRuntime)
+		defer cmdCancel()
+	}
+	cmd := exec.CommandContext(cmdCtx, params.TargetCmd[0], params.TargetCmd[1:]...)
+	cmd.Env = env
+	cmd.Stdout = a.Stdout
+	cmd.Stderr = a.Stderr
+	cmd.Stdin = a.Stdin
+	if params.MaxRuntime > 0 {
+		cmd.Cancel = func() error {
+			if ctx.Err() != nil {
+				return cmd.Process.Kill()
+			}
+			a.Logger.Warn("dbt command exceeded max runtime, terminating", "max_runtime", params.MaxRuntime)
+			return cmd.Process.Signal(syscall.SIGTERM)
+		}
+		cmd.WaitDelay = maxRuntimeKillDelay
+	}
+	cmdErr := cmd.Run()
+	timedOut := cmdErr != nil && ctx.Err() == nil && cmdCtx.Err() == context.DeadlineExceeded
+	return timedOut, cmdErr
+}
+
+// waitForTail waits in no-exec mode until the OTEL file has been read to its
+// end, bounded by maxRuntime if set. It reports whether maxRuntime was hit.
+func (a *App) waitForTail(ctx context.Context, tailStopped <-chan struct{}, maxRuntime time.Duration) bool {
+	a.Logger.Debug("no-exec mode, reading the OTEL file to its end")
+	var timeout <-chan time.Time
+	if maxRuntime > 0 {
+		timer := time.NewTimer(maxRuntime)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-tailStopped:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-timeout:
+		return true
+	}
+}
+
+// exitCode applies the exit code mode to the code derived from dbt's result.
+func (a *App) exitCode(code int, mode string) int {
+	switch mode {
+	case ExitCodeModeAlwaysZero:
+		if code != 0 {
+			a.Logger.Info("ignoring non-zero exit code", "exit_code", code, "exit_code_mode", mode)
+		}
+		return 0
+	case ExitCodeModeForwarderAware:
+		if code == 0 && a.forwardFailed.Load() {
+			fmt.Fprintln(a.Stderr, "dbt command succeeded but OTEL data could not be forwarded")
+			return ExitCodeForwardFailed
 		}
-		fmt.Fprintf(a.Stderr, "dbt command failed: %v\n", cmdErr)
-		return 1
 	}
+	return code
+}
 
-	a.Logger.Debug("OTEL forwarder completed successfully")
-	return 0
+// otelLine is a line of an OTEL file, with where and when it was read.
+type otelLine struct {
+	text   string
+	source string    // path of the file; empty if unknown
+	readAt time.Time // zero if unknown
 }
 
 // tailOTELFile monitors the OTEL log file and sends new lines to the channel.
-func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- string) {
+func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- otelLine, stopAtEOF bool) {
+	a.followOTELFile(ctx, path, stopAtEOF, func(line otelLine) bool {
+		select {
+		case lines <- line:
+			a.Logger.Debug("line sent to channel")
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// followOTELFile monitors the OTEL log file and hands each complete line to emit.
+// It stops when ctx is done or emit returns false, or at the end of the file
+// if stopAtEOF is set, handing a final line without newline to emit as well.
+// If the file is truncated or replaced (rotated) while it is followed, it is
+// read again from the start; old records are then skipped by the decoder's
+// cutoff and duplicate span handling. Unless stopAtEOF is set, if the file
+// does not appear at path, the *.jsonl file dbt writes to in the same
+// directory is followed instead.
+func (a *App) followOTELFile(ctx context.Context, path string, stopAtEOF bool, emit func(line otelLine) bool) {
 	a.Logger.Debug("starting OTEL file tail", "path", path)
 
 	// Wait for file to be created (dbt may not create it immediately)
+	// File times can lag the clock slightly, so allow for that.
+	started := a.Now().Add(-time.Second)
 	var f *os.File
 	var err error
 	for i := 0; i < 30; i++ {
@@ -159,6 +513,17 @@ func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- string
 		if err == nil {
 			break
 		}
+		// dbt may resolve the path on its own; after a second, follow the
+		// OTEL file it writes to instead.
+		if !stopAtEOF && i >= 10 {
+			if detected := detectOTELFile(filepath.Dir(path), started); detected != "" {
+				if f, err = os.Open(detected); err == nil {
+					a.Logger.Warn("OTEL file not found at the expected path, following the file dbt writes to", "expected", path, "detected", detected)
+					path = detected
+					break
+				}
+			}
+		}
 		select {
 		case <-ctx.Done():
 			a.Logger.Debug("tail cancelled before file created")
@@ -170,12 +535,19 @@ func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- string
 		a.Logger.Debug("OTEL file not found, skipping tail", "path", path, "error", err)
 		return
 	}
-	defer f.Close()
+	defer func() { f.Close() }()
 
 	a.Logger.Debug("OTEL file opened successfully", "path", path)
 
+	opened, err := f.Stat()
+	if err != nil {
+		a.Logger.Debug("failed to stat OTEL file", "path", path, "error", err)
+		return
+	}
 	reader := bufio.NewReader(f)
 	lineCount := 0
+	var offset int64   // bytes read from the current file
+	var partial string // line read up to the end of the file, awaiting its newline
 
 	for {
 		select {
@@ -186,22 +558,52 @@ func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- string
 		}
 
 		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		line = partial + line
+		partial = ""
 		if err != nil {
-			if err == io.EOF {
-				// EOF reached, wait a bit and retry
-				// Don't return the partial line if we got one
-				if line != "" {
-					// We have a partial line without newline, put it back
-					// This shouldn't happen with JSONL, but handle it gracefully
-					a.Logger.Debug("partial line at EOF, waiting for more", "partial", line[:min(50, len(line))])
+			if err == io.EOF && stopAtEOF {
+				if line = strings.TrimSuffix(line, "\r"); line != "" {
+					lineCount++
+					a.linesRead.Add(1)
+					emit(otelLine{text: line, source: path, readAt: a.Now()})
 				}
+				a.Logger.Debug("tail reached end of file", "lines_read", lineCount)
+				return
+			}
+			if err == io.EOF {
+				// Keep a partial line until the rest of it is written.
+				partial = line
 				select {
 				case <-ctx.Done():
 					a.Logger.Debug("tail completed", "lines_read", lineCount)
 					return
 				case <-time.After(100 * time.Millisecond):
-					// Continue reading
 				}
+				info, err := os.Stat(path)
+				if err != nil {
+					// Removed while rotated; wait for the new file.
+					continue
+				}
+				if !os.SameFile(opened, info) {
+					next, err := os.Open(path)
+					if err != nil {
+						continue
+					}
+					a.Logger.Info("OTEL file was replaced, reading the new file from the start", "path", path)
+					f.Close()
+					f, opened = next, info
+				} else if info.Size() < offset {
+					a.Logger.Info("OTEL file was truncated, reading it again from the start", "path", path)
+					if _, err := f.Seek(0, io.SeekStart); err != nil {
+						a.Logger.Debug("failed to rewind OTEL file", "error", err)
+						return
+					}
+				} else {
+					continue
+				}
+				reader.Reset(f)
+				offset, partial = 0, ""
 				continue
 			}
 			// Other error
@@ -217,92 +619,191 @@ func (a *App) tailOTELFile(ctx context.Context, path string, lines chan<- string
 		}
 
 		lineCount++
-		select {
-		case lines <- line:
-			a.Logger.Debug("line sent to channel", "line_number", lineCount)
-		case <-ctx.Done():
+		a.linesRead.Add(1)
+		if !emit(otelLine{text: line, source: path, readAt: a.Now()}) {
 			a.Logger.Debug("tail cancelled while sending", "lines_read", lineCount)
 			return
 		}
 	}
 }
 
+// detectOTELFile returns the most recently modified *.jsonl file in dir that
+// was modified since the given time, or "" if there is none.
+func detectOTELFile(dir string, since time.Time) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var detected string
+	var latest time.Time
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != ".jsonl" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().Before(since) || !info.ModTime().After(latest) {
+			continue
+		}
+		detected, latest = filepath.Join(dir, entry.Name()), info.ModTime()
+	}
+	return detected
+}
+
 // flushAndUpload reads lines from channel, buffers them, and periodically uploads traces.
-func (a *App) flushAndUpload(ctx context.Context, lines <-chan string, forwarders []*Forwarder, cutoffTimeNano uint64, params RunParams) error {
+func (a *App) flushAndUpload(ctx context.Context, lines <-chan otelLine, forwarders []*Forwarder, cutoffTimeNano uint64, params RunParams) error {
 	// Create decoder once and reuse it to maintain state across flushes
-	decoder := NewDecoder(cutoffTimeNano)
-	buffer := make([]string, 0, 100)
-	ticker := time.NewTicker(5 * time.Second)
+	decoder := a.newDecoder(cutoffTimeNano, params)
+	buffer := make([]otelLine, 0, params.batchSize())
+	ticker := time.NewTicker(params.flushInterval())
 	defer ticker.Stop()
+	control := newControlFile(params.ControlFile)
+	paused := false
+	countFlush := params.FlushSpanCount > 0 || params.FlushLogCount > 0
+	debounce := newDebouncer(a.cfg.DebounceMax, a.cfg.DebounceDelay, a.Now)
+
+	// Forwarders with their own batch settings get decoded records as they
+	// are decoded and upload them on their own cadence.
+	forwarders, batchers := splitBatchedForwarders(forwarders)
+	for _, b := range batchers {
+		go a.runBatcher(b, control, params)
+	}
+	defer func() {
+		for _, b := range batchers {
+			b.close()
+		}
+	}()
 
-	flush := func() {
+	// Decoded records waiting for upload. Without count based flushing they
+	// only live within a single flush.
+	var pendingSpans []*tracepb.Span
+	var pendingLogs []*logspb.LogRecord
+	var pendingMetrics []*metricspb.Metric
+	// Decoded records for the batchers, handed over by handOff.
+	var batched batchRecords
+	decodeBuffer := func() {
 		if len(buffer) == 0 {
 			return
 		}
-		a.Logger.Debug("flushing buffer", "line_count", len(buffer))
-
-		spans, logs, err := decoder.DecodeLines(buffer)
+		a.Logger.Debug("decoding buffer", "line_count", len(buffer))
+		spans, logs, err := decoder.decodeOTELLines(buffer)
+		buffer = buffer[:0]
 		if err != nil {
-			a.Logger.Debug("failed to decode spans", "error", err)
 			// Don't return error for decode failures, just log and skip
 			a.Logger.Warn("skipping invalid OTEL log lines", "error", err)
-			buffer = buffer[:0]
 			return
 		}
+		metrics := decoder.Metrics()
+		a.Logger.Debug("decoded results", "span_count", len(spans), "log_count", len(logs), "metric_count", len(metrics))
+		if len(batchers) > 0 {
+			batched.spans = append(batched.spans, spans...)
+			batched.logs = append(batched.logs, logs...)
+			batched.metrics = append(batched.metrics, metrics...)
+		}
+		if len(forwarders) == 0 {
+			return
+		}
+		pendingSpans = append(pendingSpans, spans...)
+		pendingLogs = append(pendingLogs, logs...)
+		pendingMetrics = append(pendingMetrics, metrics...)
+	}
+	// handOff passes the decoded records to the batchers. It must not be
+	// called while holding in-flight memory, as the batchers wait for it too
+	// and stop taking records meanwhile.
+	handOff := func() {
+		if batched.len() == 0 {
+			return
+		}
+		for _, b := range batchers {
+			b.add(batched.spans, batched.logs, batched.metrics)
+		}
+		batched = batchRecords{}
+	}
+	countReached := func() bool {
+		return (params.FlushSpanCount > 0 && len(pendingSpans) >= params.FlushSpanCount) ||
+			(params.FlushLogCount > 0 && len(pendingLogs) >= params.FlushLogCount)
+	}
 
-		a.Logger.Debug("decoded results", "span_count", len(spans), "log_count", len(logs))
-
-		if len(logs) == 0 && len(spans) == 0 {
-			a.Logger.Debug("no spans or logs decoded from buffer")
+	// flush uploads pending records; unless final or forced they may be held
+	// back by debouncing. The control file pauses all but the final flush:
+	// nothing would upload what it spools once the run is over.
+	flush := func(final, force bool) {
+		pausedNow := control.Paused()
+		if pausedNow && !final {
+			if !paused {
+				a.Logger.Info("forwarding paused by control file", "path", params.ControlFile)
+				paused = true
+			}
+			if len(buffer) == 0 {
+				return
+			}
+			if err := control.Spool(lineTexts(buffer)); err != nil {
+				// Keep the lines in memory; they are retried on the next flush.
+				a.Logger.Warn("failed to spool OTEL log lines while paused", "error", err)
+				return
+			}
+			a.Logger.Debug("spooled buffer while paused", "line_count", len(buffer))
 			buffer = buffer[:0]
 			return
 		}
-		var wg sync.WaitGroup
-		uploadCtxWithTimeout, uploadCancel := context.WithTimeout(context.Background(), params.FlushTimeout)
-		defer uploadCancel()
-		if len(logs) > 0 {
-			a.Logger.Debug("logs decoded but not yet handled", "count", len(logs))
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for _, forwarder := range forwarders {
-					if err := forwarder.UploadLogs(uploadCtxWithTimeout, &logspb.ScopeLogs{
-						Scope: &commonpb.InstrumentationScope{
-							Name:    "dbt-fusion-otel-forwarder",
-							Version: Version,
-						},
-						LogRecords: logs,
-					}); err != nil {
-						a.Logger.Warn("failed to upload logs", "error", err, "log_count", len(logs))
-					} else {
-						a.Logger.Debug("logs uploaded successfully", "log_count", len(logs))
-					}
-				}
-			}()
-		}
-
-		if len(spans) > 0 {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for _, forwarder := range forwarders {
-					if err := forwarder.UploadTraces(uploadCtxWithTimeout, &tracepb.ScopeSpans{
-						Scope: &commonpb.InstrumentationScope{
-							Name:    "dbt-fusion-otel-forwarder",
-							Version: Version,
-						},
-						Spans: spans,
-					}); err != nil {
-						a.Logger.Warn("failed to upload traces", "error", err, "span_count", len(spans))
-					} else {
-						a.Logger.Debug("traces uploaded successfully", "span_count", len(spans))
-					}
-				}
-			}()
+		if pausedNow {
+			a.Logger.Warn("the run ended while forwarding is paused by the control file, uploading the remaining records anyway", "path", params.ControlFile)
+		} else if paused {
+			a.Logger.Info("forwarding resumed by control file", "path", params.ControlFile)
+			paused = false
 		}
-		wg.Wait()
-		a.Logger.Debug("upload telemetry successfully", "span_count", len(spans), "log_count", len(logs))
-		buffer = buffer[:0]
+		spooled, err := control.Drain()
+		if err != nil {
+			a.Logger.Warn("failed to replay spooled OTEL log lines", "error", err)
+		}
+		if len(spooled) > 0 {
+			a.Logger.Debug("replaying spooled lines", "line_count", len(spooled))
+			// Spooled lines count as read when they are replayed, from no
+			// particular file.
+			replayed := make([]otelLine, len(spooled), len(spooled)+len(buffer))
+			for i, line := range spooled {
+				replayed[i].text = line
+			}
+			buffer = append(replayed, buffer...)
+		}
+		if len(buffer) == 0 && len(pendingSpans) == 0 && len(pendingLogs) == 0 && len(pendingMetrics) == 0 {
+			return
+		}
+		// Reserve in-flight memory before decoding. While other uploads hold
+		// it, this loop stops reading lines and the tail stops reading the file.
+		defer handOff() // after the release below
+		release := a.inFlight.acquire(linesSize(buffer) + recordsSize(pendingSpans, pendingLogs, pendingMetrics))
+		defer release()
+		decodeBuffer()
+		if len(forwarders) == 0 {
+			return
+		}
+		// Snapshots are taken anew on every flush and never held back, so
+		// they cannot outdate the completed span. The final flush sends none.
+		var inProgress []*tracepb.Span
+		if !final {
+			inProgress = decoder.InProgressSpans()
+		}
+		if len(pendingLogs) == 0 && len(pendingSpans) == 0 && len(pendingMetrics) == 0 && len(inProgress) == 0 {
+			a.Logger.Debug("no spans, logs or metrics decoded from buffer")
+			return
+		}
+		if !force && debounce.hold(len(pendingSpans)+len(pendingLogs)+len(pendingMetrics)) {
+			a.Logger.Debug("holding records back for debouncing", "span_count", len(pendingSpans), "log_count", len(pendingLogs))
+			return
+		}
+		if len(inProgress) > 0 {
+			a.Logger.Debug("uploading in-progress span snapshots", "span_count", len(inProgress))
+			pendingSpans = append(pendingSpans, inProgress...)
+		}
+		// Records may come from several decode calls when counting decoded records.
+		sortSpansByStartTime(pendingSpans)
+		sortLogsByTime(pendingLogs)
+		retries := 0
+		if final {
+			retries = params.FinalFlushRetries
+		}
+		a.upload(pendingSpans, pendingLogs, pendingMetrics, forwarders, params, retries)
+		pendingSpans, pendingLogs, pendingMetrics = nil, nil, nil
 	}
 
 	for {
@@ -312,24 +813,345 @@ func (a *App) flushAndUpload(ctx context.Context, lines <-chan string, forwarder
 				// Channel closed, flush remaining buffer and exit
 				// Use background context for final flush to avoid cancellation
 				a.Logger.Debug("lines channel closed, final flush")
-				flush()
+				flush(true, true)
 				return nil
 			}
 			buffer = append(buffer, line)
-			if len(buffer) >= 100 {
-				flush()
+			if countFlush && !control.Paused() {
+				decodeBuffer()
+				handOff()
+				if countReached() {
+					flush(false, false)
+				}
+				continue
+			}
+			if len(buffer) >= params.batchSize() {
+				flush(false, false)
 			}
 		case <-ticker.C:
-			flush()
+			flush(false, false)
+		case <-a.flushRequests:
+			a.Logger.Debug("flush requested")
+			flush(false, true)
 		case <-ctx.Done():
-			a.Logger.Debug("upload cancelled, final flush")
+			// Lines already queued were read from the file; buffer them
+			// rather than losing them, bounded so a busy tail cannot hold
+			// up shutdown.
+			drained := 0
+		drain:
+			for drained < params.cancelDrainLimit() {
+				select {
+				case line, ok := <-lines:
+					if !ok {
+						break drain
+					}
+					buffer = append(buffer, line)
+					drained++
+				default:
+					break drain
+				}
+			}
+			a.Logger.Debug("upload cancelled, final flush", "drained_lines", drained)
 			// Use background context for final flush to avoid cancellation
-			flush()
+			flush(true, true)
 			return nil
 		}
 	}
 }
 
+// lineTexts returns the text of each line.
+func lineTexts(lines []otelLine) []string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return texts
+}
+
+// requestFlush asks the running upload loop to flush now, bypassing
+// debouncing. Requests made while one is pending are merged into it, so the
+// caller never blocks.
+func (a *App) requestFlush() {
+	select {
+	case a.flushRequests <- struct{}{}:
+	default:
+	}
+}
+
+// handleFlushSignals turns flushSignals into flush requests until the
+// returned function is called. On platforms without them it does nothing.
+func (a *App) handleFlushSignals() (stop func()) {
+	if len(flushSignals) == 0 {
+		a.Logger.Debug("flush on signal is not supported on this platform")
+		return func() {}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, flushSignals...)
+	go func() {
+		for s := range sig {
+			a.Logger.Info("flush requested by signal", "signal", s.String())
+			a.requestFlush()
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(sig)
+	}
+}
+
+// warmup establishes exporter connections ahead of the first upload. Failures
+// are only logged; the upload itself reports real connection problems.
+func (a *App) warmup(ctx context.Context, forwarders []*Forwarder) {
+	warmupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for _, forwarder := range forwarders {
+		if err := forwarder.Warmup(warmupCtx); err != nil {
+			a.Logger.Debug("exporter warmup failed", "forwarder", forwarder.name, "error", err)
+		}
+	}
+}
+
+func (a *App) newDecoder(cutoffTimeNano uint64, params RunParams) *Decoder {
+	decoder := NewDecoder(cutoffTimeNano)
+	decoder.Now = a.Now
+	decoder.StrictTimestamps(params.StrictTimestamps)
+	decoder.ExplicitOKStatus(params.ExplicitOKStatus)
+	decoder.InvocationCutoff(params.InvocationCutoff)
+	decoder.ForwarderVersion(params.ForwarderVersion)
+	// Only forwarding an existing file replays data; a live run is the
+	// original. Forward and Replay set NoExec.
+	decoder.Replayed(params.NoExec && params.MarkReplayed, params.ReplayID)
+	decoder.SynthesizeIDs(params.SynthesizeIDs)
+	decoder.OnDuplicate(params.OnDuplicate)
+	decoder.SpanNameFields(params.SpanNameFields)
+	decoder.EventSummary(params.EventSummary)
+	decoder.StacktraceFields(params.StacktraceFields)
+	decoder.ResolveLogSpans(params.ResolveLogSpans)
+	decoder.NumberHints(a.cfg.NumberHints)
+	decoder.NodeDurationMetrics(a.cfg.Metrics.FromSpans)
+	decoder.DecodeLatencyMetrics(a.cfg.Metrics.DecodeLatency)
+	decoder.SourceFileAttribute(a.cfg.Decoder.SourceFileAttribute)
+	if severity, ok := severityNumber(a.cfg.Logs.ElevateSeverityThreshold); ok {
+		decoder.ElevateSeverity(severity)
+	}
+	decoder.ExceptionEventName(a.cfg.Decoder.ExceptionEventName)
+	if mapping := a.cfg.Decoder.AttributeMapping; mapping != nil {
+		decoder.AttributeTransformer(mapping.transformer())
+	}
+	decoder.InProgressAfter(params.InProgressAfter)
+	decoder.ElapsedUnit(params.ElapsedUnit)
+	if params.TraceParent != "" {
+		if traceID, spanID, err := ParseTraceParent(params.TraceParent); err == nil {
+			decoder.ParentContext(traceID, spanID)
+		} else {
+			a.Logger.Warn("ignoring traceparent", "error", err)
+		}
+	}
+	decoder.CommentPrefix(params.CommentPrefix)
+	return decoder
+}
+
+// startSpool opens the spool and replays the batches left by earlier runs in
+// the background. Batches spooled by this run are not replayed.
+func (a *App) startSpool(forwarders []*Forwarder, params RunParams, wg *sync.WaitGroup) {
+	sp, err := newSpool(params.SpoolDir, params.SpoolMaxBytes)
+	if err != nil {
+		a.Logger.Warn("spooling is disabled", "error", err)
+		return
+	}
+	paths, err := sp.pending()
+	if err != nil {
+		a.Logger.Warn("spooling is disabled", "error", err)
+		return
+	}
+	a.spool = sp
+	if len(paths) == 0 {
+		return
+	}
+	a.Logger.Info("replaying spooled batches", "dir", params.SpoolDir, "count", len(paths))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, path := range paths {
+			a.replaySpooled(path, forwarders, params)
+		}
+	}()
+}
+
+// replaySpooled uploads a spooled batch to the forwarders that have not
+// uploaded it yet. Batches that cannot be read, or whose forwarders no longer
+// exist, are dropped.
+func (a *App) replaySpooled(path string, forwarders []*Forwarder, params RunParams) {
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	release := a.inFlight.acquire(size)
+	defer release()
+	batch, err := a.spool.load(path)
+	if err != nil {
+		a.Logger.Warn("dropping unreadable spooled batch", "path", path, "error", err)
+		_ = a.spool.settle(path, nil, nil)
+		return
+	}
+	targets := slices.DeleteFunc(slices.Clone(forwarders), func(f *Forwarder) bool {
+		return !slices.Contains(batch.Forwarders, f.name)
+	})
+	if len(targets) == 0 {
+		a.Logger.Warn("dropping spooled batch of unknown forwarders", "path", path, "forwarders", batch.Forwarders)
+		_ = a.spool.settle(path, nil, nil)
+		return
+	}
+	failed := a.uploadBatch(batch.spans, batch.logs, batch.metrics, targets, params)
+	if len(failed) > 0 {
+		a.forwardFailed.Store(true)
+	}
+	if err := a.spool.settle(path, batch, failed); err != nil {
+		a.Logger.Warn("failed to update spooled batch", "path", path, "error", err)
+	}
+}
+
+// upload sends decoded spans, logs and metrics to every forwarder, keeping
+// them in the spool until every forwarder uploaded them. The forwarders that
+// failed are retried up to retries times.
+func (a *App) upload(spans []*tracepb.Span, logs []*logspb.LogRecord, metrics []*metricspb.Metric, forwarders []*Forwarder, params RunParams, retries int) {
+	count := int64(len(spans) + len(logs) + len(metrics))
+	a.pending.Add(count)
+	a.stats.addDecoded(len(spans), len(logs), len(metrics))
+	var path string
+	batch := &spoolBatch{spans: spans, logs: logs, metrics: metrics}
+	if a.spool != nil {
+		for _, f := range forwarders {
+			batch.Forwarders = append(batch.Forwarders, f.name)
+		}
+		var err error
+		if path, err = a.spool.save(batch); err != nil {
+			a.Logger.Warn("failed to spool batch", "error", err)
+		}
+	}
+	// Forwarders modify the records they upload, so every attempt gets a fresh
+	// copy and the batch stays as decoded for retries and the spool.
+	failed := a.uploadBatch(cloneMessages(spans), cloneMessages(logs), cloneMessages(metrics), forwarders, params)
+	for attempt := 1; len(failed) > 0 && attempt <= retries; attempt++ {
+		a.Logger.Info("retrying the final flush", "attempt", attempt, "max_attempts", retries, "forwarders", failed)
+		failed = a.uploadBatch(cloneMessages(spans), cloneMessages(logs), cloneMessages(metrics), slices.DeleteFunc(slices.Clone(forwarders), func(f *Forwarder) bool {
+			return !slices.Contains(failed, f.name)
+		}), params)
+	}
+	if len(failed) > 0 {
+		a.forwardFailed.Store(true)
+	} else {
+		a.pending.Add(-count)
+		a.flushed.Add(count)
+		a.stats.addUploaded(len(spans), len(logs), len(metrics))
+	}
+	if path != "" {
+		if err := a.spool.settle(path, batch, failed); err != nil {
+			a.Logger.Warn("failed to update spooled batch", "path", path, "error", err)
+		}
+	}
+}
+
+// uploadBatch sends spans, logs and metrics to every forwarder, or the ones
+// their match expressions route them to, bounded by UploadTimeout, and returns
+// the names of the forwarders that failed.
+func (a *App) uploadBatch(spans []*tracepb.Span, logs []*logspb.LogRecord, metrics []*metricspb.Metric, forwarders []*Forwarder, params RunParams) []string {
+	var failedMu sync.Mutex
+	failedSet := make(map[string]bool)
+	fail := func(forwarders ...*Forwarder) {
+		failedMu.Lock()
+		defer failedMu.Unlock()
+		for _, f := range forwarders {
+			failedSet[f.name] = true
+		}
+		a.stats.addErrors(len(forwarders))
+	}
+	var wg sync.WaitGroup
+	uploadCtxWithTimeout, uploadCancel := context.WithTimeout(context.Background(), params.uploadTimeout())
+	defer uploadCancel()
+	if len(logs) > 0 {
+		a.Logger.Debug("logs decoded but not yet handled", "count", len(logs))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Route before uploading, as forwarders modify the records.
+			routed := make([][]*logspb.LogRecord, len(forwarders))
+			for i, forwarder := range forwarders {
+				routed[i] = forwarder.routeLogs(logs)
+			}
+			for i, forwarder := range forwarders {
+				if len(routed[i]) == 0 {
+					continue
+				}
+				if err := forwarder.UploadLogs(uploadCtxWithTimeout, &logspb.ScopeLogs{
+					Scope:      a.cfg.Scope.Logs.scope(),
+					SchemaUrl:  a.cfg.Scope.Logs.schemaURL(),
+					LogRecords: routed[i],
+				}); err != nil {
+					a.Logger.Warn("failed to upload logs", "error", err, "log_count", len(routed[i]))
+					fail(forwarder)
+				} else {
+					a.Logger.Debug("logs uploaded successfully", "log_count", len(routed[i]))
+				}
+			}
+		}()
+	}
+
+	if len(spans) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			routed := make([][]*tracepb.Span, len(forwarders))
+			for i, forwarder := range forwarders {
+				routed[i] = forwarder.routeSpans(spans)
+			}
+			for i, forwarder := range forwarders {
+				if len(routed[i]) == 0 {
+					continue
+				}
+				if err := forwarder.UploadTraces(uploadCtxWithTimeout, &tracepb.ScopeSpans{
+					Scope:     a.cfg.Scope.Traces.scope(),
+					SchemaUrl: a.cfg.Scope.Traces.schemaURL(),
+					Spans:     routed[i],
+				}); err != nil {
+					a.Logger.Warn("failed to upload traces", "error", err, "span_count", len(routed[i]))
+					fail(forwarder)
+				} else {
+					a.Logger.Debug("traces uploaded successfully", "span_count", len(routed[i]))
+				}
+			}
+		}()
+	}
+	if len(metrics) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			routed := make([][]*metricspb.Metric, len(forwarders))
+			for i, forwarder := range forwarders {
+				routed[i] = forwarder.routeMetrics(metrics)
+			}
+			for i, forwarder := range forwarders {
+				if len(routed[i]) == 0 {
+					continue
+				}
+				if err := forwarder.UploadMetrics(uploadCtxWithTimeout, &metricspb.ScopeMetrics{
+					Scope:     a.cfg.Scope.Metrics.scope(),
+					SchemaUrl: a.cfg.Scope.Metrics.schemaURL(),
+					Metrics:   routed[i],
+				}); err != nil {
+					a.Logger.Warn("failed to upload metrics", "error", err, "metric_count", len(routed[i]))
+					fail(forwarder)
+				} else {
+					a.Logger.Debug("metrics uploaded successfully", "metric_count", len(routed[i]))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	a.Logger.Debug("upload telemetry successfully", "span_count", len(spans), "log_count", len(logs), "metric_count", len(metrics))
+	return slices.Sorted(maps.Keys(failedSet))
+}
+
 func hasEnv(env []string, key string) bool {
 	prefix := key + "="
 	for _, e := range env {
@@ -340,9 +1162,13 @@ func hasEnv(env []string, key string) bool {
 	return false
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// envValue returns the value of key in env, or "" if it is unset.
+func envValue(env []string, key string) string {
+	prefix := key + "="
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, prefix); ok {
+			return value
+		}
 	}
-	return b
+	return ""
 }
@@ -0,0 +1,1317 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestApp() *App {
+	return &App{
+		cfg:     &Config{},
+		Stdout:  io.Discard,
+		Stderr:  io.Discard,
+		Environ: os.Environ,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Now:     time.Now,
+
+		flushRequests: make(chan struct{}, 1),
+	}
+}
+
+// spanLines returns SpanStart/SpanEnd pairs for n spans with ids starting at offset.
+func spanLines(offset, n int) []string {
+	lines := make([]string, 0, n*2)
+	for i := offset; i < offset+n; i++ {
+		lines = append(lines,
+			fmt.Sprintf(`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"%016x","span_name":"span-%d","start_time_unix_nano":"%d"}`, i+1, i, 1000+i),
+			fmt.Sprintf(`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"%016x","end_time_unix_nano":"%d"}`, i+1, 2000+i),
+		)
+	}
+	return lines
+}
+
+func newMockForwarder(t *testing.T, mock Exporter) []*Forwarder {
+	t.Helper()
+	fw, err := NewForwarder("test-forwarder", ForwardConfig{
+		Traces: &TracesForwardConfig{Exporters: []string{"mock"}},
+		Logs:   &LogsForwardConfig{Exporters: []string{"mock"}},
+	}, map[string]Exporter{"mock": mock})
+	require.NoError(t, err)
+	return []*Forwarder{fw}
+}
+
+func TestFlushAndUpload_ControlFilePauseResume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	dir := t.TempDir()
+	controlPath := filepath.Join(dir, "control")
+	require.NoError(t, os.WriteFile(controlPath, []byte("pause"), 0o600))
+
+	a := newTestApp()
+	lines := make(chan otelLine, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout: 5 * time.Second,
+			ControlFile:  controlPath,
+		})
+		assert.NoError(t, err)
+	}()
+
+	// 100 lines trigger a flush; while paused they must be spooled, not uploaded.
+	for _, line := range spanLines(0, 50) {
+		lines <- otelLine{text: line}
+	}
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(controlPath + ".spool")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var uploaded atomic.Int64
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploaded.Add(int64(len(protoSpans[0].ScopeSpans[0].Spans)))
+			return nil
+		},
+	).Times(1)
+
+	require.NoError(t, os.WriteFile(controlPath, []byte("resume"), 0o600))
+	for _, line := range spanLines(50, 50) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	<-done
+
+	assert.Equal(t, int64(100), uploaded.Load(), "spooled spans should be replayed with new ones")
+	_, err := os.Stat(controlPath + ".spool")
+	assert.True(t, os.IsNotExist(err), "spool should be removed after replay")
+}
+
+func TestFlushAndUpload_ControlFileRunEndsPaused(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	var uploaded atomic.Int64
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploaded.Add(int64(len(protoSpans[0].ScopeSpans[0].Spans)))
+			return nil
+		},
+	).Times(1)
+
+	dir := t.TempDir()
+	controlPath := filepath.Join(dir, "control")
+	require.NoError(t, os.WriteFile(controlPath, []byte("pause"), 0o600))
+
+	var logBuf bytes.Buffer
+	a := newTestApp()
+	a.Logger = slog.New(slog.NewTextHandler(&logBuf, nil))
+	lines := make(chan otelLine, 1000)
+	// 100 lines trigger a flush that spools them; the rest is still buffered
+	// when dbt exits.
+	for _, line := range spanLines(0, 60) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+		FlushTimeout: 5 * time.Second,
+		ControlFile:  controlPath,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(60), uploaded.Load(), "spooled and buffered spans are uploaded by the final flush")
+	_, err = os.Stat(controlPath + ".spool")
+	assert.True(t, os.IsNotExist(err), "nothing is left in the spool")
+	assert.Contains(t, logBuf.String(), "the run ended while forwarding is paused by the control file")
+}
+
+func TestFlushAndUpload_FlushSpanCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	batches := make(chan int, 10)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			batches <- len(protoSpans[0].ScopeSpans[0].Spans)
+			return nil
+		},
+	).Times(3)
+
+	lines := make(chan otelLine, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := newTestApp().flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout:   5 * time.Second,
+			FlushSpanCount: 3,
+		})
+		assert.NoError(t, err)
+	}()
+
+	// 6 spans are only 12 lines, far below the 100 line buffer and before the ticker fires.
+	for _, line := range spanLines(0, 6) {
+		lines <- otelLine{text: line}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case n := <-batches:
+			assert.Equal(t, 3, n)
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected a flush once 3 spans were decoded")
+		}
+	}
+
+	for _, line := range spanLines(6, 1) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	<-done
+	assert.Equal(t, 1, <-batches, "remaining spans are uploaded by the final flush")
+}
+
+func TestUpload_Scope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	a := newTestApp()
+	a.cfg = &Config{Scope: ScopeConfig{
+		Traces: &InstrumentationScopeConfig{Name: "dbt-traces", Version: "1.2.3"},
+		Logs:   &InstrumentationScopeConfig{Name: "dbt-logs"},
+	}}
+
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			scope := protoSpans[0].ScopeSpans[0].Scope
+			assert.Equal(t, "dbt-traces", scope.GetName())
+			assert.Equal(t, "1.2.3", scope.GetVersion())
+			return nil
+		},
+	).Times(1)
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			scope := protoLogs[0].ScopeLogs[0].Scope
+			assert.Equal(t, "dbt-logs", scope.GetName())
+			assert.Equal(t, Version, scope.GetVersion(), "version falls back to the forwarder version")
+			return nil
+		},
+	).Times(1)
+
+	a.upload([]*tracepb.Span{{Name: "span"}}, []*logspb.LogRecord{{}}, nil, newMockForwarder(t, mock), RunParams{FlushTimeout: 5 * time.Second}, 0)
+}
+
+func TestUpload_SchemaURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	const resourceSchema = "https://opentelemetry.io/schemas/1.26.0"
+	a := newTestApp()
+	a.cfg = &Config{Scope: ScopeConfig{
+		Traces:  &InstrumentationScopeConfig{SchemaURL: "https://example.com/traces"},
+		Logs:    &InstrumentationScopeConfig{SchemaURL: "https://example.com/logs"},
+		Metrics: &InstrumentationScopeConfig{SchemaURL: "https://example.com/metrics"},
+	}}
+	fw, err := NewForwarder("test-forwarder", ForwardConfig{
+		Resource: &ForwardResourceConfig{SchemaURL: resourceSchema},
+		Traces:   &TracesForwardConfig{Exporters: []string{"mock"}},
+		Logs:     &LogsForwardConfig{Exporters: []string{"mock"}},
+		Metrics:  &MetricsForwardConfig{Exporters: []string{"mock"}},
+	}, map[string]Exporter{"mock": mock})
+	require.NoError(t, err)
+
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			assert.Equal(t, resourceSchema, protoSpans[0].GetSchemaUrl())
+			assert.Equal(t, "https://example.com/traces", protoSpans[0].ScopeSpans[0].GetSchemaUrl())
+			return nil
+		},
+	).Times(1)
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			assert.Equal(t, resourceSchema, protoLogs[0].GetSchemaUrl())
+			assert.Equal(t, "https://example.com/logs", protoLogs[0].ScopeLogs[0].GetSchemaUrl())
+			return nil
+		},
+	).Times(1)
+	mock.EXPECT().UploadMetrics(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoMetrics []*metricspb.ResourceMetrics) error {
+			assert.Equal(t, resourceSchema, protoMetrics[0].GetSchemaUrl())
+			assert.Equal(t, "https://example.com/metrics", protoMetrics[0].ScopeMetrics[0].GetSchemaUrl())
+			return nil
+		},
+	).Times(1)
+
+	metric := &metricspb.Metric{Name: "rows", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+		DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}}},
+	}}}
+	a.upload([]*tracepb.Span{{Name: "span"}}, []*logspb.LogRecord{{}}, []*metricspb.Metric{metric}, []*Forwarder{fw}, RunParams{FlushTimeout: 5 * time.Second}, 0)
+}
+
+func TestInstrumentationScopeConfig_Default(t *testing.T) {
+	var cfg *InstrumentationScopeConfig
+	scope := cfg.scope()
+	assert.Equal(t, "dbt-fusion-otel-forwarder", scope.GetName())
+	assert.Equal(t, Version, scope.GetVersion())
+}
+
+func TestControlFile_Paused(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control")
+	c := newControlFile(path)
+
+	assert.False(t, c.Paused(), "missing file means running")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	assert.True(t, c.Paused(), "empty file pauses")
+	require.NoError(t, os.WriteFile(path, []byte("pause\n"), 0o600))
+	assert.True(t, c.Paused())
+	require.NoError(t, os.WriteFile(path, []byte("resume\n"), 0o600))
+	assert.False(t, c.Paused())
+
+	var disabled *controlFile
+	assert.False(t, disabled.Paused())
+}
+
+func TestRun_MaxRuntimeExceeded(t *testing.T) {
+	var tracesUploaded atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			tracesUploaded.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	// Prefix timestamps so they lie in the future and pass the start time cutoff.
+	future := time.Now().Add(time.Hour).UnixNano() / 1e4
+	var content strings.Builder
+	for _, line := range spanLines(0, 3) {
+		content.WriteString(strings.ReplaceAll(line, `_unix_nano":"`, fmt.Sprintf(`_unix_nano":"%d`, future)) + "\n")
+	}
+	src := filepath.Join(dir, "src.jsonl")
+	require.NoError(t, os.WriteFile(src, []byte(content.String()), 0o600))
+
+	a := newTestApp()
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+		},
+	}
+	a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+
+	start := time.Now()
+	code := a.Run(context.Background(), RunParams{
+		LogPath:      dir,
+		OtelFile:     "otel.jsonl",
+		TargetCmd:    []string{"sh", "-c", `cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"; exec sleep 30`},
+		FlushTimeout: 5 * time.Second,
+		MaxRuntime:   500 * time.Millisecond,
+	})
+	assert.Equal(t, ExitCodeMaxRuntimeExceeded, code)
+	assert.Less(t, time.Since(start), 10*time.Second, "dbt should be terminated by the watchdog")
+	assert.Positive(t, tracesUploaded.Load(), "final flush should run after the watchdog fired")
+}
+
+func TestRun_ExitCodeMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	future := time.Now().Add(time.Hour).UnixNano() / 1e4
+	var content strings.Builder
+	for _, line := range spanLines(0, 1) {
+		content.WriteString(strings.ReplaceAll(line, `_unix_nano":"`, fmt.Sprintf(`_unix_nano":"%d`, future)) + "\n")
+	}
+	src := filepath.Join(dir, "src.jsonl")
+	require.NoError(t, os.WriteFile(src, []byte(content.String()), 0o600))
+
+	cases := []struct {
+		mode         string
+		dbtExit      int
+		uploadFailed bool
+		expected     int
+	}{
+		{mode: ExitCodeModePassthrough, dbtExit: 0, expected: 0},
+		{mode: ExitCodeModePassthrough, dbtExit: 2, expected: 2},
+		{mode: ExitCodeModePassthrough, dbtExit: 0, uploadFailed: true, expected: 0},
+		{mode: ExitCodeModeAlwaysZero, dbtExit: 0, expected: 0},
+		{mode: ExitCodeModeAlwaysZero, dbtExit: 2, expected: 0},
+		{mode: ExitCodeModeAlwaysZero, dbtExit: 2, uploadFailed: true, expected: 0},
+		{mode: ExitCodeModeForwarderAware, dbtExit: 0, expected: 0},
+		{mode: ExitCodeModeForwarderAware, dbtExit: 2, expected: 2},
+		{mode: ExitCodeModeForwarderAware, dbtExit: 0, uploadFailed: true, expected: ExitCodeForwardFailed},
+		{mode: ExitCodeModeForwarderAware, dbtExit: 2, uploadFailed: true, expected: 2},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s/exit=%d/upload_failed=%v", tc.mode, tc.dbtExit, tc.uploadFailed), func(t *testing.T) {
+			logDir := t.TempDir()
+			script := fmt.Sprintf("exit %d", tc.dbtExit)
+			if tc.uploadFailed {
+				script = fmt.Sprintf(`cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"; sleep 0.5; exit %d`, tc.dbtExit)
+			}
+			a := newTestApp()
+			a.cfg = &Config{
+				Exporters: map[string]ExporterConfig{
+					"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+				},
+				Forward: map[string]ForwardConfig{
+					"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+				},
+			}
+			a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+
+			code := a.Run(context.Background(), RunParams{
+				LogPath:      logDir,
+				OtelFile:     "otel.jsonl",
+				TargetCmd:    []string{"sh", "-c", script},
+				FlushTimeout: 5 * time.Second,
+				ExitCodeMode: tc.mode,
+			})
+			assert.Equal(t, tc.expected, code)
+		})
+	}
+}
+
+func TestRun_NoExec(t *testing.T) {
+	fixture := readTestdataLines(t, "testdata/otel.jsonl")
+	expectedSpans, _, err := NewDecoder(0).DecodeLines(fixture)
+	require.NoError(t, err)
+	require.NotEmpty(t, expectedSpans)
+
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streaming=%v", streaming), func(t *testing.T) {
+			var spansUploaded atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/traces" {
+					body, _ := io.ReadAll(r.Body)
+					var req coltracepb.ExportTraceServiceRequest
+					if assert.NoError(t, proto.Unmarshal(body, &req)) {
+						for _, rs := range req.GetResourceSpans() {
+							for _, ss := range rs.GetScopeSpans() {
+								spansUploaded.Add(int64(len(ss.GetSpans())))
+							}
+						}
+					}
+				}
+				w.Header().Set("Content-Type", "application/x-protobuf")
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "otel.jsonl"), []byte(strings.Join(fixture, "\n")+"\n"), 0o600))
+
+			a := newTestApp()
+			a.cfg = &Config{
+				Exporters: map[string]ExporterConfig{
+					"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+				},
+				Forward: map[string]ForwardConfig{
+					"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+				},
+			}
+
+			start := time.Now()
+			code := a.Run(context.Background(), RunParams{
+				LogPath:         dir,
+				OtelFile:        "otel.jsonl",
+				FlushTimeout:    5 * time.Second,
+				StreamingDecode: streaming,
+				NoExec:          true,
+			})
+			assert.Equal(t, 0, code)
+			assert.Less(t, time.Since(start), 3*time.Second, "the run ends once the file is read")
+			assert.Equal(t, int64(len(expectedSpans)), spansUploaded.Load(), "old records are forwarded without a start time cutoff")
+		})
+	}
+}
+
+func TestRun_FixedClock(t *testing.T) {
+	var spansUploaded atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			body, _ := io.ReadAll(r.Body)
+			var req coltracepb.ExportTraceServiceRequest
+			if assert.NoError(t, proto.Unmarshal(body, &req)) {
+				for _, rs := range req.GetResourceSpans() {
+					for _, ss := range rs.GetScopeSpans() {
+						spansUploaded.Add(int64(len(ss.GetSpans())))
+					}
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jsonl")
+	require.NoError(t, os.WriteFile(src, []byte(strings.Join(spanLines(0, 5), "\n")+"\n"), 0o600))
+
+	a := newTestApp()
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+		},
+	}
+	a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+	// spanLines starts spans at 1000ns, 1001ns, ...; the clock puts the wrapper
+	// start between the second and the third.
+	a.Now = func() time.Time { return time.Unix(0, 1002) }
+
+	code := a.Run(context.Background(), RunParams{
+		LogPath:      dir,
+		OtelFile:     "otel.jsonl",
+		TargetCmd:    []string{"sh", "-c", `cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"`},
+		FlushTimeout: 5 * time.Second,
+	})
+	assert.Equal(t, 0, code)
+	assert.Equal(t, int64(3), spansUploaded.Load(), "spans started before the clock's start time are cut off")
+}
+
+func TestRun_Metrics(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/metrics" {
+			body, _ := io.ReadAll(r.Body)
+			var req colmetricspb.ExportMetricsServiceRequest
+			if assert.NoError(t, proto.Unmarshal(body, &req)) {
+				mu.Lock()
+				for _, rm := range req.GetResourceMetrics() {
+					for _, sm := range rm.GetScopeMetrics() {
+						for _, metric := range sm.GetMetrics() {
+							names = append(names, metric.GetName())
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jsonl")
+	lines := append(spanLines(0, 2),
+		`{"record_type":"Metric","name":"dbt.rows_affected","value":42,"unit":"{row}"}`,
+		`{"record_type":"Metric","name":"dbt.node.duration","value":1.5,"unit":"s"}`,
+	)
+	require.NoError(t, os.WriteFile(src, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	a := newTestApp()
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {
+				Traces:  &TracesForwardConfig{Exporters: []string{"otlp"}},
+				Metrics: &MetricsForwardConfig{Exporters: []string{"otlp"}},
+			},
+		},
+	}
+	a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+	a.Now = func() time.Time { return time.Unix(0, 0) }
+
+	code := a.Run(context.Background(), RunParams{
+		LogPath:      dir,
+		OtelFile:     "otel.jsonl",
+		TargetCmd:    []string{"sh", "-c", `cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"`},
+		FlushTimeout: 5 * time.Second,
+	})
+	assert.Equal(t, 0, code)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"dbt.rows_affected", "dbt.node.duration"}, names)
+}
+
+func TestRun_StdoutExporter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jsonl")
+	lines := append(spanLines(0, 3),
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1500","severity_text":"INFO","body":"running","attributes":{"unique_id":"model.a"}}`,
+	)
+	require.NoError(t, os.WriteFile(src, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	a := newTestApp()
+	a.Stdout = &stdout
+	a.Stderr = &stderr
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"stdout": {Type: "stdout"},
+			"debug":  {Type: "debug", Stdout: StdoutExporterConfig{Output: StdoutOutputStderr}},
+		},
+		Forward: map[string]ForwardConfig{
+			"traces": {Traces: &TracesForwardConfig{Exporters: []string{"stdout"}}},
+			"logs":   {Logs: &LogsForwardConfig{Exporters: []string{"debug"}}},
+		},
+	}
+	a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+	a.Now = func() time.Time { return time.Unix(0, 0) }
+
+	code := a.Run(context.Background(), RunParams{
+		LogPath:      dir,
+		OtelFile:     "otel.jsonl",
+		TargetCmd:    []string{"sh", "-c", `cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"`},
+		FlushTimeout: 5 * time.Second,
+	})
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `traces: 3 spans
+  span span-0 trace_id=00000000000000000000000000000001 span_id=0000000000000001 duration=1µs
+  span span-1 trace_id=00000000000000000000000000000001 span_id=0000000000000002 duration=1µs
+  span span-2 trace_id=00000000000000000000000000000001 span_id=0000000000000003 duration=1µs
+`, stdout.String(), "the stdout exporter writes to the App's Stdout")
+	assert.Equal(t, `logs: 1 log records
+  log INFO "running" dbt.unique_id="model.a"
+`, stderr.String(), "output: stderr writes to the App's Stderr")
+}
+
+func TestRun_SpoolReplaysFailedUploads(t *testing.T) {
+	var down atomic.Bool
+	var mu sync.Mutex
+	var names []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if assert.NoError(t, proto.Unmarshal(body, &req)) {
+			mu.Lock()
+			for _, rs := range req.GetResourceSpans() {
+				for _, ss := range rs.GetScopeSpans() {
+					for _, span := range ss.GetSpans() {
+						names = append(names, span.GetName())
+					}
+				}
+			}
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	spoolDir := filepath.Join(dir, "spool")
+	src := filepath.Join(dir, "src.jsonl")
+	require.NoError(t, os.WriteFile(src, []byte(strings.Join(spanLines(0, 2), "\n")+"\n"), 0o600))
+	run := func(cmd string) int {
+		a := newTestApp()
+		a.cfg = &Config{
+			Exporters: map[string]ExporterConfig{
+				"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+			},
+			Forward: map[string]ForwardConfig{
+				"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+			},
+		}
+		a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+		a.Now = func() time.Time { return time.Unix(0, 0) }
+		return a.Run(context.Background(), RunParams{
+			LogPath:      dir,
+			OtelFile:     "otel.jsonl",
+			TargetCmd:    []string{"sh", "-c", cmd},
+			FlushTimeout: 5 * time.Second,
+			ExitCodeMode: ExitCodeModeForwarderAware,
+			SpoolDir:     spoolDir,
+		})
+	}
+	spooled := func() []string {
+		paths, err := filepath.Glob(filepath.Join(spoolDir, "*.json"))
+		require.NoError(t, err)
+		return paths
+	}
+
+	// The collector is down: the batch stays in the spool.
+	down.Store(true)
+	assert.Equal(t, ExitCodeForwardFailed, run(`cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"`))
+	assert.Len(t, spooled(), 1)
+	assert.Empty(t, names)
+
+	// The next run replays it, even though dbt writes nothing new.
+	require.NoError(t, os.Remove(filepath.Join(dir, "otel.jsonl")))
+	down.Store(false)
+	assert.Equal(t, 0, run("true"))
+	assert.Empty(t, spooled(), "replayed batches are removed")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"span-0", "span-1"}, names)
+}
+
+func TestFlushAndUpload_FinalFlushRetries(t *testing.T) {
+	for _, retries := range []int{0, 2} {
+		ctrl := gomock.NewController(t)
+		mock := NewMockExporter(ctrl)
+		// The exporter is slow on the first upload and answers the retries.
+		calls := 0
+		mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				calls++
+				if calls == 1 {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return nil
+			},
+		).Times(min(retries, 1) + 1)
+
+		a := newTestApp()
+		lines := make(chan otelLine, 10)
+		for _, line := range spanLines(0, 2) {
+			lines <- otelLine{text: line}
+		}
+		close(lines)
+		err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout:      100 * time.Millisecond,
+			FinalFlushRetries: retries,
+		})
+		require.NoError(t, err)
+		if retries == 0 {
+			assert.True(t, a.forwardFailed.Load())
+			assert.EqualValues(t, 0, a.flushed.Load())
+			assert.EqualValues(t, 2, a.pending.Load())
+		} else {
+			assert.False(t, a.forwardFailed.Load(), "the retried final flush succeeded")
+			assert.EqualValues(t, 2, a.flushed.Load())
+			assert.EqualValues(t, 0, a.pending.Load())
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestFlushAndUpload_FinalFlushRetriesUploadDecodedRecords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	// The exporter is slow on the first upload and answers the retry.
+	var attempts []*logspb.LogRecord
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			attempts = append(attempts, protoLogs[0].ScopeLogs[0].LogRecords[0])
+			if len(attempts) == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		},
+	).Times(2)
+	fw, err := NewForwarder("test-forwarder", ForwardConfig{
+		Traces: &TracesForwardConfig{Exporters: []string{"mock"}},
+		Logs: &LogsForwardConfig{
+			Exporters: []string{"mock"},
+			Attributes: []AttributeModifierConfig{
+				{Action: "hash", Key: "dbt.unique_id"},
+			},
+			Body: &LogBodyConfig{ValueExpr: `"[" + severityText + "] " + body`},
+		},
+	}, map[string]Exporter{"mock": mock})
+	require.NoError(t, err)
+
+	a := newTestApp()
+	lines := make(chan otelLine, 10)
+	for _, line := range spanLines(0, 1) {
+		lines <- otelLine{text: line}
+	}
+	lines <- otelLine{text: `{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1500","severity_text":"INFO","body":"running","attributes":{"unique_id":"model.a"}}`}
+	close(lines)
+	err = a.flushAndUpload(context.Background(), lines, []*Forwarder{fw}, 0, RunParams{
+		FlushTimeout:      100 * time.Millisecond,
+		FinalFlushRetries: 1,
+	})
+	require.NoError(t, err)
+	assert.False(t, a.forwardFailed.Load(), "the retried final flush succeeded")
+
+	require.Len(t, attempts, 2)
+	hashed := sha256.Sum256([]byte("model.a"))
+	for _, log := range attempts {
+		assert.Equal(t, "[INFO] running", log.GetBody().GetStringValue())
+		assert.Equal(t, hex.EncodeToString(hashed[:]), convertAttributesToMap(log.GetAttributes())["dbt.unique_id"])
+	}
+}
+
+func TestRun_Cutoff(t *testing.T) {
+	// spanLines records are from 1970, as in an archived file.
+	lines := strings.Join(spanLines(0, 3), "\n") + "\n"
+	cases := []struct {
+		noExec bool
+		cutoff string
+		spans  int
+	}{
+		{noExec: true, cutoff: "", spans: 3},
+		{noExec: true, cutoff: CutoffNow, spans: 0},
+		{noExec: false, cutoff: "", spans: 0},
+		{noExec: false, cutoff: CutoffNone, spans: 3},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("no-exec=%v/cutoff=%q", tc.noExec, tc.cutoff), func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.jsonl")
+			require.NoError(t, os.WriteFile(src, []byte(lines), 0o600))
+			params := RunParams{
+				LogPath:      dir,
+				OtelFile:     "otel.jsonl",
+				FlushTimeout: 5 * time.Second,
+				NoExec:       tc.noExec,
+				Cutoff:       tc.cutoff,
+			}
+			if tc.noExec {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "otel.jsonl"), []byte(lines), 0o600))
+			} else {
+				// dbt keeps running long enough for the tail to find the file.
+				params.TargetCmd = []string{"sh", "-c", `cat "$SRC" >> "$DBT_LOG_PATH/otel.jsonl"; sleep 0.3`}
+			}
+
+			var out bytes.Buffer
+			a := newTestApp()
+			a.cfg = &Config{
+				Exporters: map[string]ExporterConfig{
+					"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &out}},
+				},
+				Forward: map[string]ForwardConfig{
+					"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory"}}},
+				},
+			}
+			a.Environ = func() []string { return append(os.Environ(), "SRC="+src) }
+			assert.Equal(t, 0, a.Run(context.Background(), params))
+			assert.Equal(t, tc.spans, strings.Count(out.String(), "  span "))
+		})
+	}
+}
+
+func TestRun_WarnsWhenOTELFileIsNeverWritten(t *testing.T) {
+	dir := t.TempDir()
+	run := func(cmd string) string {
+		var logBuf bytes.Buffer
+		a := newTestApp()
+		a.Logger = slog.New(slog.NewTextHandler(&logBuf, nil))
+		code := a.Run(context.Background(), RunParams{
+			LogPath:      dir,
+			OtelFile:     "otel.jsonl",
+			TargetCmd:    []string{"sh", "-c", cmd},
+			FlushTimeout: 5 * time.Second,
+		})
+		assert.Equal(t, 0, code, "the warning does not change the exit code")
+		return logBuf.String()
+	}
+
+	out := run("true")
+	assert.Contains(t, out, "level=WARN")
+	assert.Contains(t, out, "no lines were read from the OTEL file")
+	assert.Contains(t, out, "path="+filepath.Join(dir, "otel.jsonl"))
+	assert.Contains(t, out, "file_exists=false")
+	assert.Contains(t, out, "DBT_OTEL_FILE_NAME=otel.jsonl")
+
+	out = run(fmt.Sprintf(`echo '%s' >> "$DBT_LOG_PATH/$DBT_OTEL_FILE_NAME"; sleep 0.3`, spanLines(0, 1)[0]))
+	assert.NotContains(t, out, "no lines were read from the OTEL file")
+}
+
+func TestFlushAndUpload_BatchSize(t *testing.T) {
+	for _, tc := range []struct {
+		batchSize int
+		uploads   []int // span count of each upload
+	}{
+		{batchSize: 0, uploads: []int{3}},
+		{batchSize: 2, uploads: []int{1, 1, 1}},
+	} {
+		t.Run(fmt.Sprintf("batch-size=%d", tc.batchSize), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := NewMockExporter(ctrl)
+
+			var uploads []int
+			mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+					uploads = append(uploads, len(protoSpans[0].ScopeSpans[0].Spans))
+					return nil
+				},
+			).AnyTimes()
+
+			lines := make(chan otelLine, 10)
+			// Each span is a SpanStart and a SpanEnd line.
+			for _, line := range spanLines(0, 3) {
+				lines <- otelLine{text: line}
+			}
+			close(lines)
+			err := newTestApp().flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+				FlushTimeout:  5 * time.Second,
+				FlushInterval: time.Hour,
+				BatchSize:     tc.batchSize,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.uploads, uploads)
+		})
+	}
+}
+
+func TestFlushAndUpload_ForwarderBatch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		batch   ForwardBatchConfig
+		uploads []int // span count of each upload of the batched forwarder
+	}{
+		{name: "size", batch: ForwardBatchConfig{Size: 3}, uploads: []int{3, 3}},
+		{name: "interval", batch: ForwardBatchConfig{Interval: time.Hour}, uploads: []int{6}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			uploadsOf := func(uploads *[]int) Exporter {
+				mock := NewMockExporter(ctrl)
+				mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+						*uploads = append(*uploads, len(protoSpans[0].ScopeSpans[0].Spans))
+						return nil
+					},
+				).AnyTimes()
+				return mock
+			}
+			var sharedUploads, batchedUploads []int
+			shared, err := NewForwarder("shared", ForwardConfig{
+				Traces: &TracesForwardConfig{Exporters: []string{"shared"}},
+			}, map[string]Exporter{"shared": uploadsOf(&sharedUploads)})
+			require.NoError(t, err)
+			batched, err := NewForwarder("batched", ForwardConfig{
+				Traces: &TracesForwardConfig{Exporters: []string{"batched"}},
+				Batch:  &tc.batch,
+			}, map[string]Exporter{"batched": uploadsOf(&batchedUploads)})
+			require.NoError(t, err)
+
+			lines := make(chan otelLine, 20)
+			for _, line := range spanLines(0, 6) {
+				lines <- otelLine{text: line}
+			}
+			close(lines)
+			err = newTestApp().flushAndUpload(context.Background(), lines, []*Forwarder{shared, batched}, 0, RunParams{
+				FlushTimeout:  5 * time.Second,
+				FlushInterval: time.Hour,
+				BatchSize:     2, // a flush per span
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 1, 1, 1, 1, 1}, sharedUploads)
+			assert.Equal(t, tc.uploads, batchedUploads)
+		})
+	}
+}
+
+func TestFlushAndUpload_DrainsLinesOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	var spans int
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			spans += len(protoSpans[0].ScopeSpans[0].Spans)
+			return nil
+		},
+	).AnyTimes()
+
+	// The channel stays open with lines queued while the context is already
+	// cancelled, so whichever case the loop picks first, the queued lines
+	// must still be part of the final flush.
+	lines := make(chan otelLine, 10)
+	for _, line := range spanLines(0, 3) {
+		lines <- otelLine{text: line}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := newTestApp().flushAndUpload(ctx, lines, newMockForwarder(t, mock), 0, RunParams{
+		FlushTimeout:  5 * time.Second,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, spans)
+	assert.Empty(t, lines)
+}
+
+func TestFlushAndUpload_RequestFlush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	uploads := make(chan int, 10)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploads <- len(protoSpans[0].ScopeSpans[0].Spans)
+			return nil
+		},
+	).AnyTimes()
+
+	a := newTestApp()
+	// Debouncing would hold the records back on a tick, but not on request.
+	a.cfg.DebounceDelay = time.Hour
+	lines := make(chan otelLine, 10)
+	done := make(chan error)
+	go func() {
+		done <- a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout:  5 * time.Second,
+			FlushInterval: time.Hour,
+		})
+	}()
+	for _, line := range spanLines(0, 2) {
+		lines <- otelLine{text: line}
+	}
+	require.Eventually(t, func() bool { return len(lines) == 0 }, time.Second, time.Millisecond)
+	a.requestFlush()
+	select {
+	case n := <-uploads:
+		assert.Equal(t, 2, n)
+	case <-time.After(2 * time.Second):
+		t.Fatal("requested flush did not upload")
+	}
+
+	close(lines)
+	require.NoError(t, <-done)
+	assert.Empty(t, uploads, "nothing is left for the final flush")
+}
+
+func TestFlushAndUpload_InProgressSpans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	uploads := make(chan []*tracepb.Span, 10)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploads <- protoSpans[0].ScopeSpans[0].Spans
+			return nil
+		},
+	).Times(2)
+
+	a := newTestApp()
+	// spanLines starts spans at 1000ns, 1001ns, ...
+	a.Now = func() time.Time { return time.Unix(0, 1000+int64(time.Minute)) }
+	lines := make(chan otelLine, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout:    5 * time.Second,
+			FlushSpanCount:  1,
+			InProgressAfter: 30 * time.Second,
+		})
+		assert.NoError(t, err)
+	}()
+
+	// The first span stays open while the second completes and triggers a flush.
+	open := spanLines(0, 1)
+	lines <- otelLine{text: open[0]}
+	for _, line := range spanLines(1, 1) {
+		lines <- otelLine{text: line}
+	}
+	select {
+	case spans := <-uploads:
+		require.Len(t, spans, 2)
+		assert.Equal(t, "span-0", spans[0].Name)
+		assert.Equal(t, true, convertAttributesToMap(spans[0].Attributes)["dbt.span.in_progress"])
+		assert.Equal(t, uint64(1000+int64(time.Minute)), spans[0].EndTimeUnixNano, "the snapshot ends now")
+		assert.Equal(t, "span-1", spans[1].Name)
+		assert.NotContains(t, convertAttributesToMap(spans[1].Attributes), "dbt.span.in_progress")
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a flush with the in-progress snapshot")
+	}
+
+	lines <- otelLine{text: open[1]}
+	close(lines)
+	<-done
+	spans := <-uploads
+	require.Len(t, spans, 1, "the final flush sends the completed span without a snapshot")
+	assert.Equal(t, "span-0", spans[0].Name)
+	assert.NotContains(t, convertAttributesToMap(spans[0].Attributes), "dbt.span.in_progress")
+}
+
+func TestNewDecoder_Replayed(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_threads.jsonl")
+	cases := []struct {
+		name     string
+		params   RunParams
+		replayed bool
+		replayID string
+	}{
+		{"replay", RunParams{NoExec: true, MarkReplayed: true}, true, ""},
+		{"replay with id", RunParams{NoExec: true, MarkReplayed: true, ReplayID: "backfill-1"}, true, "backfill-1"},
+		{"not marked", RunParams{NoExec: true}, false, ""},
+		{"normal run", RunParams{MarkReplayed: true, ReplayID: "backfill-1"}, false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spans, logs, err := newTestApp().newDecoder(0, c.params).DecodeLines(lines)
+			require.NoError(t, err)
+			require.NotEmpty(t, spans)
+			require.NotEmpty(t, logs)
+			attrSets := make([][]*commonpb.KeyValue, 0, len(spans)+len(logs))
+			for _, span := range spans {
+				attrSets = append(attrSets, span.Attributes)
+			}
+			for _, log := range logs {
+				attrSets = append(attrSets, log.Attributes)
+			}
+			for _, attrs := range attrSets {
+				m := convertAttributesToMap(attrs)
+				if c.replayed {
+					assert.Equal(t, true, m["dbt.replayed"])
+				} else {
+					assert.NotContains(t, m, "dbt.replayed")
+				}
+				if c.replayID != "" {
+					assert.Equal(t, c.replayID, m["dbt.replay_id"])
+				} else {
+					assert.NotContains(t, m, "dbt.replay_id")
+				}
+			}
+		})
+	}
+}
+
+func TestRunParams_UploadTimeout(t *testing.T) {
+	assert.Equal(t, DefaultUploadTimeout, RunParams{}.uploadTimeout())
+	assert.Equal(t, DefaultUploadTimeout, RunParams{FlushTimeout: 5 * time.Minute}.uploadTimeout())
+	assert.Equal(t, time.Second, RunParams{FlushTimeout: time.Second}.uploadTimeout(), "uploads never outlast the flush timeout by default")
+	assert.Equal(t, time.Second, RunParams{FlushTimeout: time.Second, UploadTimeout: time.Minute}.uploadTimeout(), "exporters wait for uploads in flight on exit")
+	assert.Equal(t, time.Second, RunParams{FlushTimeout: time.Minute, UploadTimeout: time.Second}.uploadTimeout())
+}
+
+func TestUpload_UploadTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	var uploadErr error
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			<-ctx.Done()
+			uploadErr = ctx.Err()
+			return uploadErr
+		},
+	)
+	a := newTestApp()
+	start := time.Now()
+	a.upload([]*tracepb.Span{{Name: "span"}}, nil, nil, newMockForwarder(t, mock), RunParams{
+		FlushTimeout:  time.Minute,
+		UploadTimeout: 50 * time.Millisecond,
+	}, 0)
+	assert.Less(t, time.Since(start), 5*time.Second, "the upload timeout bounds the upload, not the flush timeout")
+	assert.ErrorIs(t, uploadErr, context.DeadlineExceeded)
+	assert.True(t, a.forwardFailed.Load())
+}
+
+func TestRun_FlushTimeoutBoundsShutdownWait(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "otel.jsonl"), []byte(strings.Join(spanLines(0, 2), "\n")+"\n"), 0o600))
+	a := newTestApp()
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+		},
+	}
+	start := time.Now()
+	code := a.Run(context.Background(), RunParams{
+		LogPath:       dir,
+		OtelFile:      "otel.jsonl",
+		NoExec:        true,
+		FlushTimeout:  200 * time.Millisecond,
+		UploadTimeout: time.Minute,
+		ExitCodeMode:  ExitCodeModeForwarderAware,
+	})
+	assert.Less(t, time.Since(start), 10*time.Second, "the flush timeout bounds the wait on exit, not the upload timeout")
+	assert.Equal(t, ExitCodeForwardFailed, code)
+}
+
+func TestTailOTELFile_TruncatedAndRotated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "otel.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("line-1\nline-2\nline-3\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan otelLine, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newTestApp().tailOTELFile(ctx, path, lines, false)
+	}()
+	receive := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				assert.Equal(t, w, got.text)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+	receive("line-1", "line-2", "line-3")
+
+	// Truncated in place and rewritten shorter than what was read.
+	require.NoError(t, os.WriteFile(path, []byte("after-truncate\n"), 0o600))
+	receive("after-truncate")
+
+	// Rotated: moved away and replaced by a new file.
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("after-rotate-1\nafter-rotate-"), 0o600))
+	receive("after-rotate-1")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	receive("after-rotate-2")
+
+	cancel()
+	<-done
+	assert.Empty(t, lines, "no line is read twice")
+}
+
+func TestTailOTELFile_DetectsUnexpectedFileName(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "previous.jsonl")
+	require.NoError(t, os.WriteFile(stale, []byte("stale\n"), 0o600))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan otelLine, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newTestApp().tailOTELFile(ctx, filepath.Join(dir, "otel.jsonl"), lines, false)
+	}()
+	// dbt writes somewhere other than the file name it was given.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dbt-otel.jsonl"), []byte("line-1\nline-2\n"), 0o600))
+	for _, want := range []string{"line-1", "line-2"} {
+		select {
+		case got := <-lines:
+			assert.Equal(t, want, got.text)
+			assert.Equal(t, filepath.Join(dir, "dbt-otel.jsonl"), got.source, "lines carry the file they were read from")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestRun_StatsFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "otel.jsonl"), []byte(strings.Join(spanLines(0, 2), "\n")+"\n"), 0o600))
+	exporters := map[string]ExporterConfig{
+		"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &bytes.Buffer{}}},
+		"otlp":   {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+	}
+
+	t.Run("file", func(t *testing.T) {
+		a := newTestApp()
+		a.cfg = &Config{
+			Exporters: exporters,
+			Forward: map[string]ForwardConfig{
+				"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory"}}},
+			},
+		}
+		statsFile := filepath.Join(t.TempDir(), "stats.json")
+		code := a.Run(context.Background(), RunParams{LogPath: dir, OtelFile: "otel.jsonl", NoExec: true, FlushTimeout: 5 * time.Second, StatsFile: statsFile})
+		require.Equal(t, 0, code)
+
+		b, err := os.ReadFile(statsFile)
+		require.NoError(t, err)
+		var stats RunStats
+		require.NoError(t, json.Unmarshal(b, &stats))
+		assert.GreaterOrEqual(t, stats.DurationSeconds, 0.0)
+		stats.DurationSeconds = 0
+		assert.Equal(t, RunStats{
+			LinesRead: 4,
+			Decoded:   RecordCounts{Spans: 2},
+			Uploaded:  RecordCounts{Spans: 2},
+			Exporters: map[string]*ExporterStats{"memory": {Succeeded: 1}},
+		}, stats)
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		var stdout bytes.Buffer
+		a := newTestApp()
+		a.Stdout = &stdout
+		a.cfg = &Config{
+			Exporters: exporters,
+			Forward: map[string]ForwardConfig{
+				"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory", "otlp"}}},
+			},
+		}
+		code := a.Run(context.Background(), RunParams{LogPath: dir, OtelFile: "otel.jsonl", NoExec: true, FlushTimeout: 5 * time.Second, StatsFile: "-", ExitCodeMode: ExitCodeModeForwarderAware})
+		require.Equal(t, ExitCodeForwardFailed, code)
+
+		var stats RunStats
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &stats))
+		assert.Equal(t, RecordCounts{Spans: 2}, stats.Decoded)
+		assert.Equal(t, RecordCounts{}, stats.Uploaded, "records count as uploaded once every forwarder sent them")
+		assert.Equal(t, int64(1), stats.Errors)
+		assert.Equal(t, map[string]*ExporterStats{"memory": {Succeeded: 1}, "otlp": {Failed: 1}}, stats.Exporters)
+		assert.Equal(t, ExitCodeForwardFailed, stats.ExitCode)
+	})
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"slices"
+	"time"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// forwardBatcher buffers the decoded records of a forwarder with its own
+// batch settings and uploads them on its own cadence, independent of the
+// shared flush of the other forwarders.
+type forwardBatcher struct {
+	forwarder *Forwarder
+	interval  time.Duration
+	size      int
+	records   chan batchRecords
+	done      chan struct{}
+}
+
+// batchRecords are decoded records handed to a forwardBatcher.
+type batchRecords struct {
+	spans   []*tracepb.Span
+	logs    []*logspb.LogRecord
+	metrics []*metricspb.Metric
+}
+
+func (r *batchRecords) len() int {
+	return len(r.spans) + len(r.logs) + len(r.metrics)
+}
+
+// splitBatchedForwarders returns the forwarders uploaded by the shared flush
+// and a batcher for each forwarder with its own batch settings.
+func splitBatchedForwarders(forwarders []*Forwarder) ([]*Forwarder, []*forwardBatcher) {
+	var shared []*Forwarder
+	var batchers []*forwardBatcher
+	for _, f := range forwarders {
+		batch := f.cfg.Batch
+		if batch == nil || (batch.Interval <= 0 && batch.Size <= 0) {
+			shared = append(shared, f)
+			continue
+		}
+		batchers = append(batchers, &forwardBatcher{
+			forwarder: f,
+			interval:  batch.Interval,
+			size:      batch.Size,
+			records:   make(chan batchRecords, 100),
+			done:      make(chan struct{}),
+		})
+	}
+	return shared, batchers
+}
+
+// add hands decoded records to the batcher. Forwarders modify the records
+// they upload, so the batcher gets its own copy.
+func (b *forwardBatcher) add(spans []*tracepb.Span, logs []*logspb.LogRecord, metrics []*metricspb.Metric) {
+	if len(spans) == 0 && len(logs) == 0 && len(metrics) == 0 {
+		return
+	}
+	b.records <- batchRecords{
+		spans:   cloneMessages(spans),
+		logs:    cloneMessages(logs),
+		metrics: cloneMessages(metrics),
+	}
+}
+
+// close makes the batcher upload what it holds and waits until it is done.
+func (b *forwardBatcher) close() {
+	close(b.records)
+	<-b.done
+}
+
+// runBatcher uploads the records handed to b once size records are pending
+// or every interval, and everything left once b is closed. The control file
+// pauses all but the final upload.
+func (a *App) runBatcher(b *forwardBatcher, control *controlFile, params RunParams) {
+	defer close(b.done)
+	var tick <-chan time.Time
+	if b.interval > 0 {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var pending batchRecords
+	flush := func(final bool) {
+		if pending.len() == 0 || (!final && control.Paused()) {
+			return
+		}
+		a.Logger.Debug("flushing forwarder batch", "forwarder", b.forwarder.name, "span_count", len(pending.spans), "log_count", len(pending.logs), "metric_count", len(pending.metrics))
+		sortSpansByStartTime(pending.spans)
+		sortLogsByTime(pending.logs)
+		retries := 0
+		if final {
+			retries = params.FinalFlushRetries
+		}
+		// While waiting, the batcher stops taking records and so holds up the
+		// read loop handing them over.
+		release := a.inFlight.acquire(recordsSize(pending.spans, pending.logs, pending.metrics))
+		defer release()
+		a.upload(pending.spans, pending.logs, pending.metrics, []*Forwarder{b.forwarder}, params, retries)
+		pending = batchRecords{}
+	}
+	for {
+		select {
+		case records, ok := <-b.records:
+			if !ok {
+				flush(true)
+				return
+			}
+			pending.spans = append(pending.spans, records.spans...)
+			pending.logs = append(pending.logs, records.logs...)
+			pending.metrics = append(pending.metrics, records.metrics...)
+			if b.size > 0 && pending.len() >= b.size {
+				flush(false)
+			}
+		case <-tick:
+			flush(false)
+		}
+	}
+}
+
+func cloneMessages[T proto.Message](messages []T) []T {
+	if len(messages) == 0 {
+		return nil
+	}
+	cloned := slices.Clone(messages)
+	for i, m := range cloned {
+		cloned[i] = proto.Clone(m).(T)
+	}
+	return cloned
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/hex"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
@@ -23,10 +27,104 @@ func NewSpanEnv() (*cel.Env, error) {
 		cel.Variable("kind", cel.StringType),
 		cel.Variable("events", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
 		cel.Variable("links", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		idFunctions(),
+		extFunctions(),
 	)
 	return env, err
 }
 
+// extFunctions enables the cel-go extension libraries for strings (e.g.
+// substring, lowerAscii, split, replace), math (e.g. math.greatest),
+// lists, sets and base64 encoding in every rule environment.
+func extFunctions() cel.EnvOption {
+	return cel.Lib(extLib{})
+}
+
+type extLib struct{}
+
+func (extLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		ext.Strings(),
+		ext.Math(),
+		ext.Lists(),
+		ext.Sets(),
+		ext.Encoders(),
+	}
+}
+
+func (extLib) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
+
+// idFunctions provides helpers for rules on hex encoded ids:
+// hexLen(s) returns the number of bytes s represents (-1 if s is not hex),
+// isValidTraceId(s) and isValidSpanId(s) check length and reject all-zero ids
+// as the W3C Trace Context spec does.
+func idFunctions() cel.EnvOption {
+	return cel.Lib(idLib{})
+}
+
+type idLib struct{}
+
+func (idLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("hexLen",
+			cel.Overload("hexLen_string", []*cel.Type{cel.StringType}, cel.IntType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					b, ok := decodeHexID(val)
+					if !ok {
+						return types.Int(-1)
+					}
+					return types.Int(len(b))
+				}),
+			),
+		),
+		cel.Function("isValidTraceId",
+			cel.Overload("isValidTraceId_string", []*cel.Type{cel.StringType}, cel.BoolType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					return types.Bool(isValidHexID(val, 16))
+				}),
+			),
+		),
+		cel.Function("isValidSpanId",
+			cel.Overload("isValidSpanId_string", []*cel.Type{cel.StringType}, cel.BoolType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					return types.Bool(isValidHexID(val, 8))
+				}),
+			),
+		),
+	}
+}
+
+func (idLib) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
+
+func decodeHexID(val ref.Val) ([]byte, bool) {
+	s, ok := val.Value().(string)
+	if !ok {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func isValidHexID(val ref.Val, size int) bool {
+	b, ok := decodeHexID(val)
+	if !ok || len(b) != size {
+		return false
+	}
+	for _, c := range b {
+		if c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func NewLogEnv() (*cel.Env, error) {
 	env, err := cel.NewEnv(
 		cel.Variable("traceId", cel.StringType),
@@ -37,6 +135,52 @@ func NewLogEnv() (*cel.Env, error) {
 		cel.Variable("severityText", cel.StringType),
 		cel.Variable("body", cel.DynType),
 		cel.Variable("attributes", cel.MapType(cel.StringType, cel.DynType)),
+		extFunctions(),
+	)
+	return env, err
+}
+
+func NewMetricEnv() (*cel.Env, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("name", cel.StringType),
+		cel.Variable("description", cel.StringType),
+		cel.Variable("unit", cel.StringType),
+		cel.Variable("timeUnixNano", cel.UintType),
+		cel.Variable("value", cel.DynType),
+		cel.Variable("attributes", cel.MapType(cel.StringType, cel.DynType)),
+		extFunctions(),
+	)
+	return env, err
+}
+
+// NewMatchEnv returns the CEL environment for forward match expressions,
+// which are evaluated on spans, log records and metrics alike. It declares
+// the variables of all three; a variable the record does not have fails the
+// evaluation.
+func NewMatchEnv() (*cel.Env, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("traceId", cel.StringType),
+		cel.Variable("spanId", cel.StringType),
+		cel.Variable("parentSpanId", cel.StringType),
+		cel.Variable("name", cel.StringType),
+		cel.Variable("traceState", cel.StringType),
+		cel.Variable("startTimeUnixNano", cel.UintType),
+		cel.Variable("endTimeUnixNano", cel.UintType),
+		cel.Variable("status", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("kind", cel.StringType),
+		cel.Variable("events", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		cel.Variable("links", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		cel.Variable("timeUnixNano", cel.UintType),
+		cel.Variable("observedTimeUnixNano", cel.UintType),
+		cel.Variable("severityNumber", cel.IntType),
+		cel.Variable("severityText", cel.StringType),
+		cel.Variable("body", cel.DynType),
+		cel.Variable("description", cel.StringType),
+		cel.Variable("unit", cel.StringType),
+		cel.Variable("value", cel.DynType),
+		cel.Variable("attributes", cel.MapType(cel.StringType, cel.DynType)),
+		idFunctions(),
+		extFunctions(),
 	)
 	return env, err
 }
@@ -122,6 +266,25 @@ func LogForEval(log *logspb.LogRecord) any {
 	return obj
 }
 
+// MetricForEval describes a metric with one of its data points.
+func MetricForEval(metric *metricspb.Metric, dp *metricspb.NumberDataPoint) any {
+	var value any
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		value = v.AsInt
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = v.AsDouble
+	}
+	return map[string]any{
+		"name":         metric.GetName(),
+		"description":  metric.GetDescription(),
+		"unit":         metric.GetUnit(),
+		"timeUnixNano": dp.GetTimeUnixNano(),
+		"value":        value,
+		"attributes":   convertAttributesToMap(dp.GetAttributes()),
+	}
+}
+
 func convertAttributesToMap(attrs []*commonpb.KeyValue) map[string]any {
 	result := make(map[string]any)
 	for _, attr := range attrs {
@@ -4,8 +4,10 @@ import (
 	"slices"
 	"testing"
 
+	"github.com/google/cel-go/cel"
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
@@ -231,3 +233,89 @@ func TestNewLogEnvEval(t *testing.T) {
 		t.Fatalf("expression evaluated to %v (type %T)", out.Value(), out.Value())
 	}
 }
+
+func TestNewSpanEnvIDFunctions(t *testing.T) {
+	env, err := NewSpanEnv()
+	if err != nil {
+		t.Fatalf("NewSpanEnv returned error: %v", err)
+	}
+	cases := []struct {
+		expr string
+		want any
+	}{
+		{`hexLen("0102030405060708")`, int64(8)},
+		{`hexLen("")`, int64(0)},
+		{`hexLen("abc")`, int64(-1)},
+		{`hexLen("zz")`, int64(-1)},
+		{`isValidTraceId("019c97cafe1c76e2abb150e9427e666a")`, true},
+		{`isValidTraceId("00000000000000000000000000000000")`, false},
+		{`isValidTraceId("019c97cafe1c76e2")`, false},
+		{`isValidTraceId("not-hex-not-hex-not-hex-not-hex!")`, false},
+		{`isValidSpanId("0102030405060708")`, true},
+		{`isValidSpanId("0000000000000000")`, false},
+		{`isValidSpanId("01020304")`, false},
+		{`isValidSpanId(spanId)`, true},
+		{`isValidSpanId(parentSpanId)`, false},
+	}
+	span := SpanForEval(&tracepb.Span{SpanId: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			ast, issues := env.Compile(c.expr)
+			if issues != nil && issues.Err() != nil {
+				t.Fatalf("Compile failed: %v", issues.Err())
+			}
+			prog, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("Program creation failed: %v", err)
+			}
+			out, _, err := prog.Eval(span)
+			if err != nil {
+				t.Fatalf("Eval returned error: %v", err)
+			}
+			if out.Value() != c.want {
+				t.Fatalf("expected %v, got %v", c.want, out.Value())
+			}
+		})
+	}
+}
+
+func TestRuleEnvExtensionFunctions(t *testing.T) {
+	cases := []struct {
+		name   string
+		newEnv func() (*cel.Env, error)
+		input  any
+		expr   string
+		want   any
+	}{
+		{"span substring", NewSpanEnv, SpanForEval(&tracepb.Span{Name: "model.jaffle.orders"}), `name.substring(0, 5)`, "model"},
+		{"span split", NewSpanEnv, SpanForEval(&tracepb.Span{Name: "model.jaffle.orders"}), `name.split(".")[2]`, "orders"},
+		{"span lowerAscii", NewSpanEnv, SpanForEval(&tracepb.Span{Name: "Node Evaluated"}), `name.lowerAscii().replace(" ", "_")`, "node_evaluated"},
+		{"span math", NewSpanEnv, SpanForEval(&tracepb.Span{StartTimeUnixNano: 5, EndTimeUnixNano: 3}), `math.greatest(startTimeUnixNano, endTimeUnixNano)`, uint64(5)},
+		{"log indexOf", NewLogEnv, LogForEval(&logspb.LogRecord{SeverityText: "WARN: deprecated"}), `severityText.indexOf(":")`, int64(4)},
+		{"log trim", NewLogEnv, LogForEval(&logspb.LogRecord{SeverityText: "  INFO "}), `severityText.trim()`, "INFO"},
+		{"metric upperAscii", NewMetricEnv, MetricForEval(&metricspb.Metric{Name: "rows"}, &metricspb.NumberDataPoint{}), `name.upperAscii()`, "ROWS"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			env, err := c.newEnv()
+			if err != nil {
+				t.Fatalf("env creation failed: %v", err)
+			}
+			ast, issues := env.Compile(c.expr)
+			if issues != nil && issues.Err() != nil {
+				t.Fatalf("Compile failed: %v", issues.Err())
+			}
+			prog, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("Program creation failed: %v", err)
+			}
+			out, _, err := prog.Eval(c.input)
+			if err != nil {
+				t.Fatalf("Eval returned error: %v", err)
+			}
+			if out.Value() != c.want {
+				t.Fatalf("expected %v, got %v", c.want, out.Value())
+			}
+		})
+	}
+}
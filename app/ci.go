@@ -0,0 +1,92 @@
+package app
+
+// CIDetector returns the resource attributes describing the CI run that
+// getenv reads the environment of, or nil if the environment is not of the CI
+// system it knows.
+type CIDetector func(getenv func(string) string) map[string]any
+
+// ciDetectors are tried in order until one detects its CI system.
+var ciDetectors = []CIDetector{
+	detectGitHubActions,
+	detectGitLabCI,
+	detectCircleCI,
+}
+
+// RegisterCIDetector adds a detector for another CI system. Registered
+// detectors are tried before the built-in ones, so they can also replace them.
+func RegisterCIDetector(detector CIDetector) {
+	ciDetectors = append([]CIDetector{detector}, ciDetectors...)
+}
+
+// DetectCIAttributes returns the attributes of the first detector that
+// recognizes the environment, or nil outside CI.
+func DetectCIAttributes(getenv func(string) string) map[string]any {
+	for _, detect := range ciDetectors {
+		if attrs := detect(getenv); attrs != nil {
+			return attrs
+		}
+	}
+	return nil
+}
+
+// ciAttributes builds the attributes of a CI run from environment variable
+// names, leaving out unset ones.
+func ciAttributes(getenv func(string) string, provider string, vars map[string]string) map[string]any {
+	attrs := map[string]any{"ci.provider": provider}
+	for key, name := range vars {
+		if v := getenv(name); v != "" {
+			attrs[key] = v
+		}
+	}
+	return attrs
+}
+
+func detectGitHubActions(getenv func(string) string) map[string]any {
+	if getenv("GITHUB_ACTIONS") != "true" {
+		return nil
+	}
+	attrs := ciAttributes(getenv, "github_actions", map[string]string{
+		"ci.pipeline.id":   "GITHUB_RUN_ID",
+		"ci.pipeline.name": "GITHUB_WORKFLOW",
+		"ci.job.id":        "GITHUB_JOB",
+		"ci.commit.sha":    "GITHUB_SHA",
+		"ci.branch":        "GITHUB_REF_NAME",
+	})
+	server, repo, runID := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID")
+	if server != "" && repo != "" && runID != "" {
+		url := server + "/" + repo + "/actions/runs/" + runID
+		if attempt := getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			url += "/attempts/" + attempt
+		}
+		attrs["ci.job.url"] = url
+	}
+	return attrs
+}
+
+func detectGitLabCI(getenv func(string) string) map[string]any {
+	if getenv("GITLAB_CI") != "true" {
+		return nil
+	}
+	return ciAttributes(getenv, "gitlab_ci", map[string]string{
+		"ci.pipeline.id":   "CI_PIPELINE_ID",
+		"ci.pipeline.name": "CI_PROJECT_PATH",
+		"ci.job.id":        "CI_JOB_ID",
+		"ci.job.url":       "CI_JOB_URL",
+		"ci.commit.sha":    "CI_COMMIT_SHA",
+		"ci.branch":        "CI_COMMIT_REF_NAME",
+	})
+}
+
+func detectCircleCI(getenv func(string) string) map[string]any {
+	if getenv("CIRCLECI") != "true" {
+		return nil
+	}
+	return ciAttributes(getenv, "circleci", map[string]string{
+		"ci.pipeline.id":   "CIRCLE_WORKFLOW_ID",
+		"ci.pipeline.name": "CIRCLE_PROJECT_REPONAME",
+		"ci.job.id":        "CIRCLE_BUILD_NUM",
+		"ci.job.url":       "CIRCLE_BUILD_URL",
+		"ci.commit.sha":    "CIRCLE_SHA1",
+		"ci.branch":        "CIRCLE_BRANCH",
+	})
+}
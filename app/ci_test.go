@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func fakeGetenv(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+var githubActionsEnv = map[string]string{
+	"GITHUB_ACTIONS":     "true",
+	"GITHUB_RUN_ID":      "1658821493",
+	"GITHUB_RUN_ATTEMPT": "2",
+	"GITHUB_WORKFLOW":    "dbt build",
+	"GITHUB_JOB":         "build",
+	"GITHUB_SHA":         "ffac537e6cbbf934b08745a378932722df287a53",
+	"GITHUB_REF_NAME":    "main",
+	"GITHUB_SERVER_URL":  "https://github.com",
+	"GITHUB_REPOSITORY":  "octo-org/jaffle-shop",
+}
+
+func TestDetectCIAttributes(t *testing.T) {
+	assert.Equal(t, map[string]any{
+		"ci.provider":      "github_actions",
+		"ci.pipeline.id":   "1658821493",
+		"ci.pipeline.name": "dbt build",
+		"ci.job.id":        "build",
+		"ci.job.url":       "https://github.com/octo-org/jaffle-shop/actions/runs/1658821493/attempts/2",
+		"ci.commit.sha":    "ffac537e6cbbf934b08745a378932722df287a53",
+		"ci.branch":        "main",
+	}, DetectCIAttributes(fakeGetenv(githubActionsEnv)))
+
+	assert.Equal(t, map[string]any{
+		"ci.provider":    "gitlab_ci",
+		"ci.pipeline.id": "1234",
+		"ci.job.url":     "https://gitlab.com/group/project/-/jobs/5678",
+	}, DetectCIAttributes(fakeGetenv(map[string]string{
+		"GITLAB_CI":      "true",
+		"CI_PIPELINE_ID": "1234",
+		"CI_JOB_URL":     "https://gitlab.com/group/project/-/jobs/5678",
+	})), "unset variables are left out")
+
+	assert.Equal(t, "circleci", DetectCIAttributes(fakeGetenv(map[string]string{"CIRCLECI": "true"}))["ci.provider"])
+	assert.Nil(t, DetectCIAttributes(fakeGetenv(nil)), "nothing is detected outside CI")
+}
+
+func TestRegisterCIDetector(t *testing.T) {
+	saved := ciDetectors
+	t.Cleanup(func() { ciDetectors = saved })
+
+	RegisterCIDetector(func(getenv func(string) string) map[string]any {
+		if getenv("BUILDKITE") != "true" {
+			return nil
+		}
+		return map[string]any{"ci.provider": "buildkite", "ci.pipeline.id": getenv("BUILDKITE_BUILD_ID")}
+	})
+	assert.Equal(t, map[string]any{"ci.provider": "buildkite", "ci.pipeline.id": "42"},
+		DetectCIAttributes(fakeGetenv(map[string]string{"BUILDKITE": "true", "BUILDKITE_BUILD_ID": "42"})))
+	assert.Equal(t, "github_actions", DetectCIAttributes(fakeGetenv(githubActionsEnv))["ci.provider"], "built-in detectors still apply")
+}
+
+func TestForwarder_CIAttributes(t *testing.T) {
+	for name, value := range githubActionsEnv {
+		t.Setenv(name, value)
+	}
+	for _, enabled := range []bool{false, true} {
+		ctrl := gomock.NewController(t)
+		mockExporter := NewMockExporter(ctrl)
+		fw, err := NewForwarder("test-forwarder", ForwardConfig{
+			Resource: &ForwardResourceConfig{
+				Attributes:   map[string]any{"ci.pipeline.name": "nightly"},
+				CIAttributes: enabled,
+			},
+			Traces: &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+		}, map[string]Exporter{"test-exporter": mockExporter})
+		require.NoError(t, err)
+
+		mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				attrs := convertAttributesToMap(protoSpans[0].Resource.Attributes)
+				assert.Equal(t, "nightly", attrs["ci.pipeline.name"], "explicit attributes take precedence")
+				if enabled {
+					assert.Equal(t, "github_actions", attrs["ci.provider"])
+					assert.Equal(t, "1658821493", attrs["ci.pipeline.id"])
+					assert.Equal(t, "https://github.com/octo-org/jaffle-shop/actions/runs/1658821493/attempts/2", attrs["ci.job.url"])
+				} else {
+					assert.NotContains(t, attrs, "ci.provider")
+				}
+				return nil
+			},
+		)
+		require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: []*tracepb.Span{{Name: "span"}}}))
+		ctrl.Finish()
+	}
+}
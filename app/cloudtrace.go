@@ -0,0 +1,277 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultCloudTraceEndpoint = "https://cloudtrace.googleapis.com"
+	cloudTraceScope           = "https://www.googleapis.com/auth/trace.append"
+
+	// Cloud Trace limits, see https://cloud.google.com/trace/docs/quotas#trace-limits
+	cloudTraceMaxDisplayNameBytes = 128
+	cloudTraceMaxAttributes       = 32
+	cloudTraceMaxAttributeKey     = 128
+	cloudTraceMaxAttributeValue   = 256
+)
+
+// CloudTraceExporter sends spans to Google Cloud Trace with the v2
+// BatchWriteSpans REST API. Credentials are resolved from Application
+// Default Credentials on Start. Cloud Trace has no log or metric
+// ingestion, so those are dropped with a warning.
+type CloudTraceExporter struct {
+	projectID       string
+	endpoint        string
+	httpClient      *http.Client
+	warnOnce        sync.Once
+	metricsWarnOnce sync.Once
+}
+
+func NewCloudTraceExporter(cfg CloudTraceExporterConfig) *CloudTraceExporter {
+	return &CloudTraceExporter{
+		projectID: cfg.ProjectID,
+		endpoint:  defaultCloudTraceEndpoint,
+	}
+}
+
+func (e *CloudTraceExporter) Start(ctx context.Context) error {
+	if e.httpClient != nil {
+		return nil
+	}
+	client, err := google.DefaultClient(ctx, cloudTraceScope)
+	if err != nil {
+		return fmt.Errorf("cloudtrace: find default credentials: %w", err)
+	}
+	e.httpClient = client
+	return nil
+}
+
+func (e *CloudTraceExporter) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (e *CloudTraceExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	e.warnOnce.Do(func() {
+		slog.Warn("cloudtrace exporter does not support logs, dropping them", "project_id", e.projectID)
+	})
+	return nil
+}
+
+func (e *CloudTraceExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	e.metricsWarnOnce.Do(func() {
+		slog.Warn("cloudtrace exporter does not support metrics, dropping them", "project_id", e.projectID)
+	})
+	return nil
+}
+
+func (e *CloudTraceExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	spans := convertToCloudTraceSpans(e.projectID, protoSpans)
+	if len(spans) == 0 {
+		return nil
+	}
+	if e.httpClient == nil {
+		return fmt.Errorf("cloudtrace: exporter is not started")
+	}
+	body, err := json.Marshal(cloudTraceBatchWriteRequest{Spans: spans})
+	if err != nil {
+		return fmt.Errorf("cloudtrace: marshal spans: %w", err)
+	}
+	url := fmt.Sprintf("%s/v2/projects/%s/traces:batchWrite", e.endpoint, e.projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cloudtrace: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudtrace: batch write spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("cloudtrace: batch write spans: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+type cloudTraceBatchWriteRequest struct {
+	Spans []*cloudTraceSpan `json:"spans"`
+}
+
+type cloudTraceSpan struct {
+	Name         string                `json:"name"`
+	SpanID       string                `json:"spanId"`
+	ParentSpanID string                `json:"parentSpanId,omitempty"`
+	DisplayName  cloudTraceString      `json:"displayName"`
+	StartTime    string                `json:"startTime"`
+	EndTime      string                `json:"endTime"`
+	Attributes   *cloudTraceAttributes `json:"attributes,omitempty"`
+	Status       *cloudTraceStatus     `json:"status,omitempty"`
+	SpanKind     string                `json:"spanKind,omitempty"`
+}
+
+type cloudTraceString struct {
+	Value              string `json:"value"`
+	TruncatedByteCount int    `json:"truncatedByteCount,omitempty"`
+}
+
+type cloudTraceAttributes struct {
+	AttributeMap           map[string]cloudTraceAttributeValue `json:"attributeMap"`
+	DroppedAttributesCount int                                 `json:"droppedAttributesCount,omitempty"`
+}
+
+type cloudTraceAttributeValue struct {
+	StringValue *cloudTraceString `json:"stringValue,omitempty"`
+	IntValue    *string           `json:"intValue,omitempty"` // int64 is a JSON string in proto3 JSON
+	BoolValue   *bool             `json:"boolValue,omitempty"`
+}
+
+type cloudTraceStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// convertToCloudTraceSpans converts OTLP spans to Cloud Trace spans. Resource
+// attributes are merged into each span's attributes, span attributes winning
+// on conflict, because Cloud Trace has no separate resource.
+func convertToCloudTraceSpans(projectID string, protoSpans []*otlp.ResourceSpans) []*cloudTraceSpan {
+	var spans []*cloudTraceSpan
+	for _, rs := range protoSpans {
+		resourceAttrs := convertAttributesToMap(rs.GetResource().GetAttributes())
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				spans = append(spans, convertToCloudTraceSpan(projectID, resourceAttrs, span))
+			}
+		}
+	}
+	return spans
+}
+
+func convertToCloudTraceSpan(projectID string, resourceAttrs map[string]any, span *tracepb.Span) *cloudTraceSpan {
+	traceID := hex.EncodeToString(span.GetTraceId())
+	spanID := hex.EncodeToString(span.GetSpanId())
+	out := &cloudTraceSpan{
+		Name:        fmt.Sprintf("projects/%s/traces/%s/spans/%s", projectID, traceID, spanID),
+		SpanID:      spanID,
+		DisplayName: truncateCloudTraceString(span.GetName(), cloudTraceMaxDisplayNameBytes),
+		StartTime:   formatCloudTraceTime(span.GetStartTimeUnixNano()),
+		EndTime:     formatCloudTraceTime(span.GetEndTimeUnixNano()),
+		SpanKind:    cloudTraceSpanKind(span.GetKind()),
+	}
+	if len(span.GetParentSpanId()) > 0 {
+		out.ParentSpanID = hex.EncodeToString(span.GetParentSpanId())
+	}
+
+	attrs := make(map[string]any, len(resourceAttrs)+len(span.GetAttributes()))
+	for key, value := range resourceAttrs {
+		attrs[key] = value
+	}
+	for key, value := range convertAttributesToMap(span.GetAttributes()) {
+		attrs[key] = value
+	}
+	out.Attributes = convertToCloudTraceAttributes(attrs, int(span.GetDroppedAttributesCount()))
+
+	switch span.GetStatus().GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		out.Status = &cloudTraceStatus{Code: 0}
+	case tracepb.Status_STATUS_CODE_ERROR:
+		// google.rpc.Code UNKNOWN
+		out.Status = &cloudTraceStatus{Code: 2, Message: span.GetStatus().GetMessage()}
+	}
+	return out
+}
+
+func convertToCloudTraceAttributes(attrs map[string]any, dropped int) *cloudTraceAttributes {
+	if len(attrs) == 0 && dropped == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := &cloudTraceAttributes{
+		AttributeMap:           make(map[string]cloudTraceAttributeValue),
+		DroppedAttributesCount: dropped,
+	}
+	for _, key := range keys {
+		if len(out.AttributeMap) >= cloudTraceMaxAttributes || len(key) > cloudTraceMaxAttributeKey {
+			out.DroppedAttributesCount++
+			continue
+		}
+		switch v := attrs[key].(type) {
+		case bool:
+			out.AttributeMap[key] = cloudTraceAttributeValue{BoolValue: &v}
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			out.AttributeMap[key] = cloudTraceAttributeValue{IntValue: &s}
+		case string:
+			s := truncateCloudTraceString(v, cloudTraceMaxAttributeValue)
+			out.AttributeMap[key] = cloudTraceAttributeValue{StringValue: &s}
+		case nil:
+			out.DroppedAttributesCount++
+		default:
+			var str string
+			if b, err := json.Marshal(v); err == nil {
+				str = string(b)
+			} else {
+				str = fmt.Sprint(v)
+			}
+			s := truncateCloudTraceString(str, cloudTraceMaxAttributeValue)
+			out.AttributeMap[key] = cloudTraceAttributeValue{StringValue: &s}
+		}
+	}
+	return out
+}
+
+// truncateCloudTraceString cuts s to at most limit bytes without splitting a UTF-8 rune.
+func truncateCloudTraceString(s string, limit int) cloudTraceString {
+	if len(s) <= limit {
+		return cloudTraceString{Value: s}
+	}
+	cut := limit
+	for cut > 0 && !isRuneStart(s[cut]) {
+		cut--
+	}
+	return cloudTraceString{Value: s[:cut], TruncatedByteCount: len(s) - cut}
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func formatCloudTraceTime(nano uint64) string {
+	return time.Unix(0, int64(nano)).UTC().Format(time.RFC3339Nano)
+}
+
+func cloudTraceSpanKind(kind tracepb.Span_SpanKind) string {
+	switch kind {
+	case tracepb.Span_SPAN_KIND_INTERNAL:
+		return "INTERNAL"
+	case tracepb.Span_SPAN_KIND_SERVER:
+		return "SERVER"
+	case tracepb.Span_SPAN_KIND_CLIENT:
+		return "CLIENT"
+	case tracepb.Span_SPAN_KIND_PRODUCER:
+		return "PRODUCER"
+	case tracepb.Span_SPAN_KIND_CONSUMER:
+		return "CONSUMER"
+	default:
+		return ""
+	}
+}
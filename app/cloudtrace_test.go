@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func testCloudTraceResourceSpans() []*otlp.ResourceSpans {
+	return []*otlp.ResourceSpans{{
+		Resource: &resourcepb.Resource{
+			Attributes: convertAttributesFromMap(map[string]any{
+				"service.name": "dbt",
+				"env":          "prod",
+			}),
+		},
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Spans: []*tracepb.Span{{
+				TraceId:           []byte{0x01, 0x9c, 0x97, 0xca, 0xfe, 0x1c, 0x76, 0xe2, 0xab, 0xb1, 0x50, 0xe9, 0x42, 0x7e, 0x66, 0x6a},
+				SpanId:            []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a},
+				ParentSpanId:      []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+				Name:              "Node evaluated (my_model)",
+				Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: 1772073188912148000,
+				EndTimeUnixNano:   1772073189000000000,
+				Attributes: []*commonpb.KeyValue{
+					{Key: "env", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "dev"}}},
+					{Key: "rows", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 42}}},
+					{Key: "cached", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+				},
+				Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "boom"},
+			}},
+		}},
+	}}
+}
+
+func TestConvertToCloudTraceSpans(t *testing.T) {
+	spans := convertToCloudTraceSpans("my-project", testCloudTraceResourceSpans())
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "projects/my-project/traces/019c97cafe1c76e2abb150e9427e666a/spans/000000000000000a", span.Name)
+	assert.Equal(t, "000000000000000a", span.SpanID)
+	assert.Equal(t, "0000000000000001", span.ParentSpanID)
+	assert.Equal(t, "Node evaluated (my_model)", span.DisplayName.Value)
+	assert.Equal(t, "2026-02-26T02:33:08.912148Z", span.StartTime)
+	assert.Equal(t, "2026-02-26T02:33:09Z", span.EndTime)
+	assert.Equal(t, "INTERNAL", span.SpanKind)
+	assert.Equal(t, &cloudTraceStatus{Code: 2, Message: "boom"}, span.Status)
+
+	attrs := span.Attributes.AttributeMap
+	assert.Equal(t, "dbt", attrs["service.name"].StringValue.Value, "resource attributes are merged")
+	assert.Equal(t, "dev", attrs["env"].StringValue.Value, "span attributes win over resource attributes")
+	assert.Equal(t, "42", *attrs["rows"].IntValue)
+	assert.True(t, *attrs["cached"].BoolValue)
+}
+
+func TestConvertToCloudTraceAttributes_Limits(t *testing.T) {
+	attrs := make(map[string]any)
+	for i := 0; i < cloudTraceMaxAttributes+3; i++ {
+		attrs[strings.Repeat("k", i+1)] = "v"
+	}
+	attrs["long"] = strings.Repeat("あ", 100)
+	out := convertToCloudTraceAttributes(attrs, 1)
+	assert.Len(t, out.AttributeMap, cloudTraceMaxAttributes)
+	assert.Equal(t, 1+len(attrs)-cloudTraceMaxAttributes, out.DroppedAttributesCount)
+
+	s := truncateCloudTraceString(strings.Repeat("あ", 100), cloudTraceMaxAttributeValue)
+	assert.Len(t, s.Value, 255, "truncation must not split a multi-byte rune")
+	assert.Equal(t, 300-255, s.TruncatedByteCount)
+}
+
+func TestCloudTraceExporter_UploadTraces(t *testing.T) {
+	var gotPath string
+	var gotBody cloudTraceBatchWriteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &gotBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	exp := NewCloudTraceExporter(CloudTraceExporterConfig{ProjectID: "my-project"})
+	exp.endpoint = srv.URL
+	exp.httpClient = srv.Client()
+	require.NoError(t, exp.Start(context.Background()))
+
+	require.NoError(t, exp.UploadTraces(context.Background(), testCloudTraceResourceSpans()))
+	assert.Equal(t, "/v2/projects/my-project/traces:batchWrite", gotPath)
+	require.Len(t, gotBody.Spans, 1)
+	assert.Equal(t, "000000000000000a", gotBody.Spans[0].SpanID)
+
+	require.NoError(t, exp.UploadLogs(context.Background(), []*otlp.ResourceLogs{{}}), "logs are dropped without error")
+}
+
+func TestCloudTraceExporterConfig_Validate(t *testing.T) {
+	cfg := ExporterConfig{Type: "cloudtrace"}
+	require.Error(t, cfg.Validate())
+	cfg.CloudTrace.ProjectID = "my-project"
+	require.NoError(t, cfg.Validate())
+}
@@ -1,26 +1,175 @@
 package app
 
 import (
-	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	yaml "github.com/goccy/go-yaml"
 	"github.com/mashiike/go-otlp-helper/otlp"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
 )
 
 type Config struct {
 	Exporters map[string]ExporterConfig `yaml:"exporters"`
 	Forward   map[string]ForwardConfig  `yaml:"forward"`
+	Profiles  map[string]ProfileConfig  `yaml:"profiles,omitempty"`
+	Scope     ScopeConfig               `yaml:"scope,omitempty"`
+	// MaxInFlightBytes limits the total size of batches being decoded and
+	// uploaded at once; 0 means no limit.
+	MaxInFlightBytes int64 `yaml:"max_in_flight_bytes,omitempty"`
+	// DebounceDelay holds decoded records back across flushes for up to this
+	// long, to send fewer and larger requests; 0 disables debouncing.
+	DebounceDelay time.Duration `yaml:"debounce_delay,omitempty"`
+	// DebounceMax releases held records early once this many are pending.
+	DebounceMax int `yaml:"debounce_max,omitempty"`
+	// NumberHints forces the type of record attributes, keyed by their name
+	// in the dbt file, regardless of their JSON representation.
+	NumberHints map[string]string `yaml:"number_hints,omitempty"` // "int" or "double"
+	Decoder     DecoderConfig     `yaml:"decoder,omitempty"`
+	Metrics     MetricsConfig     `yaml:"metrics,omitempty"`
+	Logs        LogsConfig        `yaml:"logs,omitempty"`
+}
+
+// LogsConfig customizes how decoded log records affect their spans.
+type LogsConfig struct {
+	// ElevateSeverityThreshold marks the span of a log record at or above
+	// this severity as ERROR, e.g. "ERROR"; empty leaves spans alone.
+	ElevateSeverityThreshold string `yaml:"elevate_severity_threshold,omitempty"`
+}
+
+// MetricsConfig enables metrics derived from the decoded records, uploaded
+// by the forward rules with metrics exporters.
+type MetricsConfig struct {
+	// FromSpans emits a dbt.node.duration_ms gauge for each node span.
+	FromSpans bool `yaml:"from_spans,omitempty"`
+	// DecodeLatency emits a dbt.forwarder.span.decode_latency_ms histogram
+	// of how long spans stay pending, from being read until complete.
+	DecodeLatency bool `yaml:"decode_latency,omitempty"`
+}
+
+// DecoderConfig customizes how records of the dbt file are decoded.
+type DecoderConfig struct {
+	AttributeMapping *AttributeMappingConfig `yaml:"attribute_mapping,omitempty"`
+	// ExceptionEventName replaces "exception" as the name of exception events.
+	ExceptionEventName string `yaml:"exception_event_name,omitempty"`
+	// SourceFileAttribute stamps spans and log records with the OTEL file
+	// they were read from under this key, e.g. dbt.source_file.
+	SourceFileAttribute string `yaml:"source_file_attribute,omitempty"`
+}
+
+// AttributeMappingConfig replaces the default renaming of record attributes,
+// which prefixes keys with "dbt." and renames sql to db.statement. Renames
+// win over passthrough, and passthrough over the default renames and the
+// prefix.
+type AttributeMappingConfig struct {
+	Prefix      *string           `yaml:"prefix,omitempty"`      // default "dbt."; "" keeps keys unprefixed
+	Rename      map[string]string `yaml:"rename,omitempty"`      // key -> new key, merged over sql: db.statement
+	Passthrough []string          `yaml:"passthrough,omitempty"` // keys kept verbatim
+}
+
+func (cfg *AttributeMappingConfig) Validate() error {
+	for key, renamed := range cfg.Rename {
+		if renamed == "" {
+			return fmt.Errorf("rename[%s] must not be empty", key)
+		}
+	}
+	return nil
+}
+
+// transformer builds the Decoder's attribute transformer.
+func (cfg *AttributeMappingConfig) transformer() func([]*commonpb.KeyValue) []*commonpb.KeyValue {
+	prefix := defaultAttributePrefix
+	if cfg.Prefix != nil {
+		prefix = *cfg.Prefix
+	}
+	rename := maps.Clone(defaultAttributeRenames)
+	for _, key := range cfg.Passthrough {
+		rename[key] = key
+	}
+	maps.Copy(rename, cfg.Rename)
+	return newAttributeTransformer(prefix, rename)
+}
+
+// ScopeConfig sets the instrumentation scope of each signal, so backends can
+// tell traces and logs from this forwarder apart.
+type ScopeConfig struct {
+	Traces  *InstrumentationScopeConfig `yaml:"traces,omitempty"`
+	Logs    *InstrumentationScopeConfig `yaml:"logs,omitempty"`
+	Metrics *InstrumentationScopeConfig `yaml:"metrics,omitempty"`
+}
+
+// InstrumentationScopeConfig overrides the scope name and version. Empty
+// fields fall back to the forwarder's name and version. SchemaURL is set on
+// the scope's records, e.g. ScopeSpans.
+type InstrumentationScopeConfig struct {
+	Name      string `yaml:"name,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+	SchemaURL string `yaml:"schema_url,omitempty"`
+}
+
+func (cfg *InstrumentationScopeConfig) scope() *commonpb.InstrumentationScope {
+	scope := &commonpb.InstrumentationScope{
+		Name:    "dbt-fusion-otel-forwarder",
+		Version: Version,
+	}
+	if cfg == nil {
+		return scope
+	}
+	if cfg.Name != "" {
+		scope.Name = cfg.Name
+	}
+	if cfg.Version != "" {
+		scope.Version = cfg.Version
+	}
+	return scope
+}
+
+func (cfg *InstrumentationScopeConfig) schemaURL() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.SchemaURL
 }
 
 func (cfg *Config) Validate() error {
+	if cfg.DebounceDelay < 0 || cfg.DebounceMax < 0 {
+		return errors.New("debounce_delay and debounce_max must not be negative")
+	}
+	if cfg.DebounceMax > 0 && cfg.DebounceDelay == 0 {
+		return errors.New("debounce_max requires debounce_delay")
+	}
+	for key, hint := range cfg.NumberHints {
+		if hint != NumberHintInt && hint != NumberHintDouble {
+			return fmt.Errorf("number_hints[%s] must be %q or %q, got %q", key, NumberHintInt, NumberHintDouble, hint)
+		}
+	}
+	if threshold := cfg.Logs.ElevateSeverityThreshold; threshold != "" {
+		if _, ok := severityNumber(threshold); !ok {
+			return fmt.Errorf("logs.elevate_severity_threshold must be one of TRACE, DEBUG, INFO, WARN, ERROR or FATAL, got %q", threshold)
+		}
+	}
+	if cfg.Decoder.AttributeMapping != nil {
+		if err := cfg.Decoder.AttributeMapping.Validate(); err != nil {
+			return fmt.Errorf("decoder.attribute_mapping.%w", err)
+		}
+	}
 	for name, expCfg := range cfg.Exporters {
 		if name == "" {
 			return fmt.Errorf("exporter name is required")
@@ -29,63 +178,479 @@ func (cfg *Config) Validate() error {
 			return fmt.Errorf("exporters[%s].%w", name, err)
 		}
 	}
+	for name, profile := range cfg.Profiles {
+		for expName, expCfg := range profile.Exporters {
+			if err := expCfg.Validate(); err != nil {
+				return fmt.Errorf("profiles[%s].exporters[%s].%w", name, expName, err)
+			}
+		}
+	}
+	// Report every dangling exporter reference at once, as a typo would
+	// otherwise silently drop the records of the signal.
+	var undefined []string
+	for name, fwCfg := range cfg.Forward {
+		undefined = append(undefined, fwCfg.undefinedExporters(fmt.Sprintf("forward[%s]", name), cfg.Exporters)...)
+	}
+	for name, profile := range cfg.Profiles {
+		exporters := cfg.profileExporters(profile)
+		for fwName, fwCfg := range profile.Forward {
+			undefined = append(undefined, fwCfg.undefinedExporters(fmt.Sprintf("profiles[%s].forward[%s]", name, fwName), exporters)...)
+		}
+	}
+	if len(undefined) > 0 {
+		slices.Sort(undefined)
+		return fmt.Errorf("undefined exporters referenced: %s", strings.Join(undefined, ", "))
+	}
+	for name, fwCfg := range cfg.Forward {
+		if err := fwCfg.Validate(cfg.Exporters); err != nil {
+			return fmt.Errorf("forward[%s].%w", name, err)
+		}
+	}
+	for name, profile := range cfg.Profiles {
+		exporters := cfg.profileExporters(profile)
+		for fwName, fwCfg := range profile.Forward {
+			if err := fwCfg.Validate(exporters); err != nil {
+				return fmt.Errorf("profiles[%s].forward[%s].%w", name, fwName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// profileExporters returns the exporters defined once profile is applied.
+func (cfg *Config) profileExporters(profile ProfileConfig) map[string]ExporterConfig {
+	exporters := maps.Clone(cfg.Exporters)
+	if exporters == nil {
+		exporters = make(map[string]ExporterConfig, len(profile.Exporters))
+	}
+	maps.Copy(exporters, profile.Exporters)
+	return exporters
+}
+
+// ProfileConfig is a named overlay of exporters and forward rules, selected at
+// runtime with --profile. Entries replace base entries of the same name.
+type ProfileConfig struct {
+	Exporters map[string]ExporterConfig `yaml:"exporters,omitempty"`
+	Forward   map[string]ForwardConfig  `yaml:"forward,omitempty"`
+}
+
+// ApplyProfile merges the named profile over the base exporters and forward rules.
+func (cfg *Config) ApplyProfile(name string) error {
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s is not defined", name)
+	}
+	if len(profile.Exporters) > 0 && cfg.Exporters == nil {
+		cfg.Exporters = make(map[string]ExporterConfig, len(profile.Exporters))
+	}
+	for expName, expCfg := range profile.Exporters {
+		cfg.Exporters[expName] = expCfg
+	}
+	if len(profile.Forward) > 0 && cfg.Forward == nil {
+		cfg.Forward = make(map[string]ForwardConfig, len(profile.Forward))
+	}
+	for fwName, fwCfg := range profile.Forward {
+		cfg.Forward[fwName] = fwCfg
+	}
 	return nil
 }
 
 type ExporterConfig struct {
-	Type          string             `yaml:"type"`
-	MaxAttempts   int                `yaml:"max_attempts,omitempty"`
-	RetryInterval *time.Duration     `yaml:"retry_interval,omitempty"`
-	Otlp          OtlpExporterConfig `yaml:",inline"`
+	Type              string                      `yaml:"type"`
+	Enabled           *bool                       `yaml:"enabled,omitempty"` // false keeps the config but sends nothing; default true
+	MaxAttempts       int                         `yaml:"max_attempts,omitempty"`
+	RetryInterval     *time.Duration              `yaml:"retry_interval,omitempty"`
+	Timeout           *time.Duration              `yaml:"timeout,omitempty"`            // bound of each upload, including retries
+	ResourceOverrides map[string]any              `yaml:"resource_overrides,omitempty"` // null value removes the attribute
+	SampleRatio       *float64                    `yaml:"sample_ratio,omitempty"`       // share of traces sent to this exporter, 0 to 1
+	Otlp              OtlpExporterConfig          `yaml:",inline"`
+	CloudTrace        CloudTraceExporterConfig    `yaml:",inline"`
+	Elasticsearch     ElasticsearchExporterConfig `yaml:",inline"`
+	Loki              LokiExporterConfig          `yaml:",inline"`
+	File              FileExporterConfig          `yaml:",inline"`
+	Stdout            StdoutExporterConfig        `yaml:",inline"`
+}
+
+// IsEnabled reports whether the exporter sends anything; exporters are
+// enabled unless Enabled is false.
+func (cfg *ExporterConfig) IsEnabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
 }
 
 func (cfg *ExporterConfig) Validate() error {
-	if cfg.Type == "otlp" {
+	if cfg.Timeout != nil && *cfg.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", *cfg.Timeout)
+	}
+	if cfg.SampleRatio != nil && (*cfg.SampleRatio < 0 || *cfg.SampleRatio > 1) {
+		return fmt.Errorf("sample_ratio must be between 0 and 1, got %v", *cfg.SampleRatio)
+	}
+	switch cfg.Type {
+	case "otlp":
+		if cfg.Otlp.Retry != nil && (cfg.MaxAttempts != 0 || cfg.RetryInterval != nil) {
+			return errors.New("retry cannot be combined with max_attempts or retry_interval")
+		}
 		return cfg.Otlp.Validate()
+	case "cloudtrace":
+		return cfg.CloudTrace.Validate()
+	case "elasticsearch":
+		return cfg.Elasticsearch.Validate()
+	case "loki":
+		return cfg.Loki.Validate()
+	case "file":
+		return cfg.File.Validate()
+	case "stdout", "debug":
+		return cfg.Stdout.Validate()
 	}
 	return fmt.Errorf("type is not supported: %s", cfg.Type)
 }
 
+type CloudTraceExporterConfig struct {
+	ProjectID string `yaml:"project_id,omitempty"` // Google Cloud project; credentials come from ADC
+}
+
+func (cfg *CloudTraceExporterConfig) Validate() error {
+	if cfg.ProjectID == "" {
+		return errors.New("project_id is required")
+	}
+	return nil
+}
+
+type ElasticsearchExporterConfig struct {
+	URL      string `yaml:"url,omitempty"`      // cluster URL, e.g. https://localhost:9200
+	Index    string `yaml:"index,omitempty"`    // index or data stream the logs are written to
+	Username string `yaml:"username,omitempty"` // basic auth user
+	Password string `yaml:"password,omitempty"` // basic auth password
+	APIKey   string `yaml:"api_key,omitempty"`  // encoded API key, sent as "Authorization: ApiKey <api_key>"
+}
+
+func (cfg *ElasticsearchExporterConfig) Validate() error {
+	if cfg.URL == "" {
+		return errors.New("url is required")
+	}
+	if cfg.Index == "" {
+		return errors.New("index is required")
+	}
+	if cfg.APIKey != "" && cfg.Username != "" {
+		return errors.New("api_key and username are mutually exclusive")
+	}
+	return nil
+}
+
+type LokiExporterConfig struct {
+	URL      string            `yaml:"url,omitempty"`       // base URL, e.g. http://localhost:3100
+	Labels   map[string]string `yaml:"labels,omitempty"`    // label name to the attribute it is read from
+	Username string            `yaml:"username,omitempty"`  // basic auth user
+	Password string            `yaml:"password,omitempty"`  // basic auth password
+	TenantID string            `yaml:"tenant_id,omitempty"` // sent as X-Scope-OrgID for multi-tenant Loki
+}
+
+func (cfg *LokiExporterConfig) Validate() error {
+	if cfg.URL == "" {
+		return errors.New("url is required")
+	}
+	for name := range cfg.Labels {
+		if !lokiLabelName.MatchString(name) {
+			return fmt.Errorf("invalid label name: %q", name)
+		}
+	}
+	return nil
+}
+
+// File formats of the file exporter.
+const (
+	FileFormatJSONL     = "jsonl"     // one compact JSON object per line
+	FileFormatProtoJSON = "protojson" // indented JSON objects, for reading by eye
+)
+
+type FileExporterConfig struct {
+	Path   string `yaml:"path,omitempty"`   // file the telemetry is appended to
+	Format string `yaml:"format,omitempty"` // "jsonl" (default) or "protojson"
+}
+
+func (cfg *FileExporterConfig) Validate() error {
+	if cfg.Path == "" {
+		return errors.New("path is required")
+	}
+	if cfg.Format != "" && cfg.Format != FileFormatJSONL && cfg.Format != FileFormatProtoJSON {
+		return fmt.Errorf("format must be %q or %q, got %q", FileFormatJSONL, FileFormatProtoJSON, cfg.Format)
+	}
+	return nil
+}
+
+// Outputs of the stdout exporter.
+const (
+	StdoutOutputStdout = "stdout"
+	StdoutOutputStderr = "stderr"
+)
+
+type StdoutExporterConfig struct {
+	Output  string `yaml:"output,omitempty"`  // "stdout" (default) or "stderr"
+	Verbose bool   `yaml:"verbose,omitempty"` // also dump each batch as indented OTLP JSON
+
+	// Writer overrides Output. App.Run sets it to the App's Stdout or Stderr.
+	Writer io.Writer `yaml:"-"`
+}
+
+func (cfg *StdoutExporterConfig) Validate() error {
+	if cfg.Output != "" && cfg.Output != StdoutOutputStdout && cfg.Output != StdoutOutputStderr {
+		return fmt.Errorf("output must be %q or %q, got %q", StdoutOutputStdout, StdoutOutputStderr, cfg.Output)
+	}
+	return nil
+}
+
 type OtlpExporterConfig struct {
 	Endpoint      string            `yaml:"endpoint"`
 	Protocol      string            `yaml:"protocol,omitempty"`       // "http/protobuf", "http/json", "grpc"
-	Gzip          *bool             `yaml:"gzip,omitempty"`           // Enable gzip compression
+	Gzip          *GzipMode         `yaml:"gzip,omitempty"`           // true, false or auto
 	Headers       map[string]string `yaml:"headers,omitempty"`        // Custom headers
 	ExportTimeout *time.Duration    `yaml:"export_timeout,omitempty"` // Export timeout
 	UserAgent     string            `yaml:"user_agent,omitempty"`     // Custom user agent
 
+	GzipAutoThreshold int `yaml:"gzip_auto_threshold,omitempty"` // bytes above which gzip: auto compresses
+
+	Retry *RetryConfig `yaml:"retry,omitempty"` // exponential backoff on transient errors, instead of max_attempts/retry_interval
+
+	TLS *TLSConfig `yaml:"tls,omitempty"` // custom CA, client certificate and verification for OTLP/HTTP
+
 	// Per-signal configurations
 	Traces *OtlpSignalConfig `yaml:"traces,omitempty"`
 	Logs   *OtlpSignalConfig `yaml:"logs,omitempty"`
 }
 
+// RetryConfig retries transient upload failures with jittered exponential
+// backoff. Zero fields take the defaults.
+type RetryConfig struct {
+	MaxAttempts     int           `yaml:"max_attempts,omitempty"`     // default 5
+	InitialInterval time.Duration `yaml:"initial_interval,omitempty"` // default 1s
+	MaxInterval     time.Duration `yaml:"max_interval,omitempty"`     // default 30s
+	Multiplier      float64       `yaml:"multiplier,omitempty"`       // default 2
+}
+
+const (
+	defaultRetryMaxAttempts     = 5
+	defaultRetryInitialInterval = time.Second
+	defaultRetryMaxInterval     = 30 * time.Second
+	defaultRetryMultiplier      = 2
+)
+
+func (cfg *RetryConfig) Validate() error {
+	if cfg.MaxAttempts < 0 || cfg.InitialInterval < 0 || cfg.MaxInterval < 0 {
+		return errors.New("max_attempts, initial_interval and max_interval must not be negative")
+	}
+	if cfg.Multiplier != 0 && cfg.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be at least 1, got %v", cfg.Multiplier)
+	}
+	if cfg.InitialInterval > 0 && cfg.MaxInterval > 0 && cfg.MaxInterval < cfg.InitialInterval {
+		return errors.New("max_interval must not be less than initial_interval")
+	}
+	return nil
+}
+
+// retryExporter wraps exp in a RetryExporter retrying transient OTLP errors.
+func (cfg *RetryConfig) retryExporter(exp Exporter) *RetryExporter {
+	retry := &RetryExporter{
+		Exporter:      exp,
+		MaxAttempts:   cmp.Or(cfg.MaxAttempts, defaultRetryMaxAttempts),
+		RetryInterval: cmp.Or(cfg.InitialInterval, defaultRetryInitialInterval),
+		MaxInterval:   cmp.Or(cfg.MaxInterval, defaultRetryMaxInterval),
+		Multiplier:    cmp.Or(cfg.Multiplier, defaultRetryMultiplier),
+		Retryable:     isTransientOTLPError,
+	}
+	retry.MaxInterval = max(retry.MaxInterval, retry.RetryInterval)
+	return retry
+}
+
 type OtlpSignalConfig struct {
 	Endpoint      string            `yaml:"endpoint,omitempty"`
 	Protocol      string            `yaml:"protocol,omitempty"`
-	Gzip          *bool             `yaml:"gzip,omitempty"`
+	Gzip          *GzipMode         `yaml:"gzip,omitempty"`
 	Headers       map[string]string `yaml:"headers,omitempty"`
 	ExportTimeout *time.Duration    `yaml:"export_timeout,omitempty"`
 	UserAgent     string            `yaml:"user_agent,omitempty"`
+	TLS           *TLSConfig        `yaml:"tls,omitempty"` // replaces the exporter's tls for this signal
+}
+
+// endpoint returns the signal's endpoint, or "" for a nil config.
+func (s *OtlpSignalConfig) endpoint() string {
+	if s == nil {
+		return ""
+	}
+	return s.Endpoint
+}
+
+// TLSConfig configures the TLS connection of OTLP/HTTP signals. It does not
+// apply to grpc, whose credentials the otlp helper picks from the endpoint's
+// scheme.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`   // PEM bundle verifying the server instead of the system roots
+	CertFile           string `yaml:"cert_file,omitempty"` // PEM client certificate, requires key_file
+	KeyFile            string `yaml:"key_file,omitempty"`  // PEM client key, requires cert_file
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"` // overrides the name verified against the certificate
+}
+
+func (cfg *TLSConfig) Validate() error {
+	_, err := cfg.load()
+	return err
+}
+
+// load reads the certificate files and builds the tls.Config. A nil
+// TLSConfig returns nil, leaving the transport's defaults.
+func (cfg *TLSConfig) load() (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: no PEM certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cert_file and key_file: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
 }
 
 func (cfg *OtlpExporterConfig) Validate() error {
-	if cfg.Endpoint == "" {
-		return errors.New("endpoint is required")
+	resolved, err := cfg.withEnvDefaults()
+	if err != nil {
+		return err
+	}
+	// Signal endpoints, configured or from OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT,
+	// replace the exporter's endpoint once every signal has one.
+	if resolved.Endpoint == "" && (resolved.Traces.endpoint() == "" || resolved.Logs.endpoint() == "") {
+		return errors.New("endpoint is required, or set OTEL_EXPORTER_OTLP_ENDPOINT or the endpoints of both traces and logs")
+	}
+	if cfg.HasHeaderTemplates() {
+		if _, err := NewDynamicHeadersExporter(nil, *cfg); err != nil {
+			return fmt.Errorf("headers: %w", err)
+		}
+	}
+	if cfg.Retry != nil {
+		if err := cfg.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	if err := cfg.validateTLS(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateTLS loads every tls block, so that unreadable files fail at load
+// time, and rejects tls on a signal sent over grpc.
+func (cfg *OtlpExporterConfig) validateTLS() error {
+	if cfg.TLS != nil {
+		if err := cfg.TLS.Validate(); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	for _, s := range []struct {
+		name   string
+		signal *OtlpSignalConfig
+	}{{"traces", cfg.Traces}, {"logs", cfg.Logs}} {
+		tlsCfg, protocol := cfg.TLS, cfg.Protocol
+		if s.signal != nil {
+			if s.signal.TLS != nil {
+				if err := s.signal.TLS.Validate(); err != nil {
+					return fmt.Errorf("%s.tls: %w", s.name, err)
+				}
+				tlsCfg = s.signal.TLS
+			}
+			protocol = cmp.Or(s.signal.Protocol, protocol)
+		}
+		if tlsCfg != nil && !strings.HasPrefix(protocol, "http/") {
+			return fmt.Errorf("tls requires an http protocol, but %s is sent over grpc", s.name)
+		}
 	}
 	return nil
 }
 
-func (cfg *OtlpExporterConfig) ClientOptions() []otlp.ClientOption {
+// HasHeaderTemplates reports whether any header value contains a `${cel:...}` template.
+func (cfg *OtlpExporterConfig) HasHeaderTemplates() bool {
+	if hasHeaderTemplate(cfg.Headers) {
+		return true
+	}
+	if cfg.Traces != nil && hasHeaderTemplate(cfg.Traces.Headers) {
+		return true
+	}
+	return cfg.Logs != nil && hasHeaderTemplate(cfg.Logs.Headers)
+}
+
+// gzipModes resolves the gzip mode of each signal; unset means off.
+func (cfg *OtlpExporterConfig) gzipModes() (traces, logs GzipMode) {
+	traces, logs = GzipModeOff, GzipModeOff
+	if cfg.Gzip != nil {
+		traces, logs = *cfg.Gzip, *cfg.Gzip
+	}
+	if cfg.Traces != nil && cfg.Traces.Gzip != nil {
+		traces = *cfg.Traces.Gzip
+	}
+	if cfg.Logs != nil && cfg.Logs.Gzip != nil {
+		logs = *cfg.Logs.Gzip
+	}
+	return traces, logs
+}
+
+// UsesGzip reports whether any signal may be sent compressed.
+func (cfg *OtlpExporterConfig) UsesGzip() bool {
+	traces, logs := cfg.gzipModes()
+	return traces != GzipModeOff || logs != GzipModeOff
+}
+
+// ClientOptions builds the otlp client options, with the fields left empty
+// taken from the OTEL_EXPORTER_OTLP_* environment variables. When headers
+// contain templates they are left to DynamicHeadersExporter and injected per
+// request instead.
+// The client does not compress; GzipExporter picks between this client and
+// one built with gzip enabled. It fails when a tls block's files cannot be
+// loaded.
+func (cfg *OtlpExporterConfig) ClientOptions() ([]otlp.ClientOption, error) {
+	return cfg.clientOptions(false)
+}
+
+// clientOptions builds the otlp client options with gzip enabled or disabled
+// for all signals. The helper only compresses gRPC, so OTLP/HTTP requests are
+// compressed by gzipTransport.
+func (cfg *OtlpExporterConfig) clientOptions(gzip bool) ([]otlp.ClientOption, error) {
+	resolved, err := cfg.withEnvDefaults()
+	if err != nil {
+		return nil, err
+	}
+	cfg = &resolved
 	var opts []otlp.ClientOption
+	dynamicHeaders := cfg.HasHeaderTemplates()
+	tlsCfg, err := cfg.TLS.load()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	if transport := cfg.transport(tlsCfg, dynamicHeaders, gzip); transport != http.DefaultTransport {
+		opts = append(opts, otlp.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	opts = append(opts, otlp.WithGzip(gzip))
 
 	// Global options
 	if cfg.Protocol != "" {
 		opts = append(opts, otlp.WithProtocol(cfg.Protocol))
 	}
-	if cfg.Gzip != nil {
-		opts = append(opts, otlp.WithGzip(*cfg.Gzip))
-	}
-	if len(cfg.Headers) > 0 {
+	if len(cfg.Headers) > 0 && !dynamicHeaders {
 		opts = append(opts, otlp.WithHeaders(cfg.Headers))
 	}
 	if cfg.ExportTimeout != nil {
@@ -103,10 +668,7 @@ func (cfg *OtlpExporterConfig) ClientOptions() []otlp.ClientOption {
 		if cfg.Traces.Protocol != "" {
 			opts = append(opts, otlp.WithTracesProtocol(cfg.Traces.Protocol))
 		}
-		if cfg.Traces.Gzip != nil {
-			opts = append(opts, otlp.WithTracesGzip(*cfg.Traces.Gzip))
-		}
-		if len(cfg.Traces.Headers) > 0 {
+		if len(cfg.Traces.Headers) > 0 && !dynamicHeaders {
 			opts = append(opts, otlp.WithTracesHeaders(cfg.Traces.Headers))
 		}
 		if cfg.Traces.ExportTimeout != nil {
@@ -115,6 +677,13 @@ func (cfg *OtlpExporterConfig) ClientOptions() []otlp.ClientOption {
 		if cfg.Traces.UserAgent != "" {
 			opts = append(opts, otlp.WithTracesUserAgent(cfg.Traces.UserAgent))
 		}
+		if cfg.Traces.TLS != nil {
+			tlsCfg, err := cfg.Traces.TLS.load()
+			if err != nil {
+				return nil, fmt.Errorf("traces.tls: %w", err)
+			}
+			opts = append(opts, otlp.WithTracesHTTPClient(&http.Client{Transport: cfg.transport(tlsCfg, dynamicHeaders, gzip)}))
+		}
 	}
 
 	// Logs-specific options
@@ -125,10 +694,7 @@ func (cfg *OtlpExporterConfig) ClientOptions() []otlp.ClientOption {
 		if cfg.Logs.Protocol != "" {
 			opts = append(opts, otlp.WithLogsProtocol(cfg.Logs.Protocol))
 		}
-		if cfg.Logs.Gzip != nil {
-			opts = append(opts, otlp.WithLogsGzip(*cfg.Logs.Gzip))
-		}
-		if len(cfg.Logs.Headers) > 0 {
+		if len(cfg.Logs.Headers) > 0 && !dynamicHeaders {
 			opts = append(opts, otlp.WithLogsHeaders(cfg.Logs.Headers))
 		}
 		if cfg.Logs.ExportTimeout != nil {
@@ -137,18 +703,108 @@ func (cfg *OtlpExporterConfig) ClientOptions() []otlp.ClientOption {
 		if cfg.Logs.UserAgent != "" {
 			opts = append(opts, otlp.WithLogsUserAgent(cfg.Logs.UserAgent))
 		}
+		if cfg.Logs.TLS != nil {
+			tlsCfg, err := cfg.Logs.TLS.load()
+			if err != nil {
+				return nil, fmt.Errorf("logs.tls: %w", err)
+			}
+			opts = append(opts, otlp.WithLogsHTTPClient(&http.Client{Transport: cfg.transport(tlsCfg, dynamicHeaders, gzip)}))
+		}
 	}
 
-	return opts
+	return opts, nil
+}
+
+// transport returns the round tripper of OTLP/HTTP requests: a clone of
+// http.DefaultTransport when tlsCfg is set, wrapped to inject dynamic headers
+// and to compress. Without any of them it is http.DefaultTransport itself.
+func (cfg *OtlpExporterConfig) transport(tlsCfg *tls.Config, dynamicHeaders, gzip bool) http.RoundTripper {
+	var transport http.RoundTripper = http.DefaultTransport
+	if tlsCfg != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsCfg
+		transport = t
+	}
+	if dynamicHeaders {
+		transport = &requestHeadersTransport{base: transport}
+	}
+	if gzip {
+		transport = &gzipTransport{base: transport}
+	}
+	return transport
 }
 
 type ForwardConfig struct {
-	Resource *ForwardResourceConfig `yaml:"resource,omitempty"`
-	Traces   *TracesForwardConfig   `yaml:"traces,omitempty"`
-	Logs     *LogsForwardConfig     `yaml:"logs,omitempty"`
+	Resource            *ForwardResourceConfig `yaml:"resource,omitempty"`
+	Traces              *TracesForwardConfig   `yaml:"traces,omitempty"`
+	Logs                *LogsForwardConfig     `yaml:"logs,omitempty"`
+	Metrics             *MetricsForwardConfig  `yaml:"metrics,omitempty"`
+	DBSystemMapping     map[string]string      `yaml:"db_system_mapping,omitempty"`     // dbt adapter type -> OTel db.system; "" disables
+	DropEmptyAttributes bool                   `yaml:"drop_empty_attributes,omitempty"` // drop "", [] and null attribute values; false and 0 are kept
+
+	// Match is a CEL condition routing records to this forwarder: it only
+	// uploads the spans, log records and metrics it is true for. Forwarders
+	// without Match upload the records no Match is true for.
+	Match *string `yaml:"match,omitempty"`
+
+	// Batch uploads the records of this forwarder on its own cadence rather
+	// than on every flush of the run.
+	Batch *ForwardBatchConfig `yaml:"batch,omitempty"`
+
+	// ReservedAttributes is the policy for span, log and metric attributes
+	// whose key is a resource key, such as service.name; unset keeps them.
+	ReservedAttributes       string `yaml:"reserved_attributes,omitempty"`        // "warn", "drop" or "prefix"
+	ReservedAttributesPrefix string `yaml:"reserved_attributes_prefix,omitempty"` // prefix policy: prepended to the key, default "dbt."
+}
+
+// ForwardBatchConfig buffers decoded records for a forwarder until Size
+// records are pending or Interval has passed, whichever comes first.
+type ForwardBatchConfig struct {
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Size     int           `yaml:"size,omitempty"` // spans, log records and metrics
+}
+
+// Policies for attributes with a reserved key.
+const (
+	ReservedAttributesWarn   = "warn"   // keep them and warn once per key
+	ReservedAttributesDrop   = "drop"   // remove them
+	ReservedAttributesPrefix = "prefix" // rename them with reserved_attributes_prefix
+)
+
+// undefinedExporters returns the exporter references of the rule that are
+// not in exporters, e.g. "forward[default].traces: otlpp" for path
+// "forward[default]".
+func (cfg *ForwardConfig) undefinedExporters(path string, exporters map[string]ExporterConfig) []string {
+	var undefined []string
+	check := func(signal string, names []string) {
+		for _, name := range names {
+			if _, ok := exporters[name]; !ok {
+				undefined = append(undefined, fmt.Sprintf("%s.%s: %s", path, signal, name))
+			}
+		}
+	}
+	if cfg.Traces != nil {
+		check("traces", cfg.Traces.Exporters)
+	}
+	if cfg.Logs != nil {
+		check("logs", cfg.Logs.Exporters)
+	}
+	if cfg.Metrics != nil {
+		check("metrics", cfg.Metrics.Exporters)
+	}
+	return undefined
 }
 
 func (cfg *ForwardConfig) Validate(exporters map[string]ExporterConfig) error {
+	if cfg.Match != nil {
+		env, err := NewMatchEnv()
+		if err != nil {
+			return err
+		}
+		if _, err := compileExpr(*cfg.Match, env); err != nil {
+			return fmt.Errorf("invalid match: %w", err)
+		}
+	}
 	if cfg.Traces != nil {
 		if err := cfg.Traces.Validate(exporters); err != nil {
 			return fmt.Errorf("traces.%w", err)
@@ -159,27 +815,105 @@ func (cfg *ForwardConfig) Validate(exporters map[string]ExporterConfig) error {
 			return fmt.Errorf("logs.%w", err)
 		}
 	}
+	if cfg.Metrics != nil {
+		if err := cfg.Metrics.Validate(exporters); err != nil {
+			return fmt.Errorf("metrics.%w", err)
+		}
+	}
+	switch cfg.ReservedAttributes {
+	case "", ReservedAttributesWarn, ReservedAttributesDrop, ReservedAttributesPrefix:
+	default:
+		return fmt.Errorf("reserved_attributes must be one of 'warn', 'drop', 'prefix'")
+	}
+	if cfg.Batch != nil {
+		if cfg.Batch.Interval < 0 || cfg.Batch.Size < 0 {
+			return fmt.Errorf("batch.interval and batch.size must not be negative")
+		}
+		if cfg.Batch.Interval == 0 && cfg.Batch.Size == 0 {
+			return fmt.Errorf("batch requires interval or size")
+		}
+	}
 	return nil
 }
 
 type AttributeModifierConfig struct {
-	Action    string  `yaml:"action"` // "set", "remove"
-	When      *string `yaml:"when"`
-	Key       string  `yaml:"key"`
-	Value     any     `yaml:"value"`
-	ValueExpr string  `yaml:"value_expr,omitempty"`
+	Action          string         `yaml:"action"` // "set", "remove", "map", "rename", "copy", "hash", "truncate"
+	When            *string        `yaml:"when"`
+	SpanNamePattern string         `yaml:"span_name_pattern,omitempty"` // regexp on span name; ignored for logs and metrics
+	Key             string         `yaml:"key"`
+	Value           any            `yaml:"value"`
+	ValueExpr       string         `yaml:"value_expr,omitempty"`
+	Mapping         map[string]any `yaml:"mapping,omitempty"`    // map action: current value -> new value
+	Default         any            `yaml:"default,omitempty"`    // map action: value for unmatched values; unchanged if unset
+	To              string         `yaml:"to,omitempty"`         // rename action: new key of the attribute
+	From            string         `yaml:"from,omitempty"`       // copy action: key of the attribute, or resource attribute, to copy
+	Algorithm       string         `yaml:"algorithm,omitempty"`  // hash action: digest name, "sha256" if unset
+	Salt            string         `yaml:"salt,omitempty"`       // hash action: prepended to the value before hashing
+	MaxLength       int            `yaml:"max_length,omitempty"` // truncate action: maximum length in characters
+	ValueType       string         `yaml:"value_type,omitempty"` // set action: expected type of the value, see valueTypes
+}
+
+// valueTypes are the attribute value types a set action can declare.
+var valueTypes = []string{"string", "int", "double", "bool", "array", "map"}
+
+// valueTypeMatches reports whether val, as decoded from the config or
+// returned by a CEL expression, is of the attribute value type. Integers are
+// doubles too, as a whole number like 1 is read as an integer.
+func valueTypeMatches(valueType string, val any) bool {
+	switch v := reflect.ValueOf(val); valueType {
+	case "string":
+		return v.Kind() == reflect.String
+	case "int":
+		return isInteger(val)
+	case "double":
+		return v.CanFloat() || isInteger(val)
+	case "bool":
+		return v.Kind() == reflect.Bool
+	case "array":
+		return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+	case "map":
+		return v.Kind() == reflect.Map
+	}
+	return false
+}
+
+func isInteger(val any) bool {
+	v := reflect.ValueOf(val)
+	return v.CanInt() || v.CanUint()
+}
+
+// toValueType returns val as the attribute value type: integers become
+// float64 for double, so that the attribute is set as a double.
+func toValueType(valueType string, val any) any {
+	if valueType != "double" {
+		return val
+	}
+	switch v := reflect.ValueOf(val); {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	}
+	return val
 }
 
 func (cfg *AttributeModifierConfig) Validate() error {
 	if cfg.Action == "" {
 		cfg.Action = "set"
 	}
-	if cfg.Action != "set" && cfg.Action != "remove" {
-		return fmt.Errorf("action must be one of 'set', 'remove'")
+	switch cfg.Action {
+	case "set", "remove", "map", "rename", "copy", "hash", "truncate":
+	default:
+		return fmt.Errorf("action must be one of 'set', 'remove', 'map', 'rename', 'copy', 'hash', 'truncate'")
 	}
 	if cfg.Key == "" {
 		return fmt.Errorf("key is required")
 	}
+	if cfg.SpanNamePattern != "" {
+		if _, err := regexp.Compile(cfg.SpanNamePattern); err != nil {
+			return fmt.Errorf("invalid span_name_pattern: %w", err)
+		}
+	}
 	if cfg.Action == "set" {
 		if cfg.Value == nil && cfg.ValueExpr == "" {
 			return errors.New("either value or value_expr must be set")
@@ -188,19 +922,87 @@ func (cfg *AttributeModifierConfig) Validate() error {
 			return errors.New("cannot both value and value_expr be set")
 		}
 	}
+	if cfg.ValueType != "" {
+		if !slices.Contains(valueTypes, cfg.ValueType) {
+			return fmt.Errorf("value_type must be one of '%s'", strings.Join(valueTypes, "', '"))
+		}
+		if cfg.Action != "set" {
+			return errors.New("value_type can only be used with the set action")
+		}
+		if cfg.Value != nil && !valueTypeMatches(cfg.ValueType, cfg.Value) {
+			if isInteger(cfg.Value) {
+				return fmt.Errorf("value %v of key %s was read as an integer, which is not of value_type %s", cfg.Value, cfg.Key, cfg.ValueType)
+			}
+			return fmt.Errorf("value %v of key %s is not of value_type %s", cfg.Value, cfg.Key, cfg.ValueType)
+		}
+	}
+	if cfg.Action == "map" {
+		if len(cfg.Mapping) == 0 {
+			return errors.New("mapping is required for the map action")
+		}
+		if cfg.Value != nil || cfg.ValueExpr != "" {
+			return errors.New("value and value_expr cannot be used with the map action")
+		}
+	}
+	if cfg.Action == "rename" {
+		if cfg.To == "" {
+			return errors.New("to is required for the rename action")
+		}
+		if cfg.Value != nil || cfg.ValueExpr != "" {
+			return errors.New("value and value_expr cannot be used with the rename action")
+		}
+	}
+	if cfg.Action == "copy" {
+		if cfg.From == "" {
+			return errors.New("from is required for the copy action")
+		}
+		if cfg.Value != nil || cfg.ValueExpr != "" {
+			return errors.New("value and value_expr cannot be used with the copy action")
+		}
+	}
+	if cfg.Action == "hash" {
+		if _, ok := hashAlgorithms[cfg.Algorithm]; cfg.Algorithm != "" && !ok {
+			return fmt.Errorf("algorithm must be one of %s", strings.Join(slices.Sorted(maps.Keys(hashAlgorithms)), ", "))
+		}
+		if cfg.Value != nil || cfg.ValueExpr != "" {
+			return errors.New("value and value_expr cannot be used with the hash action")
+		}
+	}
+	if cfg.Action == "truncate" {
+		if cfg.MaxLength <= 0 {
+			return errors.New("max_length must be positive for the truncate action")
+		}
+		if cfg.Value != nil || cfg.ValueExpr != "" {
+			return errors.New("value and value_expr cannot be used with the truncate action")
+		}
+	}
 	return nil
 }
 
 type ForwardResourceConfig struct {
 	Attributes map[string]any `yaml:"attributes"`
+	// CIAttributes adds ci.* attributes of the CI run detected from the
+	// environment; attributes set explicitly take precedence.
+	CIAttributes bool `yaml:"ci_attributes,omitempty"`
+	// SchemaURL is set on the uploaded ResourceSpans, ResourceLogs and
+	// ResourceMetrics, for backends that validate it.
+	SchemaURL string `yaml:"schema_url,omitempty"`
 }
 
 type TracesForwardConfig struct {
-	Attributes []AttributeModifierConfig `yaml:"attributes,omitempty"`
-	Exporters  []string                  `yaml:"exporters"`
+	Attributes  []AttributeModifierConfig `yaml:"attributes,omitempty"`
+	Exporters   []string                  `yaml:"exporters"`
+	MinDuration *time.Duration            `yaml:"min_duration,omitempty"` // drop spans shorter than this
+	MaxDuration *time.Duration            `yaml:"max_duration,omitempty"` // drop spans longer than this
+	DropWhen    *string                   `yaml:"drop_when,omitempty"`    // CEL condition; spans for which it is true are dropped
+
+	MaxSpansPerResource int `yaml:"max_spans_per_resource,omitempty"` // split uploads into ResourceSpans of at most this many spans
 }
 
 func (cfg *TracesForwardConfig) Validate(exporters map[string]ExporterConfig) error {
+	if len(cfg.Attributes) > 0 && len(cfg.Exporters) == 0 {
+		return errors.New("attributes are set but exporters is empty, so the modified traces would be discarded")
+	}
 	for _, name := range cfg.Exporters {
 		if _, ok := exporters[name]; !ok {
 			return fmt.Errorf("traces exporter %s is not defined", name)
@@ -211,15 +1013,46 @@ func (cfg *TracesForwardConfig) Validate(exporters map[string]ExporterConfig) er
 			return fmt.Errorf("invalid trace attribute modifier: %w", err)
 		}
 	}
+	if (cfg.MinDuration != nil && *cfg.MinDuration < 0) || (cfg.MaxDuration != nil && *cfg.MaxDuration < 0) {
+		return errors.New("min_duration and max_duration must not be negative")
+	}
+	if cfg.MinDuration != nil && cfg.MaxDuration != nil && *cfg.MinDuration > *cfg.MaxDuration {
+		return errors.New("min_duration must not be greater than max_duration")
+	}
+	if cfg.MaxSpansPerResource < 0 {
+		return errors.New("max_spans_per_resource must not be negative")
+	}
+	if cfg.DropWhen != nil && *cfg.DropWhen == "" {
+		return errors.New("drop_when must not be empty")
+	}
 	return nil
 }
 
 type LogsForwardConfig struct {
 	Attributes []AttributeModifierConfig `yaml:"attributes,omitempty"`
+	Body       *LogBodyConfig            `yaml:"body,omitempty"`
 	Exporters  []string                  `yaml:"exporters"`
+	Sampling   *LogSamplingConfig        `yaml:"sampling,omitempty"`
+	DropWhen   *string                   `yaml:"drop_when,omitempty"` // CEL condition; log records for which it is true are dropped
+}
+
+// LogBodyConfig rewrites the log record body with a CEL expression, for
+// backends that display only the body.
+type LogBodyConfig struct {
+	ValueExpr string `yaml:"value_expr"`
+}
+
+func (cfg *LogBodyConfig) Validate() error {
+	if cfg.ValueExpr == "" {
+		return errors.New("value_expr is required")
+	}
+	return nil
 }
 
 func (cfg *LogsForwardConfig) Validate(exporters map[string]ExporterConfig) error {
+	if len(cfg.Attributes) > 0 && len(cfg.Exporters) == 0 {
+		return errors.New("attributes are set but exporters is empty, so the modified logs would be discarded")
+	}
 	for _, name := range cfg.Exporters {
 		if _, ok := exporters[name]; !ok {
 			return fmt.Errorf("logs exporter %s is not defined", name)
@@ -230,9 +1063,83 @@ func (cfg *LogsForwardConfig) Validate(exporters map[string]ExporterConfig) erro
 			return fmt.Errorf("invalid log attribute modifier: %w", err)
 		}
 	}
+	if cfg.Body != nil {
+		if err := cfg.Body.Validate(); err != nil {
+			return fmt.Errorf("invalid log body: %w", err)
+		}
+	}
+	if cfg.Sampling != nil {
+		if err := cfg.Sampling.Validate(); err != nil {
+			return fmt.Errorf("invalid log sampling: %w", err)
+		}
+	}
+	if cfg.DropWhen != nil && *cfg.DropWhen == "" {
+		return errors.New("drop_when must not be empty")
+	}
+	return nil
+}
+
+// MetricsForwardConfig routes metrics decoded from Metric records. Attribute
+// modifiers apply to the attributes of each data point.
+type MetricsForwardConfig struct {
+	Attributes []AttributeModifierConfig `yaml:"attributes,omitempty"`
+	Exporters  []string                  `yaml:"exporters"`
+}
+
+func (cfg *MetricsForwardConfig) Validate(exporters map[string]ExporterConfig) error {
+	if len(cfg.Attributes) > 0 && len(cfg.Exporters) == 0 {
+		return errors.New("attributes are set but exporters is empty, so the modified metrics would be discarded")
+	}
+	for _, name := range cfg.Exporters {
+		if _, ok := exporters[name]; !ok {
+			return fmt.Errorf("metrics exporter %s is not defined", name)
+		}
+	}
+	for _, attrMod := range cfg.Attributes {
+		if err := attrMod.Validate(); err != nil {
+			return fmt.Errorf("invalid metric attribute modifier: %w", err)
+		}
+	}
 	return nil
 }
 
+// LogSamplingConfig keeps every log record at or above MinSeverity and a
+// random share of Ratio of the records below it.
+type LogSamplingConfig struct {
+	MinSeverity string  `yaml:"min_severity"` // TRACE, DEBUG, INFO, WARN, ERROR or FATAL
+	Ratio       float64 `yaml:"ratio"`        // 0 drops all records below min_severity, 1 keeps all
+}
+
+func (cfg *LogSamplingConfig) Validate() error {
+	if _, ok := severityNumber(cfg.MinSeverity); !ok {
+		return fmt.Errorf("min_severity must be one of TRACE, DEBUG, INFO, WARN, ERROR or FATAL, got %q", cfg.MinSeverity)
+	}
+	if cfg.Ratio < 0 || cfg.Ratio > 1 {
+		return errors.New("ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// severityNumber returns the lowest severity number of a severity name, e.g.
+// 13 (WARN) for "warn" or "WARNING".
+func severityNumber(name string) (logspb.SeverityNumber, bool) {
+	switch strings.ToUpper(name) {
+	case "TRACE":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE, true
+	case "DEBUG":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG, true
+	case "INFO":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO, true
+	case "WARN", "WARNING":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN, true
+	case "ERROR":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, true
+	case "FATAL":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, true
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, false
+}
+
 // LoadConfig loads configuration from the specified path.
 func LoadConfig(path string) (*Config, error) {
 	r, err := loadConfig(path)
@@ -255,7 +1162,16 @@ func loadConfig(path string) (io.Reader, error) {
 	if err != nil {
 		return nil, fmt.Errorf("expand env vars in config: %w", err)
 	}
-	return bytes.NewReader([]byte(expanded)), nil
+	// JSON is YAML, so the YAML decoder reads JSON configs with the same keys
+	// and value formats, such as "30s" durations. Check the syntax first to
+	// report JSON errors as such.
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var doc any
+		if err := json.Unmarshal([]byte(expanded), &doc); err != nil {
+			return nil, fmt.Errorf("parse JSON config: %w", err)
+		}
+	}
+	return strings.NewReader(expanded), nil
 }
 
 var re = regexp.MustCompile(`\$\{([^}]+)\}`)
@@ -265,6 +1181,25 @@ func expandWithDefaultAndError(s string) (string, error) {
 	result := re.ReplaceAllStringFunc(s, func(m string) string {
 		content := strings.TrimSuffix(strings.TrimPrefix(m, "${"), "}")
 
+		// ${cel:...} is a header template resolved at upload time
+		if strings.HasPrefix(content, "cel:") {
+			return m
+		}
+
+		// ${<scheme>:<ref>} is resolved by the SecretResolver registered for scheme
+		if scheme, ref, ok := strings.Cut(content, ":"); ok {
+			if resolver, ok := lookupSecretResolver(scheme); ok {
+				val, err := resolver.Resolve(context.Background(), ref)
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("resolve %s: %w", m, err)
+					}
+					return ""
+				}
+				return val
+			}
+		}
+
 		// ?:error
 		if parts := strings.SplitN(content, ":?", 2); len(parts) == 2 {
 			key := parts[0]
@@ -1,9 +1,21 @@
 package app
 
 import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	yaml "github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -37,6 +49,28 @@ func TestLoadConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "cloudtrace exporter",
+			path:      "testdata/config_with_cloudtrace.yml",
+			expectErr: false,
+			expectConfig: &Config{
+				Exporters: map[string]ExporterConfig{
+					"cloudtrace": {
+						Type: "cloudtrace",
+						CloudTrace: CloudTraceExporterConfig{
+							ProjectID: "my-project",
+						},
+					},
+				},
+				Forward: map[string]ForwardConfig{
+					"default": {
+						Traces: &TracesForwardConfig{
+							Exporters: []string{"cloudtrace"},
+						},
+					},
+				},
+			},
+		},
 		{
 			name:      "config with env var expansion",
 			path:      "testdata/config_with_header.yml",
@@ -233,6 +267,25 @@ func TestLoadConfig(t *testing.T) {
 
 }
 
+func TestLoadConfig_JSON(t *testing.T) {
+	t.Setenv("API_KEY", "test-api-key")
+	for _, name := range []string{"config", "config_with_default"} {
+		t.Run(name, func(t *testing.T) {
+			want, err := LoadConfig("testdata/" + name + ".yml")
+			require.NoError(t, err)
+			got, err := LoadConfig("testdata/" + name + ".json")
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+	t.Run("syntax error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"exporters": {"otlp": {"type": "otlp",}}}`), 0o644))
+		_, err := LoadConfig(path)
+		require.ErrorContains(t, err, "parse JSON config")
+	})
+}
+
 func TestExpandWithDefaultAndError(t *testing.T) {
 	cases := []struct {
 		name      string
@@ -348,3 +401,317 @@ func TestExpandWithDefaultAndError(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandWithDefaultAndError_SecretResolvers(t *testing.T) {
+	stub := func(values map[string]string) SecretResolver {
+		return SecretResolverFunc(func(ctx context.Context, ref string) (string, error) {
+			if v, ok := values[ref]; ok {
+				return v, nil
+			}
+			return "", errors.New("not found")
+		})
+	}
+	for scheme, values := range map[string]map[string]string{
+		"ssm":            {"/dbt/otel/endpoint": "https://collector:4318"},
+		"secretsmanager": {"dbt-otel-token": "s3cr3t"},
+	} {
+		orig, _ := lookupSecretResolver(scheme)
+		RegisterSecretResolver(scheme, stub(values))
+		t.Cleanup(func() { RegisterSecretResolver(scheme, orig) })
+	}
+
+	t.Run("references are expanded", func(t *testing.T) {
+		t.Setenv("SERVICE", "dbt")
+		result, err := expandWithDefaultAndError(
+			"endpoint: ${ssm:/dbt/otel/endpoint}\n" +
+				"token: Bearer ${secretsmanager:dbt-otel-token}\n" +
+				"service: ${SERVICE}\n" +
+				"env: ${ENV_NAME:-dev}\n" +
+				"request_id: ${cel:uuid()}",
+		)
+		require.NoError(t, err)
+		require.Equal(t,
+			"endpoint: https://collector:4318\n"+
+				"token: Bearer s3cr3t\n"+
+				"service: dbt\n"+
+				"env: dev\n"+
+				"request_id: ${cel:uuid()}",
+			result,
+		)
+	})
+
+	t.Run("resolve failure is an error", func(t *testing.T) {
+		_, err := expandWithDefaultAndError("token: ${secretsmanager:missing}")
+		require.ErrorContains(t, err, "${secretsmanager:missing}")
+	})
+
+	t.Run("custom scheme", func(t *testing.T) {
+		RegisterSecretResolver("vault", stub(map[string]string{"secret/dbt": "from-vault"}))
+		t.Cleanup(func() { RegisterSecretResolver("vault", nil) })
+		result, err := expandWithDefaultAndError("${vault:secret/dbt}")
+		require.NoError(t, err)
+		require.Equal(t, "from-vault", result)
+	})
+}
+
+func TestAttributeModifierConfig_ValidateValueType(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		yaml      string
+		expectErr string
+	}{
+		{name: "string", yaml: `{key: env, value: prod, value_type: string}`},
+		{name: "int", yaml: `{key: retries, value: 3, value_type: int}`},
+		{name: "negative int", yaml: `{key: offset, value: -1, value_type: int}`},
+		{name: "double", yaml: `{key: ratio, value: 0.5, value_type: double}`},
+		{name: "bool", yaml: `{key: enabled, value: true, value_type: bool}`},
+		{name: "array", yaml: `{key: tags, value: [a, b], value_type: array}`},
+		{name: "value_expr is checked at runtime", yaml: `{key: name, value_expr: 'name', value_type: int}`},
+		{name: "mismatched static value", yaml: `{key: retries, value: three, value_type: int}`, expectErr: "value three of key retries is not of value_type int"},
+		{name: "quoted number", yaml: `{key: retries, value: "3", value_type: int}`, expectErr: "is not of value_type int"},
+		{name: "int is a double", yaml: `{key: ratio, value: 1, value_type: double}`},
+		{name: "int is not string", yaml: `{key: build, value: 123, value_type: string}`, expectErr: "value 123 of key build was read as an integer, which is not of value_type string"},
+		{name: "unknown type", yaml: `{key: env, value: prod, value_type: text}`, expectErr: "value_type must be one of"},
+		{name: "other action", yaml: `{action: remove, key: env, value_type: string}`, expectErr: "only be used with the set action"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg AttributeModifierConfig
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yaml), &cfg))
+			err := cfg.Validate()
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestForwardConfig_ValidateBatch(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		batch     ForwardBatchConfig
+		expectErr bool
+	}{
+		{name: "size", batch: ForwardBatchConfig{Size: 500}},
+		{name: "interval", batch: ForwardBatchConfig{Interval: time.Minute}},
+		{name: "empty", batch: ForwardBatchConfig{}, expectErr: true},
+		{name: "negative size", batch: ForwardBatchConfig{Size: -1, Interval: time.Minute}, expectErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := ForwardConfig{Batch: &tc.batch}
+			err := cfg.Validate(nil)
+			if tc.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestForwardConfig_ValidateAttributesWithoutExporters(t *testing.T) {
+	exporters := map[string]ExporterConfig{
+		"otlp": {Type: "otlp", Otlp: OtlpExporterConfig{Endpoint: "http://localhost:4317"}},
+	}
+	attrs := []AttributeModifierConfig{{Action: "set", Key: "env", Value: "prod"}}
+	cases := []struct {
+		name      string
+		cfg       ForwardConfig
+		expectErr bool
+	}{
+		{
+			name:      "traces attributes without exporters",
+			cfg:       ForwardConfig{Traces: &TracesForwardConfig{Attributes: attrs}},
+			expectErr: true,
+		},
+		{
+			name:      "logs attributes without exporters",
+			cfg:       ForwardConfig{Logs: &LogsForwardConfig{Attributes: attrs, Exporters: []string{}}},
+			expectErr: true,
+		},
+		{
+			name: "attributes with exporters",
+			cfg: ForwardConfig{
+				Traces: &TracesForwardConfig{Attributes: attrs, Exporters: []string{"otlp"}},
+				Logs:   &LogsForwardConfig{Attributes: attrs, Exporters: []string{"otlp"}},
+			},
+		},
+		{
+			name: "no attributes and no exporters",
+			cfg:  ForwardConfig{Traces: &TracesForwardConfig{}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate(exporters)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	cases := []struct {
+		name            string
+		profile         string
+		expectEndpoints map[string]string
+		expectTraces    []string
+		expectErr       bool
+	}{
+		{
+			name:            "dev overrides the base exporter",
+			profile:         "dev",
+			expectEndpoints: map[string]string{"otlp": "http://collector.dev:4317"},
+			expectTraces:    []string{"otlp"},
+		},
+		{
+			name:    "prod adds an exporter and overrides forward",
+			profile: "prod",
+			expectEndpoints: map[string]string{
+				"otlp":   "https://collector.prod:4317",
+				"backup": "https://backup.prod:4317",
+			},
+			expectTraces: []string{"otlp", "backup"},
+		},
+		{
+			name:      "unknown profile",
+			profile:   "staging",
+			expectErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := LoadConfig("testdata/config_with_profiles.yml")
+			require.NoError(t, err)
+			err = cfg.ApplyProfile(tc.profile)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			endpoints := make(map[string]string)
+			for name, exp := range cfg.Exporters {
+				endpoints[name] = exp.Otlp.Endpoint
+			}
+			require.Equal(t, tc.expectEndpoints, endpoints)
+			require.Equal(t, tc.expectTraces, cfg.Forward["default"].Traces.Exporters)
+		})
+	}
+}
+
+func TestLoadConfig_UndefinedExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+exporters:
+  otlp:
+    type: otlp
+    endpoint: "http://localhost:4317"
+forward:
+  default:
+    traces:
+      exporters: [otlpp]
+    logs:
+      exporters: [otlp, missing]
+profiles:
+  prod:
+    exporters:
+      backup:
+        type: otlp
+        endpoint: "https://backup.prod:4317"
+    forward:
+      default:
+        traces:
+          exporters: [otlp, backup]
+`), 0o644))
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	require.Equal(t, "undefined exporters referenced: forward[default].logs: missing, forward[default].traces: otlpp", err.Error(),
+		"profile rules may reference the exporters of the profile")
+}
+
+func TestConfig_ValidateNumberHints(t *testing.T) {
+	require.NoError(t, (&Config{NumberHints: map[string]string{"rows_affected": "int", "elapsed": "double"}}).Validate())
+	require.ErrorContains(t, (&Config{NumberHints: map[string]string{"rows_affected": "integer"}}).Validate(), "number_hints[rows_affected]")
+}
+
+func TestConfig_ValidateElevateSeverityThreshold(t *testing.T) {
+	require.NoError(t, (&Config{Logs: LogsConfig{ElevateSeverityThreshold: "error"}}).Validate())
+	require.ErrorContains(t, (&Config{Logs: LogsConfig{ElevateSeverityThreshold: "CRITICAL"}}).Validate(), "logs.elevate_severity_threshold")
+}
+
+func TestConfig_ValidateAttributeMapping(t *testing.T) {
+	mapping := func(rename map[string]string) *Config {
+		return &Config{Decoder: DecoderConfig{AttributeMapping: &AttributeMappingConfig{Rename: rename}}}
+	}
+	require.NoError(t, mapping(map[string]string{"sql": "db.query.text"}).Validate())
+	require.ErrorContains(t, mapping(map[string]string{"sql": ""}).Validate(), "decoder.attribute_mapping.rename[sql] must not be empty")
+}
+
+func TestOtlpExporterConfig_ValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o644))
+
+	cases := []struct {
+		name string
+		cfg  OtlpExporterConfig
+		err  string
+	}{
+		{"insecure", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", TLS: &TLSConfig{InsecureSkipVerify: true}}, ""},
+		{"cert without key", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", TLS: &TLSConfig{CertFile: "client.pem"}}, "tls: cert_file and key_file must be set together"},
+		{"missing ca_file", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", TLS: &TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}}, "tls: ca_file: open "},
+		{"ca_file without certificates", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", TLS: &TLSConfig{CAFile: notPEM}}, "tls: ca_file: no PEM certificates found in " + notPEM},
+		{"missing key_file", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", Logs: &OtlpSignalConfig{TLS: &TLSConfig{CertFile: notPEM, KeyFile: filepath.Join(dir, "key.pem")}}}, "logs.tls: cert_file and key_file: "},
+		{"grpc", OtlpExporterConfig{Endpoint: "https://otlp", TLS: &TLSConfig{InsecureSkipVerify: true}}, "tls requires an http protocol, but traces is sent over grpc"},
+		{"grpc signal", OtlpExporterConfig{Endpoint: "https://otlp", Protocol: "http/protobuf", TLS: &TLSConfig{InsecureSkipVerify: true}, Logs: &OtlpSignalConfig{Protocol: "grpc"}}, "tls requires an http protocol, but logs is sent over grpc"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestOtlpExporterConfig_TLSCAFile(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o644))
+
+	upload := func(cfg OtlpExporterConfig) error {
+		exp, err := NewExporter(context.Background(), ExporterConfig{Type: "otlp", MaxAttempts: 1, Otlp: cfg})
+		require.NoError(t, err)
+		require.NoError(t, exp.Start(context.Background()))
+		defer exp.Stop(context.Background())
+		return exp.UploadTraces(context.Background(), []*tracepb.ResourceSpans{{}})
+	}
+	require.Error(t, upload(OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}), "the test server's certificate is not trusted by default")
+	require.NoError(t, upload(OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf", TLS: &TLSConfig{CAFile: caFile}}))
+	require.NoError(t, upload(OtlpExporterConfig{
+		Endpoint: srv.URL,
+		Protocol: "http/protobuf",
+		TLS:      &TLSConfig{CAFile: caFile, ServerName: "other.example.com"},
+		Traces:   &OtlpSignalConfig{TLS: &TLSConfig{CAFile: caFile}},
+	}), "the traces tls replaces the exporter's")
+
+	_, err := NewExporter(context.Background(), ExporterConfig{Type: "otlp", Otlp: OtlpExporterConfig{
+		Endpoint: srv.URL,
+		Protocol: "http/protobuf",
+		TLS:      &TLSConfig{CertFile: "client.pem"},
+	}})
+	require.ErrorContains(t, err, "tls: cert_file and key_file must be set together")
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// controlFile lets operators pause uploads during maintenance windows without
+// stopping dbt. While paused, raw lines are spooled next to the control file so
+// they can be replayed (in order) once forwarding resumes.
+type controlFile struct {
+	path      string
+	spoolPath string
+}
+
+func newControlFile(path string) *controlFile {
+	if path == "" {
+		return nil
+	}
+	return &controlFile{
+		path:      path,
+		spoolPath: path + ".spool",
+	}
+}
+
+// Paused reports whether forwarding is paused. The file being present pauses
+// forwarding unless its content is "resume"; a missing file means running.
+func (c *controlFile) Paused() bool {
+	if c == nil {
+		return false
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) != "resume"
+}
+
+// Spool appends lines to the spool file.
+func (c *controlFile) Spool(lines []string) error {
+	f, err := os.OpenFile(c.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open spool: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("write spool: %w", err)
+		}
+	}
+	return w.Flush()
+}
+
+// Drain returns the spooled lines and removes the spool file.
+func (c *controlFile) Drain() ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	f, err := os.Open(c.spoolPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open spool: %w", err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read spool: %w", err)
+	}
+	if err := os.Remove(c.spoolPath); err != nil {
+		return nil, fmt.Errorf("remove spool: %w", err)
+	}
+	return lines, nil
+}
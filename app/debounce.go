@@ -0,0 +1,37 @@
+package app
+
+import "time"
+
+// debouncer holds decoded records back across flushes until maxPending records
+// are pending or the oldest pending flush has waited delay, so rapid small
+// flushes are coalesced into fewer requests. A nil debouncer holds nothing.
+type debouncer struct {
+	maxPending int
+	delay      time.Duration
+	since      time.Time
+	now        func() time.Time
+}
+
+func newDebouncer(maxPending int, delay time.Duration, now func() time.Time) *debouncer {
+	if delay <= 0 {
+		return nil
+	}
+	return &debouncer{maxPending: maxPending, delay: delay, now: now}
+}
+
+// hold reports whether pending records should wait for a later flush. The
+// delay restarts once they are released.
+func (d *debouncer) hold(pending int) bool {
+	if d == nil || pending == 0 {
+		return false
+	}
+	now := d.now()
+	if d.since.IsZero() {
+		d.since = now
+	}
+	if (d.maxPending > 0 && pending >= d.maxPending) || now.Sub(d.since) >= d.delay {
+		d.since = time.Time{}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDebouncer_Hold(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := newDebouncer(10, time.Minute, func() time.Time { return now })
+
+	assert.False(t, d.hold(0), "nothing to hold")
+	assert.True(t, d.hold(3))
+	now = now.Add(30 * time.Second)
+	assert.True(t, d.hold(6))
+	assert.False(t, d.hold(10), "released at debounce_max")
+
+	assert.True(t, d.hold(1), "the delay restarts after a release")
+	now = now.Add(time.Minute)
+	assert.False(t, d.hold(2), "released after debounce_delay")
+
+	var disabled *debouncer
+	assert.Nil(t, newDebouncer(10, 0, time.Now))
+	assert.False(t, disabled.hold(5))
+}
+
+func TestFlushAndUpload_Debounce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	var batches []int
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			batches = append(batches, len(protoSpans[0].ScopeSpans[0].Spans))
+			return nil
+		},
+	).AnyTimes()
+
+	a := newTestApp()
+	a.cfg = &Config{DebounceDelay: time.Hour, DebounceMax: 120}
+	lines := make(chan otelLine, 1000)
+	// 250 spans are 500 lines: five 100 line flushes of 50 spans each.
+	for _, line := range spanLines(0, 250) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+		FlushTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{150, 100}, batches, "flushes are coalesced until debounce_max, the final flush sends the rest")
+
+	// The debouncer follows the App clock: an hour passes between flushes.
+	batches = nil
+	now := time.Unix(0, 0)
+	a = newTestApp()
+	a.Now = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+	a.cfg = &Config{DebounceDelay: time.Hour, DebounceMax: 120}
+	lines = make(chan otelLine, 1000)
+	for _, line := range spanLines(0, 250) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	err = a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+		FlushTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{100, 100, 50}, batches, "held flushes are released once debounce_delay passed")
+}
+
+func TestConfig_ValidateDebounce(t *testing.T) {
+	require.NoError(t, (&Config{DebounceDelay: time.Second, DebounceMax: 100}).Validate())
+	require.NoError(t, (&Config{DebounceDelay: time.Second}).Validate())
+	require.Error(t, (&Config{DebounceMax: 100}).Validate(), "debounce_max requires debounce_delay")
+	require.Error(t, (&Config{DebounceDelay: -time.Second}).Validate())
+}
@@ -2,18 +2,38 @@
 package app
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"maps"
+	"math"
 	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 )
 
+// defaultSpanNameFields is where dbt writes the span name.
+var defaultSpanNameFields = []string{"span_name"}
+
+// defaultStacktraceFields are the record attributes that may carry the
+// traceback of a failed node.
+var defaultStacktraceFields = []string{"traceback", "stacktrace"}
+
+// exceptionTypeFields are the record attributes that may carry the type of the
+// error of a failed node.
+var exceptionTypeFields = []string{"exception_type", "error_type"}
+
 // nonErrorOutcomes is a list of node outcomes that are not considered errors.
 // e.g. ephemeral models skipped due to NO_OP
 var nonErrorOutcomes = []string{
@@ -21,6 +41,59 @@ var nonErrorOutcomes = []string{
 	"NODE_OUTCOME_SKIPPED",
 }
 
+// Types a number hint can force an attribute to.
+const (
+	NumberHintInt    = "int"
+	NumberHintDouble = "double"
+)
+
+// Modes for records of a span that was already emitted, e.g. a second SpanEnd
+// written by a dbt bug or a replayed file.
+const (
+	// OnDuplicateDrop ignores such records.
+	OnDuplicateDrop = "drop"
+	// OnDuplicateMerge emits the span again with the attributes, events and
+	// status of the duplicate records merged in, for backends that keep the
+	// latest version of a span.
+	OnDuplicateMerge = "merge"
+)
+
+// Units of the elapsed field a span's end time is derived from when the
+// record has no end time.
+const (
+	// ElapsedUnitAuto reads values below elapsedAutoSecondsBelow as seconds,
+	// which dbt reports elapsed times in, and larger ones as nanoseconds.
+	ElapsedUnitAuto         = "auto"
+	ElapsedUnitSeconds      = "s"
+	ElapsedUnitMilliseconds = "ms"
+	ElapsedUnitNanoseconds  = "ns"
+)
+
+// elapsedAutoSecondsBelow is 1e6 seconds, over eleven days, while 1e6
+// nanoseconds is a millisecond.
+const elapsedAutoSecondsBelow = 1e6
+
+// ValidElapsedUnit reports whether unit is a known elapsed unit.
+func ValidElapsedUnit(unit string) bool {
+	switch unit {
+	case ElapsedUnitAuto, ElapsedUnitSeconds, ElapsedUnitMilliseconds, ElapsedUnitNanoseconds:
+		return true
+	}
+	return false
+}
+
+// DefaultExceptionEventName is the OpenTelemetry name of exception events.
+const DefaultExceptionEventName = "exception"
+
+// completedSpanCapacity is how many recently emitted span ids are remembered
+// to detect duplicates.
+const completedSpanCapacity = 1024
+
+// ValidOnDuplicate reports whether mode is a known duplicate span mode.
+func ValidOnDuplicate(mode string) bool {
+	return mode == OnDuplicateDrop || mode == OnDuplicateMerge
+}
+
 // spanPartial represents an incomplete span being assembled from SpanStart/SpanEnd
 type spanPartial struct {
 	traceID       string
@@ -29,47 +102,105 @@ type spanPartial struct {
 	name          string
 	start         uint64
 	end           uint64
+	elapsed       time.Duration // end time fallback when the records have none
 	attrs         []*commonpb.KeyValue
 	events        []*tracepb.Span_Event
+	links         []*tracepb.Span_Link
 	statusCode    tracepb.Status_StatusCode
 	statusMessage string
+	kind          tracepb.Span_SpanKind
+	invalidTime   bool
+	succeeded     bool
+	readAt        time.Time // when the first line of the span was read
+	source        string    // file the first line of the span was read from
 }
 
 // Decoder decodes OTEL JSONL log lines into OTLP spans and log records.
 // It maintains state to match SpanStart/SpanEnd pairs and only emits complete spans.
 type Decoder struct {
+	// Now is the clock for timestamps the decoder makes up, such as the start
+	// time of a span whose own is unparseable. It defaults to time.Now.
+	Now func() time.Time
+
 	cutoffTimeNano       uint64
 	spanPartials         map[string]*spanPartial
 	attributeTransformer func([]*commonpb.KeyValue) []*commonpb.KeyValue
+	strictTimestamps     bool
+	explicitOKStatus     bool
+	invocationCutoff     bool
+	invocationTraceID    string
+	commentPrefix        string
+	forwarderVersion     bool
+	replayAttributes     []*commonpb.KeyValue
+	synthesizeIDs        bool
+	invocationID         string
+	parentTraceID        []byte
+	parentSpanID         []byte
+	onDuplicate          string
+	completedSpans       *completedSpans
+	spanNameFields       []string
+	eventSummary         bool
+	lineTransformers     []func(map[string]any) map[string]any
+	stacktraceFields     []string
+	resolveLogSpans      bool
+	metrics              []*metricspb.Metric
+	nodeDurationMetrics  bool
+	elevateSeverity      logspb.SeverityNumber
+	exceptionEventName   string
+	numberHints          map[string]string
+	inProgressAfter      time.Duration
+	elapsedUnit          string
+	decodeLatency        *latencyHistogram
+	sourceFileKey        string
+	line                 otelLine // the line being decoded, for its read time and source
 }
 
 // NewDecoder creates a new Decoder with the given cutoff time.
 // Lines with timestamps before cutoffTimeNano will be skipped (for log rotation handling).
 func NewDecoder(cutoffTimeNano uint64) *Decoder {
 	d := &Decoder{
-		cutoffTimeNano: cutoffTimeNano,
-		spanPartials:   make(map[string]*spanPartial),
+		Now:              time.Now,
+		cutoffTimeNano:   cutoffTimeNano,
+		spanPartials:     make(map[string]*spanPartial),
+		onDuplicate:      OnDuplicateDrop,
+		completedSpans:   newCompletedSpans(completedSpanCapacity),
+		spanNameFields:   defaultSpanNameFields,
+		stacktraceFields: defaultStacktraceFields,
+		elapsedUnit:      ElapsedUnitAuto,
+
+		exceptionEventName: DefaultExceptionEventName,
 	}
 	d.AttributeTransformer(nil)
 	return d
 }
 
-func defaultAttributeTransformer(attrs []*commonpb.KeyValue) []*commonpb.KeyValue {
-	result := make([]*commonpb.KeyValue, 0, len(attrs))
-	for _, attr := range attrs {
-		key := attr.Key
-		switch {
-		case key == "sql":
-			key = "db.statement"
-		case !strings.HasPrefix(key, "dbt."):
-			key = "dbt." + key
-		}
-		result = append(result, &commonpb.KeyValue{
-			Key:   key,
-			Value: attr.Value,
-		})
+// defaultAttributePrefix and defaultAttributeRenames make up the default
+// attribute transformer.
+const defaultAttributePrefix = "dbt."
+
+var defaultAttributeRenames = map[string]string{"sql": "db.statement"}
+
+var defaultAttributeTransformer = newAttributeTransformer(defaultAttributePrefix, defaultAttributeRenames)
+
+// newAttributeTransformer returns a transformer renaming the keys in rename
+// and prefixing every other key that does not already have the prefix.
+func newAttributeTransformer(prefix string, rename map[string]string) func([]*commonpb.KeyValue) []*commonpb.KeyValue {
+	return func(attrs []*commonpb.KeyValue) []*commonpb.KeyValue {
+		result := make([]*commonpb.KeyValue, 0, len(attrs))
+		for _, attr := range attrs {
+			key := attr.Key
+			if renamed, ok := rename[key]; ok {
+				key = renamed
+			} else if !strings.HasPrefix(key, prefix) {
+				key = prefix + key
+			}
+			result = append(result, &commonpb.KeyValue{
+				Key:   key,
+				Value: attr.Value,
+			})
+		}
+		return result
 	}
-	return result
 }
 
 func (d *Decoder) AttributeTransformer(f func([]*commonpb.KeyValue) []*commonpb.KeyValue) {
@@ -79,161 +210,923 @@ func (d *Decoder) AttributeTransformer(f func([]*commonpb.KeyValue) []*commonpb.
 	d.attributeTransformer = f
 }
 
+// RegisterLineTransformer adds f to the functions applied to every parsed line,
+// for light preprocessing such as renaming fields of a dbt output variant the
+// decoder does not understand. Transformers run in registration order, after
+// the line is parsed as JSON and before anything else looks at it: the
+// record_type dispatch, the cutoff checks and id synthesis all see the
+// transformed record. Comment lines are skipped before parsing and never reach
+// a transformer. Returning nil skips the line.
+func (d *Decoder) RegisterLineTransformer(f func(map[string]any) map[string]any) {
+	if f != nil {
+		d.lineTransformers = append(d.lineTransformers, f)
+	}
+}
+
+// StrictTimestamps controls how unparseable span timestamps are handled.
+// By default a bad start time falls back to now and a bad end time to the start time;
+// in strict mode such spans are dropped with a warning instead, so a format change
+// in dbt does not silently produce wrong timings.
+func (d *Decoder) StrictTimestamps(strict bool) {
+	d.strictTimestamps = strict
+}
+
+// ExplicitOKStatus sets STATUS_CODE_OK on spans whose node_outcome is
+// NODE_OUTCOME_SUCCESS. By default such spans are left UNSET as the OTel spec
+// recommends, but some backends only count explicitly OK spans as successful.
+func (d *Decoder) ExplicitOKStatus(enabled bool) {
+	d.explicitOKStatus = enabled
+}
+
+// InvocationCutoff makes the decoder key the cutoff off dbt's own invocation
+// start record instead of the wrapper's start time. Records are dropped until the
+// first Invocation SpanStart at or after the cutoff; its start time becomes the
+// new cutoff and only records of its trace are decoded from then on. This
+// excludes content of earlier invocations precisely, even when they were written
+// after the wrapper started.
+func (d *Decoder) InvocationCutoff(enabled bool) {
+	d.invocationCutoff = enabled
+}
+
+// CommentPrefix makes the decoder ignore lines starting with prefix (after
+// leading whitespace), such as `#` comments injected by other tooling. Such
+// lines are skipped quietly instead of being reported as unparseable.
+// An empty prefix disables comment handling.
+func (d *Decoder) CommentPrefix(prefix string) {
+	d.commentPrefix = prefix
+}
+
+// ForwarderVersion stamps dbt.forwarder.version with the forwarder's Version on
+// every span and log record, to tell which forwarder release processed the data.
+// It is off by default as it adds an attribute to every record.
+func (d *Decoder) ForwarderVersion(enabled bool) {
+	d.forwarderVersion = enabled
+}
+
+// Replayed stamps dbt.replayed=true, and dbt.replay_id if replayID is not
+// empty, on every record, so that backends can tell data forwarded again from
+// an existing file apart from the original upload and dedupe it.
+func (d *Decoder) Replayed(enabled bool, replayID string) {
+	d.replayAttributes = nil
+	if !enabled {
+		return
+	}
+	d.replayAttributes = append(d.replayAttributes, &commonpb.KeyValue{
+		Key:   "dbt.replayed",
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}},
+	})
+	if replayID != "" {
+		d.replayAttributes = append(d.replayAttributes, &commonpb.KeyValue{
+			Key:   "dbt.replay_id",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: replayID}},
+		})
+	}
+}
+
+// SynthesizeIDs makes the decoder derive ids for span and log records that
+// lack them, instead of skipping such records. The span id is a hash of the
+// invocation_id, the node unique_id and the phase, and the trace id a hash of
+// the invocation_id, so the same record always gets the same ids and a log
+// record gets the id of the span it belongs to. Records without an invocation
+// id or without both unique_id and phase are still skipped.
+func (d *Decoder) SynthesizeIDs(enabled bool) {
+	d.synthesizeIDs = enabled
+}
+
+// OnDuplicate sets how records of an already emitted span id are handled:
+// OnDuplicateDrop (the default) or OnDuplicateMerge. Unknown modes are ignored.
+func (d *Decoder) OnDuplicate(mode string) {
+	if ValidOnDuplicate(mode) {
+		d.onDuplicate = mode
+	}
+}
+
+// ElapsedUnit sets the unit of the elapsed field, which gives a span's end
+// time when its records have none. Unknown units are ignored.
+func (d *Decoder) ElapsedUnit(unit string) {
+	if ValidElapsedUnit(unit) {
+		d.elapsedUnit = unit
+	}
+}
+
+// SpanNameFields sets the record fields tried in order for the span name, for
+// record variants that use e.g. "name" instead of "span_name". A field of the
+// form "attributes.<key>" reads the record attribute <key>. If none is set the
+// node unique_id is used. An empty list restores the default, span_name.
+func (d *Decoder) SpanNameFields(fields []string) {
+	if len(fields) == 0 {
+		fields = defaultSpanNameFields
+	}
+	d.spanNameFields = fields
+}
+
+// EventSummary stamps dbt.span.event_count (number of span events) and
+// dbt.span.error (whether an exception event exists) on every span, for quick
+// filtering in backends that do not show span events.
+func (d *Decoder) EventSummary(enabled bool) {
+	d.eventSummary = enabled
+}
+
+// InProgressAfter makes InProgressSpans report spans that have been open for
+// at least after. Zero, the default, disables the snapshots.
+func (d *Decoder) InProgressAfter(after time.Duration) {
+	d.inProgressAfter = after
+}
+
+// InProgressSpans returns snapshots of the spans that started at least the
+// InProgressAfter duration ago by the decoder's clock and have not ended yet.
+// A snapshot ends now and carries dbt.span.in_progress=true; the span is
+// emitted again with the same id once it completes, so backends that update
+// spans replace the snapshot.
+func (d *Decoder) InProgressSpans() []*tracepb.Span {
+	if d.inProgressAfter <= 0 {
+		return nil
+	}
+	now := uint64(d.Now().UnixNano())
+	var spans []*tracepb.Span
+	for _, p := range d.spanPartials {
+		if p.start == 0 || p.end != 0 || p.invalidTime || now < p.start || time.Duration(now-p.start) < d.inProgressAfter {
+			continue
+		}
+		// The snapshot must not share events or attributes with the final span.
+		span := proto.Clone(d.buildSpan(p)).(*tracepb.Span)
+		span.EndTimeUnixNano = now
+		span.Attributes = append(d.stampSource(d.transformAttributes(span.Attributes), p.source), &commonpb.KeyValue{
+			Key:   "dbt.span.in_progress",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}},
+		})
+		spans = append(spans, span)
+	}
+	sortSpansByStartTime(spans)
+	return spans
+}
+
+// StacktraceFields sets the record attributes tried in order for the
+// exception.stacktrace of the exception event created for a failed node. An
+// empty list restores the default, traceback and stacktrace.
+func (d *Decoder) StacktraceFields(fields []string) {
+	if len(fields) == 0 {
+		fields = defaultStacktraceFields
+	}
+	d.stacktraceFields = fields
+}
+
+// ResolveLogSpans re-correlates log records whose span id is not a span the
+// decoder has seen, e.g. a node span written before the cutoff, to the nearest
+// known span: the innermost open or recently completed span of the same trace
+// running at the record's time, preferring spans of the node named by the
+// record's unique_id.
+func (d *Decoder) ResolveLogSpans(enabled bool) {
+	d.resolveLogSpans = enabled
+}
+
+// spanName returns the first non-empty span name field, falling back to the
+// node unique_id.
+func (d *Decoder) spanName(obj map[string]any) string {
+	attrsObj, _ := obj["attributes"].(map[string]any)
+	for _, field := range d.spanNameFields {
+		src := obj
+		if key, ok := strings.CutPrefix(field, "attributes."); ok {
+			src, field = attrsObj, key
+		}
+		if name := stringFrom(src, field); name != "" {
+			return name
+		}
+	}
+	return stringFrom(attrsObj, "unique_id")
+}
+
+// ParentContext re-roots decoded records under an external trace, such as the
+// orchestrator run that triggered dbt: spans and log records get traceID, and
+// spans without a parent get spanID as their parent. Nil ids disable it.
+func (d *Decoder) ParentContext(traceID, spanID []byte) {
+	d.parentTraceID = traceID
+	d.parentSpanID = spanID
+}
+
+// ParseTraceParent parses a W3C traceparent header value
+// (version-traceid-parentid-flags) and returns its trace and span ids.
+func ParseTraceParent(s string) (traceID, spanID []byte, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: expected version-traceid-parentid-flags", s)
+	}
+	version := parts[0]
+	if len(version) != 2 || version == "ff" || decodeHex(version) == nil {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: bad version", s)
+	}
+	// Later versions may append fields, version 00 has exactly four.
+	if version == "00" && len(parts) != 4 {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: expected version-traceid-parentid-flags", s)
+	}
+	traceID = decodeHex(parts[1])
+	if len(traceID) != 16 || slices.Max(traceID) == 0 || parts[1] != strings.ToLower(parts[1]) {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: bad trace id", s)
+	}
+	spanID = decodeHex(parts[2])
+	if len(spanID) != 8 || slices.Max(spanID) == 0 || parts[2] != strings.ToLower(parts[2]) {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: bad parent id", s)
+	}
+	if len(parts[3]) != 2 || decodeHex(parts[3]) == nil {
+		return nil, nil, fmt.Errorf("invalid traceparent %q: bad flags", s)
+	}
+	return traceID, spanID, nil
+}
+
+// NumberHints forces record attributes to an int or double value by their key
+// as written in the dbt file, e.g. {"rows_affected": "int"}, so numbers keep
+// one type whether dbt writes them as 42, 42.0 or "42". Values that cannot be
+// converted without losing information are left as they are.
+func (d *Decoder) NumberHints(hints map[string]string) {
+	d.numberHints = hints
+}
+
+// transformAttributes applies number hints and the attribute transformer and
+// stamps the forwarder version and the replay attributes.
+func (d *Decoder) transformAttributes(attrs []*commonpb.KeyValue) []*commonpb.KeyValue {
+	if len(d.numberHints) > 0 {
+		for _, attr := range attrs {
+			if hint, ok := d.numberHints[attr.GetKey()]; ok {
+				attr.Value = hintNumber(attr.GetValue(), hint)
+			}
+		}
+	}
+	attrs = d.attributeTransformer(attrs)
+	if d.forwarderVersion && !hasAttribute(attrs, "dbt.forwarder.version") {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   "dbt.forwarder.version",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: Version}},
+		})
+	}
+	for _, attr := range d.replayAttributes {
+		if !hasAttribute(attrs, attr.GetKey()) {
+			attrs = append(attrs, proto.Clone(attr).(*commonpb.KeyValue))
+		}
+	}
+	return attrs
+}
+
 // DecodeLines parses OTEL JSONL log lines and returns complete spans and log records.
 // Only spans with both SpanStart and SpanEnd are returned.
 // Call Flush() at the end to get any remaining incomplete spans.
 func (d *Decoder) DecodeLines(lines []string) ([]*tracepb.Span, []*logspb.LogRecord, error) {
+	return d.DecodeLinesReadAt(lines, nil)
+}
+
+// DecodeLinesReadAt is DecodeLines for lines read at the times in readAt,
+// which date the start of the decode latency of their spans. Lines without a
+// read time, or with a zero one, count as read when they are decoded.
+func (d *Decoder) DecodeLinesReadAt(lines []string, readAt []time.Time) ([]*tracepb.Span, []*logspb.LogRecord, error) {
+	otelLines := make([]otelLine, len(lines))
+	for i, line := range lines {
+		otelLines[i].text = line
+		if i < len(readAt) {
+			otelLines[i].readAt = readAt[i]
+		}
+	}
+	return d.decodeOTELLines(otelLines)
+}
+
+// decodeOTELLines is DecodeLines for lines carrying their read time and source.
+func (d *Decoder) decodeOTELLines(lines []otelLine) ([]*tracepb.Span, []*logspb.LogRecord, error) {
 	var completeSpans []*tracepb.Span
 	var logs []*logspb.LogRecord
 
 	for _, line := range lines {
-		var obj map[string]any
-		if err := json.Unmarshal([]byte(line), &obj); err != nil {
-			continue
+		span, log := d.decodeOTELLine(line)
+		if span != nil {
+			completeSpans = append(completeSpans, span)
 		}
-		recordType := stringFrom(obj, "record_type")
-		if recordType == "" {
-			continue
+		if log != nil {
+			logs = append(logs, log)
 		}
+	}
+
+	// Sort complete spans by start time for deterministic output
+	sortSpansByStartTime(completeSpans)
+
+	// Sort logs by time for deterministic output
+	sortLogsByTime(logs)
+
+	return completeSpans, logs, nil
+}
+
+// ExceptionEventName names the exception events the decoder creates for
+// failed nodes and tests, and the events it takes as errors; exception events
+// of the records are renamed to it. An empty name keeps
+// DefaultExceptionEventName.
+func (d *Decoder) ExceptionEventName(name string) {
+	if name == "" {
+		name = DefaultExceptionEventName
+	}
+	d.exceptionEventName = name
+}
 
-		// Check cutoff time - skip logs older than command start time
-		var logTimeNano uint64
-		if timeStr := stringFrom(obj, "start_time_unix_nano"); timeStr != "" {
-			logTimeNano = parseNano(timeStr, 0)
-		} else if timeStr := stringFrom(obj, "time_unix_nano"); timeStr != "" {
-			logTimeNano = parseNano(timeStr, 0)
+// renameExceptionEvents gives the exception events of a record the
+// configured name.
+func (d *Decoder) renameExceptionEvents(events []*tracepb.Span_Event) []*tracepb.Span_Event {
+	for _, event := range events {
+		if event.Name == DefaultExceptionEventName {
+			event.Name = d.exceptionEventName
 		}
-		if logTimeNano > 0 && logTimeNano < d.cutoffTimeNano {
-			continue // Skip old logs from previous runs
+	}
+	return events
+}
+
+// ElevateSeverity marks the span of a log record at or above the given
+// severity as ERROR, with the log body as the status message, if the span has
+// not ended yet. Records without a severity number are compared by their
+// severity text.
+func (d *Decoder) ElevateSeverity(threshold logspb.SeverityNumber) {
+	d.elevateSeverity = threshold
+}
+
+// NodeDurationMetrics makes the decoder derive a dbt.node.duration_ms gauge
+// from the span of each node, the one with a unique_id and a node_type but no
+// phase (dbt's "Node processed"). The data point is at the span's end time
+// and carries the node's unique_id and node_type. It is returned by Metrics.
+func (d *Decoder) NodeDurationMetrics(enabled bool) {
+	d.nodeDurationMetrics = enabled
+}
+
+// DecodeLatencyMetrics makes the decoder observe how long each span stays
+// pending, from its first line being read until it is emitted, in a
+// dbt.forwarder.span.decode_latency_ms histogram. The cumulative histogram is
+// returned by Metrics whenever a span completed since the last call.
+func (d *Decoder) DecodeLatencyMetrics(enabled bool) {
+	d.decodeLatency = nil
+	if enabled {
+		d.decodeLatency = newLatencyHistogram(d.Now())
+	}
+}
+
+// Metrics returns the metrics decoded from Metric records since the last call
+// and forgets them. DecodeLine and DecodeLines only return spans and logs, so
+// metrics are collected here after decoding.
+func (d *Decoder) Metrics() []*metricspb.Metric {
+	metrics := d.metrics
+	d.metrics = nil
+	if d.decodeLatency != nil {
+		if metric := d.decodeLatency.metric(d.Now()); metric != nil {
+			metrics = append(metrics, metric)
 		}
+	}
+	return metrics
+}
+
+// SourceFileAttribute makes the decoder stamp spans and log records with
+// the path of the OTEL file they were read from, as an attribute with the
+// given key, e.g. dbt.source_file. A span carries the file of its first line.
+// An empty key, the default, stamps nothing, as do lines of unknown origin.
+func (d *Decoder) SourceFileAttribute(key string) {
+	d.sourceFileKey = key
+}
+
+// decodeOTELLine is DecodeLine for a line carrying its read time and source.
+func (d *Decoder) decodeOTELLine(line otelLine) (*tracepb.Span, *logspb.LogRecord) {
+	d.line = line
+	defer func() { d.line = otelLine{} }()
+	return d.DecodeLine(line.text)
+}
+
+// readAt returns when the line being decoded was read.
+func (d *Decoder) readAt() time.Time {
+	if d.line.readAt.IsZero() {
+		return d.Now()
+	}
+	return d.line.readAt
+}
+
+// stampSource appends the source file attribute, if enabled, to attrs.
+func (d *Decoder) stampSource(attrs []*commonpb.KeyValue, source string) []*commonpb.KeyValue {
+	if d.sourceFileKey == "" || source == "" {
+		return attrs
+	}
+	return append(attrs, &commonpb.KeyValue{
+		Key:   d.sourceFileKey,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: source}},
+	})
+}
+
+// DecodeLine parses a single OTEL JSONL line. It returns the span completed by
+// this line (on SpanEnd) or the log record it carries; both are nil for lines
+// that only update decoder state or are skipped. Unlike DecodeLines the result
+// is not sorted, which lets callers stream records without buffering lines.
+func (d *Decoder) DecodeLine(line string) (*tracepb.Span, *logspb.LogRecord) {
+	if d.commentPrefix != "" && strings.HasPrefix(strings.TrimLeft(line, " \t"), d.commentPrefix) {
+		return nil, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		slog.Debug("skipping unparseable line", "error", err)
+		return nil, nil
+	}
+	for _, transform := range d.lineTransformers {
+		if obj = transform(obj); obj == nil {
+			return nil, nil
+		}
+	}
+	recordType := stringFrom(obj, "record_type")
+	if recordType == "" {
+		return nil, nil
+	}
 
-		switch recordType {
-		case "SpanStart", "SpanEnd":
-			spanID := stringFrom(obj, "span_id")
-			if spanID == "" {
-				continue
+	// Check cutoff time - skip logs older than command start time
+	var logTimeNano uint64
+	if timeStr := stringFrom(obj, "start_time_unix_nano"); timeStr != "" {
+		logTimeNano = parseNano(timeStr, 0)
+	} else if timeStr := stringFrom(obj, "time_unix_nano"); timeStr != "" {
+		logTimeNano = parseNano(timeStr, 0)
+	}
+	if logTimeNano > 0 && logTimeNano < d.cutoffTimeNano {
+		return nil, nil // Skip old logs from previous runs
+	}
+	if d.invocationCutoff && !d.matchInvocation(obj, recordType, logTimeNano) {
+		return nil, nil
+	}
+	if d.synthesizeIDs {
+		d.fillMissingIDs(obj)
+	}
+
+	switch recordType {
+	case "SpanStart", "SpanEnd":
+		spanID := stringFrom(obj, "span_id")
+		if spanID == "" {
+			return nil, nil
+		}
+		prev, duplicate := d.completedSpans.get(spanID)
+		if duplicate && d.onDuplicate == OnDuplicateDrop {
+			slog.Debug("dropping record of an already emitted span", "span_id", spanID, "record_type", recordType)
+			return nil, nil
+		}
+
+		p := d.spanPartials[spanID]
+		if p == nil {
+			p = &spanPartial{source: d.line.source}
+			if d.decodeLatency != nil {
+				p.readAt = d.readAt()
 			}
+			d.spanPartials[spanID] = p
+		}
+		p.spanID = spanID
+		if traceID := stringFrom(obj, "trace_id"); traceID != "" {
+			p.traceID = traceID
+		}
+		if parent := stringFrom(obj, "parent_span_id"); parent != "" {
+			p.parent = parent
+		}
+		if kind, ok := extractSpanKind(obj); ok {
+			p.kind = kind
+		}
 
-			p := d.spanPartials[spanID]
-			if p == nil {
-				p = &spanPartial{}
-				d.spanPartials[spanID] = p
+		if name := d.spanName(obj); name != "" && (recordType == "SpanStart" || p.name == "") {
+			p.name = name
+		}
+
+		if recordType == "SpanStart" {
+			if start := stringFrom(obj, "start_time_unix_nano"); start != "" {
+				if n, ok := parseNanoOK(start); ok {
+					p.start = n
+				} else if d.strictTimestamps {
+					p.invalidTime = true
+				} else {
+					p.start = uint64(d.Now().UnixNano())
+				}
+			}
+			p.attrs = extractAttributes(obj, p.attrs)
+			if events := d.renameExceptionEvents(extractEvents(obj)); len(events) > 0 {
+				p.events = append(p.events, events...)
+			}
+			p.links = appendLinks(p.links, extractLinks(obj))
+		} else { // SpanEnd
+			if end := stringFrom(obj, "end_time_unix_nano"); end != "" {
+				if n, ok := parseNanoOK(end); ok {
+					p.end = n
+				} else if d.strictTimestamps {
+					p.invalidTime = true
+				} else {
+					p.end = p.start
+				}
+			}
+			if elapsed, ok := d.elapsed(obj); ok {
+				p.elapsed = elapsed
 			}
-			p.spanID = spanID
-			if traceID := stringFrom(obj, "trace_id"); traceID != "" {
-				p.traceID = traceID
+			if p.invalidTime {
+				slog.Warn("skipping span with unparseable timestamp", "span_id", spanID, "span_name", p.name)
+				delete(d.spanPartials, spanID)
+				return nil, nil
 			}
-			if parent := stringFrom(obj, "parent_span_id"); parent != "" {
-				p.parent = parent
+			p.attrs = extractAttributes(obj, p.attrs)
+			if events := d.renameExceptionEvents(extractEvents(obj)); len(events) > 0 {
+				p.events = append(p.events, events...)
 			}
+			p.links = appendLinks(p.links, extractLinks(obj))
 
-			if recordType == "SpanStart" {
-				if name := stringFrom(obj, "span_name"); name != "" {
-					p.name = name
+			// Extract status information from SpanEnd
+			if statusObj, ok := obj["status"].(map[string]any); ok {
+				if code := getInt(statusObj, "code"); code > 0 {
+					p.statusCode = tracepb.Status_StatusCode(code)
 				}
-				if start := stringFrom(obj, "start_time_unix_nano"); start != "" {
-					p.start = parseNano(start, uint64(time.Now().UnixNano()))
-				}
-				p.attrs = extractAttributes(obj, p.attrs)
-				if events := extractEvents(obj); len(events) > 0 {
-					p.events = append(p.events, events...)
-				}
-			} else { // SpanEnd
-				if end := stringFrom(obj, "end_time_unix_nano"); end != "" {
-					p.end = parseNano(end, p.start)
-				}
-				p.attrs = extractAttributes(obj, p.attrs)
-				if events := extractEvents(obj); len(events) > 0 {
-					p.events = append(p.events, events...)
+				if msg := stringFrom(statusObj, "message"); msg != "" {
+					p.statusMessage = msg
 				}
+				p.attrs = appendStatusAttributes(p.attrs, statusObj)
+			}
 
-				// Extract status information from SpanEnd
-				if statusObj, ok := obj["status"].(map[string]any); ok {
-					if code := getInt(statusObj, "code"); code > 0 {
-						p.statusCode = tracepb.Status_StatusCode(code)
-					}
-					if msg := stringFrom(statusObj, "message"); msg != "" {
-						p.statusMessage = msg
+			// Check for exception events and set ERROR status
+			for _, event := range p.events {
+				if event.Name == d.exceptionEventName {
+					if p.statusCode == tracepb.Status_STATUS_CODE_UNSET {
+						p.statusCode = tracepb.Status_STATUS_CODE_ERROR
 					}
-				}
-
-				// Check for exception events and set ERROR status
-				for _, event := range p.events {
-					if event.Name == "exception" {
-						if p.statusCode == tracepb.Status_STATUS_CODE_UNSET {
-							p.statusCode = tracepb.Status_STATUS_CODE_ERROR
-						}
-						// Extract exception.message for status message if available
-						if p.statusMessage == "" {
-							for _, attr := range event.Attributes {
-								if attr.Key == "exception.message" {
-									if strVal, ok := attr.Value.Value.(*commonpb.AnyValue_StringValue); ok {
-										p.statusMessage = strVal.StringValue
-										break
-									}
+					// Extract exception.message for status message if available
+					if p.statusMessage == "" {
+						for _, attr := range event.Attributes {
+							if attr.Key == "exception.message" {
+								if strVal, ok := attr.Value.Value.(*commonpb.AnyValue_StringValue); ok {
+									p.statusMessage = strVal.StringValue
+									break
 								}
 							}
 						}
-						break
 					}
+					break
 				}
+			}
 
-				// Check for test/node failures in attributes and create exception events
-				if attrsObj, ok := obj["attributes"].(map[string]any); ok {
-					p.checkTestFailure(attrsObj)
-					p.checkNodeOutcomeFailure(attrsObj)
-				}
+			// Check for test/node failures in attributes and create exception events
+			if attrsObj, ok := obj["attributes"].(map[string]any); ok {
+				n := len(p.events)
+				p.checkTestFailure(attrsObj, d.exceptionEventName)
+				p.checkNodeOutcomeFailure(attrsObj, d.exceptionEventName)
+				d.addExceptionDetails(p.events[n:], attrsObj)
+				p.succeeded = stringFrom(attrsObj, "node_outcome") == "NODE_OUTCOME_SUCCESS"
+			}
+
+			// A duplicate SpanEnd alone completes the span emitted before
+			if duplicate && p.start == 0 {
+				p.start = prev.GetStartTimeUnixNano()
+			}
 
-				// SpanEnd received - if we have start time, emit the complete span
-				if p.start > 0 {
-					span := d.buildSpan(p)
-					if span != nil {
-						span.Attributes = d.attributeTransformer(span.Attributes)
-						completeSpans = append(completeSpans, span)
-						// Remove from partials map as it's now complete
-						delete(d.spanPartials, spanID)
+			// SpanEnd received - if we have start time, emit the complete span
+			if p.start > 0 {
+				span := d.buildSpan(p)
+				if span != nil {
+					span.Attributes = d.stampSource(d.transformAttributes(span.Attributes), p.source)
+					// Remove from partials map as it's now complete
+					delete(d.spanPartials, spanID)
+					if duplicate {
+						span = mergeDuplicateSpan(prev, span)
 					}
+					if d.eventSummary {
+						stampEventSummary(span, d.exceptionEventName)
+					}
+					if d.nodeDurationMetrics && !duplicate {
+						if metric := d.nodeDurationMetric(p, span); metric != nil {
+							d.metrics = append(d.metrics, metric)
+						}
+					}
+					if d.decodeLatency != nil {
+						d.decodeLatency.observe(d.Now().Sub(p.readAt))
+					}
+					d.completedSpans.add(spanID, p.uniqueID(), span, d.onDuplicate == OnDuplicateMerge)
+					return span, nil
 				}
 			}
+		}
 
-		case "LogRecord":
-			traceID := stringFrom(obj, "trace_id")
-			spanID := stringFrom(obj, "span_id")
-			if traceID == "" || spanID == "" {
-				continue
-			}
+	case "LogRecord":
+		traceID := stringFrom(obj, "trace_id")
+		spanID := stringFrom(obj, "span_id")
+		if traceID == "" || spanID == "" {
+			return nil, nil
+		}
 
-			logRecord := &logspb.LogRecord{
-				TimeUnixNano:   logTimeNano,
-				TraceId:        decodeHex(traceID),
-				SpanId:         decodeHex(spanID),
-				SeverityNumber: logspb.SeverityNumber(getInt(obj, "severity_number")),
-				SeverityText:   stringFrom(obj, "severity_text"),
-				Attributes:     d.attributeTransformer(extractAttributes(obj, nil)),
-			}
+		logRecord := &logspb.LogRecord{
+			TimeUnixNano:   logTimeNano,
+			TraceId:        d.traceID(traceID),
+			SpanId:         decodeHex(spanID),
+			SeverityNumber: logspb.SeverityNumber(getInt(obj, "severity_number")),
+			SeverityText:   stringFrom(obj, "severity_text"),
+			Attributes:     d.stampSource(d.transformAttributes(extractAttributes(obj, nil)), d.line.source),
+		}
 
-			// Set body from "body" field
-			if body := stringFrom(obj, "body"); body != "" {
-				logRecord.Body = &commonpb.AnyValue{
-					Value: &commonpb.AnyValue_StringValue{StringValue: body},
+		if d.resolveLogSpans && d.spanPartials[spanID] == nil {
+			if _, known := d.completedSpans.get(spanID); !known {
+				attrsObj, _ := obj["attributes"].(map[string]any)
+				if nearest := d.nearestSpan(logRecord.TraceId, stringFrom(attrsObj, "unique_id"), logTimeNano); nearest != "" {
+					logRecord.SpanId = decodeHex(nearest)
 				}
 			}
+		}
+
+		// Set body from "body" field
+		if body := stringFrom(obj, "body"); body != "" {
+			logRecord.Body = &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_StringValue{StringValue: body},
+			}
+		}
+
+		d.elevateSpanStatus(spanID, logRecord)
+
+		return nil, logRecord
 
-			logs = append(logs, logRecord)
+	case "Metric":
+		if metric := d.decodeMetric(obj, logTimeNano); metric != nil {
+			d.metrics = append(d.metrics, metric)
 		}
 	}
+	return nil, nil
+}
 
-	// Sort complete spans by start time for deterministic output
-	sortSpansByStartTime(completeSpans)
+// elevateSpanStatus marks the pending span of a log record as ERROR if the
+// record is at or above the elevate severity threshold.
+func (d *Decoder) elevateSpanStatus(spanID string, log *logspb.LogRecord) {
+	if d.elevateSeverity == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		return
+	}
+	p := d.spanPartials[spanID]
+	if p == nil {
+		return
+	}
+	severity := log.GetSeverityNumber()
+	if severity == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		severity, _ = severityNumber(log.GetSeverityText())
+	}
+	if severity < d.elevateSeverity {
+		return
+	}
+	p.statusCode = tracepb.Status_STATUS_CODE_ERROR
+	if p.statusMessage == "" {
+		p.statusMessage = log.GetBody().GetStringValue()
+	}
+}
 
-	// Sort logs by time for deterministic output
-	sortLogsByTime(logs)
+// nodeDurationMetric returns the dbt.node.duration_ms gauge of a node span,
+// or nil for other spans.
+func (d *Decoder) nodeDurationMetric(p *spanPartial, span *tracepb.Span) *metricspb.Metric {
+	var uniqueID, nodeType *commonpb.KeyValue
+	for _, attr := range p.attrs {
+		switch attr.GetKey() {
+		case "unique_id":
+			uniqueID = attr
+		case "node_type":
+			nodeType = attr
+		case "phase":
+			return nil
+		}
+	}
+	if uniqueID == nil || nodeType == nil || span.EndTimeUnixNano < span.StartTimeUnixNano {
+		return nil
+	}
+	return &metricspb.Metric{
+		Name: "dbt.node.duration_ms",
+		Unit: "ms",
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{
+				StartTimeUnixNano: span.StartTimeUnixNano,
+				TimeUnixNano:      span.EndTimeUnixNano,
+				Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: float64(span.EndTimeUnixNano-span.StartTimeUnixNano) / 1e6},
+				Attributes:        d.transformAttributes([]*commonpb.KeyValue{proto.Clone(uniqueID).(*commonpb.KeyValue), proto.Clone(nodeType).(*commonpb.KeyValue)}),
+			}},
+		}},
+	}
+}
 
-	return completeSpans, logs, nil
+// decodeMetric builds a gauge with a single data point from a Metric record's
+// name, value and unit, or returns nil if the name or a numeric value is
+// missing. Records without a time are stamped with the decoder's clock.
+func (d *Decoder) decodeMetric(obj map[string]any, timeNano uint64) *metricspb.Metric {
+	name := stringFrom(obj, "name")
+	var value float64
+	var ok bool
+	switch v := obj["value"].(type) {
+	case float64:
+		value, ok = v, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		value, ok = parsed, err == nil
+	}
+	if name == "" || !ok {
+		slog.Debug("skipping metric record without a name or numeric value", "name", name)
+		return nil
+	}
+	if timeNano == 0 {
+		timeNano = uint64(d.Now().UnixNano())
+	}
+	return &metricspb.Metric{
+		Name:        name,
+		Description: stringFrom(obj, "description"),
+		Unit:        stringFrom(obj, "unit"),
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{
+				TimeUnixNano: timeNano,
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				Attributes:   d.transformAttributes(extractAttributes(obj, nil)),
+			}},
+		}},
+	}
+}
+
+// fillMissingIDs sets synthesized trace_id and span_id fields on obj where
+// they are missing. The invocation id is remembered from the records that
+// carry it, as node records do not.
+func (d *Decoder) fillMissingIDs(obj map[string]any) {
+	attrsObj, _ := obj["attributes"].(map[string]any)
+	if id := stringFrom(attrsObj, "invocation_id"); id != "" {
+		d.invocationID = id
+	}
+	if stringFrom(obj, "trace_id") != "" && stringFrom(obj, "span_id") != "" {
+		return
+	}
+	uniqueID := stringFrom(attrsObj, "unique_id")
+	phase := stringFrom(attrsObj, "phase")
+	if d.invocationID == "" || (uniqueID == "" && phase == "") {
+		return
+	}
+	if stringFrom(obj, "trace_id") == "" {
+		obj["trace_id"] = synthesizeID(16, d.invocationID)
+	}
+	if stringFrom(obj, "span_id") == "" {
+		obj["span_id"] = synthesizeID(8, d.invocationID, uniqueID, phase)
+	}
+}
+
+// synthesizeID derives a hex encoded id of size bytes from fields. All-zero
+// ids are invalid in OTLP, so that case is mapped to a non-zero id.
+func synthesizeID(size int, fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	id := sum[:size]
+	if slices.Max(id) == 0 {
+		id[size-1] = 1
+	}
+	return hex.EncodeToString(id)
+}
+
+// nearestSpan returns the id of the innermost known span of traceID that runs
+// at timeNano, preferring spans of the node uniqueID, or "" if none does.
+// Open spans are considered running until they end.
+func (d *Decoder) nearestSpan(traceID []byte, uniqueID string, timeNano uint64) string {
+	if timeNano == 0 {
+		return ""
+	}
+	var nearestID string
+	var nearestStart uint64
+	var nearestMatches bool
+	consider := func(spanID, spanUniqueID string, start uint64) {
+		matches := uniqueID != "" && spanUniqueID == uniqueID
+		later := start > nearestStart || start == nearestStart && spanID < nearestID
+		if nearestID == "" || matches && !nearestMatches || matches == nearestMatches && later {
+			nearestID, nearestStart, nearestMatches = spanID, start, matches
+		}
+	}
+	for spanID, p := range d.spanPartials {
+		if p.start > 0 && p.start <= timeNano && slices.Equal(d.traceID(p.traceID), traceID) {
+			consider(spanID, p.uniqueID(), p.start)
+		}
+	}
+	for spanID, entry := range d.completedSpans.spans {
+		if entry.start <= timeNano && timeNano <= entry.end && slices.Equal(entry.traceID, traceID) {
+			consider(spanID, entry.uniqueID, entry.start)
+		}
+	}
+	return nearestID
+}
+
+// mergeDuplicateSpan combines a span emitted before with a new completion of the
+// same span id. Attributes of prev win, events and new links of dup are appended, an error
+// status of either is kept and the span covers both time ranges.
+func mergeDuplicateSpan(prev, dup *tracepb.Span) *tracepb.Span {
+	merged := proto.Clone(prev).(*tracepb.Span)
+	for _, attr := range dup.GetAttributes() {
+		if !hasAttribute(merged.Attributes, attr.GetKey()) {
+			merged.Attributes = append(merged.Attributes, attr)
+		}
+	}
+	merged.Events = append(merged.Events, dup.GetEvents()...)
+	merged.Links = appendLinks(merged.Links, dup.GetLinks())
+	if merged.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR && dup.GetStatus() != nil {
+		merged.Status = dup.GetStatus()
+	}
+	if dup.GetStartTimeUnixNano() < merged.GetStartTimeUnixNano() {
+		merged.StartTimeUnixNano = dup.GetStartTimeUnixNano()
+	}
+	if dup.GetEndTimeUnixNano() > merged.GetEndTimeUnixNano() {
+		merged.EndTimeUnixNano = dup.GetEndTimeUnixNano()
+	}
+	return merged
+}
+
+// stampEventSummary sets dbt.span.event_count and dbt.span.error from the
+// span's events, replacing values stamped before a duplicate merge.
+func stampEventSummary(span *tracepb.Span, exceptionEventName string) {
+	hasException := slices.ContainsFunc(span.GetEvents(), func(event *tracepb.Span_Event) bool {
+		return event.GetName() == exceptionEventName
+	})
+	span.Attributes = slices.DeleteFunc(span.Attributes, func(attr *commonpb.KeyValue) bool {
+		return attr.GetKey() == "dbt.span.event_count" || attr.GetKey() == "dbt.span.error"
+	})
+	span.Attributes = append(span.Attributes,
+		&commonpb.KeyValue{
+			Key:   "dbt.span.event_count",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(len(span.GetEvents()))}},
+		},
+		&commonpb.KeyValue{
+			Key:   "dbt.span.error",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: hasException}},
+		},
+	)
+}
+
+// completedSpans remembers the most recently emitted span ids, evicting the
+// oldest once capacity is reached.
+type completedSpans struct {
+	spans    map[string]completedSpan
+	order    []string
+	next     int
+	capacity int
+}
+
+// completedSpan is what is remembered of an emitted span: a copy for merging
+// if kept, and where and when it ran to correlate logs.
+type completedSpan struct {
+	span     *tracepb.Span
+	traceID  []byte
+	uniqueID string
+	start    uint64
+	end      uint64
+}
+
+func newCompletedSpans(capacity int) *completedSpans {
+	return &completedSpans{
+		spans:    make(map[string]completedSpan, capacity),
+		order:    make([]string, 0, capacity),
+		capacity: capacity,
+	}
+}
+
+func (c *completedSpans) get(spanID string) (*tracepb.Span, bool) {
+	entry, ok := c.spans[spanID]
+	return entry.span, ok
+}
+
+// add records spanID as emitted. With keep a copy of span is kept for merging,
+// as the emitted span is modified by the forwarders.
+func (c *completedSpans) add(spanID, uniqueID string, span *tracepb.Span, keep bool) {
+	entry := completedSpan{
+		traceID:  span.GetTraceId(),
+		uniqueID: uniqueID,
+		start:    span.GetStartTimeUnixNano(),
+		end:      span.GetEndTimeUnixNano(),
+	}
+	if keep {
+		entry.span = proto.Clone(span).(*tracepb.Span)
+	}
+	if _, ok := c.spans[spanID]; ok {
+		c.spans[spanID] = entry
+		return
+	}
+	if len(c.order) < c.capacity {
+		c.order = append(c.order, spanID)
+	} else {
+		delete(c.spans, c.order[c.next])
+		c.order[c.next] = spanID
+		c.next = (c.next + 1) % c.capacity
+	}
+	c.spans[spanID] = entry
+}
+
+// matchInvocation reports whether a record belongs to the current invocation,
+// detecting the invocation start record first if it has not been seen yet.
+func (d *Decoder) matchInvocation(obj map[string]any, recordType string, timeNano uint64) bool {
+	traceID := stringFrom(obj, "trace_id")
+	if d.invocationTraceID != "" {
+		return traceID == d.invocationTraceID
+	}
+	if recordType != "SpanStart" || traceID == "" {
+		return false
+	}
+	attrsObj, _ := obj["attributes"].(map[string]any)
+	if stringFrom(attrsObj, "invocation_id") == "" || !strings.HasSuffix(stringFrom(obj, "event_type"), ".Invocation") {
+		return false
+	}
+	d.invocationTraceID = traceID
+	d.cutoffTimeNano = timeNano
+	return true
+}
+
+// uniqueID returns the unique_id attribute of the span's node, if any.
+func (p *spanPartial) uniqueID() string {
+	for _, attr := range p.attrs {
+		if attr.GetKey() == "unique_id" {
+			return attr.GetValue().GetStringValue()
+		}
+	}
+	return ""
 }
 
 // checkTestFailure checks for test failure in node_test_detail and creates an exception event.
-func (p *spanPartial) checkTestFailure(attrsObj map[string]any) {
+func (p *spanPartial) checkTestFailure(attrsObj map[string]any, eventName string) {
 	testDetail, ok := attrsObj["node_test_detail"].(map[string]any)
 	if !ok {
 		return
@@ -269,7 +1162,7 @@ func (p *spanPartial) checkTestFailure(attrsObj map[string]any) {
 	}
 
 	p.events = append(p.events, &tracepb.Span_Event{
-		Name:         "exception",
+		Name:         eventName,
 		TimeUnixNano: p.end,
 		Attributes:   exceptionAttrs,
 	})
@@ -281,7 +1174,7 @@ func (p *spanPartial) checkTestFailure(attrsObj map[string]any) {
 }
 
 // checkNodeOutcomeFailure checks for node evaluation failure and creates an exception event.
-func (p *spanPartial) checkNodeOutcomeFailure(attrsObj map[string]any) {
+func (p *spanPartial) checkNodeOutcomeFailure(attrsObj map[string]any, eventName string) {
 	nodeOutcome := stringFrom(attrsObj, "node_outcome")
 	if nodeOutcome == "" || slices.Contains(nonErrorOutcomes, nodeOutcome) {
 		return
@@ -330,7 +1223,7 @@ func (p *spanPartial) checkNodeOutcomeFailure(attrsObj map[string]any) {
 	})
 
 	p.events = append(p.events, &tracepb.Span_Event{
-		Name:         "exception",
+		Name:         eventName,
 		TimeUnixNano: p.end,
 		Attributes:   exceptionAttrs,
 	})
@@ -341,6 +1234,53 @@ func (p *spanPartial) checkNodeOutcomeFailure(attrsObj map[string]any) {
 	}
 }
 
+// addExceptionDetails sets exception.stacktrace and exception.type on the
+// exception events created from a record, when the record carries them.
+func (d *Decoder) addExceptionDetails(events []*tracepb.Span_Event, attrsObj map[string]any) {
+	stacktrace := firstString(attrsObj, d.stacktraceFields)
+	exceptionType := firstString(attrsObj, exceptionTypeFields)
+	if stacktrace == "" && exceptionType == "" {
+		return
+	}
+	for _, event := range events {
+		if exceptionType != "" {
+			for _, attr := range event.Attributes {
+				if attr.Key == "exception.type" {
+					attr.Value = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: exceptionType}}
+				}
+			}
+		}
+		if stacktrace != "" {
+			event.Attributes = append(event.Attributes, &commonpb.KeyValue{
+				Key:   "exception.stacktrace",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: stacktrace}},
+			})
+		}
+	}
+}
+
+// firstString returns the first non-empty string field of obj among keys.
+func firstString(obj map[string]any, keys []string) string {
+	for _, key := range keys {
+		if s := stringFrom(obj, key); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// appendStatusAttributes adds the status fields beyond code and message, such
+// as an error category, as dbt.status.<field> attributes.
+func appendStatusAttributes(attrs []*commonpb.KeyValue, statusObj map[string]any) []*commonpb.KeyValue {
+	for _, key := range slices.Sorted(maps.Keys(statusObj)) {
+		if key == "code" || key == "message" {
+			continue
+		}
+		attrs = append(attrs, jsonValueToKeyValue("dbt.status."+key, statusObj[key]))
+	}
+	return attrs
+}
+
 // buildSpan converts a spanPartial to a complete OTLP Span
 func (d *Decoder) buildSpan(p *spanPartial) *tracepb.Span {
 	if p.start == 0 {
@@ -349,22 +1289,33 @@ func (d *Decoder) buildSpan(p *spanPartial) *tracepb.Span {
 
 	span := &tracepb.Span{
 		Name:              p.name,
-		TraceId:           decodeHex(p.traceID),
+		TraceId:           d.traceID(p.traceID),
 		SpanId:            decodeHex(p.spanID),
 		ParentSpanId:      decodeHex(p.parent),
+		Kind:              p.kind,
 		StartTimeUnixNano: p.start,
 		EndTimeUnixNano:   p.end,
 		Attributes:        deduplicateAttributes(p.attrs),
 		Events:            p.events,
+		Links:             p.links,
+	}
+
+	if len(span.ParentSpanId) == 0 && d.parentSpanID != nil {
+		span.ParentSpanId = slices.Clone(d.parentSpanID)
 	}
 
+	if span.EndTimeUnixNano == 0 && p.elapsed > 0 {
+		span.EndTimeUnixNano = span.StartTimeUnixNano + uint64(p.elapsed)
+	}
 	// If end time is not set, use start time
 	if span.EndTimeUnixNano == 0 {
 		span.EndTimeUnixNano = span.StartTimeUnixNano
 	}
 
 	// Set status if provided
-	if p.statusCode != tracepb.Status_STATUS_CODE_UNSET {
+	if p.statusCode == tracepb.Status_STATUS_CODE_UNSET && p.succeeded && d.explicitOKStatus {
+		span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK}
+	} else if p.statusCode != tracepb.Status_STATUS_CODE_UNSET {
 		span.Status = &tracepb.Status{
 			Code:    p.statusCode,
 			Message: p.statusMessage,
@@ -374,42 +1325,32 @@ func (d *Decoder) buildSpan(p *spanPartial) *tracepb.Span {
 	return span
 }
 
+// traceID decodes a record's trace id, replaced by the parent context's if set.
+func (d *Decoder) traceID(s string) []byte {
+	if d.parentTraceID != nil {
+		return slices.Clone(d.parentTraceID)
+	}
+	return decodeHex(s)
+}
+
 // sortSpansByStartTime sorts spans by their start time (ascending), then by span_id for determinism
 func sortSpansByStartTime(spans []*tracepb.Span) {
-	// Simple bubble sort (good enough for moderate sized arrays)
-	n := len(spans)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			// Sort by start time first
-			if spans[j].StartTimeUnixNano > spans[j+1].StartTimeUnixNano {
-				spans[j], spans[j+1] = spans[j+1], spans[j]
-			} else if spans[j].StartTimeUnixNano == spans[j+1].StartTimeUnixNano {
-				// If start time is equal, sort by span_id for deterministic output
-				if compareBytes(spans[j].SpanId, spans[j+1].SpanId) > 0 {
-					spans[j], spans[j+1] = spans[j+1], spans[j]
-				}
-			}
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].StartTimeUnixNano != spans[j].StartTimeUnixNano {
+			return spans[i].StartTimeUnixNano < spans[j].StartTimeUnixNano
 		}
-	}
+		return compareBytes(spans[i].SpanId, spans[j].SpanId) < 0
+	})
 }
 
 // sortLogsByTime sorts logs by their time (ascending), then by span_id for determinism
 func sortLogsByTime(logs []*logspb.LogRecord) {
-	// Simple bubble sort (good enough for moderate sized arrays)
-	n := len(logs)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			// Sort by time first
-			if logs[j].TimeUnixNano > logs[j+1].TimeUnixNano {
-				logs[j], logs[j+1] = logs[j+1], logs[j]
-			} else if logs[j].TimeUnixNano == logs[j+1].TimeUnixNano {
-				// If time is equal, sort by span_id for deterministic output
-				if compareBytes(logs[j].SpanId, logs[j+1].SpanId) > 0 {
-					logs[j], logs[j+1] = logs[j+1], logs[j]
-				}
-			}
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].TimeUnixNano != logs[j].TimeUnixNano {
+			return logs[i].TimeUnixNano < logs[j].TimeUnixNano
 		}
-	}
+		return compareBytes(logs[i].SpanId, logs[j].SpanId) < 0
+	})
 }
 
 // compareBytes compares two byte slices lexicographically
@@ -480,6 +1421,29 @@ func decodeHex(s string) []byte {
 	return b
 }
 
+// extractSpanKind reads an explicit span kind from the kind or span_kind field.
+// Names are accepted with or without the SPAN_KIND_ prefix (e.g. "CLIENT",
+// "SPAN_KIND_CLIENT"), as are the OTLP enum numbers.
+func extractSpanKind(obj map[string]any) (tracepb.Span_SpanKind, bool) {
+	for _, key := range []string{"kind", "span_kind"} {
+		switch v := obj[key].(type) {
+		case string:
+			name := strings.ToUpper(strings.TrimSpace(v))
+			if !strings.HasPrefix(name, "SPAN_KIND_") {
+				name = "SPAN_KIND_" + name
+			}
+			if kind, ok := tracepb.Span_SpanKind_value[name]; ok {
+				return tracepb.Span_SpanKind(kind), true
+			}
+		case float64:
+			if _, ok := tracepb.Span_SpanKind_name[int32(v)]; ok && v == float64(int32(v)) {
+				return tracepb.Span_SpanKind(v), true
+			}
+		}
+	}
+	return tracepb.Span_SPAN_KIND_UNSPECIFIED, false
+}
+
 func stringFrom(obj map[string]any, key string) string {
 	if obj == nil {
 		return ""
@@ -494,12 +1458,20 @@ func stringFrom(obj map[string]any, key string) string {
 
 func parseNano(val string, fallback uint64) uint64 {
 	// val may be quoted integer or decimal string; fallback to provided.
-	var n uint64
-	_, err := fmt.Sscan(val, &n)
+	if n, ok := parseNanoOK(val); ok {
+		return n
+	}
+	return fallback
+}
+
+// parseNanoOK requires the whole value to be an integer, so e.g. an RFC3339
+// string is rejected rather than read as its leading year digits.
+func parseNanoOK(val string) (uint64, bool) {
+	n, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
 	if err != nil {
-		return fallback
+		return 0, false
 	}
-	return n
+	return n, true
 }
 
 func convertAttributesFromMap(obj map[string]any) []*commonpb.KeyValue {
@@ -539,9 +1511,47 @@ func extractAttributes(obj map[string]any, attrs []*commonpb.KeyValue) []*common
 		})
 	}
 
+	// Promote the thread that processed the record to "thread" (dbt.thread
+	// after transformation) to allow analyzing parallelism.
+	if thread := extractThread(obj); thread != "" && !hasAttribute(attrs, "thread") {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key: "thread",
+			Value: &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_StringValue{StringValue: thread},
+			},
+		})
+	}
+
 	return attrs
 }
 
+// extractThread looks for a thread id on the record itself, then in its attributes.
+func extractThread(obj map[string]any) string {
+	attrsObj, _ := obj["attributes"].(map[string]any)
+	for _, src := range []map[string]any{obj, attrsObj} {
+		for _, key := range []string{"thread_id", "thread"} {
+			switch v := src[key].(type) {
+			case string:
+				if v != "" {
+					return v
+				}
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+	return ""
+}
+
+func hasAttribute(attrs []*commonpb.KeyValue, key string) bool {
+	for _, attr := range attrs {
+		if attr.GetKey() == key {
+			return true
+		}
+	}
+	return false
+}
+
 // extractEvents extracts span events from the JSON object
 func extractEvents(obj map[string]any) []*tracepb.Span_Event {
 	if obj == nil {
@@ -580,6 +1590,98 @@ func extractEvents(obj map[string]any) []*tracepb.Span_Event {
 	return events
 }
 
+// elapsed reads the elapsed field of a record, at the top level or among its
+// attributes, as a number or a numeric string in the decoder's elapsed unit.
+func (d *Decoder) elapsed(obj map[string]any) (time.Duration, bool) {
+	raw, ok := obj["elapsed"]
+	if !ok {
+		attrs, _ := obj["attributes"].(map[string]any)
+		if raw, ok = attrs["elapsed"]; !ok {
+			return 0, false
+		}
+	}
+	var v float64
+	switch x := raw.(type) {
+	case float64:
+		v = x
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return 0, false
+		}
+		v = f
+	default:
+		return 0, false
+	}
+	if !(v > 0) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	unit := d.elapsedUnit
+	if unit == ElapsedUnitAuto {
+		unit = ElapsedUnitNanoseconds
+		if v < elapsedAutoSecondsBelow {
+			unit = ElapsedUnitSeconds
+		}
+	}
+	switch unit {
+	case ElapsedUnitSeconds:
+		v *= float64(time.Second)
+	case ElapsedUnitMilliseconds:
+		v *= float64(time.Millisecond)
+	}
+	if v >= math.MaxInt64 {
+		return 0, false
+	}
+	return time.Duration(v), true
+}
+
+// extractLinks extracts span links from the JSON object. Links without a
+// valid hex trace_id and span_id are skipped.
+func extractLinks(obj map[string]any) []*tracepb.Span_Link {
+	linksArray, ok := obj["links"].([]any)
+	if !ok {
+		return nil
+	}
+
+	links := make([]*tracepb.Span_Link, 0, len(linksArray))
+	for _, linkItem := range linksArray {
+		linkObj, ok := linkItem.(map[string]any)
+		if !ok {
+			continue
+		}
+		traceID := decodeHex(stringFrom(linkObj, "trace_id"))
+		spanID := decodeHex(stringFrom(linkObj, "span_id"))
+		if len(traceID) != 16 || len(spanID) != 8 {
+			slog.Debug("skipping span link without a valid trace_id and span_id", "trace_id", linkObj["trace_id"], "span_id", linkObj["span_id"])
+			continue
+		}
+		link := &tracepb.Span_Link{
+			TraceId:    traceID,
+			SpanId:     spanID,
+			TraceState: stringFrom(linkObj, "trace_state"),
+		}
+		if attrsObj, ok := linkObj["attributes"].(map[string]any); ok {
+			link.Attributes = convertAttributesFromMap(attrsObj)
+		}
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// appendLinks appends the links to spans not linked yet, so that a link
+// repeated on SpanStart and SpanEnd is kept once.
+func appendLinks(links, more []*tracepb.Span_Link) []*tracepb.Span_Link {
+	for _, link := range more {
+		if !slices.ContainsFunc(links, func(l *tracepb.Span_Link) bool {
+			return bytes.Equal(l.GetTraceId(), link.GetTraceId()) && bytes.Equal(l.GetSpanId(), link.GetSpanId())
+		}) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
 // jsonValueToKeyValue converts a JSON value to an OTEL KeyValue
 func jsonValueToKeyValue(key string, value any) *commonpb.KeyValue {
 	kv := &commonpb.KeyValue{Key: key}
@@ -610,6 +1712,9 @@ func jsonValueToKeyValue(key string, value any) *commonpb.KeyValue {
 		kv.Value = &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{
 			KvlistValue: &commonpb.KeyValueList{Values: kvList},
 		}}
+	case nil:
+		// An empty AnyValue is the OTLP representation of null
+		kv.Value = &commonpb.AnyValue{}
 	case []any:
 		// Convert array to ArrayValue
 		var arrayValues []*commonpb.AnyValue
@@ -627,6 +1732,43 @@ func jsonValueToKeyValue(key string, value any) *commonpb.KeyValue {
 	return kv
 }
 
+// hintNumber converts value to the type named by hint, NumberHintInt or
+// NumberHintDouble. Strings are parsed; doubles only become ints when they
+// are whole numbers. Other values are returned unchanged.
+func hintNumber(value *commonpb.AnyValue, hint string) *commonpb.AnyValue {
+	var f float64
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_IntValue:
+		if hint == NumberHintInt {
+			return value
+		}
+		f = float64(v.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		f = v.DoubleValue
+	case *commonpb.AnyValue_StringValue:
+		s := strings.TrimSpace(v.StringValue)
+		if hint == NumberHintInt {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+			}
+		}
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return value
+		}
+		f = parsed
+	default:
+		return value
+	}
+	if hint == NumberHintDouble {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+	}
+	if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return value
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(f)}}
+}
+
 // sortStrings sorts strings in place (simple bubble sort)
 func sortStrings(strs []string) {
 	n := len(strs)
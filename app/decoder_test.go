@@ -5,13 +5,22 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sebdah/goldie/v2"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestDecodeOTELLines_FailedSpans(t *testing.T) {
@@ -349,3 +358,1407 @@ func serializeLogsToJSONL(t *testing.T, logs []*logspb.LogRecord) []byte {
 	}
 	return result
 }
+
+func TestDecodeLines_MalformedTimestamps(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000004","span_id":"0000000000000004","span_name":"bad start","start_time_unix_nano":"2025-01-01T00:00:00Z"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000004","span_id":"0000000000000004","end_time_unix_nano":"2000000000"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000004","span_id":"0000000000000005","span_name":"bad end","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000004","span_id":"0000000000000005","end_time_unix_nano":"not-a-number"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000004","span_id":"0000000000000006","span_name":"good","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000004","span_id":"0000000000000006","end_time_unix_nano":"2000000000"}`,
+	}
+
+	t.Run("lenient falls back", func(t *testing.T) {
+		before := uint64(time.Now().UnixNano())
+		spans, _, err := NewDecoder(0).DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) != 3 {
+			t.Fatalf("expected 3 spans, got %d", len(spans))
+		}
+		byName := make(map[string]*tracepb.Span)
+		for _, span := range spans {
+			byName[span.Name] = span
+		}
+		if got := byName["bad start"].StartTimeUnixNano; got < before {
+			t.Errorf("expected bad start to fall back to now, got %d", got)
+		}
+		if got := byName["bad end"]; got.EndTimeUnixNano != got.StartTimeUnixNano {
+			t.Errorf("expected bad end to fall back to start time, got start=%d end=%d", got.StartTimeUnixNano, got.EndTimeUnixNano)
+		}
+	})
+
+	t.Run("lenient falls back to the clock", func(t *testing.T) {
+		decoder := NewDecoder(0)
+		decoder.Now = func() time.Time { return time.Unix(1700000000, 0) }
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		for _, span := range spans {
+			if span.Name == "bad start" && span.StartTimeUnixNano != 1700000000000000000 {
+				t.Errorf("expected bad start to fall back to the fixed clock, got %d", span.StartTimeUnixNano)
+			}
+		}
+	})
+
+	t.Run("strict skips", func(t *testing.T) {
+		decoder := NewDecoder(0)
+		decoder.StrictTimestamps(true)
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+		if spans[0].Name != "good" {
+			t.Errorf("expected only the well-formed span, got %q", spans[0].Name)
+		}
+		if len(decoder.spanPartials) != 0 {
+			t.Errorf("expected skipped spans to be discarded, got %d partials", len(decoder.spanPartials))
+		}
+	})
+}
+
+func TestDecodeLines_ExplicitOKStatus(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000007","span_id":"0000000000000007","span_name":"Node evaluated (ok_model)","start_time_unix_nano":"1000000000","attributes":{"name":"ok_model","unique_id":"model.test.ok_model"}}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000007","span_id":"0000000000000007","end_time_unix_nano":"2000000000","attributes":{"name":"ok_model","unique_id":"model.test.ok_model","node_outcome":"NODE_OUTCOME_SUCCESS"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000007","span_id":"0000000000000008","span_name":"Node evaluated (skipped_model)","start_time_unix_nano":"1000000000","attributes":{"name":"skipped_model"}}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000007","span_id":"0000000000000008","end_time_unix_nano":"2000000000","attributes":{"name":"skipped_model","node_outcome":"NODE_OUTCOME_SKIPPED"}}`,
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		spans, _, err := NewDecoder(0).DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		for _, span := range spans {
+			if span.Status != nil {
+				t.Errorf("expected no status on %q, got %v", span.Name, span.Status)
+			}
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		decoder := NewDecoder(0)
+		decoder.ExplicitOKStatus(true)
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %d", len(spans))
+		}
+		for _, span := range spans {
+			switch span.Name {
+			case "Node evaluated (ok_model)":
+				if span.Status.GetCode() != tracepb.Status_STATUS_CODE_OK {
+					t.Errorf("expected OK status for success outcome, got %v", span.Status)
+				}
+			case "Node evaluated (skipped_model)":
+				if span.Status != nil {
+					t.Errorf("expected no status for skipped outcome, got %v", span.Status)
+				}
+			}
+		}
+	})
+}
+
+func TestDecodeLines_InvocationCutoff(t *testing.T) {
+	invocation := func(traceID, spanID, invocationID, start string) string {
+		return `{"record_type":"SpanStart","trace_id":"` + traceID + `","span_id":"` + spanID + `","span_name":"dbt invocation (` + invocationID + `)","start_time_unix_nano":"` + start + `","event_type":"v1.public.events.fusion.invocation.Invocation","attributes":{"invocation_id":"` + invocationID + `"}}`
+	}
+	span := func(traceID, spanID, name, start, end string) []string {
+		return []string{
+			`{"record_type":"SpanStart","trace_id":"` + traceID + `","span_id":"` + spanID + `","span_name":"` + name + `","start_time_unix_nano":"` + start + `","attributes":{}}`,
+			`{"record_type":"SpanEnd","trace_id":"` + traceID + `","span_id":"` + spanID + `","end_time_unix_nano":"` + end + `","attributes":{}}`,
+		}
+	}
+	const prior = "0000000000000000000000000000000a"
+	const current = "0000000000000000000000000000000b"
+	// The wrapper starts at 4s, while the prior invocation is still writing records.
+	const processStart = 4000000000
+	var lines []string
+	lines = append(lines, invocation(prior, "00000000000000a1", "prior-id", "1000000000"))
+	lines = append(lines, span(prior, "00000000000000a2", "prior model", "1100000000", "1200000000")...)
+	lines = append(lines, span(prior, "00000000000000a3", "prior tail model", "4100000000", "4200000000")...)
+	lines = append(lines, `{"record_type":"SpanEnd","trace_id":"`+prior+`","span_id":"00000000000000a1","end_time_unix_nano":"4300000000","attributes":{}}`)
+	lines = append(lines, invocation(current, "00000000000000b1", "current-id", "5000000000"))
+	lines = append(lines, span(current, "00000000000000b2", "current model", "5100000000", "5200000000")...)
+	// A record of another invocation interleaved with the current one.
+	lines = append(lines, span(prior, "00000000000000a4", "late prior model", "5300000000", "5400000000")...)
+	lines = append(lines, `{"record_type":"SpanEnd","trace_id":"`+current+`","span_id":"00000000000000b1","end_time_unix_nano":"5500000000","attributes":{}}`)
+
+	names := func(spans []*tracepb.Span) []string {
+		var out []string
+		for _, s := range spans {
+			out = append(out, s.Name)
+		}
+		return out
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		spans, _, err := NewDecoder(processStart).DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if got := names(spans); len(got) != 4 {
+			t.Fatalf("expected prior records after process start to be included, got %v", got)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		decoder := NewDecoder(processStart)
+		decoder.InvocationCutoff(true)
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		got := names(spans)
+		if len(got) != 2 || got[0] != "dbt invocation (current-id)" || got[1] != "current model" {
+			t.Fatalf("expected only the current invocation spans, got %v", got)
+		}
+	})
+}
+
+func TestDecodeLines_CommentPrefix(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel.jsonl")
+	var commented []string
+	for i, line := range lines {
+		if i%10 == 0 {
+			commented = append(commented, "# injected by tooling", "  #indented comment")
+		}
+		commented = append(commented, line)
+	}
+
+	var logBuf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	decoder := NewDecoder(0)
+	decoder.CommentPrefix("#")
+	spans, logs, err := decoder.DecodeLines(commented)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	g := goldie.New(t,
+		goldie.WithFixtureDir("testdata"),
+		goldie.WithNameSuffix(".golden.jsonl"),
+	)
+	g.Assert(t, "decode_without_cutoff.spans", serializeSpansToJSONL(t, spans))
+	g.Assert(t, "decode_without_cutoff.logs", serializeLogsToJSONL(t, logs))
+	if strings.Contains(logBuf.String(), "unparseable") {
+		t.Errorf("comment lines should not be reported as unparseable:\n%s", logBuf.String())
+	}
+
+	logBuf.Reset()
+	if _, _, err := NewDecoder(0).DecodeLines([]string{"# not skipped without a prefix"}); err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if !strings.Contains(logBuf.String(), "unparseable") {
+		t.Errorf("expected comment line to be reported as unparseable without a prefix")
+	}
+}
+
+func TestDecodeLines_Links(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_links.jsonl")
+	spans, _, err := NewDecoder(0).DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	// Invalid link entries are skipped and a link repeated on SpanEnd is kept once.
+	if got := len(spans[0].Links); got != 2 {
+		t.Errorf("expected 2 links on the first span, got %d", got)
+	}
+	if got := len(spans[1].Links); got != 0 {
+		t.Errorf("expected no links when links is not a list, got %d", got)
+	}
+	g := goldie.New(t,
+		goldie.WithFixtureDir("testdata"),
+		goldie.WithNameSuffix(".golden.jsonl"),
+	)
+	g.Assert(t, "decode_links.spans", serializeSpansToJSONL(t, spans))
+}
+
+func TestDecodeLines_StatusAttributes(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_status.jsonl")
+	spans, _, err := NewDecoder(0).DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	statusAttrs := func(span *tracepb.Span) map[string]any {
+		attrs := make(map[string]any)
+		for key, value := range convertAttributesToMap(span.Attributes) {
+			if strings.HasPrefix(key, "dbt.status.") {
+				attrs[key] = value
+			}
+		}
+		return attrs
+	}
+
+	orders := spans[0]
+	if orders.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || orders.Status.GetMessage() != `column "amount" does not exist` {
+		t.Errorf("expected the ERROR status with its message, got %v", orders.Status)
+	}
+	want := map[string]any{
+		"dbt.status.category":  "database",
+		"dbt.status.retryable": false,
+		"dbt.status.details":   map[string]any{"sql_state": "42703"},
+	}
+	if got := statusAttrs(orders); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected status attributes %v, got %v", want, got)
+	}
+
+	customers := spans[1]
+	if customers.Status.GetCode() != tracepb.Status_STATUS_CODE_OK {
+		t.Errorf("expected the OK status, got %v", customers.Status)
+	}
+	if got := statusAttrs(customers); len(got) != 0 {
+		t.Errorf("expected no status attributes for a plain status, got %v", got)
+	}
+}
+
+func TestDecodeLines_ThreadAttribute(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_threads.jsonl")
+	spans, logs, err := NewDecoder(0).DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	threadOf := func(attrs []*commonpb.KeyValue) []string {
+		var values []string
+		for _, attr := range attrs {
+			if attr.Key == "dbt.thread" {
+				values = append(values, attr.GetValue().GetStringValue())
+			}
+		}
+		return values
+	}
+
+	want := map[string]string{
+		"Node evaluated (model_a)": "Thread-1",
+		"Node evaluated (model_b)": "2",
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("expected %d spans, got %d", len(want), len(spans))
+	}
+	for _, span := range spans {
+		got := threadOf(span.Attributes)
+		if len(got) != 1 || got[0] != want[span.Name] {
+			t.Errorf("span %q: expected dbt.thread %q once, got %v", span.Name, want[span.Name], got)
+		}
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	if got := threadOf(logs[0].Attributes); len(got) != 1 || got[0] != "Thread-1" {
+		t.Errorf("log: expected dbt.thread Thread-1, got %v", got)
+	}
+}
+
+func TestDecodeLines_SpanKind(t *testing.T) {
+	spanLines := func(kindField string) []string {
+		return []string{
+			`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000009","span_id":"0000000000000009","span_name":"span","start_time_unix_nano":"1000000000"` + kindField + `}`,
+			`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000009","span_id":"0000000000000009","end_time_unix_nano":"2000000000"}`,
+		}
+	}
+	cases := []struct {
+		name      string
+		kindField string
+		expected  tracepb.Span_SpanKind
+	}{
+		{name: "absent", kindField: ``, expected: tracepb.Span_SPAN_KIND_UNSPECIFIED},
+		{name: "short name", kindField: `,"kind":"client"`, expected: tracepb.Span_SPAN_KIND_CLIENT},
+		{name: "enum name", kindField: `,"span_kind":"SPAN_KIND_SERVER"`, expected: tracepb.Span_SPAN_KIND_SERVER},
+		{name: "enum number", kindField: `,"kind":1`, expected: tracepb.Span_SPAN_KIND_INTERNAL},
+		{name: "unknown name", kindField: `,"kind":"sideways"`, expected: tracepb.Span_SPAN_KIND_UNSPECIFIED},
+		{name: "out of range number", kindField: `,"span_kind":42`, expected: tracepb.Span_SPAN_KIND_UNSPECIFIED},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spans, _, err := NewDecoder(0).DecodeLines(spanLines(tc.kindField))
+			if err != nil {
+				t.Fatalf("DecodeLines failed: %v", err)
+			}
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			if spans[0].Kind != tc.expected {
+				t.Errorf("expected kind %v, got %v", tc.expected, spans[0].Kind)
+			}
+		})
+	}
+
+	t.Run("kind on SpanEnd", func(t *testing.T) {
+		spans, _, err := NewDecoder(0).DecodeLines([]string{
+			`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000009","span_id":"0000000000000001","span_name":"query","start_time_unix_nano":"1000000000"}`,
+			`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000009","span_id":"0000000000000001","end_time_unix_nano":"2000000000","kind":"CLIENT"}`,
+		})
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) != 1 || spans[0].Kind != tracepb.Span_SPAN_KIND_CLIENT {
+			t.Errorf("expected one CLIENT span, got %v", spans)
+		}
+	})
+}
+
+func TestDecodeLines_NullAttribute(t *testing.T) {
+	spans, _, err := NewDecoder(0).DecodeLines([]string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000009","span_id":"0000000000000001","span_name":"span","start_time_unix_nano":"1000000000","attributes":{"materialized":null}}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000009","span_id":"0000000000000001","end_time_unix_nano":"2000000000"}`,
+	})
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	for _, attr := range spans[0].Attributes {
+		if attr.Key == "dbt.materialized" {
+			if attr.Value == nil || attr.Value.Value != nil {
+				t.Errorf("expected null to decode to an empty AnyValue, got %v", attr.Value)
+			}
+			return
+		}
+	}
+	t.Errorf("expected dbt.materialized attribute, got %v", spans[0].Attributes)
+}
+
+func TestDecodeLines_ForwarderVersion(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_threads.jsonl")
+	versionOf := func(attrs []*commonpb.KeyValue) (string, bool) {
+		for _, attr := range attrs {
+			if attr.Key == "dbt.forwarder.version" {
+				return attr.GetValue().GetStringValue(), true
+			}
+		}
+		return "", false
+	}
+
+	for _, enabled := range []bool{false, true} {
+		decoder := NewDecoder(0)
+		decoder.ForwarderVersion(enabled)
+		spans, logs, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) == 0 || len(logs) == 0 {
+			t.Fatalf("expected spans and logs, got %d spans and %d logs", len(spans), len(logs))
+		}
+		attrSets := make([][]*commonpb.KeyValue, 0, len(spans)+len(logs))
+		for _, span := range spans {
+			attrSets = append(attrSets, span.Attributes)
+		}
+		for _, log := range logs {
+			attrSets = append(attrSets, log.Attributes)
+		}
+		for _, attrs := range attrSets {
+			version, ok := versionOf(attrs)
+			if ok != enabled {
+				t.Errorf("enabled=%v: expected dbt.forwarder.version present=%v, got %v", enabled, enabled, ok)
+			}
+			if enabled && version != Version {
+				t.Errorf("expected dbt.forwarder.version %q, got %q", Version, version)
+			}
+		}
+	}
+}
+
+func TestDecodeLines_SynthesizeIDs(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"0102030405060708090a0b0c0d0e0f10","span_id":"1112131415161718","span_name":"invocation","start_time_unix_nano":"100","event_type":"v1.public.events.fusion.invocation.Invocation","attributes":{"invocation_id":"inv-1"}}`,
+		`{"record_type":"SpanStart","span_name":"Node","start_time_unix_nano":"200","attributes":{"unique_id":"model.a","phase":"EXECUTION_PHASE_RUN"}}`,
+		`{"record_type":"LogRecord","time_unix_nano":"250","severity_text":"INFO","body":"running","attributes":{"unique_id":"model.a","phase":"EXECUTION_PHASE_RUN"}}`,
+		`{"record_type":"SpanEnd","end_time_unix_nano":"300","attributes":{"unique_id":"model.a","phase":"EXECUTION_PHASE_RUN"}}`,
+		`{"record_type":"LogRecord","time_unix_nano":"260","severity_text":"INFO","body":"no stable fields"}`,
+		`{"record_type":"SpanEnd","trace_id":"0102030405060708090a0b0c0d0e0f10","span_id":"1112131415161718","end_time_unix_nano":"400"}`,
+	}
+	decode := func(synthesize bool) ([]*tracepb.Span, []*logspb.LogRecord) {
+		decoder := NewDecoder(0)
+		decoder.SynthesizeIDs(synthesize)
+		spans, logs, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		return spans, logs
+	}
+
+	spans, logs := decode(false)
+	if len(spans) != 1 || len(logs) != 0 {
+		t.Fatalf("disabled: expected only the span with ids, got %d spans and %d logs", len(spans), len(logs))
+	}
+
+	spans, logs = decode(true)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log (records without unique_id or phase are skipped), got %d", len(logs))
+	}
+	node := spans[1]
+	if node.Name != "Node" {
+		t.Fatalf("expected the Node span second, got %q", node.Name)
+	}
+	if len(node.TraceId) != 16 || bytes.Equal(node.TraceId, make([]byte, 16)) {
+		t.Errorf("expected a valid 16 byte trace id, got %x", node.TraceId)
+	}
+	if len(node.SpanId) != 8 || bytes.Equal(node.SpanId, make([]byte, 8)) {
+		t.Errorf("expected a valid 8 byte span id, got %x", node.SpanId)
+	}
+	if node.EndTimeUnixNano != 300 {
+		t.Errorf("expected SpanStart and SpanEnd to get the same span id, end time %d", node.EndTimeUnixNano)
+	}
+	if !bytes.Equal(logs[0].TraceId, node.TraceId) || !bytes.Equal(logs[0].SpanId, node.SpanId) {
+		t.Errorf("expected the log to link to its node span, got trace %x span %x", logs[0].TraceId, logs[0].SpanId)
+	}
+
+	again, _ := decode(true)
+	if !bytes.Equal(again[1].TraceId, node.TraceId) || !bytes.Equal(again[1].SpanId, node.SpanId) {
+		t.Errorf("expected ids to be stable across runs")
+	}
+}
+
+func TestSynthesizeID(t *testing.T) {
+	id := synthesizeID(8, "inv-1", "model.a", "EXECUTION_PHASE_RUN")
+	if len(id) != 16 {
+		t.Errorf("expected 16 hex chars, got %q", id)
+	}
+	if id != synthesizeID(8, "inv-1", "model.a", "EXECUTION_PHASE_RUN") {
+		t.Errorf("expected the same fields to give the same id")
+	}
+	if id == synthesizeID(8, "inv-1", "model.a", "EXECUTION_PHASE_RENDER") {
+		t.Errorf("expected a different phase to give a different id")
+	}
+	if synthesizeID(8, "ab", "c") == synthesizeID(8, "a", "bc") {
+		t.Errorf("expected fields to be separated")
+	}
+	if got := synthesizeID(16, "inv-1"); len(got) != 32 {
+		t.Errorf("expected 32 hex chars, got %q", got)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	cases := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{value: " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 "},
+		{value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01", wantErr: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", wantErr: true},
+		{value: "garbage", wantErr: true},
+	}
+	for _, tc := range cases {
+		traceID, spanID, err := ParseTraceParent(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.value, err)
+			continue
+		}
+		if got := hex.EncodeToString(traceID); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%q: unexpected trace id %s", tc.value, got)
+		}
+		if got := hex.EncodeToString(spanID); got != "00f067aa0ba902b7" {
+			t.Errorf("%q: unexpected span id %s", tc.value, got)
+		}
+	}
+}
+
+func TestDecodeLines_ParentContext(t *testing.T) {
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	traceID, spanID, err := ParseTraceParent(os.Getenv("TRACEPARENT"))
+	if err != nil {
+		t.Fatalf("ParseTraceParent failed: %v", err)
+	}
+
+	decoder := NewDecoder(0)
+	decoder.ParentContext(traceID, spanID)
+	spans, logs, err := decoder.DecodeLines(readTestdataLines(t, "testdata/otel.jsonl"))
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) == 0 || len(logs) == 0 {
+		t.Fatalf("expected spans and logs, got %d spans and %d logs", len(spans), len(logs))
+	}
+
+	roots := 0
+	for _, span := range spans {
+		if !bytes.Equal(span.TraceId, traceID) {
+			t.Errorf("span %q: expected trace id %x, got %x", span.Name, traceID, span.TraceId)
+		}
+		if bytes.Equal(span.ParentSpanId, spanID) {
+			roots++
+		} else if len(span.ParentSpanId) != 8 {
+			t.Errorf("span %q: expected a parent span id, got %x", span.Name, span.ParentSpanId)
+		}
+	}
+	if roots == 0 {
+		t.Errorf("expected root spans to be re-parented under %x", spanID)
+	}
+	for _, log := range logs {
+		if !bytes.Equal(log.TraceId, traceID) {
+			t.Errorf("expected log trace id %x, got %x", traceID, log.TraceId)
+		}
+	}
+
+	plain, _, err := NewDecoder(0).DecodeLines(readTestdataLines(t, "testdata/otel.jsonl"))
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	for i, span := range plain {
+		if len(span.ParentSpanId) == 0 {
+			if !bytes.Equal(spans[i].ParentSpanId, spanID) {
+				t.Errorf("root span %q: expected parent %x, got %x", span.Name, spanID, spans[i].ParentSpanId)
+			}
+		} else if !bytes.Equal(spans[i].ParentSpanId, span.ParentSpanId) {
+			t.Errorf("span %q: expected the parent to be kept", span.Name)
+		}
+	}
+}
+
+func TestDecodeLines_DuplicateSpan(t *testing.T) {
+	start := `{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"node","start_time_unix_nano":"100","attributes":{"unique_id":"model.a"}}`
+	end := `{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"200","attributes":{"node_outcome":"NODE_OUTCOME_SUCCESS"}}`
+	failedEnd := `{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"300","attributes":{"node_outcome":"NODE_OUTCOME_ERROR","rows":3}}`
+
+	cases := []struct {
+		name  string
+		mode  string
+		lines []string
+		spans int
+	}{
+		{name: "duplicated SpanEnd is dropped", mode: OnDuplicateDrop, lines: []string{start, end, end}, spans: 1},
+		{name: "replayed span is dropped", mode: OnDuplicateDrop, lines: []string{start, end, start, end}, spans: 1},
+		{name: "unknown mode drops", mode: "bogus", lines: []string{start, end, failedEnd}, spans: 1},
+		{name: "duplicated SpanEnd is merged", mode: OnDuplicateMerge, lines: []string{start, end, failedEnd}, spans: 2},
+	}
+	for _, tc := range cases {
+		decoder := NewDecoder(0)
+		decoder.OnDuplicate(tc.mode)
+		spans, _, err := decoder.DecodeLines(tc.lines)
+		if err != nil {
+			t.Fatalf("%s: DecodeLines failed: %v", tc.name, err)
+		}
+		if len(spans) != tc.spans {
+			t.Errorf("%s: expected %d spans, got %d", tc.name, tc.spans, len(spans))
+		}
+	}
+
+	decoder := NewDecoder(0)
+	decoder.OnDuplicate(OnDuplicateMerge)
+	first, _ := decoder.DecodeLine(start)
+	if first != nil {
+		t.Fatalf("expected no span on SpanStart")
+	}
+	first, _ = decoder.DecodeLine(end)
+	merged, _ := decoder.DecodeLine(failedEnd)
+	if first == nil || merged == nil {
+		t.Fatalf("expected the span and its merged duplicate, got %v and %v", first, merged)
+	}
+	if merged.StartTimeUnixNano != 100 || merged.EndTimeUnixNano != 300 {
+		t.Errorf("expected the merged span to cover 100-300, got %d-%d", merged.StartTimeUnixNano, merged.EndTimeUnixNano)
+	}
+	if merged.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Errorf("expected the error of the duplicate to be merged, got %v", merged.GetStatus())
+	}
+	for _, key := range []string{"dbt.unique_id", "dbt.rows"} {
+		if !hasAttribute(merged.Attributes, key) {
+			t.Errorf("expected merged span to have %s", key)
+		}
+	}
+	for _, attr := range merged.Attributes {
+		if attr.Key == "dbt.node_outcome" && attr.GetValue().GetStringValue() != "NODE_OUTCOME_SUCCESS" {
+			t.Errorf("expected attributes of the first span to win, got node_outcome %v", attr.GetValue())
+		}
+	}
+	if first.GetStatus() != nil || hasAttribute(first.Attributes, "dbt.rows") {
+		t.Errorf("expected the span emitted first to be left unchanged")
+	}
+}
+
+func TestCompletedSpans_Eviction(t *testing.T) {
+	c := newCompletedSpans(2)
+	c.add("a", "", &tracepb.Span{Name: "a"}, true)
+	c.add("b", "", &tracepb.Span{Name: "b"}, false)
+	if span, ok := c.get("a"); !ok || span.GetName() != "a" {
+		t.Errorf("expected a copy of a to be kept, got %v", span)
+	}
+	if span, ok := c.get("b"); !ok || span != nil {
+		t.Errorf("expected b to be remembered without a copy, got %v", span)
+	}
+	c.add("c", "", &tracepb.Span{Name: "c"}, false)
+	if _, ok := c.get("a"); ok {
+		t.Errorf("expected the oldest id to be evicted")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Errorf("expected c to be remembered")
+	}
+}
+
+func TestDecodeLines_SpanNameFields(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"from span_name","name":"from name","start_time_unix_nano":"100","attributes":{"label":"from label","unique_id":"model.a"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","name":"from name","start_time_unix_nano":"200","attributes":{"label":"from label","unique_id":"model.b"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","start_time_unix_nano":"300","attributes":{"label":"from label","unique_id":"model.c"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000004","start_time_unix_nano":"400","attributes":{"unique_id":"model.d"}}`,
+	}
+	for i := 1; i <= 4; i++ {
+		lines = append(lines, fmt.Sprintf(`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"%016x","end_time_unix_nano":"500"}`, i))
+	}
+
+	cases := []struct {
+		fields   []string
+		expected []string
+	}{
+		{fields: nil, expected: []string{"from span_name", "model.b", "model.c", "model.d"}},
+		{fields: []string{"span_name", "name"}, expected: []string{"from span_name", "from name", "model.c", "model.d"}},
+		{fields: []string{"name", "attributes.label"}, expected: []string{"from name", "from name", "from label", "model.d"}},
+	}
+	for _, tc := range cases {
+		decoder := NewDecoder(0)
+		decoder.SpanNameFields(tc.fields)
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		names := make([]string, 0, len(spans))
+		for _, span := range spans {
+			names = append(names, span.Name)
+		}
+		if !slices.Equal(names, tc.expected) {
+			t.Errorf("fields %v: expected names %v, got %v", tc.fields, tc.expected, names)
+		}
+	}
+}
+
+func TestDecodeLines_EventSummary(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"no events","start_time_unix_nano":"100"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"500"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","span_name":"events","start_time_unix_nano":"200","events":[{"name":"compiled","time_unix_nano":"250"}]}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","end_time_unix_nano":"500","events":[{"name":"executed","time_unix_nano":"450"}]}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","span_name":"failed","start_time_unix_nano":"300"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","end_time_unix_nano":"500","attributes":{"node_outcome":"NODE_OUTCOME_ERROR"}}`,
+	}
+	type summary struct {
+		eventCount int64
+		isError    bool
+	}
+	expected := map[string]summary{
+		"no events": {eventCount: 0, isError: false},
+		"events":    {eventCount: 2, isError: false},
+		"failed":    {eventCount: 1, isError: true},
+	}
+
+	decoder := NewDecoder(0)
+	spans, _, err := decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	for _, span := range spans {
+		if hasAttribute(span.Attributes, "dbt.span.event_count") || hasAttribute(span.Attributes, "dbt.span.error") {
+			t.Errorf("span %q: summary attributes set without EventSummary", span.Name)
+		}
+	}
+
+	decoder = NewDecoder(0)
+	decoder.EventSummary(true)
+	decoder.OnDuplicate(OnDuplicateMerge)
+	spans, _, err = decoder.DecodeLines(append(lines,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"600","events":[{"name":"exception","attributes":{"exception.message":"retry failed"}}]}`,
+	))
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	expected["merged"] = summary{eventCount: 1, isError: true}
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		name := span.Name
+		if span.EndTimeUnixNano == 600 {
+			name = "merged"
+		}
+		var got summary
+		counts := 0
+		for _, attr := range span.Attributes {
+			switch attr.Key {
+			case "dbt.span.event_count":
+				got.eventCount = attr.Value.GetIntValue()
+				counts++
+			case "dbt.span.error":
+				got.isError = attr.Value.GetBoolValue()
+				counts++
+			}
+		}
+		if counts != 2 {
+			t.Errorf("span %q: expected each summary attribute once, got %d", name, counts)
+		}
+		if got != expected[name] {
+			t.Errorf("span %q: expected %+v, got %+v", name, expected[name], got)
+		}
+	}
+}
+
+func TestDecodeLines_LineTransformer(t *testing.T) {
+	lines := []string{
+		`{"type":"SpanStart","trace_id":"00000000000000000000000000000001","id":"0000000000000001","span_name":"model.a","start_time_unix_nano":"100"}`,
+		`{"type":"SpanEnd","trace_id":"00000000000000000000000000000001","id":"0000000000000001","end_time_unix_nano":"500"}`,
+		`{"type":"SpanStart","trace_id":"00000000000000000000000000000001","id":"0000000000000002","span_name":"skip me","start_time_unix_nano":"200"}`,
+		`{"type":"SpanEnd","trace_id":"00000000000000000000000000000001","id":"0000000000000002","end_time_unix_nano":"500"}`,
+	}
+	rename := func(from, to string) func(map[string]any) map[string]any {
+		return func(obj map[string]any) map[string]any {
+			if v, ok := obj[from]; ok {
+				obj[to] = v
+				delete(obj, from)
+			}
+			return obj
+		}
+	}
+
+	spans, _, err := NewDecoder(0).DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 0 {
+		t.Fatalf("expected no spans without a transformer, got %d", len(spans))
+	}
+
+	decoder := NewDecoder(0)
+	decoder.RegisterLineTransformer(rename("type", "record_type"))
+	decoder.RegisterLineTransformer(rename("id", "span_id"))
+	// Registered last, so it sees the renamed fields.
+	decoder.RegisterLineTransformer(func(obj map[string]any) map[string]any {
+		if obj["span_id"] == "0000000000000002" {
+			return nil
+		}
+		return obj
+	})
+	spans, _, err = decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name != "model.a" || spans[0].EndTimeUnixNano != 500 {
+		t.Errorf("unexpected span: name %q, end %d", spans[0].Name, spans[0].EndTimeUnixNano)
+	}
+}
+
+func TestDecodeLines_ExceptionEventName(t *testing.T) {
+	lines := []string{
+		// A failed node gets a created exception event.
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"Node evaluated (model.a)","start_time_unix_nano":"100"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"200","attributes":{"unique_id":"model.a","node_outcome":"NODE_OUTCOME_ERROR"}}`,
+		// An exception event of the record is detected and renamed.
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","span_name":"Node evaluated (model.b)","start_time_unix_nano":"100"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","end_time_unix_nano":"200","events":[{"name":"exception","time_unix_nano":"150","attributes":{"exception.message":"boom"}}]}`,
+	}
+	decoder := NewDecoder(0)
+	decoder.ExceptionEventName("error")
+	decoder.EventSummary(true)
+	spans, _, err := decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if len(span.Events) != 1 || span.Events[0].Name != "error" {
+			t.Errorf("%s: expected one event named error, got %v", span.Name, span.Events)
+		}
+		if span.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+			t.Errorf("%s: expected ERROR status, got %v", span.Name, span.Status)
+		}
+		if attrs := convertAttributesToMap(span.Attributes); attrs["dbt.span.error"] != true {
+			t.Errorf("%s: expected dbt.span.error=true, got %v", span.Name, attrs["dbt.span.error"])
+		}
+	}
+	if msg := spans[1].GetStatus().GetMessage(); msg != "boom" {
+		t.Errorf("expected status message from the renamed event, got %q", msg)
+	}
+}
+
+func TestDecodeLines_ExceptionStacktrace(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel_traceback.jsonl")
+	exceptionAttrs := func(t *testing.T, decoder *Decoder) map[string]map[string]string {
+		t.Helper()
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		got := make(map[string]map[string]string)
+		for _, span := range spans {
+			for _, event := range span.Events {
+				if event.Name != "exception" {
+					continue
+				}
+				attrs := make(map[string]string)
+				for _, attr := range event.Attributes {
+					attrs[attr.Key] = attr.Value.GetStringValue()
+				}
+				got[span.Name] = attrs
+			}
+		}
+		return got
+	}
+	const orders = "Node evaluated (model.jaffle_shop.orders)"
+	const customers = "Node evaluated (model.jaffle_shop.customers)"
+
+	got := exceptionAttrs(t, NewDecoder(0))
+	if len(got) != 2 {
+		t.Fatalf("expected exception events on 2 spans, got %d", len(got))
+	}
+	want := "Traceback (most recent call last):\n  File \"macros/orders.sql\", line 12, in orders\nDatabaseError: column \"amount\" does not exist"
+	if got[orders]["exception.stacktrace"] != want {
+		t.Errorf("expected stacktrace %q, got %q", want, got[orders]["exception.stacktrace"])
+	}
+	if got[orders]["exception.type"] != "dbt.DatabaseError" {
+		t.Errorf("expected exception.type from error_type, got %q", got[orders]["exception.type"])
+	}
+	if _, ok := got[customers]["exception.stacktrace"]; ok {
+		t.Errorf("unexpected stacktrace from a field that is not configured")
+	}
+	if got[customers]["exception.type"] != "dbt.NodeEvaluationFailure" {
+		t.Errorf("expected default exception.type, got %q", got[customers]["exception.type"])
+	}
+
+	decoder := NewDecoder(0)
+	decoder.StacktraceFields([]string{"stack"})
+	got = exceptionAttrs(t, decoder)
+	if got[customers]["exception.stacktrace"] != `  File "models/customers.sql", line 3` {
+		t.Errorf("expected stacktrace from the configured field, got %q", got[customers]["exception.stacktrace"])
+	}
+	if _, ok := got[orders]["exception.stacktrace"]; ok {
+		t.Errorf("unexpected stacktrace from traceback when only stack is configured")
+	}
+}
+
+func TestDecodeLine_ResolveLogSpans(t *testing.T) {
+	spanLines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"invocation","start_time_unix_nano":"100"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","parent_span_id":"0000000000000001","span_name":"model.a","start_time_unix_nano":"200","attributes":{"unique_id":"model.a"}}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","end_time_unix_nano":"400"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","parent_span_id":"0000000000000001","span_name":"model.b","start_time_unix_nano":"300","attributes":{"unique_id":"model.b"}}`,
+	}
+	const trace = "00000000000000000000000000000001"
+	cases := []struct {
+		name     string
+		traceID  string
+		spanID   string
+		time     string
+		uniqueID string
+		expected string
+	}{
+		{name: "unknown span of a running node", traceID: trace, spanID: "00000000000000ff", time: "350", uniqueID: "model.a", expected: "0000000000000002"},
+		{name: "unknown span without a node", traceID: trace, spanID: "00000000000000ff", time: "350", expected: "0000000000000003"},
+		{name: "unknown span of an ended node", traceID: trace, spanID: "00000000000000ff", time: "500", uniqueID: "model.a", expected: "0000000000000003"},
+		{name: "known span", traceID: trace, spanID: "0000000000000001", time: "350", uniqueID: "model.b", expected: "0000000000000001"},
+		{name: "nothing running", traceID: trace, spanID: "00000000000000ff", time: "50", expected: "00000000000000ff"},
+		{name: "other trace", traceID: "00000000000000000000000000000002", spanID: "00000000000000ff", time: "350", expected: "00000000000000ff"},
+	}
+	for _, enabled := range []bool{false, true} {
+		decoder := NewDecoder(0)
+		decoder.ResolveLogSpans(enabled)
+		for _, line := range spanLines {
+			decoder.DecodeLine(line)
+		}
+		for _, tc := range cases {
+			_, log := decoder.DecodeLine(fmt.Sprintf(`{"record_type":"LogRecord","trace_id":"%s","span_id":"%s","time_unix_nano":"%s","body":"log","attributes":{"unique_id":"%s"}}`,
+				tc.traceID, tc.spanID, tc.time, tc.uniqueID))
+			if log == nil {
+				t.Fatalf("%s: expected a log record", tc.name)
+			}
+			expected := tc.expected
+			if !enabled {
+				expected = tc.spanID
+			}
+			if got := hex.EncodeToString(log.SpanId); got != expected {
+				t.Errorf("%s (enabled %v): expected span id %s, got %s", tc.name, enabled, expected, got)
+			}
+		}
+	}
+}
+
+func TestDecodeLines_Metrics(t *testing.T) {
+	lines := []string{
+		`{"record_type":"Metric","name":"dbt.rows_affected","value":42,"unit":"{row}","time_unix_nano":"1000","attributes":{"unique_id":"model.a"}}`,
+		`{"record_type":"Metric","name":"dbt.node.duration","value":"1.5","unit":"s"}`,
+		`{"record_type":"Metric","value":1}`,
+		`{"record_type":"Metric","name":"dbt.no_value","value":"n/a"}`,
+	}
+	decoder := NewDecoder(0)
+	decoder.Now = func() time.Time { return time.Unix(0, 2000) }
+	spans, logs, err := decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 0 || len(logs) != 0 {
+		t.Fatalf("expected no spans or logs, got %d spans and %d logs", len(spans), len(logs))
+	}
+	metrics := decoder.Metrics()
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	}
+	rows := metrics[0]
+	if rows.Name != "dbt.rows_affected" || rows.Unit != "{row}" {
+		t.Errorf("unexpected metric: name %q, unit %q", rows.Name, rows.Unit)
+	}
+	dp := rows.GetGauge().GetDataPoints()[0]
+	if dp.GetAsDouble() != 42 || dp.TimeUnixNano != 1000 {
+		t.Errorf("unexpected data point: value %v, time %d", dp.GetAsDouble(), dp.TimeUnixNano)
+	}
+	if attrs := convertAttributesToMap(dp.Attributes); attrs["dbt.unique_id"] != "model.a" {
+		t.Errorf("expected transformed attributes, got %v", attrs)
+	}
+	dp = metrics[1].GetGauge().GetDataPoints()[0]
+	if dp.GetAsDouble() != 1.5 || dp.TimeUnixNano != 2000 {
+		t.Errorf("expected numeric string value stamped with the clock, got value %v, time %d", dp.GetAsDouble(), dp.TimeUnixNano)
+	}
+	if metrics := decoder.Metrics(); len(metrics) != 0 {
+		t.Errorf("expected metrics to be returned once, got %d again", len(metrics))
+	}
+}
+
+func TestDecodeLines_NodeDurationMetrics(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"Node processed (model.a)","start_time_unix_nano":"1000000000","attributes":{"unique_id":"model.a","node_type":"NODE_TYPE_MODEL"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","parent_span_id":"0000000000000001","span_name":"Node evaluated (model.a)","start_time_unix_nano":"1000000000","attributes":{"unique_id":"model.a","node_type":"NODE_TYPE_MODEL","phase":"EXECUTION_PHASE_RUN"}}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","end_time_unix_nano":"1200000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"1250500000"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","span_name":"Invocation","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","end_time_unix_nano":"2000000000"}`,
+	}
+	for _, enabled := range []bool{false, true} {
+		decoder := NewDecoder(0)
+		decoder.NodeDurationMetrics(enabled)
+		spans, _, err := decoder.DecodeLines(lines)
+		if err != nil {
+			t.Fatalf("DecodeLines failed: %v", err)
+		}
+		if len(spans) != 3 {
+			t.Fatalf("expected 3 spans, got %d", len(spans))
+		}
+		metrics := decoder.Metrics()
+		if !enabled {
+			if len(metrics) != 0 {
+				t.Errorf("expected no metrics when disabled, got %d", len(metrics))
+			}
+			continue
+		}
+		if len(metrics) != 1 {
+			t.Fatalf("expected 1 metric for the node span only, got %d", len(metrics))
+		}
+		if metrics[0].Name != "dbt.node.duration_ms" || metrics[0].Unit != "ms" {
+			t.Errorf("unexpected metric: name %q, unit %q", metrics[0].Name, metrics[0].Unit)
+		}
+		dp := metrics[0].GetGauge().GetDataPoints()[0]
+		if dp.GetAsDouble() != 250.5 || dp.TimeUnixNano != 1250500000 {
+			t.Errorf("unexpected data point: value %v, time %d", dp.GetAsDouble(), dp.TimeUnixNano)
+		}
+		want := map[string]any{"dbt.unique_id": "model.a", "dbt.node_type": "NODE_TYPE_MODEL"}
+		if attrs := convertAttributesToMap(dp.Attributes); !reflect.DeepEqual(attrs, want) {
+			t.Errorf("expected attributes %v, got %v", want, attrs)
+		}
+	}
+}
+
+func TestDecodeLinesReadAt_DecodeLatencyMetrics(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	decoder := NewDecoder(0)
+	decoder.Now = func() time.Time { return now }
+	decoder.DecodeLatencyMetrics(true)
+
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"Node evaluated (model.a)","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","span_name":"Node evaluated (model.b)","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"2000000000"}`,
+	}
+	now = base.Add(3 * time.Second)
+	readAt := []time.Time{base, base.Add(time.Second), base.Add(2 * time.Second)}
+	spans, _, err := decoder.DecodeLinesReadAt(lines, readAt)
+	if err != nil {
+		t.Fatalf("DecodeLinesReadAt failed: %v", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	metrics := decoder.Metrics()
+	if len(metrics) != 1 {
+		t.Fatalf("expected the latency histogram, got %d metrics", len(metrics))
+	}
+	if metrics[0].Name != "dbt.forwarder.span.decode_latency_ms" || metrics[0].Unit != "ms" {
+		t.Errorf("unexpected metric: name %q, unit %q", metrics[0].Name, metrics[0].Unit)
+	}
+	dp := metrics[0].GetHistogram().GetDataPoints()[0]
+	if dp.Count != 1 || dp.GetSum() != 3000 {
+		t.Errorf("expected the completed span observed from its first line read 3s ago, got count %d, sum %v", dp.Count, dp.GetSum())
+	}
+	if dp.StartTimeUnixNano != uint64(base.UnixNano()) || dp.TimeUnixNano != uint64(now.UnixNano()) {
+		t.Errorf("unexpected data point times: start %d, time %d", dp.StartTimeUnixNano, dp.TimeUnixNano)
+	}
+	if metrics := decoder.Metrics(); len(metrics) != 0 {
+		t.Errorf("expected no histogram without newly completed spans, got %d metrics", len(metrics))
+	}
+
+	// The pending span completes on a later flush; the histogram is cumulative.
+	now = base.Add(10 * time.Second)
+	if _, _, err := decoder.DecodeLines([]string{
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","end_time_unix_nano":"2000000000"}`,
+	}); err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	metrics = decoder.Metrics()
+	if len(metrics) != 1 {
+		t.Fatalf("expected the latency histogram, got %d metrics", len(metrics))
+	}
+	dp = metrics[0].GetHistogram().GetDataPoints()[0]
+	if dp.Count != 2 || dp.GetSum() != 12000 || dp.GetMax() != 9000 {
+		t.Errorf("expected both spans observed, got count %d, sum %v, max %v", dp.Count, dp.GetSum(), dp.GetMax())
+	}
+}
+
+func TestDecodeOTELLines_SourceFileAttribute(t *testing.T) {
+	lines := []otelLine{
+		{source: "logs/old.jsonl", text: `{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"Node evaluated (model.a)","start_time_unix_nano":"1000000000"}`},
+		// The tail switched files while the span was open.
+		{source: "logs/new.jsonl", text: `{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1100000000","severity_text":"INFO","body":"running"}`},
+		{source: "logs/new.jsonl", text: `{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"2000000000"}`},
+		{text: `{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"2100000000","severity_text":"INFO","body":"unknown origin"}`},
+	}
+	decoder := NewDecoder(0)
+	decoder.SourceFileAttribute("dbt.source_file")
+	spans, logs, err := decoder.decodeOTELLines(lines)
+	if err != nil {
+		t.Fatalf("decodeOTELLines failed: %v", err)
+	}
+	if len(spans) != 1 || len(logs) != 2 {
+		t.Fatalf("expected 1 span and 2 logs, got %d and %d", len(spans), len(logs))
+	}
+	if got := convertAttributesToMap(spans[0].Attributes)["dbt.source_file"]; got != "logs/old.jsonl" {
+		t.Errorf("expected the span to carry the file of its start, got %v", got)
+	}
+	if got := convertAttributesToMap(logs[0].Attributes)["dbt.source_file"]; got != "logs/new.jsonl" {
+		t.Errorf("expected the log to carry its own file, got %v", got)
+	}
+	if _, ok := convertAttributesToMap(logs[1].Attributes)["dbt.source_file"]; ok {
+		t.Errorf("expected no source file for a line of unknown origin")
+	}
+
+	decoder = NewDecoder(0)
+	spans, _, _ = decoder.decodeOTELLines(lines)
+	if _, ok := convertAttributesToMap(spans[0].Attributes)["dbt.source_file"]; ok {
+		t.Errorf("expected no source file attribute by default")
+	}
+}
+
+func TestDecodeLines_ElevateSeverity(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"Node evaluated (model.a)","start_time_unix_nano":"1000000000"}`,
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1100000000","severity_number":13,"severity_text":"WARN","body":"slow query"}`,
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1200000000","severity_text":"ERROR","body":"relation does not exist"}`,
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1300000000","severity_number":17,"severity_text":"ERROR","body":"second error"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"2000000000"}`,
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"2100000000","severity_number":17,"severity_text":"ERROR","body":"after the span ended"}`,
+	}
+	tests := []struct {
+		name      string
+		threshold logspb.SeverityNumber
+		want      *tracepb.Status
+	}{
+		{name: "disabled"},
+		{name: "error", threshold: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, want: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "relation does not exist"}},
+		{name: "warn", threshold: logspb.SeverityNumber_SEVERITY_NUMBER_WARN, want: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "slow query"}},
+		{name: "fatal", threshold: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(0)
+			decoder.ElevateSeverity(tt.threshold)
+			spans, logs, err := decoder.DecodeLines(lines)
+			if err != nil {
+				t.Fatalf("DecodeLines failed: %v", err)
+			}
+			if len(spans) != 1 || len(logs) != 4 {
+				t.Fatalf("expected 1 span and 4 logs, got %d and %d", len(spans), len(logs))
+			}
+			if got := spans[0].Status; !proto.Equal(got, tt.want) {
+				t.Errorf("expected status %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeLines_NumberHints(t *testing.T) {
+	lines := []string{
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"100","attributes":{"rows_affected":"42","elapsed":3,"bytes":1.0,"partial":1.5,"other":"42","label":"n/a"}}`,
+	}
+	decoder := NewDecoder(0)
+	decoder.NumberHints(map[string]string{
+		"rows_affected": NumberHintInt,
+		"bytes":         NumberHintInt,
+		"partial":       NumberHintInt,
+		"elapsed":       NumberHintDouble,
+		"label":         NumberHintInt,
+	})
+	_, logs, err := decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	values := make(map[string]*commonpb.AnyValue)
+	for _, attr := range logs[0].Attributes {
+		values[attr.Key] = attr.Value
+	}
+	cases := []struct {
+		key      string
+		expected *commonpb.AnyValue
+	}{
+		{"dbt.rows_affected", &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 42}}},
+		{"dbt.bytes", &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 1}}},
+		{"dbt.elapsed", &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 3}}},
+		// Not converted: a fraction under an int hint, an unhinted key and a non-number.
+		{"dbt.partial", &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}}},
+		{"dbt.other", &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "42"}}},
+		{"dbt.label", &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "n/a"}}},
+	}
+	for _, tc := range cases {
+		if !proto.Equal(values[tc.key], tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.key, tc.expected, values[tc.key])
+		}
+	}
+}
+
+func TestDecodeLines_AttributeMapping(t *testing.T) {
+	lines := []string{
+		`{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"100","attributes":{"unique_id":"model.a","sql":"select 1","node_type":"model","http.status_code":200,"dbt.kept":true}}`,
+	}
+	prefix := "dbt_"
+	mapping := &AttributeMappingConfig{
+		Prefix:      &prefix,
+		Rename:      map[string]string{"node_type": "dbt.resource_type", "unique_id": "dbt.node.id"},
+		Passthrough: []string{"http.status_code", "sql", "unique_id"},
+	}
+	decoder := NewDecoder(0)
+	decoder.AttributeTransformer(mapping.transformer())
+	_, logs, err := decoder.DecodeLines(lines)
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(logs))
+	}
+	var keys []string
+	for _, attr := range logs[0].Attributes {
+		keys = append(keys, attr.Key)
+	}
+	slices.Sort(keys)
+	// A configured rename wins over passthrough, passthrough keys are kept
+	// verbatim instead of being prefixed or renamed by default, and other
+	// keys get the configured prefix.
+	expected := []string{"dbt.node.id", "dbt.resource_type", "dbt_dbt.kept", "http.status_code", "sql"}
+	if !slices.Equal(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestDecodeLines_EndTimeFromElapsed(t *testing.T) {
+	const start = 1772073194000000000
+	spanLines := func(end string) []string {
+		return []string{
+			`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"model.a","start_time_unix_nano":"1772073194000000000"}`,
+			`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"model.a",` + end + `}`,
+		}
+	}
+	cases := []struct {
+		name        string
+		unit        string
+		end         string
+		expectedEnd uint64
+	}{
+		{"seconds by heuristic", "", `"elapsed":1.5`, start + 1_500_000_000},
+		{"nanoseconds by heuristic", "", `"elapsed":"2500000000"`, start + 2_500_000_000},
+		{"attribute", "", `"attributes":{"elapsed":2}`, start + 2_000_000_000},
+		{"milliseconds", ElapsedUnitMilliseconds, `"elapsed":250`, start + 250_000_000},
+		{"nanoseconds", ElapsedUnitNanoseconds, `"elapsed":5`, start + 5},
+		{"explicit end time wins", "", `"end_time_unix_nano":"1772073195000000000","elapsed":30`, start + 1_000_000_000},
+		{"garbage", "", `"elapsed":"soon"`, start},
+		{"negative", "", `"elapsed":-1`, start},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder := NewDecoder(0)
+			decoder.ElapsedUnit(tc.unit)
+			spans, _, err := decoder.DecodeLines(spanLines(tc.end))
+			if err != nil {
+				t.Fatalf("DecodeLines failed: %v", err)
+			}
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			if got := spans[0].EndTimeUnixNano; got != tc.expectedEnd {
+				t.Errorf("expected end time %d, got %d", tc.expectedEnd, got)
+			}
+		})
+	}
+}
+
+func TestDecoder_InProgressSpans(t *testing.T) {
+	lines := []string{
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","span_name":"model.long","start_time_unix_nano":"1000000000","attributes":{"unique_id":"model.long"}}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000002","span_name":"model.recent","start_time_unix_nano":"55000000000"}`,
+		`{"record_type":"SpanStart","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","span_name":"model.done","start_time_unix_nano":"2000000000"}`,
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000003","end_time_unix_nano":"3000000000"}`,
+	}
+	decoder := NewDecoder(0)
+	decoder.Now = func() time.Time { return time.Unix(60, 0) }
+	if _, _, err := decoder.DecodeLines(lines); err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if spans := decoder.InProgressSpans(); spans != nil {
+		t.Fatalf("expected no snapshots while disabled, got %d", len(spans))
+	}
+
+	decoder.InProgressAfter(30 * time.Second)
+	spans := decoder.InProgressSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 snapshot of the span open for over 30s, got %d", len(spans))
+	}
+	snapshot := spans[0]
+	if snapshot.Name != "model.long" || snapshot.StartTimeUnixNano != 1000000000 || snapshot.EndTimeUnixNano != 60000000000 {
+		t.Errorf("unexpected snapshot: name %q, start %d, end %d", snapshot.Name, snapshot.StartTimeUnixNano, snapshot.EndTimeUnixNano)
+	}
+	attrs := convertAttributesToMap(snapshot.Attributes)
+	if attrs["dbt.span.in_progress"] != true || attrs["dbt.unique_id"] != "model.long" {
+		t.Errorf("expected in-progress marker and transformed attributes, got %v", attrs)
+	}
+	if again := decoder.InProgressSpans(); len(again) != 1 {
+		t.Errorf("expected the snapshot on every call while the span is open, got %d", len(again))
+	}
+
+	spans, _, err := decoder.DecodeLines([]string{
+		`{"record_type":"SpanEnd","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","end_time_unix_nano":"70000000000"}`,
+	})
+	if err != nil {
+		t.Fatalf("DecodeLines failed: %v", err)
+	}
+	if len(spans) != 1 || !slices.Equal(spans[0].SpanId, snapshot.SpanId) || spans[0].EndTimeUnixNano != 70000000000 {
+		t.Fatalf("expected the completed span with the snapshot's id, got %v", spans)
+	}
+	if _, ok := convertAttributesToMap(spans[0].Attributes)["dbt.span.in_progress"]; ok {
+		t.Error("the completed span must not be marked in progress")
+	}
+	if len(convertAttributesToMap(snapshot.Attributes)) != 2 {
+		t.Errorf("the snapshot must not change when the span completes, got %v", snapshot.Attributes)
+	}
+	if spans := decoder.InProgressSpans(); len(spans) != 0 {
+		t.Errorf("expected no snapshots after completion, got %d", len(spans))
+	}
+}
+
+// bubbleSortSpans and bubbleSortLogs are the former implementations of
+// sortSpansByStartTime and sortLogsByTime, kept as the reference order.
+func bubbleSortSpans(spans []*tracepb.Span) {
+	for i := 0; i < len(spans)-1; i++ {
+		for j := 0; j < len(spans)-i-1; j++ {
+			if spans[j].StartTimeUnixNano > spans[j+1].StartTimeUnixNano ||
+				spans[j].StartTimeUnixNano == spans[j+1].StartTimeUnixNano && compareBytes(spans[j].SpanId, spans[j+1].SpanId) > 0 {
+				spans[j], spans[j+1] = spans[j+1], spans[j]
+			}
+		}
+	}
+}
+
+func bubbleSortLogs(logs []*logspb.LogRecord) {
+	for i := 0; i < len(logs)-1; i++ {
+		for j := 0; j < len(logs)-i-1; j++ {
+			if logs[j].TimeUnixNano > logs[j+1].TimeUnixNano ||
+				logs[j].TimeUnixNano == logs[j+1].TimeUnixNano && compareBytes(logs[j].SpanId, logs[j+1].SpanId) > 0 {
+				logs[j], logs[j+1] = logs[j+1], logs[j]
+			}
+		}
+	}
+}
+
+// shuffledRecords returns n spans and log records in random order, with few
+// distinct times and span ids so that ties and fully equal keys are common.
+func shuffledRecords(n int, seed uint64) ([]*tracepb.Span, []*logspb.LogRecord) {
+	r := rand.New(rand.NewPCG(seed, seed))
+	spans := make([]*tracepb.Span, n)
+	logs := make([]*logspb.LogRecord, n)
+	for i := range n {
+		spanID := []byte{0, 0, 0, 0, 0, 0, 0, byte(r.IntN(8))}
+		if r.IntN(10) == 0 {
+			spanID = nil
+		}
+		ts := uint64(r.IntN(n/4 + 1))
+		spans[i] = &tracepb.Span{Name: fmt.Sprint(i), SpanId: spanID, StartTimeUnixNano: ts}
+		logs[i] = &logspb.LogRecord{SeverityText: fmt.Sprint(i), SpanId: spanID, TimeUnixNano: ts}
+	}
+	return spans, logs
+}
+
+func TestSortByTime_MatchesBubbleSort(t *testing.T) {
+	for seed := range uint64(20) {
+		spans, logs := shuffledRecords(200, seed)
+		wantSpans, wantLogs := slices.Clone(spans), slices.Clone(logs)
+		bubbleSortSpans(wantSpans)
+		bubbleSortLogs(wantLogs)
+		sortSpansByStartTime(spans)
+		sortLogsByTime(logs)
+		for i := range spans {
+			if spans[i] != wantSpans[i] {
+				t.Fatalf("seed %d: span %d is %s, want %s", seed, i, spans[i].Name, wantSpans[i].Name)
+			}
+			if logs[i] != wantLogs[i] {
+				t.Fatalf("seed %d: log %d is %s, want %s", seed, i, logs[i].SeverityText, wantLogs[i].SeverityText)
+			}
+		}
+	}
+}
+
+func BenchmarkSortSpansByStartTime(b *testing.B) {
+	input, _ := shuffledRecords(5000, 1)
+	spans := make([]*tracepb.Span, len(input))
+	b.Run("sort", func(b *testing.B) {
+		for b.Loop() {
+			copy(spans, input)
+			sortSpansByStartTime(spans)
+		}
+	})
+	b.Run("bubble", func(b *testing.B) {
+		for b.Loop() {
+			copy(spans, input)
+			bubbleSortSpans(spans)
+		}
+	})
+}
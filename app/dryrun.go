@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const dryRunName = "dry-run"
+
+// dryRunExporter counts what would have been uploaded instead of sending it.
+type dryRunExporter struct {
+	NoopExporter
+
+	mu         sync.Mutex
+	spans      int
+	errorSpans int
+	logs       int
+	traceIDs   map[string]struct{}
+}
+
+func newDryRunExporter() *dryRunExporter {
+	return &dryRunExporter{traceIDs: make(map[string]struct{})}
+}
+
+func (e *dryRunExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				e.spans++
+				if span.GetStatus().GetCode() == tracepb.Status_STATUS_CODE_ERROR {
+					e.errorSpans++
+				}
+				e.traceIDs[hex.EncodeToString(span.GetTraceId())] = struct{}{}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *dryRunExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rl := range protoLogs {
+		for _, sl := range rl.GetScopeLogs() {
+			e.logs += len(sl.GetLogRecords())
+		}
+	}
+	return nil
+}
+
+// printSummary writes the counts of a dry run.
+func (e *dryRunExporter) printSummary(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(w, "dry run, nothing was uploaded: %d spans (%d with errors) in %d traces, %d log records\n",
+		e.spans, e.errorSpans, len(e.traceIDs), e.logs)
+}
+
+// dryRunForwarders returns a single forwarder sending every span and log
+// record to exp, in place of the configured forward rules and exporters.
+func (a *App) dryRunForwarders(ctx context.Context, exp *dryRunExporter) []*Forwarder {
+	exporters := map[string]Exporter{dryRunName: exp}
+	a.stats.wrapExporters(exporters)
+	fw, err := NewForwarder(dryRunName, ForwardConfig{
+		Traces: &TracesForwardConfig{Exporters: []string{dryRunName}},
+		Logs:   &LogsForwardConfig{Exporters: []string{dryRunName}},
+	}, exporters)
+	if err != nil {
+		a.Logger.Error("failed to create the dry run forwarder", "error", err)
+		return nil
+	}
+	if err := fw.Start(ctx); err != nil {
+		a.Logger.Error("failed to start the dry run forwarder", "error", err)
+		return nil
+	}
+	return []*Forwarder{fw}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestRun_DryRun(t *testing.T) {
+	spans, logs, err := NewDecoder(0).DecodeLines(readTestdataLines(t, "testdata/otel.jsonl"))
+	require.NoError(t, err)
+	traceIDs := make(map[string]bool)
+	errorSpans := 0
+	for _, span := range spans {
+		traceIDs[hex.EncodeToString(span.TraceId)] = true
+		if span.GetStatus().GetCode() == tracepb.Status_STATUS_CODE_ERROR {
+			errorSpans++
+		}
+	}
+
+	for _, cfg := range []*Config{
+		{},
+		{
+			Exporters: map[string]ExporterConfig{
+				"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &bytes.Buffer{}}},
+			},
+			Forward: map[string]ForwardConfig{
+				"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory"}}},
+			},
+		},
+	} {
+		var stderr bytes.Buffer
+		a := newTestApp()
+		a.Stderr = &stderr
+		a.cfg = cfg
+		code := a.Run(context.Background(), RunParams{
+			LogPath:      "testdata",
+			OtelFile:     "otel.jsonl",
+			FlushTimeout: 5 * time.Second,
+			NoExec:       true,
+			DryRun:       true,
+		})
+		assert.Equal(t, 0, code)
+		assert.Equal(t, fmt.Sprintf("dry run, nothing was uploaded: %d spans (%d with errors) in %d traces, %d log records\n",
+			len(spans), errorSpans, len(traceIDs), len(logs)), stderr.String())
+		if memory, ok := cfg.Exporters["memory"]; ok {
+			assert.Empty(t, memory.Stdout.Writer.(*bytes.Buffer).String(), "configured exporters are not used")
+		}
+	}
+}
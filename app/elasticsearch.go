@@ -0,0 +1,219 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// ElasticsearchExporter indexes log records into Elasticsearch or OpenSearch
+// with the _bulk API, one document per record. There is no trace or metric
+// ingestion, so spans and metrics are dropped with a warning.
+type ElasticsearchExporter struct {
+	url             string
+	index           string
+	username        string
+	password        string
+	apiKey          string
+	httpClient      *http.Client
+	warnOnce        sync.Once
+	metricsWarnOnce sync.Once
+}
+
+func NewElasticsearchExporter(cfg ElasticsearchExporterConfig) *ElasticsearchExporter {
+	return &ElasticsearchExporter{
+		url:        strings.TrimRight(cfg.URL, "/"),
+		index:      cfg.Index,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		apiKey:     cfg.APIKey,
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (e *ElasticsearchExporter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (e *ElasticsearchExporter) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (e *ElasticsearchExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	e.warnOnce.Do(func() {
+		slog.Warn("elasticsearch exporter does not support traces, dropping them", "index", e.index)
+	})
+	return nil
+}
+
+func (e *ElasticsearchExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	e.metricsWarnOnce.Do(func() {
+		slog.Warn("elasticsearch exporter does not support metrics, dropping them", "index", e.index)
+	})
+	return nil
+}
+
+func (e *ElasticsearchExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	body, n, err := buildElasticsearchBulkBody(e.index, protoLogs)
+	if err != nil {
+		return fmt.Errorf("elasticsearch: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("elasticsearch: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case e.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	case e.username != "":
+		req.SetBasicAuth(e.username, e.password)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("elasticsearch: bulk index logs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("elasticsearch: bulk index logs: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	// A 200 response may still carry failures of individual documents.
+	var result elasticsearchBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("elasticsearch: decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first *elasticsearchBulkError
+	for _, item := range result.Items {
+		for _, res := range item {
+			if res.Error != nil {
+				failed++
+				if first == nil {
+					first = res.Error
+				}
+			}
+		}
+	}
+	if first == nil {
+		return fmt.Errorf("elasticsearch: bulk index logs: response reported errors")
+	}
+	return fmt.Errorf("elasticsearch: bulk index logs: %d of %d documents failed: %s: %s", failed, n, first.Type, first.Reason)
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                                       `json:"errors"`
+	Items  []map[string]elasticsearchBulkItemResponse `json:"items"`
+}
+
+type elasticsearchBulkItemResponse struct {
+	Status int                     `json:"status"`
+	Error  *elasticsearchBulkError `json:"error,omitempty"`
+}
+
+type elasticsearchBulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type elasticsearchLogDocument struct {
+	Timestamp      string              `json:"@timestamp"`
+	Message        string              `json:"message,omitempty"`
+	SeverityText   string              `json:"severity_text,omitempty"`
+	SeverityNumber int32               `json:"severity_number,omitempty"`
+	TraceID        string              `json:"trace_id,omitempty"`
+	SpanID         string              `json:"span_id,omitempty"`
+	Attributes     map[string]any      `json:"attributes,omitempty"`
+	Resource       map[string]any      `json:"resource,omitempty"`
+	Scope          *elasticsearchScope `json:"scope,omitempty"`
+}
+
+type elasticsearchScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// buildElasticsearchBulkBody renders log records as an NDJSON _bulk body of
+// create actions, which works for both regular indices and data streams.
+// It returns the body and the number of documents in it.
+func buildElasticsearchBulkBody(index string, protoLogs []*otlp.ResourceLogs) ([]byte, int, error) {
+	action, err := json.Marshal(map[string]any{"create": map[string]string{"_index": index}})
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	n := 0
+	for _, rl := range protoLogs {
+		resource := convertAttributesToMap(rl.GetResource().GetAttributes())
+		for _, sl := range rl.GetScopeLogs() {
+			var scope *elasticsearchScope
+			if s := sl.GetScope(); s != nil {
+				scope = &elasticsearchScope{Name: s.GetName(), Version: s.GetVersion()}
+			}
+			for _, log := range sl.GetLogRecords() {
+				doc, err := json.Marshal(convertToElasticsearchDocument(log, resource, scope))
+				if err != nil {
+					return nil, 0, fmt.Errorf("marshal log record: %w", err)
+				}
+				buf.Write(action)
+				buf.WriteByte('\n')
+				buf.Write(doc)
+				buf.WriteByte('\n')
+				n++
+			}
+		}
+	}
+	return buf.Bytes(), n, nil
+}
+
+func convertToElasticsearchDocument(log *logspb.LogRecord, resource map[string]any, scope *elasticsearchScope) *elasticsearchLogDocument {
+	ts := log.GetTimeUnixNano()
+	if ts == 0 {
+		ts = log.GetObservedTimeUnixNano()
+	}
+	doc := &elasticsearchLogDocument{
+		Timestamp:      time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano),
+		SeverityText:   log.GetSeverityText(),
+		SeverityNumber: int32(log.GetSeverityNumber()),
+		Attributes:     convertAttributesToMap(log.GetAttributes()),
+		Resource:       resource,
+		Scope:          scope,
+	}
+	if len(log.GetTraceId()) > 0 {
+		doc.TraceID = hex.EncodeToString(log.GetTraceId())
+	}
+	if len(log.GetSpanId()) > 0 {
+		doc.SpanID = hex.EncodeToString(log.GetSpanId())
+	}
+	// message is always a string so its mapping does not depend on the first
+	// document indexed; structured bodies are stored as JSON text.
+	switch body := getAttributeValue(log.GetBody()).(type) {
+	case nil:
+	case string:
+		doc.Message = body
+	default:
+		if b, err := json.Marshal(body); err == nil {
+			doc.Message = string(b)
+		} else {
+			doc.Message = fmt.Sprint(body)
+		}
+	}
+	return doc
+}
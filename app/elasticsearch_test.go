@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func testElasticsearchResourceLogs() []*otlp.ResourceLogs {
+	return []*otlp.ResourceLogs{{
+		Resource: &resourcepb.Resource{
+			Attributes: convertAttributesFromMap(map[string]any{"service.name": "dbt"}),
+		},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{Name: "dbt-fusion-otel-forwarder", Version: "v1.0.0"},
+			LogRecords: []*logspb.LogRecord{
+				{
+					TimeUnixNano:   1772073188916175000,
+					TraceId:        []byte{0x01, 0x9c, 0x97, 0xca, 0xfe, 0x1c, 0x76, 0xe2, 0xab, 0xb1, 0x50, 0xe9, 0x42, 0x7e, 0x66, 0x6a},
+					SpanId:         []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a},
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+					SeverityText:   "INFO",
+					Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "Loading packages.yml"}},
+					Attributes:     convertAttributesFromMap(map[string]any{"dbt.action": "Loading"}),
+				},
+				{
+					TimeUnixNano: 1772073189000000000,
+					SeverityText: "WARN",
+					Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+						Values: convertAttributesFromMap(map[string]any{"rows": "3"}),
+					}}},
+				},
+			},
+		}},
+	}}
+}
+
+func TestBuildElasticsearchBulkBody(t *testing.T) {
+	body, n, err := buildElasticsearchBulkBody("dbt-logs", testElasticsearchResourceLogs())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	lines := strings.Split(string(body), "\n")
+	require.Len(t, lines, 5, "an action line and a document line per record, newline terminated")
+	assert.Empty(t, lines[4])
+	assert.JSONEq(t, `{"create":{"_index":"dbt-logs"}}`, lines[0])
+	assert.JSONEq(t, `{
+		"@timestamp": "2026-02-26T02:33:08.916175Z",
+		"message": "Loading packages.yml",
+		"severity_text": "INFO",
+		"severity_number": 9,
+		"trace_id": "019c97cafe1c76e2abb150e9427e666a",
+		"span_id": "000000000000000a",
+		"attributes": {"dbt.action": "Loading"},
+		"resource": {"service.name": "dbt"},
+		"scope": {"name": "dbt-fusion-otel-forwarder", "version": "v1.0.0"}
+	}`, lines[1])
+	assert.JSONEq(t, `{"create":{"_index":"dbt-logs"}}`, lines[2])
+	assert.JSONEq(t, `{
+		"@timestamp": "2026-02-26T02:33:09Z",
+		"message": "{\"rows\":\"3\"}",
+		"severity_text": "WARN",
+		"resource": {"service.name": "dbt"},
+		"scope": {"name": "dbt-fusion-otel-forwarder", "version": "v1.0.0"}
+	}`, lines[3], "structured bodies are stored as JSON text")
+}
+
+func TestElasticsearchExporter_UploadLogs(t *testing.T) {
+	var gotPath, gotContentType, gotAuth string
+	var gotLines int
+	respond := `{"errors":false,"items":[{"create":{"status":201}},{"create":{"status":201}}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotContentType = r.Header.Get("Content-Type")
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotLines = strings.Count(string(b), "\n")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, respond)
+	}))
+	defer srv.Close()
+
+	exp := NewElasticsearchExporter(ElasticsearchExporterConfig{URL: srv.URL + "/", Index: "dbt-logs", APIKey: "c2VjcmV0"})
+	require.NoError(t, exp.Start(context.Background()))
+	require.NoError(t, exp.UploadLogs(context.Background(), testElasticsearchResourceLogs()))
+	assert.Equal(t, "/_bulk", gotPath)
+	assert.Equal(t, "application/x-ndjson", gotContentType)
+	assert.Equal(t, "ApiKey c2VjcmV0", gotAuth)
+	assert.Equal(t, 4, gotLines)
+
+	basic := NewElasticsearchExporter(ElasticsearchExporterConfig{URL: srv.URL, Index: "dbt-logs", Username: "elastic", Password: "changeme"})
+	require.NoError(t, basic.UploadLogs(context.Background(), testElasticsearchResourceLogs()))
+	assert.Equal(t, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ==", gotAuth)
+
+	respond = `{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [message]"}}}]}`
+	err := exp.UploadLogs(context.Background(), testElasticsearchResourceLogs())
+	require.Error(t, err, "failures of individual documents are reported")
+	assert.Contains(t, err.Error(), "1 of 2 documents failed: mapper_parsing_exception")
+
+	gotPath = ""
+	require.NoError(t, exp.UploadLogs(context.Background(), []*otlp.ResourceLogs{{}}))
+	assert.Empty(t, gotPath, "nothing is sent without log records")
+	require.NoError(t, exp.UploadTraces(context.Background(), []*otlp.ResourceSpans{{}}), "traces are dropped without error")
+}
+
+func TestElasticsearchExporter_UploadLogsStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "missing authentication credentials"})
+	}))
+	defer srv.Close()
+
+	exp := NewElasticsearchExporter(ElasticsearchExporterConfig{URL: srv.URL, Index: "dbt-logs"})
+	err := exp.UploadLogs(context.Background(), testElasticsearchResourceLogs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 401")
+}
+
+func TestElasticsearchExporterConfig(t *testing.T) {
+	var cfg ExporterConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+type: elasticsearch
+url: https://localhost:9200
+index: dbt-logs
+username: elastic
+password: changeme
+`), &cfg))
+	assert.Equal(t, ElasticsearchExporterConfig{
+		URL:      "https://localhost:9200",
+		Index:    "dbt-logs",
+		Username: "elastic",
+		Password: "changeme",
+	}, cfg.Elasticsearch)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Elasticsearch.APIKey = "c2VjcmV0"
+	require.Error(t, cfg.Validate(), "api_key and username are mutually exclusive")
+	require.Error(t, (&ExporterConfig{Type: "elasticsearch", Elasticsearch: ElasticsearchExporterConfig{URL: "https://localhost:9200"}}).Validate(), "index is required")
+	require.Error(t, (&ExporterConfig{Type: "elasticsearch", Elasticsearch: ElasticsearchExporterConfig{Index: "dbt-logs"}}).Validate(), "url is required")
+}
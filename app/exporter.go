@@ -2,12 +2,23 @@ package app
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mashiike/go-otlp-helper/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -20,6 +31,7 @@ type Exporter interface {
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
 	UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error
+	UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error
 	UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error
 }
 
@@ -28,6 +40,12 @@ var _ Exporter = (*otlp.Client)(nil)
 func NewExporters(ctx context.Context, cfgs map[string]ExporterConfig) map[string]Exporter {
 	exporters := make(map[string]Exporter)
 	for name, cfg := range cfgs {
+		if !cfg.IsEnabled() {
+			// Forwarders referencing it still start, and upload to nothing.
+			slog.Info("exporter is disabled", "name", name)
+			exporters[name] = &NoopExporter{}
+			continue
+		}
 		exp, err := NewExporter(ctx, cfg)
 		if err != nil {
 			slog.Error("failed to create exporter", "name", name, "error", err)
@@ -39,37 +57,241 @@ func NewExporters(ctx context.Context, cfgs map[string]ExporterConfig) map[strin
 }
 
 func NewExporter(ctx context.Context, cfg ExporterConfig) (Exporter, error) {
-	if cfg.Type == "otlp" {
-		opts := cfg.Otlp.ClientOptions()
+	var exp Exporter
+	switch cfg.Type {
+	case "otlp":
+		// Resolve the environment once, so that every wrapper sees it.
+		otlpCfg, err := cfg.Otlp.withEnvDefaults()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Otlp = otlpCfg
+		opts, err := cfg.Otlp.ClientOptions()
+		if err != nil {
+			return nil, err
+		}
 		client, err := otlp.NewClient(cfg.Otlp.Endpoint, opts...)
 		if err != nil {
 			return nil, err
 		}
-		var exp Exporter = &OonceStartExporter{Exporter: client}
-		attempts := cfg.MaxAttempts
-		if attempts == 0 {
-			attempts = defaultMaxAttempts
+		exp = client
+		if cfg.Otlp.UsesGzip() {
+			gzipOpts, err := cfg.Otlp.clientOptions(true)
+			if err != nil {
+				return nil, err
+			}
+			gzipClient, err := otlp.NewClient(cfg.Otlp.Endpoint, gzipOpts...)
+			if err != nil {
+				return nil, err
+			}
+			exp = NewGzipExporter(client, gzipClient, cfg.Otlp)
 		}
-		interval := defaultRetryInterval
-		if cfg.RetryInterval != nil {
-			interval = *cfg.RetryInterval
+		exp = &OonceStartExporter{Exporter: exp}
+		if len(cfg.Otlp.httpEndpoints()) > 0 {
+			exp = NewHTTPWarmupExporter(exp, cfg.Otlp)
 		}
-		if attempts > 1 {
-			exp = &RetryExporter{
-				Exporter:      exp,
-				MaxAttempts:   attempts,
-				RetryInterval: interval,
+		if cfg.Otlp.HasHeaderTemplates() {
+			exp, err = NewDynamicHeadersExporter(exp, cfg.Otlp)
+			if err != nil {
+				return nil, err
 			}
 		}
-		return exp, nil
+	case "cloudtrace":
+		exp = &OonceStartExporter{Exporter: NewCloudTraceExporter(cfg.CloudTrace)}
+	case "elasticsearch":
+		exp = NewElasticsearchExporter(cfg.Elasticsearch)
+	case "loki":
+		exp = NewLokiExporter(cfg.Loki)
+	case "file":
+		exp = NewFileExporter(cfg.File)
+	case "stdout", "debug":
+		exp = NewStdoutExporter(cfg.Stdout)
+	default:
+		return nil, errors.New("unsupported exporter type: " + cfg.Type)
+	}
+	if cfg.SampleRatio != nil && *cfg.SampleRatio < 1 {
+		exp = &SamplingExporter{
+			Exporter: exp,
+			Ratio:    *cfg.SampleRatio,
+		}
+	}
+	if len(cfg.ResourceOverrides) > 0 {
+		exp = &ResourceOverrideExporter{
+			Exporter:  exp,
+			Overrides: cfg.ResourceOverrides,
+		}
+	}
+	attempts := cfg.MaxAttempts
+	if attempts == 0 {
+		attempts = defaultMaxAttempts
+	}
+	interval := defaultRetryInterval
+	if cfg.RetryInterval != nil {
+		interval = *cfg.RetryInterval
+	}
+	retry := &RetryExporter{
+		Exporter:      exp,
+		MaxAttempts:   attempts,
+		RetryInterval: interval,
+	}
+	if cfg.Type == "otlp" && cfg.Otlp.Retry != nil {
+		retry = cfg.Otlp.Retry.retryExporter(exp)
+	}
+	if retry.MaxAttempts > 1 {
+		exp = retry
+	}
+	if cfg.Timeout != nil {
+		exp = &TimeoutExporter{
+			Exporter: exp,
+			Timeout:  *cfg.Timeout,
+		}
+	}
+	return exp, nil
+}
+
+// ResourceOverrideExporter rewrites resource attributes right before upload.
+// The payload is shared with other exporters of the same forwarder, so the
+// resource is copied instead of being modified in place.
+type ResourceOverrideExporter struct {
+	Exporter
+	Overrides map[string]any
+}
+
+func (e *ResourceOverrideExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	overridden := make([]*otlp.ResourceLogs, 0, len(protoLogs))
+	for _, rl := range protoLogs {
+		overridden = append(overridden, &logspb.ResourceLogs{
+			Resource:  e.overrideResource(rl.GetResource()),
+			ScopeLogs: rl.GetScopeLogs(),
+			SchemaUrl: rl.GetSchemaUrl(),
+		})
 	}
-	return nil, errors.New("unsupported exporter type: " + cfg.Type)
+	return e.Exporter.UploadLogs(ctx, overridden)
 }
 
+func (e *ResourceOverrideExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	overridden := make([]*otlp.ResourceSpans, 0, len(protoSpans))
+	for _, rs := range protoSpans {
+		overridden = append(overridden, &tracepb.ResourceSpans{
+			Resource:   e.overrideResource(rs.GetResource()),
+			ScopeSpans: rs.GetScopeSpans(),
+			SchemaUrl:  rs.GetSchemaUrl(),
+		})
+	}
+	return e.Exporter.UploadTraces(ctx, overridden)
+}
+
+func (e *ResourceOverrideExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	overridden := make([]*otlp.ResourceMetrics, 0, len(protoMetrics))
+	for _, rm := range protoMetrics {
+		overridden = append(overridden, &metricspb.ResourceMetrics{
+			Resource:     e.overrideResource(rm.GetResource()),
+			ScopeMetrics: rm.GetScopeMetrics(),
+			SchemaUrl:    rm.GetSchemaUrl(),
+		})
+	}
+	return e.Exporter.UploadMetrics(ctx, overridden)
+}
+
+func (e *ResourceOverrideExporter) overrideResource(res *resourcepb.Resource) *resourcepb.Resource {
+	attrs := convertAttributesToMap(res.GetAttributes())
+	for key, value := range e.Overrides {
+		if value == nil {
+			delete(attrs, key)
+			continue
+		}
+		attrs[key] = value
+	}
+	return &resourcepb.Resource{
+		Attributes:             convertAttributesFromMap(attrs),
+		DroppedAttributesCount: res.GetDroppedAttributesCount(),
+	}
+}
+
+// SamplingExporter sends only a share Ratio of the traces to its exporter,
+// so that a cheaper backend gets a subset while the other exporters of the
+// forwarder get everything. Traces are sampled by trace ID like OpenTelemetry's
+// TraceIdRatioBased sampler, so a trace is kept or dropped as a whole and log
+// records follow their trace. Log records without a trace and metrics are
+// always sent. The payload is shared with other exporters, so the kept records
+// are copied into new containers.
+type SamplingExporter struct {
+	Exporter
+	Ratio float64
+}
+
+func (e *SamplingExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	sampled := make([]*otlp.ResourceLogs, 0, len(protoLogs))
+	for _, rl := range protoLogs {
+		scopes := make([]*logspb.ScopeLogs, 0, len(rl.GetScopeLogs()))
+		for _, sl := range rl.GetScopeLogs() {
+			var records []*logspb.LogRecord
+			for _, log := range sl.GetLogRecords() {
+				if len(log.GetTraceId()) == 0 || e.keep(log.GetTraceId()) {
+					records = append(records, log)
+				}
+			}
+			if len(records) > 0 {
+				scopes = append(scopes, &logspb.ScopeLogs{Scope: sl.GetScope(), LogRecords: records, SchemaUrl: sl.GetSchemaUrl()})
+			}
+		}
+		if len(scopes) > 0 {
+			sampled = append(sampled, &logspb.ResourceLogs{Resource: rl.GetResource(), ScopeLogs: scopes, SchemaUrl: rl.GetSchemaUrl()})
+		}
+	}
+	if len(sampled) == 0 {
+		return nil
+	}
+	return e.Exporter.UploadLogs(ctx, sampled)
+}
+
+func (e *SamplingExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	sampled := make([]*otlp.ResourceSpans, 0, len(protoSpans))
+	for _, rs := range protoSpans {
+		scopes := make([]*tracepb.ScopeSpans, 0, len(rs.GetScopeSpans()))
+		for _, ss := range rs.GetScopeSpans() {
+			var spans []*tracepb.Span
+			for _, span := range ss.GetSpans() {
+				if e.keep(span.GetTraceId()) {
+					spans = append(spans, span)
+				}
+			}
+			if len(spans) > 0 {
+				scopes = append(scopes, &tracepb.ScopeSpans{Scope: ss.GetScope(), Spans: spans, SchemaUrl: ss.GetSchemaUrl()})
+			}
+		}
+		if len(scopes) > 0 {
+			sampled = append(sampled, &tracepb.ResourceSpans{Resource: rs.GetResource(), ScopeSpans: scopes, SchemaUrl: rs.GetSchemaUrl()})
+		}
+	}
+	if len(sampled) == 0 {
+		return nil
+	}
+	return e.Exporter.UploadTraces(ctx, sampled)
+}
+
+// keep compares the low 63 bits of the trace ID's last 8 bytes against the
+// ratio, as TraceIdRatioBased does. IDs too short to carry them are kept.
+func (e *SamplingExporter) keep(traceID []byte) bool {
+	if len(traceID) < 16 {
+		return true
+	}
+	return binary.BigEndian.Uint64(traceID[8:16])>>1 < uint64(e.Ratio*(1<<63))
+}
+
+// RetryExporter retries failed uploads until MaxAttempts, waiting
+// RetryInterval between attempts. With a Multiplier, the wait grows by it
+// after every retry up to MaxInterval and is jittered by ±20% so that
+// forwarders do not retry in lockstep. A retry that would outlast the
+// context's deadline, such as the flush timeout, is not attempted.
 type RetryExporter struct {
 	Exporter
 	MaxAttempts   int
 	RetryInterval time.Duration
+	MaxInterval   time.Duration
+	Multiplier    float64
+	// Retryable reports whether an error is worth retrying; nil retries all.
+	Retryable func(error) bool
 }
 
 func (e *RetryExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
@@ -84,8 +306,15 @@ func (e *RetryExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.Res
 	})
 }
 
+func (e *RetryExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	return e.withRetry(ctx, "metrics", func(ctx context.Context) error {
+		return e.Exporter.UploadMetrics(ctx, protoMetrics)
+	})
+}
+
 func (e *RetryExporter) withRetry(ctx context.Context, kind string, fn func(context.Context) error) error {
 	var lastErr error
+	interval := e.RetryInterval
 	for i := 0; i < e.MaxAttempts; i++ {
 		err := fn(ctx)
 		if err == nil {
@@ -95,24 +324,103 @@ func (e *RetryExporter) withRetry(ctx context.Context, kind string, fn func(cont
 		if ctx.Err() != nil {
 			return lastErr
 		}
+		if e.Retryable != nil && !e.Retryable(err) {
+			slog.Debug("upload failed with a permanent error, not retrying", "kind", kind, "error", err)
+			return lastErr
+		}
 		if i < e.MaxAttempts-1 {
+			wait := interval
+			if e.Multiplier > 0 {
+				wait = time.Duration(float64(interval) * (0.8 + 0.4*rand.Float64()))
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				slog.Warn("upload failed, no time left to retry",
+					"kind", kind,
+					"attempt", i+1,
+					"error", err,
+				)
+				return lastErr
+			}
 			slog.Warn("upload failed, will retry",
 				"kind", kind,
 				"attempt", i+1,
 				"max_attempts", e.MaxAttempts,
-				"retry_interval", e.RetryInterval,
+				"retry_interval", wait,
 				"error", err,
 			)
 			select {
-			case <-time.After(e.RetryInterval):
+			case <-time.After(wait):
 			case <-ctx.Done():
 				return lastErr
 			}
+			if e.Multiplier > 0 {
+				interval = time.Duration(float64(interval) * e.Multiplier)
+				if e.MaxInterval > 0 && interval > e.MaxInterval {
+					interval = e.MaxInterval
+				}
+			}
 		}
 	}
 	return lastErr
 }
 
+// otlpStatusCode extracts the HTTP status of a failed OTLP/HTTP upload.
+var otlpStatusCode = regexp.MustCompile(`unexpected status code: (\d+)`)
+
+// isTransientOTLPError reports whether an OTLP upload error is worth
+// retrying: the gRPC codes and HTTP statuses the OTLP specification marks as
+// retryable, and failures to reach the collector. Rejected data, such as
+// partial success or 400 responses, is not retried.
+func isTransientOTLPError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The export timeout of a single attempt.
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+			codes.Unavailable, codes.ResourceExhausted, codes.DataLoss:
+			return true
+		}
+		return false
+	}
+	if m := otlpStatusCode.FindStringSubmatch(err.Error()); m != nil {
+		switch m[1] {
+		case "429", "502", "503", "504":
+			return true
+		}
+		return false
+	}
+	return strings.Contains(err.Error(), "failed to send request")
+}
+
+// TimeoutExporter bounds each upload, including its retries, by Timeout.
+// When it is a child of a MultiplexExporter, the multiplex also stops waiting
+// for it after Timeout, so a child that ignores its context does not hold up
+// the others.
+type TimeoutExporter struct {
+	Exporter
+	Timeout time.Duration
+}
+
+func (e *TimeoutExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	return e.Exporter.UploadLogs(ctx, protoLogs)
+}
+
+func (e *TimeoutExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	return e.Exporter.UploadTraces(ctx, protoSpans)
+}
+
+func (e *TimeoutExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	return e.Exporter.UploadMetrics(ctx, protoMetrics)
+}
+
 type OonceStartExporter struct {
 	Exporter
 	startErr error
@@ -140,6 +448,10 @@ func (e *NoopExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.Resourc
 	return nil
 }
 
+func (e *NoopExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	return nil
+}
+
 func (e *NoopExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
 	return nil
 }
@@ -207,53 +519,68 @@ func (e *MultiplexExporter) Stop(ctx context.Context) error {
 }
 
 func (e *MultiplexExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(e.exporters))
+	return e.uploadEach(ctx, func(ctx context.Context, exp Exporter) error {
+		return exp.UploadLogs(ctx, protoLogs)
+	})
+}
 
-	for _, exporter := range e.exporters {
-		wg.Add(1)
-		go func(exp Exporter) {
-			defer wg.Done()
-			if err := exp.UploadLogs(ctx, protoLogs); err != nil {
-				errCh <- err
-			}
-		}(exporter)
-	}
+func (e *MultiplexExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	return e.uploadEach(ctx, func(ctx context.Context, exp Exporter) error {
+		return exp.UploadTraces(ctx, protoSpans)
+	})
+}
 
-	wg.Wait()
-	close(errCh)
-	var errs []error
-	for err := range errCh {
-		errs = append(errs, err)
-	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
-	}
-	return nil
+func (e *MultiplexExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	return e.uploadEach(ctx, func(ctx context.Context, exp Exporter) error {
+		return exp.UploadMetrics(ctx, protoMetrics)
+	})
 }
 
-func (e *MultiplexExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+// uploadEach uploads to every child concurrently. A child with a timeout gets
+// its own context with that deadline and is waited for until then only: if it
+// is still running, its timeout is recorded as its error and it is left to
+// finish in the background, so a hung child delays the upload by at most its
+// timeout. Other children are called with ctx as is.
+func (e *MultiplexExporter) uploadEach(ctx context.Context, upload func(context.Context, Exporter) error) error {
+	errs := make([]error, len(e.exporters))
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(e.exporters))
-
-	for _, exporter := range e.exporters {
+	for i, exp := range e.exporters {
 		wg.Add(1)
-		go func(exp Exporter) {
+		go func() {
 			defer wg.Done()
-			if err := exp.UploadTraces(ctx, protoSpans); err != nil {
-				errCh <- err
+			timeout := childTimeout(exp)
+			if timeout <= 0 {
+				errs[i] = upload(ctx, exp)
+				return
 			}
-		}(exporter)
+			childCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- upload(childCtx, exp) }()
+			select {
+			case errs[i] = <-done:
+			case <-childCtx.Done():
+				select {
+				case errs[i] = <-done:
+					return
+				default:
+				}
+				if errors.Is(childCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+					errs[i] = fmt.Errorf("exporter %d of %d timed out after %s: %w", i+1, len(e.exporters), timeout, childCtx.Err())
+				} else {
+					errs[i] = childCtx.Err()
+				}
+			}
+		}()
 	}
-
 	wg.Wait()
-	close(errCh)
-	var errs []error
-	for err := range errCh {
-		errs = append(errs, err)
-	}
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	return errors.Join(errs...)
+}
+
+// childTimeout returns the upload timeout configured for a child, or 0.
+func childTimeout(exp Exporter) time.Duration {
+	if t, ok := exp.(*TimeoutExporter); ok {
+		return t.Timeout
 	}
-	return nil
+	return 0
 }
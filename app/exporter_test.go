@@ -83,6 +83,20 @@ func (mr *MockExporterMockRecorder) UploadLogs(ctx, protoLogs any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadLogs", reflect.TypeOf((*MockExporter)(nil).UploadLogs), ctx, protoLogs)
 }
 
+// UploadMetrics mocks base method.
+func (m *MockExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadMetrics", ctx, protoMetrics)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadMetrics indicates an expected call of UploadMetrics.
+func (mr *MockExporterMockRecorder) UploadMetrics(ctx, protoMetrics any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadMetrics", reflect.TypeOf((*MockExporter)(nil).UploadMetrics), ctx, protoMetrics)
+}
+
 // UploadTraces mocks base method.
 func (m *MockExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
 	m.ctrl.T.Helper()
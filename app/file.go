@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// FileExporter appends telemetry to a local file as OTLP JSON, for debugging
+// and runs without a collector. Each ResourceSpans, ResourceLogs or
+// ResourceMetrics is written as its own export request, e.g.
+// {"resourceSpans":[...]}, so the signal of every object is known and the
+// file can be read back by OTLP JSON file receivers. Writes are buffered
+// until Stop.
+type FileExporter struct {
+	path   string
+	format string
+
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+func NewFileExporter(cfg FileExporterConfig) *FileExporter {
+	format := cfg.Format
+	if format == "" {
+		format = FileFormatJSONL
+	}
+	return &FileExporter{path: cfg.Path, format: format}
+}
+
+// Start creates the parent directories and opens the file for appending. It
+// may be called again by every forwarder sharing the exporter.
+func (e *FileExporter) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o755); err != nil {
+		return fmt.Errorf("file: create directory: %w", err)
+	}
+	f, err := os.OpenFile(e.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("file: open: %w", err)
+	}
+	e.file = f
+	e.w = bufio.NewWriter(f)
+	return nil
+}
+
+// Stop flushes buffered writes and closes the file.
+func (e *FileExporter) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := errors.Join(e.w.Flush(), e.file.Close())
+	e.file, e.w = nil, nil
+	if err != nil {
+		return fmt.Errorf("file: close: %w", err)
+	}
+	return nil
+}
+
+func (e *FileExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	msgs := make([]proto.Message, 0, len(protoSpans))
+	for _, rs := range protoSpans {
+		msgs = append(msgs, &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*otlp.ResourceSpans{rs}})
+	}
+	return e.write(msgs)
+}
+
+func (e *FileExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	msgs := make([]proto.Message, 0, len(protoLogs))
+	for _, rl := range protoLogs {
+		msgs = append(msgs, &collogspb.ExportLogsServiceRequest{ResourceLogs: []*otlp.ResourceLogs{rl}})
+	}
+	return e.write(msgs)
+}
+
+func (e *FileExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	msgs := make([]proto.Message, 0, len(protoMetrics))
+	for _, rm := range protoMetrics {
+		msgs = append(msgs, &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*otlp.ResourceMetrics{rm}})
+	}
+	return e.write(msgs)
+}
+
+func (e *FileExporter) write(msgs []proto.Message) error {
+	opts := protojson.MarshalOptions{}
+	if e.format == FileFormatProtoJSON {
+		opts.Indent = "  "
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.w == nil {
+		return errors.New("file: exporter is not started")
+	}
+	for _, msg := range msgs {
+		b, err := opts.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("file: marshal: %w", err)
+		}
+		if _, err := e.w.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("file: write: %w", err)
+		}
+	}
+	return nil
+}
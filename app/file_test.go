@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "telemetry.jsonl")
+	resource := &resourcepb.Resource{Attributes: convertAttributesFromMap(map[string]any{"service.name": "dbt"})}
+	ctx := context.Background()
+
+	exp := NewFileExporter(FileExporterConfig{Path: path})
+	require.Error(t, exp.UploadTraces(ctx, nil), "uploads need Start")
+	require.NoError(t, exp.Start(ctx))
+	require.NoError(t, exp.Start(ctx), "forwarders sharing the exporter start it again")
+	require.NoError(t, exp.UploadTraces(ctx, []*otlp.ResourceSpans{
+		{Resource: resource, ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "model.a"}}}}},
+		{Resource: resource, ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "model.b"}}}}},
+	}))
+	require.NoError(t, exp.UploadLogs(ctx, []*otlp.ResourceLogs{
+		{Resource: resource, ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{SeverityText: "INFO"}}}}},
+	}))
+	_, err := os.Stat(path)
+	require.NoError(t, err, "parent directories are created")
+	require.NoError(t, exp.Stop(ctx))
+	require.NoError(t, exp.Stop(ctx))
+
+	// A second run appends to the same file.
+	exp = NewFileExporter(FileExporterConfig{Path: path, Format: FileFormatJSONL})
+	require.NoError(t, exp.Start(ctx))
+	require.NoError(t, exp.UploadMetrics(ctx, []*otlp.ResourceMetrics{
+		{Resource: resource, ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{Name: "dbt.rows_affected"}}}}},
+	}))
+	require.NoError(t, exp.Stop(ctx))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	require.Len(t, lines, 4, "one line per resource")
+
+	var traces coltracepb.ExportTraceServiceRequest
+	require.NoError(t, protojson.Unmarshal([]byte(lines[1]), &traces))
+	assert.Equal(t, "model.b", traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+	assert.Equal(t, "dbt", convertAttributesToMap(traces.ResourceSpans[0].Resource.Attributes)["service.name"])
+	var logs collogspb.ExportLogsServiceRequest
+	require.NoError(t, protojson.Unmarshal([]byte(lines[2]), &logs))
+	assert.Equal(t, "INFO", logs.ResourceLogs[0].ScopeLogs[0].LogRecords[0].SeverityText)
+	var metrics colmetricspb.ExportMetricsServiceRequest
+	require.NoError(t, protojson.Unmarshal([]byte(lines[3]), &metrics))
+	assert.Equal(t, "dbt.rows_affected", metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestFileExporter_ProtoJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telemetry.json")
+	ctx := context.Background()
+	exp := NewFileExporter(FileExporterConfig{Path: path, Format: FileFormatProtoJSON})
+	require.NoError(t, exp.Start(ctx))
+	require.NoError(t, exp.UploadTraces(ctx, []*otlp.ResourceSpans{
+		{ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "model.a"}}}}},
+	}))
+	require.NoError(t, exp.Stop(ctx))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Greater(t, strings.Count(string(b), "\n"), 1, "objects are indented")
+	var traces coltracepb.ExportTraceServiceRequest
+	require.NoError(t, protojson.Unmarshal(b, &traces))
+	assert.Equal(t, "model.a", traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+}
+
+func TestFileExporterConfig(t *testing.T) {
+	var cfg ExporterConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+type: file
+path: ./otlp/telemetry.jsonl
+format: protojson
+`), &cfg))
+	assert.Equal(t, FileExporterConfig{Path: "./otlp/telemetry.jsonl", Format: "protojson"}, cfg.File)
+	require.NoError(t, cfg.Validate())
+
+	cfg.File.Format = "yaml"
+	require.Error(t, cfg.Validate())
+	require.Error(t, (&ExporterConfig{Type: "file"}).Validate(), "path is required")
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// flushSignals request an immediate flush with RunParams.FlushOnSignal.
+var flushSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package app
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleFlushSignals(t *testing.T) {
+	a := newTestApp()
+	stop := a.handleFlushSignals()
+	defer stop()
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-a.flushRequests:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGUSR1 did not request a flush")
+	}
+}
@@ -0,0 +1,6 @@
+package app
+
+import "os"
+
+// flushSignals is empty, as Windows has no SIGUSR1.
+var flushSignals []os.Signal
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Forward decodes the OTEL JSONL lines read from r and forwards them through
+// the configured forward rules, without running dbt; for example to replay a
+// saved OTEL file. Lines are batched and flushed as in Run, and the decoder
+// options of params apply, including MarkReplayed. The whole input is forwarded unless Cutoff is
+// CutoffNow or Since is set. Options of the dbt run and the tail, such as
+// TargetCmd, LogPath, SpoolDir and StreamingDecode, are ignored. It returns an
+// error if r could not be read or some records could not be forwarded.
+func (a *App) Forward(ctx context.Context, r io.Reader, params RunParams) error {
+	forwarders := newForwarders(ctx, a.forwarderConfig(), a.stats)
+	defer func() {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer stopCancel()
+		for _, forwarder := range forwarders {
+			if err := forwarder.Stop(stopCtx); err != nil {
+				a.Logger.Warn("failed to stop forwarder", "error", err)
+			}
+		}
+	}()
+	return a.forward(ctx, r, forwarders, params)
+}
+
+func (a *App) forward(ctx context.Context, r io.Reader, forwarders []*Forwarder, params RunParams) error {
+	a.inFlight = newInFlightGate(a.cfg.MaxInFlightBytes)
+	// Like with NoExec, the lines come from an existing file rather than a
+	// running dbt, so MarkReplayed and ReplayID apply.
+	params.NoExec = true
+	var cutoffTimeNano uint64
+	switch {
+	case params.Cutoff == CutoffNow:
+		cutoffTimeNano = uint64(a.Now().UnixNano())
+	case !params.Since.IsZero():
+		cutoffTimeNano = uint64(params.Since.UnixNano())
+	}
+
+	// Files, such as the one Replay opens, are the source of their lines.
+	var source string
+	if f, ok := r.(interface{ Name() string }); ok {
+		source = f.Name()
+	}
+	lines := make(chan otelLine, 1000)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		readErr <- a.readLines(ctx, r, source, lines)
+	}()
+	if err := a.flushAndUpload(ctx, lines, forwarders, cutoffTimeNano, params); err != nil {
+		return err
+	}
+	// flushAndUpload stops early when ctx is done, without waiting for the
+	// reader, which may be blocked reading r.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := <-readErr; err != nil {
+		return err
+	}
+	if a.forwardFailed.Load() {
+		return errors.New("some OTEL data could not be forwarded")
+	}
+	return nil
+}
+
+// Replay forwards a previously captured OTEL file with Forward, ignoring
+// Cutoff; Since still skips older records. The run statistics are written to
+// StatsFile if set. It returns 0 if every record was forwarded and 1 otherwise.
+func (a *App) Replay(ctx context.Context, path string, params RunParams) int {
+	started := a.Now()
+	if params.StatsFile != "" {
+		a.stats = newRunStats()
+	}
+	code := 0
+	if err := a.replay(ctx, path, params); err != nil {
+		fmt.Fprintf(a.Stderr, "replay failed: %v\n", err)
+		code = 1
+	}
+	if params.StatsFile != "" {
+		a.writeStats(params.StatsFile, started, code)
+	}
+	return code
+}
+
+func (a *App) replay(ctx context.Context, path string, params RunParams) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	a.Logger.Info("replaying OTEL file", "path", path, "since", params.Since)
+	params.Cutoff = CutoffNone
+	return a.Forward(ctx, f, params)
+}
+
+// readLines sends the non-empty lines of r, read from source, to lines until
+// r ends or ctx is done.
+func (a *App) readLines(ctx context.Context, r io.Reader, source string, lines chan<- otelLine) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			a.linesRead.Add(1)
+			select {
+			case lines <- otelLine{text: line, source: source, readAt: a.Now()}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read OTEL lines: %w", err)
+		}
+	}
+}
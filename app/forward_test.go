@@ -0,0 +1,208 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestApp_Forward(t *testing.T) {
+	fixture := readTestdataLines(t, "testdata/otel.jsonl")
+	expectedSpans, expectedLogs, err := NewDecoder(0).DecodeLines(fixture)
+	require.NoError(t, err)
+	require.NotEmpty(t, expectedSpans)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	var spans, logs atomic.Int64
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			spans.Add(int64(len(protoSpans[0].ScopeSpans[0].Spans)))
+			return nil
+		},
+	).MinTimes(1)
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			logs.Add(int64(len(protoLogs[0].ScopeLogs[0].LogRecords)))
+			return nil
+		},
+	).AnyTimes()
+
+	f, err := os.Open("testdata/otel.jsonl")
+	require.NoError(t, err)
+	defer f.Close()
+	a := newTestApp()
+	require.NoError(t, a.forward(context.Background(), f, newMockForwarder(t, mock), RunParams{FlushTimeout: 5 * time.Second}))
+	assert.Equal(t, int64(len(expectedSpans)), spans.Load())
+	assert.Equal(t, int64(len(expectedLogs)), logs.Load())
+	assert.Equal(t, int64(len(fixture)), a.linesRead.Load())
+}
+
+func TestApp_Forward_UploadFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(errors.New("unavailable"))
+
+	r := strings.NewReader(strings.Join(spanLines(0, 2), "\r\n"))
+	err := newTestApp().forward(context.Background(), r, newMockForwarder(t, mock), RunParams{FlushTimeout: 5 * time.Second})
+	assert.ErrorContains(t, err, "could not be forwarded")
+}
+
+func TestApp_Forward_ConfiguredExporters(t *testing.T) {
+	var memory bytes.Buffer
+	a := newTestApp()
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &memory}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory"}}},
+		},
+	}
+	r := strings.NewReader(strings.Join(spanLines(0, 2), "\n") + "\n")
+	require.NoError(t, a.Forward(context.Background(), r, RunParams{FlushTimeout: 5 * time.Second}))
+	assert.Contains(t, memory.String(), "traces: 2 spans")
+}
+
+func TestApp_Replay(t *testing.T) {
+	var spansUploaded atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if assert.NoError(t, proto.Unmarshal(body, &req)) {
+			for _, rs := range req.GetResourceSpans() {
+				for _, ss := range rs.GetScopeSpans() {
+					spansUploaded.Add(int64(len(ss.GetSpans())))
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "otel.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(spanLines(0, 10), "\n")+"\n"), 0o600))
+	newApp := func() *App {
+		a := newTestApp()
+		a.cfg = &Config{
+			Exporters: map[string]ExporterConfig{
+				"otlp": {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+			},
+			Forward: map[string]ForwardConfig{
+				"default": {Traces: &TracesForwardConfig{Exporters: []string{"otlp"}}},
+			},
+		}
+		return a
+	}
+
+	// The cutoff is ignored, so the spans of the old run are forwarded.
+	assert.Equal(t, 0, newApp().Replay(context.Background(), path, RunParams{FlushTimeout: 5 * time.Second, Cutoff: CutoffNow}))
+	assert.Equal(t, int64(10), spansUploaded.Load())
+
+	spansUploaded.Store(0)
+	assert.Equal(t, 0, newApp().Replay(context.Background(), path, RunParams{FlushTimeout: 5 * time.Second, Since: time.Unix(0, 1005)}))
+	assert.Equal(t, int64(5), spansUploaded.Load(), "spans started before since are skipped")
+
+	var stderr bytes.Buffer
+	a := newApp()
+	a.Stderr = &stderr
+	assert.Equal(t, 1, a.Replay(context.Background(), filepath.Join(t.TempDir(), "missing.jsonl"), RunParams{FlushTimeout: 5 * time.Second}))
+	assert.Contains(t, stderr.String(), "replay failed: ")
+}
+
+func TestApp_Forward_SourceFileAttribute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	var mu sync.Mutex
+	sources := make(map[string]string) // span name or log body -> dbt.source_file
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, span := range protoSpans[0].ScopeSpans[0].Spans {
+				sources[span.Name], _ = convertAttributesToMap(span.Attributes)["dbt.source_file"].(string)
+			}
+			return nil
+		},
+	).AnyTimes()
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, log := range protoLogs[0].ScopeLogs[0].LogRecords {
+				sources[log.Body.GetStringValue()], _ = convertAttributesToMap(log.Attributes)["dbt.source_file"].(string)
+			}
+			return nil
+		},
+	).AnyTimes()
+
+	dir := t.TempDir()
+	files := map[string][]string{
+		filepath.Join(dir, "first.jsonl"):  append(spanLines(0, 1), `{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1500","severity_text":"INFO","body":"from first"}`),
+		filepath.Join(dir, "second.jsonl"): append(spanLines(1, 1), `{"record_type":"LogRecord","trace_id":"00000000000000000000000000000001","span_id":"0000000000000001","time_unix_nano":"1501","severity_text":"INFO","body":"from second"}`),
+	}
+	a := newTestApp()
+	a.cfg.Decoder.SourceFileAttribute = "dbt.source_file"
+	for path, lines := range files {
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		require.NoError(t, a.forward(context.Background(), f, newMockForwarder(t, mock), RunParams{FlushTimeout: 5 * time.Second}))
+		f.Close()
+	}
+	first, second := filepath.Join(dir, "first.jsonl"), filepath.Join(dir, "second.jsonl")
+	assert.Equal(t, map[string]string{
+		"span-0":      first,
+		"from first":  first,
+		"span-1":      second,
+		"from second": second,
+	}, sources)
+}
+
+func TestApp_Forward_MarkReplayed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	var spans []*tracepb.Span
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			spans = append(spans, protoSpans[0].ScopeSpans[0].Spans...)
+			return nil
+		},
+	).AnyTimes()
+
+	// Forward never runs dbt, so the records are marked without NoExec.
+	a := newTestApp()
+	require.NoError(t, a.forward(context.Background(), strings.NewReader(strings.Join(spanLines(0, 2), "\n")+"\n"), newMockForwarder(t, mock), RunParams{
+		FlushTimeout: 5 * time.Second,
+		MarkReplayed: true,
+		ReplayID:     "backfill-1",
+	}))
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		attrs := convertAttributesToMap(span.Attributes)
+		assert.Equal(t, true, attrs["dbt.replayed"])
+		assert.Equal(t, "backfill-1", attrs["dbt.replay_id"])
+	}
+}
@@ -1,24 +1,62 @@
 package app
 
 import (
+	"cmp"
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
 	"log/slog"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/cel-go/cel"
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 type Forwarder struct {
-	name                   string
-	resourceAttributes     []*commonpb.KeyValue
-	cfg                    ForwardConfig
-	logsExporter           Exporter
-	tracesExporter         Exporter
-	spanAttributeModifiers []*attributeModifier
-	logAttributeModifiers  []*attributeModifier
+	name                     string
+	resourceAttributes       []*commonpb.KeyValue
+	cfg                      ForwardConfig
+	logsExporter             Exporter
+	tracesExporter           Exporter
+	metricsExporter          Exporter
+	spanAttributeModifiers   []*attributeModifier
+	logAttributeModifiers    []*attributeModifier
+	metricAttributeModifiers []*attributeModifier
+	logBodyProg              cel.Program
+	spanDropProg             cel.Program
+	logDropProg              cel.Program
+	matchProg                cel.Program    // nil uploads the records no forwarder matches
+	router                   *forwardRouter // set when a forwarder of the run has a match expression
+	sampleRand               func() float64 // draws log sampling decisions
+	reservedKeys             map[string]bool
+	reservedWarned           sync.Map // keys already warned about by the warn policy
+
+	mu       sync.Mutex
+	dbSystem string // detected from the first span carrying dbt.adapter_type
+}
+
+// defaultDBSystems maps dbt adapter types whose name differs from the
+// OpenTelemetry db.system value. Other adapter types are used as is.
+var defaultDBSystems = map[string]string{
+	"postgres":  "postgresql",
+	"sqlserver": "mssql",
 }
 
 func NewForwarder(name string, cfg ForwardConfig, exporters map[string]Exporter) (*Forwarder, error) {
@@ -29,8 +67,16 @@ func NewForwarder(name string, cfg ForwardConfig, exporters map[string]Exporter)
 	if _, ok := attrs["service.name"]; !ok {
 		attrs["service.name"] = "dbt"
 	}
+	if cfg.Resource != nil && cfg.Resource.CIAttributes {
+		for key, value := range DetectCIAttributes(os.Getenv) {
+			if _, ok := attrs[key]; !ok {
+				attrs[key] = value
+			}
+		}
+	}
 	spanAttrModifiers := make([]*attributeModifier, 0)
-	if cfg.Traces != nil && len(cfg.Traces.Attributes) > 0 {
+	var spanDropProg cel.Program
+	if cfg.Traces != nil && (len(cfg.Traces.Attributes) > 0 || cfg.Traces.DropWhen != nil) {
 		env, err := NewSpanEnv()
 		if err != nil {
 			return nil, err
@@ -43,14 +89,25 @@ func NewForwarder(name string, cfg ForwardConfig, exporters map[string]Exporter)
 			}
 			spanAttrModifiers = append(spanAttrModifiers, modifier)
 		}
+		if cfg.Traces.DropWhen != nil {
+			spanDropProg, err = compileExpr(*cfg.Traces.DropWhen, env)
+			if err != nil {
+				slog.Warn("failed to create span drop_when expression", "forwarder", name, "error", err)
+			}
+		}
 	}
 	logAttrModifiers := make([]*attributeModifier, 0)
-	if cfg.Logs != nil && len(cfg.Logs.Attributes) > 0 {
+	var logBodyProg, logDropProg cel.Program
+	if cfg.Logs != nil && (len(cfg.Logs.Attributes) > 0 || cfg.Logs.Body != nil || cfg.Logs.DropWhen != nil) {
 		logEnv, err := NewLogEnv()
 		if err != nil {
 			return nil, err
 		}
 		for _, modCfg := range cfg.Logs.Attributes {
+			if modCfg.SpanNamePattern != "" {
+				slog.Warn("span_name_pattern is ignored for log attribute modifiers", "forwarder", name, "key", modCfg.Key)
+				modCfg.SpanNamePattern = ""
+			}
 			modifier, err := newAttributeModifier(modCfg, logEnv)
 			if err != nil {
 				slog.Warn("failed to create log attribute modifier", "forwarder", name, "error", err)
@@ -58,16 +115,83 @@ func NewForwarder(name string, cfg ForwardConfig, exporters map[string]Exporter)
 			}
 			logAttrModifiers = append(logAttrModifiers, modifier)
 		}
+		if cfg.Logs.Body != nil {
+			logBodyProg, err = compileLogBody(cfg.Logs.Body, logEnv)
+			if err != nil {
+				slog.Warn("failed to create log body expression", "forwarder", name, "error", err)
+			}
+		}
+		if cfg.Logs.DropWhen != nil {
+			logDropProg, err = compileExpr(*cfg.Logs.DropWhen, logEnv)
+			if err != nil {
+				slog.Warn("failed to create log drop_when expression", "forwarder", name, "error", err)
+			}
+		}
+	}
+	metricAttrModifiers := make([]*attributeModifier, 0)
+	if cfg.Metrics != nil && len(cfg.Metrics.Attributes) > 0 {
+		metricEnv, err := NewMetricEnv()
+		if err != nil {
+			return nil, err
+		}
+		for _, modCfg := range cfg.Metrics.Attributes {
+			if modCfg.SpanNamePattern != "" {
+				slog.Warn("span_name_pattern is ignored for metric attribute modifiers", "forwarder", name, "key", modCfg.Key)
+				modCfg.SpanNamePattern = ""
+			}
+			modifier, err := newAttributeModifier(modCfg, metricEnv)
+			if err != nil {
+				slog.Warn("failed to create metric attribute modifier", "forwarder", name, "error", err)
+				continue
+			}
+			metricAttrModifiers = append(metricAttrModifiers, modifier)
+		}
+	}
+	for _, modifier := range slices.Concat(spanAttrModifiers, logAttrModifiers, metricAttrModifiers) {
+		modifier.resource = attrs
+	}
+	var reservedKeys map[string]bool
+	switch cfg.ReservedAttributes {
+	case "":
+	case ReservedAttributesWarn, ReservedAttributesDrop, ReservedAttributesPrefix:
+		reservedKeys = make(map[string]bool, len(reservedResourceKeys)+len(attrs))
+		for _, key := range reservedResourceKeys {
+			reservedKeys[key] = true
+		}
+		for key := range attrs {
+			reservedKeys[key] = true
+		}
+	default:
+		slog.Warn("unknown reserved_attributes policy, keeping reserved attributes", "forwarder", name, "policy", cfg.ReservedAttributes)
+	}
+	var matchProg cel.Program
+	if cfg.Match != nil {
+		env, err := NewMatchEnv()
+		if err != nil {
+			return nil, err
+		}
+		// A broken match would route every record to the default forwarders.
+		if matchProg, err = compileExpr(*cfg.Match, env); err != nil {
+			return nil, fmt.Errorf("invalid match: %w", err)
+		}
 	}
 	fw := &Forwarder{
-		name:                   name,
-		cfg:                    cfg,
-		resourceAttributes:     convertAttributesFromMap(attrs),
-		spanAttributeModifiers: spanAttrModifiers,
-		logAttributeModifiers:  logAttrModifiers,
+		name:                     name,
+		cfg:                      cfg,
+		resourceAttributes:       convertAttributesFromMap(attrs),
+		spanAttributeModifiers:   spanAttrModifiers,
+		logAttributeModifiers:    logAttrModifiers,
+		metricAttributeModifiers: metricAttrModifiers,
+		logBodyProg:              logBodyProg,
+		spanDropProg:             spanDropProg,
+		logDropProg:              logDropProg,
+		matchProg:                matchProg,
+		sampleRand:               rand.Float64,
+		reservedKeys:             reservedKeys,
 	}
 	logsExporters := make([]Exporter, 0)
 	tracesExporters := make([]Exporter, 0)
+	metricsExporters := make([]Exporter, 0)
 
 	if cfg.Logs == nil {
 		cfg.Logs = &LogsForwardConfig{}
@@ -102,6 +226,23 @@ func NewForwarder(name string, cfg ForwardConfig, exporters map[string]Exporter)
 	} else if len(tracesExporters) > 1 {
 		fw.tracesExporter = NewMultiplexExporter(tracesExporters...)
 	}
+
+	if cfg.Metrics == nil {
+		cfg.Metrics = &MetricsForwardConfig{}
+	}
+	for _, name := range cfg.Metrics.Exporters {
+		exp, ok := exporters[name]
+		if !ok {
+			slog.Warn("metrics exporter not found", "name", name)
+			continue
+		}
+		metricsExporters = append(metricsExporters, exp)
+	}
+	if len(metricsExporters) == 1 {
+		fw.metricsExporter = metricsExporters[0]
+	} else if len(metricsExporters) > 1 {
+		fw.metricsExporter = NewMultiplexExporter(metricsExporters...)
+	}
 	return fw, nil
 }
 
@@ -116,6 +257,11 @@ func (f *Forwarder) Start(ctx context.Context) error {
 			return err
 		}
 	}
+	if f.metricsExporter != nil {
+		if err := f.metricsExporter.Start(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -130,10 +276,47 @@ func (f *Forwarder) Stop(ctx context.Context) error {
 			return err
 		}
 	}
+	if f.metricsExporter != nil {
+		if err := f.metricsExporter.Stop(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Warmup establishes connections for the forwarder's exporters.
+func (f *Forwarder) Warmup(ctx context.Context) error {
+	var errs []error
+	if f.tracesExporter != nil {
+		errs = append(errs, warmupExporter(ctx, f.tracesExporter))
+	}
+	if f.logsExporter != nil {
+		errs = append(errs, warmupExporter(ctx, f.logsExporter))
+	}
+	if f.metricsExporter != nil {
+		errs = append(errs, warmupExporter(ctx, f.metricsExporter))
+	}
+	return errors.Join(errs...)
+}
+
 func (f *Forwarder) UploadLogs(ctx context.Context, scopeLogs *logspb.ScopeLogs) error {
+	if logs := f.cfg.Logs; logs != nil && (logs.Sampling != nil || f.logDropProg != nil) {
+		sampling := logs.Sampling
+		// The record slice is shared with other forwarders, so sample into a new one.
+		kept := make([]*logspb.LogRecord, 0, len(scopeLogs.GetLogRecords()))
+		for _, log := range scopeLogs.GetLogRecords() {
+			if f.logDropProg != nil && f.dropped(f.logDropProg, LogForEval(log), "logs") {
+				continue
+			}
+			if sampling == nil || f.keepLog(sampling, log) {
+				kept = append(kept, log)
+			}
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		scopeLogs.LogRecords = kept
+	}
 	logs := scopeLogs.GetLogRecords()
 	if len(f.logAttributeModifiers) > 0 {
 		for _, log := range logs {
@@ -150,11 +333,42 @@ func (f *Forwarder) UploadLogs(ctx context.Context, scopeLogs *logspb.ScopeLogs)
 			log.Attributes = convertAttributesFromMap(attrsMap)
 		}
 	}
+	if f.logBodyProg != nil {
+		// The records are shared with other forwarders, so rewrite the bodies of copies.
+		rewritten := slices.Clone(logs)
+		for i, log := range logs {
+			// Evaluated after the attribute modifiers so the body can use their results.
+			out, _, err := f.logBodyProg.Eval(LogForEval(log))
+			if err != nil {
+				slog.Warn("failed to evaluate log body expression", "forwarder", f.name, "error", err)
+				continue
+			}
+			log = proto.Clone(log).(*logspb.LogRecord)
+			log.Body = jsonValueToKeyValue("body", out.Value()).GetValue()
+			rewritten[i] = log
+		}
+		logs = rewritten
+		scopeLogs.LogRecords = logs
+	}
+	if f.rewritesAttributes() {
+		// The records are shared with other forwarders, so rewrite copies.
+		logs = cloneMessages(logs)
+		scopeLogs.LogRecords = logs
+	}
+	if f.cfg.DropEmptyAttributes {
+		for _, log := range logs {
+			log.Attributes = dropEmptyAttributes(log.Attributes)
+		}
+	}
+	if f.reservedKeys != nil {
+		for _, log := range logs {
+			log.Attributes = f.handleReservedAttributes("log", log.Attributes)
+		}
+	}
 	resourceLogs := &logspb.ResourceLogs{
-		Resource: &resourcepb.Resource{
-			Attributes: f.resourceAttributes,
-		},
+		Resource:  f.resource(),
 		ScopeLogs: []*logspb.ScopeLogs{scopeLogs},
+		SchemaUrl: f.resourceSchemaURL(),
 	}
 	protoLogs := []*logspb.ResourceLogs{resourceLogs}
 	if f.logsExporter != nil {
@@ -165,7 +379,21 @@ func (f *Forwarder) UploadLogs(ctx context.Context, scopeLogs *logspb.ScopeLogs)
 }
 
 func (f *Forwarder) UploadTraces(ctx context.Context, scopeSpans *tracepb.ScopeSpans) error {
-	spans := scopeSpans.GetSpans()
+	if traces := f.cfg.Traces; traces != nil && (traces.MinDuration != nil || traces.MaxDuration != nil || f.spanDropProg != nil) {
+		// The span slice is shared with other forwarders, so filter into a new one.
+		kept := make([]*tracepb.Span, 0, len(scopeSpans.GetSpans()))
+		for _, span := range scopeSpans.GetSpans() {
+			if traces.keepSpan(span) && (f.spanDropProg == nil || !f.dropped(f.spanDropProg, SpanForEval(span), "traces")) {
+				kept = append(kept, span)
+			}
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		scopeSpans.Spans = kept
+	}
+	spans := f.stampDBSystem(scopeSpans.GetSpans())
+	scopeSpans.Spans = spans
 	if len(f.spanAttributeModifiers) > 0 {
 		for _, span := range spans {
 			attrsMap := convertAttributesToMap(span.GetAttributes())
@@ -181,13 +409,45 @@ func (f *Forwarder) UploadTraces(ctx context.Context, scopeSpans *tracepb.ScopeS
 			span.Attributes = convertAttributesFromMap(attrsMap)
 		}
 	}
+	if f.rewritesAttributes() {
+		// The spans are shared with other forwarders, so rewrite copies.
+		spans = cloneMessages(spans)
+		scopeSpans.Spans = spans
+	}
+	if f.cfg.DropEmptyAttributes {
+		for _, span := range spans {
+			span.Attributes = dropEmptyAttributes(span.Attributes)
+			for _, event := range span.Events {
+				event.Attributes = dropEmptyAttributes(event.Attributes)
+			}
+		}
+	}
+	if f.reservedKeys != nil {
+		for _, span := range spans {
+			span.Attributes = f.handleReservedAttributes("span", span.Attributes)
+		}
+	}
 	resourceSpans := &tracepb.ResourceSpans{
-		Resource: &resourcepb.Resource{
-			Attributes: f.resourceAttributes,
-		},
+		Resource:   f.resource(),
 		ScopeSpans: []*tracepb.ScopeSpans{scopeSpans},
+		SchemaUrl:  f.resourceSchemaURL(),
 	}
 	protoSpans := []*tracepb.ResourceSpans{resourceSpans}
+	if traces := f.cfg.Traces; traces != nil && traces.MaxSpansPerResource > 0 && len(spans) > traces.MaxSpansPerResource {
+		// Backends limiting spans per resource get the same resource repeated.
+		protoSpans = protoSpans[:0]
+		for chunk := range slices.Chunk(spans, traces.MaxSpansPerResource) {
+			protoSpans = append(protoSpans, &tracepb.ResourceSpans{
+				Resource: f.resource(),
+				ScopeSpans: []*tracepb.ScopeSpans{{
+					Scope:     scopeSpans.GetScope(),
+					SchemaUrl: scopeSpans.GetSchemaUrl(),
+					Spans:     chunk,
+				}},
+				SchemaUrl: f.resourceSchemaURL(),
+			})
+		}
+	}
 	if f.tracesExporter != nil {
 		slog.Debug("forwarder uploading traces", "forwarder", f.name, "span_count", len(spans))
 		return f.tracesExporter.UploadTraces(ctx, protoSpans)
@@ -195,7 +455,241 @@ func (f *Forwarder) UploadTraces(ctx context.Context, scopeSpans *tracepb.ScopeS
 	return nil
 }
 
+// UploadMetrics sends metrics wrapped in the forwarder's resource. Attribute
+// modifiers are applied to every data point.
+func (f *Forwarder) UploadMetrics(ctx context.Context, scopeMetrics *metricspb.ScopeMetrics) error {
+	metrics := scopeMetrics.GetMetrics()
+	if f.rewritesAttributes() {
+		// The metrics are shared with other forwarders, so rewrite copies.
+		metrics = cloneMessages(metrics)
+		scopeMetrics.Metrics = metrics
+	}
+	for _, metric := range metrics {
+		for _, dp := range metric.GetGauge().GetDataPoints() {
+			if len(f.metricAttributeModifiers) > 0 {
+				attrsMap := convertAttributesToMap(dp.GetAttributes())
+				metricObj := MetricForEval(metric, dp)
+				for _, modifier := range f.metricAttributeModifiers {
+					var err error
+					attrsMap, err = modifier.Apply(metricObj, attrsMap)
+					if err != nil {
+						slog.Warn("failed to apply metric attribute modifier", "forwarder", f.name, "error", err)
+						continue
+					}
+				}
+				dp.Attributes = convertAttributesFromMap(attrsMap)
+			}
+			if f.cfg.DropEmptyAttributes {
+				dp.Attributes = dropEmptyAttributes(dp.Attributes)
+			}
+			if f.reservedKeys != nil {
+				dp.Attributes = f.handleReservedAttributes("metric", dp.Attributes)
+			}
+		}
+	}
+	resourceMetrics := &metricspb.ResourceMetrics{
+		Resource:     f.resource(),
+		ScopeMetrics: []*metricspb.ScopeMetrics{scopeMetrics},
+		SchemaUrl:    f.resourceSchemaURL(),
+	}
+	if f.metricsExporter != nil {
+		slog.Debug("forwarder uploading metrics", "forwarder", f.name, "metric_count", len(metrics))
+		return f.metricsExporter.UploadMetrics(ctx, []*metricspb.ResourceMetrics{resourceMetrics})
+	}
+	return nil
+}
+
+// keepSpan reports whether the span's duration is within min_duration and max_duration.
+func (cfg *TracesForwardConfig) keepSpan(span *tracepb.Span) bool {
+	var d time.Duration
+	if span.GetEndTimeUnixNano() > span.GetStartTimeUnixNano() {
+		d = time.Duration(span.GetEndTimeUnixNano() - span.GetStartTimeUnixNano())
+	}
+	if cfg.MinDuration != nil && d < *cfg.MinDuration {
+		return false
+	}
+	if cfg.MaxDuration != nil && d > *cfg.MaxDuration {
+		return false
+	}
+	return true
+}
+
+// dropped evaluates a drop_when expression. Records are kept when it fails,
+// e.g. on a missing attribute.
+func (f *Forwarder) dropped(prog cel.Program, obj any, signal string) bool {
+	out, _, err := prog.Eval(obj)
+	if err != nil {
+		slog.Warn("failed to evaluate drop_when expression, keeping the record", "forwarder", f.name, "signal", signal, "error", err)
+		return false
+	}
+	drop, ok := out.Value().(bool)
+	return ok && drop
+}
+
+// keepLog reports whether a log record passes sampling. Records without a
+// severity number are judged by their severity text.
+func (f *Forwarder) keepLog(sampling *LogSamplingConfig, log *logspb.LogRecord) bool {
+	minSeverity, _ := severityNumber(sampling.MinSeverity)
+	severity := log.GetSeverityNumber()
+	if severity == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		severity, _ = severityNumber(log.GetSeverityText())
+	}
+	if severity >= minSeverity {
+		return true
+	}
+	return f.sampleRand() < sampling.Ratio
+}
+
+// rewritesAttributes reports whether the forwarder removes or renames
+// attributes of the records it uploads, on top of the attribute modifiers.
+func (f *Forwarder) rewritesAttributes() bool {
+	return f.cfg.DropEmptyAttributes || (f.reservedKeys != nil && f.cfg.ReservedAttributes != ReservedAttributesWarn)
+}
+
+// dropEmptyAttributes removes attributes with an empty string, empty array or
+// null value. Booleans and numbers are always kept, even when false or 0.
+func dropEmptyAttributes(attrs []*commonpb.KeyValue) []*commonpb.KeyValue {
+	return slices.DeleteFunc(attrs, func(attr *commonpb.KeyValue) bool {
+		switch v := attr.GetValue().GetValue().(type) {
+		case nil:
+			return true
+		case *commonpb.AnyValue_StringValue:
+			return v.StringValue == ""
+		case *commonpb.AnyValue_ArrayValue:
+			return len(v.ArrayValue.GetValues()) == 0
+		}
+		return false
+	})
+}
+
+// reservedResourceKeys are the resource keys of the OpenTelemetry semantic
+// conventions that backends read from the resource only, so the same key on a
+// span, log or metric is confusing. The forwarder's own resource keys are
+// reserved too.
+var reservedResourceKeys = []string{
+	"service.name",
+	"service.namespace",
+	"service.version",
+	"service.instance.id",
+	"telemetry.sdk.name",
+	"telemetry.sdk.language",
+	"telemetry.sdk.version",
+	"host.name",
+	"host.id",
+	"deployment.environment",
+	"deployment.environment.name",
+}
+
+// handleReservedAttributes applies the reserved_attributes policy to the
+// attributes whose key is reserved. With the prefix policy, an attribute
+// whose prefixed key is already set is dropped instead.
+func (f *Forwarder) handleReservedAttributes(signal string, attrs []*commonpb.KeyValue) []*commonpb.KeyValue {
+	switch f.cfg.ReservedAttributes {
+	case ReservedAttributesWarn:
+		for _, attr := range attrs {
+			if !f.reservedKeys[attr.GetKey()] {
+				continue
+			}
+			if _, warned := f.reservedWarned.LoadOrStore(attr.GetKey(), true); !warned {
+				slog.Warn("attribute key is reserved for the resource", "forwarder", f.name, "signal", signal, "key", attr.GetKey())
+			}
+		}
+		return attrs
+	case ReservedAttributesDrop, ReservedAttributesPrefix:
+		prefix := f.cfg.ReservedAttributesPrefix
+		if prefix == "" {
+			prefix = "dbt."
+		}
+		kept := make([]*commonpb.KeyValue, 0, len(attrs))
+		for _, attr := range attrs {
+			switch {
+			case !f.reservedKeys[attr.GetKey()]:
+				kept = append(kept, attr)
+			case f.cfg.ReservedAttributes == ReservedAttributesPrefix && !hasAttribute(attrs, prefix+attr.GetKey()):
+				kept = append(kept, &commonpb.KeyValue{Key: prefix + attr.GetKey(), Value: attr.GetValue()})
+			}
+		}
+		return kept
+	}
+	return attrs
+}
+
+// resource returns the forwarder's resource, with db.system once it is known.
+func (f *Forwarder) resource() *resourcepb.Resource {
+	f.mu.Lock()
+	dbSystem := f.dbSystem
+	f.mu.Unlock()
+	attrs := f.resourceAttributes
+	if dbSystem != "" && !hasAttribute(attrs, "db.system") {
+		attrs = append(slices.Clip(attrs), &commonpb.KeyValue{
+			Key:   "db.system",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: dbSystem}},
+		})
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func (f *Forwarder) resourceSchemaURL() string {
+	if f.cfg.Resource == nil {
+		return ""
+	}
+	return f.cfg.Resource.SchemaURL
+}
+
+// stampDBSystem returns spans with db.system set on those that ran queries
+// through a dbt adapter and remembers the first value for the resource. The
+// spans are shared with other forwarders, which may map the adapter to another
+// db.system, so the stamped spans are copies.
+func (f *Forwarder) stampDBSystem(spans []*tracepb.Span) []*tracepb.Span {
+	stamped := spans
+	for i, span := range spans {
+		var adapter string
+		for _, attr := range span.GetAttributes() {
+			if attr.GetKey() == "dbt.adapter_type" {
+				adapter = attr.GetValue().GetStringValue()
+				break
+			}
+		}
+		if adapter == "" {
+			continue
+		}
+		dbSystem, ok := f.cfg.DBSystemMapping[adapter]
+		if !ok {
+			dbSystem, ok = defaultDBSystems[adapter]
+		}
+		if !ok {
+			dbSystem = adapter
+		}
+		if dbSystem == "" {
+			continue
+		}
+		f.mu.Lock()
+		if f.dbSystem == "" {
+			f.dbSystem = dbSystem
+		}
+		f.mu.Unlock()
+		if hasAttribute(span.Attributes, "db.system") {
+			continue
+		}
+		if &stamped[0] == &spans[0] {
+			stamped = slices.Clone(spans)
+		}
+		span = proto.Clone(span).(*tracepb.Span)
+		span.Attributes = append(span.Attributes, &commonpb.KeyValue{
+			Key:   "db.system",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: dbSystem}},
+		})
+		stamped[i] = span
+	}
+	return stamped
+}
+
 func NewForwarders(ctx context.Context, cfg *Config) []*Forwarder {
+	return newForwarders(ctx, cfg, nil)
+}
+
+// newForwarders is NewForwarders counting the exporter uploads in stats.
+func newForwarders(ctx context.Context, cfg *Config, stats *runStats) []*Forwarder {
 	if len(cfg.Exporters) == 0 {
 		slog.Warn("no exporters configured, using noop exporter")
 		return []*Forwarder{}
@@ -205,6 +699,7 @@ func NewForwarders(ctx context.Context, cfg *Config) []*Forwarder {
 		slog.Warn("no valid exporters configured, using noop exporter")
 		return []*Forwarder{}
 	}
+	stats.wrapExporters(exporters)
 	forwarders := make([]*Forwarder, 0, len(cfg.Forward))
 	for name, fwCfg := range cfg.Forward {
 		fw, err := NewForwarder(name, fwCfg, exporters)
@@ -218,21 +713,48 @@ func NewForwarders(ctx context.Context, cfg *Config) []*Forwarder {
 		}
 		forwarders = append(forwarders, fw)
 	}
+	routeForwarders(forwarders)
 	return forwarders
 }
 
 type attributeModifier struct {
-	action    string
-	when      cel.Program
-	key       string
-	value     any
-	valueProg cel.Program
+	action          string
+	when            cel.Program
+	spanNamePattern *regexp.Regexp
+	key             string
+	value           any
+	valueProg       cel.Program
+	mapping         map[string]any
+	mapDefault      any
+	to              string
+	from            string
+	resource        map[string]any // copy action: read when the record lacks from
+	newHash         func() hash.Hash
+	salt            string
+	maxLength       int
+	valueType       string      // set action: expected type of value_expr results
+	typeWarned      atomic.Bool // a mismatching value_expr result was warned about
+}
+
+// hashAlgorithms are the digests of the hash action.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
 }
 
 func newAttributeModifier(cfg AttributeModifierConfig, env *cel.Env) (*attributeModifier, error) {
 	var whenProg cel.Program
 	var valueProg cel.Program
+	var spanNamePattern *regexp.Regexp
 	var err error
+	if cfg.SpanNamePattern != "" {
+		spanNamePattern, err = regexp.Compile(cfg.SpanNamePattern)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if cfg.When != nil {
 		ast, issues := env.Compile(*cfg.When)
 		if issues != nil && issues.Err() != nil {
@@ -254,15 +776,43 @@ func newAttributeModifier(cfg AttributeModifierConfig, env *cel.Env) (*attribute
 		}
 	}
 	return &attributeModifier{
-		action:    cfg.Action,
-		when:      whenProg,
-		key:       cfg.Key,
-		value:     cfg.Value,
-		valueProg: valueProg,
+		action:          cfg.Action,
+		when:            whenProg,
+		spanNamePattern: spanNamePattern,
+		key:             cfg.Key,
+		value:           toValueType(cfg.ValueType, cfg.Value),
+		valueProg:       valueProg,
+		mapping:         cfg.Mapping,
+		mapDefault:      cfg.Default,
+		to:              cfg.To,
+		from:            cfg.From,
+		newHash:         hashAlgorithms[cmp.Or(cfg.Algorithm, "sha256")],
+		salt:            cfg.Salt,
+		maxLength:       cfg.MaxLength,
+		valueType:       cfg.ValueType,
 	}, nil
 }
 
+func compileLogBody(cfg *LogBodyConfig, env *cel.Env) (cel.Program, error) {
+	return compileExpr(cfg.ValueExpr, env)
+}
+
+func compileExpr(expr string, env *cel.Env) (cel.Program, error) {
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	return env.Program(ast)
+}
+
 func (m *attributeModifier) Apply(obj any, attrs map[string]any) (map[string]any, error) {
+	if m.spanNamePattern != nil {
+		objMap, _ := obj.(map[string]any)
+		name, _ := objMap["name"].(string)
+		if !m.spanNamePattern.MatchString(name) {
+			return attrs, nil
+		}
+	}
 	if m.when != nil {
 		out, _, err := m.when.Eval(obj)
 		if err != nil {
@@ -276,16 +826,80 @@ func (m *attributeModifier) Apply(obj any, attrs map[string]any) (map[string]any
 		delete(attrs, m.key)
 		return attrs, nil
 	}
+	if m.action == "rename" {
+		// An attribute already under the new key is replaced.
+		if val, ok := attrs[m.key]; ok {
+			delete(attrs, m.key)
+			attrs[m.to] = val
+		}
+		return attrs, nil
+	}
+	if m.action == "copy" {
+		val, ok := attrs[m.from]
+		if !ok {
+			val, ok = m.resource[m.from]
+		}
+		if ok {
+			attrs[m.key] = val
+		}
+		return attrs, nil
+	}
+	if m.action == "hash" {
+		current, ok := attrs[m.key]
+		if !ok {
+			return attrs, nil
+		}
+		h := m.newHash()
+		h.Write([]byte(m.salt + attributeString(current)))
+		attrs[m.key] = hex.EncodeToString(h.Sum(nil))
+		return attrs, nil
+	}
+	if m.action == "truncate" {
+		current, ok := attrs[m.key]
+		if !ok {
+			return attrs, nil
+		}
+		// Cut on characters so that multi-byte text stays valid UTF-8.
+		if s := []rune(attributeString(current)); len(s) > m.maxLength {
+			attrs[m.key] = string(s[:m.maxLength])
+		}
+		return attrs, nil
+	}
+	if m.action == "map" {
+		current, ok := attrs[m.key]
+		if !ok {
+			return attrs, nil
+		}
+		// YAML mapping keys are strings, so non-string values match by their text.
+		if to, ok := m.mapping[attributeString(current)]; ok {
+			attrs[m.key] = to
+		} else if m.mapDefault != nil {
+			attrs[m.key] = m.mapDefault
+		}
+		return attrs, nil
+	}
 	var val any
 	if m.valueProg != nil {
 		out, _, err := m.valueProg.Eval(obj)
 		if err != nil {
 			return attrs, err
 		}
-		val = out.Value()
+		val = toValueType(m.valueType, out.Value())
+		// The value is still set; a mismatch points at a config mistake.
+		if m.valueType != "" && !valueTypeMatches(m.valueType, val) && !m.typeWarned.Swap(true) {
+			slog.Warn("value_expr result is not of the declared value_type", "key", m.key, "value_type", m.valueType, "type", fmt.Sprintf("%T", val))
+		}
 	} else {
 		val = m.value
 	}
 	attrs[m.key] = val
 	return attrs, nil
 }
+
+// attributeString returns the text of an attribute value.
+func attributeString(val any) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return fmt.Sprint(val)
+}
@@ -1,13 +1,23 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	yaml "github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"go.uber.org/mock/gomock"
 )
@@ -667,6 +677,69 @@ func TestForwarder_UploadLogs(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("log upload with body expression", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockExporter := NewMockExporter(ctrl)
+		exporters := map[string]Exporter{
+			"test-exporter": mockExporter,
+		}
+
+		cfg := ForwardConfig{
+			Traces: &TracesForwardConfig{},
+			Logs: &LogsForwardConfig{
+				Exporters: []string{"test-exporter"},
+				Attributes: []AttributeModifierConfig{
+					{
+						Action: "set",
+						Key:    "source",
+						Value:  "dbt-fusion",
+					},
+				},
+				Body: &LogBodyConfig{
+					ValueExpr: `severityText + ": " + body + " [" + attributes["unique_id"] + " from " + attributes["source"] + "]"`,
+				},
+			},
+		}
+
+		fw, err := NewForwarder("test-forwarder", cfg, exporters)
+		require.NoError(t, err)
+
+		scopeLogs := &logspb.ScopeLogs{
+			LogRecords: []*logspb.LogRecord{
+				{
+					SeverityText: "ERROR",
+					Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "compilation failed"}},
+					Attributes: []*commonpb.KeyValue{
+						{Key: "unique_id", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "model.test.my_model"}}},
+					},
+				},
+				{
+					// unique_id is missing, so the expression fails and the body is kept.
+					SeverityText: "INFO",
+					Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "started"}},
+				},
+			},
+		}
+
+		ctx := context.Background()
+		mockExporter.EXPECT().UploadLogs(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+				logs := protoLogs[0].ScopeLogs[0].LogRecords
+				assert.Equal(t, "ERROR: compilation failed [model.test.my_model from dbt-fusion]", logs[0].Body.GetStringValue())
+				assert.Equal(t, "model.test.my_model", convertAttributesToMap(logs[0].Attributes)["unique_id"])
+				assert.Equal(t, "started", logs[1].Body.GetStringValue())
+				return nil
+			},
+		).Return(nil)
+
+		shared := scopeLogs.LogRecords[0]
+		err = fw.UploadLogs(ctx, scopeLogs)
+		assert.NoError(t, err)
+		assert.Equal(t, "compilation failed", shared.Body.GetStringValue(), "the record shared with other forwarders keeps its body")
+	})
+
 	t.Run("log upload without exporter", func(t *testing.T) {
 		cfg := ForwardConfig{
 			Traces: &TracesForwardConfig{},
@@ -751,4 +824,984 @@ func TestAttributeModifier_Apply(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "prefix_test-span", result["span_name_with_prefix"])
 	})
+	t.Run("span name pattern gates the modifier", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		when := `attributes["dbt.materialized"] == "table"`
+		modifier, err := newAttributeModifier(AttributeModifierConfig{
+			Action:          "set",
+			When:            &when,
+			SpanNamePattern: `^Node evaluated \(`,
+			Key:             "scoped",
+			Value:           true,
+		}, env)
+		require.NoError(t, err)
+
+		cases := []struct {
+			name         string
+			materialized string
+			expectSet    bool
+		}{
+			{name: "Node evaluated (my_model)", materialized: "table", expectSet: true},
+			{name: "Node evaluated (my_view)", materialized: "view", expectSet: false},
+			{name: "dbt invocation (abc)", materialized: "table", expectSet: false},
+		}
+		for _, c := range cases {
+			span := &tracepb.Span{
+				Name: c.name,
+				Attributes: []*commonpb.KeyValue{
+					{Key: "dbt.materialized", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: c.materialized}}},
+				},
+			}
+			result, err := modifier.Apply(SpanForEval(span), map[string]any{})
+			require.NoError(t, err)
+			if c.expectSet {
+				assert.Equal(t, true, result["scoped"], c.name)
+			} else {
+				assert.NotContains(t, result, "scoped", c.name)
+			}
+		}
+	})
+
+	t.Run("invalid span name pattern", func(t *testing.T) {
+		cfg := AttributeModifierConfig{Key: "k", Value: "v", SpanNamePattern: "("}
+		require.Error(t, cfg.Validate())
+	})
+
+	t.Run("map action", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		mapping := map[string]any{
+			"NODE_OUTCOME_SUCCESS": "success",
+			"NODE_OUTCOME_ERROR":   "error",
+		}
+		cases := []struct {
+			name     string
+			attrs    map[string]any
+			def      any
+			expected map[string]any
+		}{
+			{name: "matched", attrs: map[string]any{"dbt.node_outcome": "NODE_OUTCOME_SUCCESS"}, expected: map[string]any{"dbt.node_outcome": "success"}},
+			{name: "unmatched is unchanged", attrs: map[string]any{"dbt.node_outcome": "NODE_OUTCOME_SKIPPED"}, expected: map[string]any{"dbt.node_outcome": "NODE_OUTCOME_SKIPPED"}},
+			{name: "unmatched with default", attrs: map[string]any{"dbt.node_outcome": "NODE_OUTCOME_SKIPPED"}, def: "other", expected: map[string]any{"dbt.node_outcome": "other"}},
+			{name: "missing key", attrs: map[string]any{}, def: "other", expected: map[string]any{}},
+		}
+		for _, c := range cases {
+			modifier, err := newAttributeModifier(AttributeModifierConfig{
+				Action:  "map",
+				Key:     "dbt.node_outcome",
+				Mapping: mapping,
+				Default: c.def,
+			}, env)
+			require.NoError(t, err)
+			result, err := modifier.Apply(nil, c.attrs)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, result, c.name)
+		}
+
+		codes, err := newAttributeModifier(AttributeModifierConfig{
+			Action:  "map",
+			Key:     "status_code",
+			Mapping: map[string]any{"2": "error"},
+		}, env)
+		require.NoError(t, err)
+		result, err := codes.Apply(nil, map[string]any{"status_code": int64(2)})
+		require.NoError(t, err)
+		assert.Equal(t, "error", result["status_code"], "non-string values match by their text")
+	})
+
+	t.Run("rename action", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "rename", Key: "db.statement", To: "db.query.text"}, env)
+		require.NoError(t, err)
+		result, err := modifier.Apply(nil, map[string]any{"db.statement": "select 1", "rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"db.query.text": "select 1", "rows": int64(3)}, result)
+
+		rows, err := newAttributeModifier(AttributeModifierConfig{Action: "rename", Key: "rows", To: "dbt.rows_affected"}, env)
+		require.NoError(t, err)
+		result, err = rows.Apply(nil, map[string]any{"rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"dbt.rows_affected": int64(3)}, result, "the value type is kept")
+
+		result, err = modifier.Apply(nil, map[string]any{"rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rows": int64(3)}, result, "a missing key is not added")
+
+		when := `name == "Query executed"`
+		guarded, err := newAttributeModifier(AttributeModifierConfig{Action: "rename", When: &when, Key: "db.statement", To: "db.query.text"}, env)
+		require.NoError(t, err)
+		result, err = guarded.Apply(SpanForEval(&tracepb.Span{Name: "Node evaluated"}), map[string]any{"db.statement": "select 1"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"db.statement": "select 1"}, result, "nothing is renamed when the condition is false")
+		result, err = guarded.Apply(SpanForEval(&tracepb.Span{Name: "Query executed"}), map[string]any{"db.statement": "select 1"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"db.query.text": "select 1"}, result)
+	})
+
+	t.Run("rename action validation", func(t *testing.T) {
+		require.Error(t, (&AttributeModifierConfig{Action: "rename", Key: "k"}).Validate(), "to is required")
+		require.Error(t, (&AttributeModifierConfig{Action: "rename", Key: "k", To: "n", Value: "v"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "rename", Key: "k", To: "n"}).Validate())
+	})
+
+	t.Run("copy action", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "copy", Key: "dbt.invocation_id", From: "invocation_id"}, env)
+		require.NoError(t, err)
+		result, err := modifier.Apply(nil, map[string]any{"invocation_id": "abc"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"invocation_id": "abc", "dbt.invocation_id": "abc"}, result, "the source is kept")
+
+		result, err = modifier.Apply(nil, map[string]any{"rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rows": int64(3)}, result, "an absent source is a no-op")
+
+		modifier.resource = map[string]any{"invocation_id": "from-resource"}
+		result, err = modifier.Apply(nil, map[string]any{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"dbt.invocation_id": "from-resource"}, result, "the resource is read when the record lacks the source")
+		result, err = modifier.Apply(nil, map[string]any{"invocation_id": "abc"})
+		require.NoError(t, err)
+		assert.Equal(t, "abc", result["dbt.invocation_id"], "the record's attribute takes precedence")
+
+		when := `name == "Node evaluated"`
+		guarded, err := newAttributeModifier(AttributeModifierConfig{Action: "copy", When: &when, Key: "dbt.invocation_id", From: "invocation_id"}, env)
+		require.NoError(t, err)
+		result, err = guarded.Apply(SpanForEval(&tracepb.Span{Name: "Query executed"}), map[string]any{"invocation_id": "abc"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"invocation_id": "abc"}, result, "nothing is copied when the condition is false")
+		result, err = guarded.Apply(SpanForEval(&tracepb.Span{Name: "Node evaluated"}), map[string]any{"invocation_id": "abc"})
+		require.NoError(t, err)
+		assert.Equal(t, "abc", result["dbt.invocation_id"])
+	})
+
+	t.Run("copy action reads the forwarder's resource", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockExporter := NewMockExporter(ctrl)
+		fw, err := NewForwarder("test-forwarder", ForwardConfig{
+			Resource: &ForwardResourceConfig{Attributes: map[string]any{"deployment.environment": "prod"}},
+			Traces: &TracesForwardConfig{
+				Exporters:  []string{"test-exporter"},
+				Attributes: []AttributeModifierConfig{{Action: "copy", Key: "env", From: "deployment.environment"}},
+			},
+		}, map[string]Exporter{"test-exporter": mockExporter})
+		require.NoError(t, err)
+		mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				assert.Equal(t, "prod", convertAttributesToMap(protoSpans[0].ScopeSpans[0].Spans[0].Attributes)["env"])
+				return nil
+			},
+		)
+		require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: []*tracepb.Span{{Name: "span"}}}))
+	})
+
+	t.Run("copy action validation", func(t *testing.T) {
+		require.Error(t, (&AttributeModifierConfig{Action: "copy", Key: "k"}).Validate(), "from is required")
+		require.Error(t, (&AttributeModifierConfig{Action: "copy", Key: "k", From: "f", Value: "v"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "copy", Key: "k", From: "f"}).Validate())
+	})
+
+	t.Run("hash action", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "hash", Key: "db.statement"}, env)
+		require.NoError(t, err)
+		result, err := modifier.Apply(nil, map[string]any{"db.statement": "select 1"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"db.statement": "822ae07d4783158bc1912bb623e5107cc9002d519e1143a9c200ed6ee18b6d0f"}, result, "sha256 by default")
+
+		salted, err := newAttributeModifier(AttributeModifierConfig{Action: "hash", Key: "db.statement", Salt: "pepper"}, env)
+		require.NoError(t, err)
+		result, err = salted.Apply(nil, map[string]any{"db.statement": "select 1"})
+		require.NoError(t, err)
+		assert.Equal(t, "1c73dd43a4b10067460e52990a84da94a76c00514d2ddd2892d860d13602838b", result["db.statement"])
+
+		md5Modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "hash", Key: "rows", Algorithm: "md5"}, env)
+		require.NoError(t, err)
+		result, err = md5Modifier.Apply(nil, map[string]any{"rows": int64(42)})
+		require.NoError(t, err)
+		assert.Equal(t, "a1d0c6e83f027327d8461063f4ac58a6", result["rows"], "non-string values are hashed by their text")
+
+		result, err = modifier.Apply(nil, map[string]any{"rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rows": int64(3)}, result, "a missing key is not added")
+	})
+
+	t.Run("hash action validation", func(t *testing.T) {
+		require.ErrorContains(t, (&AttributeModifierConfig{Action: "hash", Key: "k", Algorithm: "crc32"}).Validate(), "algorithm must be one of md5, sha1, sha256, sha512")
+		require.Error(t, (&AttributeModifierConfig{Action: "hash", Key: "k", Value: "v"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "hash", Key: "k", Algorithm: "sha512", Salt: "s"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "hash", Key: "k"}).Validate())
+	})
+
+	t.Run("truncate action", func(t *testing.T) {
+		env, err := NewSpanEnv()
+		require.NoError(t, err)
+
+		modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "truncate", Key: "db.statement", MaxLength: 6}, env)
+		require.NoError(t, err)
+		result, err := modifier.Apply(nil, map[string]any{"db.statement": "select * from orders"})
+		require.NoError(t, err)
+		assert.Equal(t, "select", result["db.statement"])
+
+		result, err = modifier.Apply(nil, map[string]any{"db.statement": "日本語のクエリです"})
+		require.NoError(t, err)
+		assert.Equal(t, "日本語のクエ", result["db.statement"], "characters are kept whole")
+
+		result, err = modifier.Apply(nil, map[string]any{"db.statement": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), result["db.statement"], "short values are unchanged")
+
+		result, err = modifier.Apply(nil, map[string]any{"rows": int64(3)})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rows": int64(3)}, result, "a missing key is not added")
+	})
+
+	t.Run("truncate action validation", func(t *testing.T) {
+		require.Error(t, (&AttributeModifierConfig{Action: "truncate", Key: "k"}).Validate(), "max_length is required")
+		require.Error(t, (&AttributeModifierConfig{Action: "truncate", Key: "k", MaxLength: 10, Value: "v"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "truncate", Key: "k", MaxLength: 10}).Validate())
+	})
+
+	t.Run("map action validation", func(t *testing.T) {
+		require.Error(t, (&AttributeModifierConfig{Action: "map", Key: "k"}).Validate(), "mapping is required")
+		require.Error(t, (&AttributeModifierConfig{Action: "map", Key: "k", Mapping: map[string]any{"a": "b"}, Value: "v"}).Validate())
+		require.NoError(t, (&AttributeModifierConfig{Action: "map", Key: "k", Mapping: map[string]any{"a": "b"}}).Validate())
+	})
+}
+
+func TestForwarder_DBSystem(t *testing.T) {
+	querySpan := func(adapter string) *tracepb.Span {
+		return &tracepb.Span{
+			Name: "Query executed",
+			Attributes: []*commonpb.KeyValue{
+				{Key: "dbt.adapter_type", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: adapter}}},
+			},
+		}
+	}
+	cases := []struct {
+		name           string
+		adapter        string
+		mapping        map[string]string
+		expectDBSystem string
+	}{
+		{name: "snowflake is used as is", adapter: "snowflake", expectDBSystem: "snowflake"},
+		{name: "postgres maps to postgresql", adapter: "postgres", expectDBSystem: "postgresql"},
+		{name: "config mapping wins", adapter: "postgres", mapping: map[string]string{"postgres": "redshift"}, expectDBSystem: "redshift"},
+		{name: "empty mapping disables", adapter: "snowflake", mapping: map[string]string{"snowflake": ""}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Traces:          &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+				DBSystemMapping: tc.mapping,
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			var uploaded []*tracepb.ResourceSpans
+			mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+					uploaded = append(uploaded, protoSpans...)
+					return nil
+				},
+			).Times(2)
+
+			other := &tracepb.Span{Name: "Node evaluated (my_model)"}
+			require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{
+				Spans: []*tracepb.Span{other, querySpan(tc.adapter)},
+			}))
+			// The resource keeps db.system for later batches without queries.
+			require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{
+				Spans: []*tracepb.Span{{Name: "later"}},
+			}))
+
+			require.Len(t, uploaded, 2)
+			spans := uploaded[0].ScopeSpans[0].Spans
+			assert.NotContains(t, convertAttributesToMap(spans[0].Attributes), "db.system", "spans without an adapter are not stamped")
+			for _, rs := range uploaded {
+				attrs := convertAttributesToMap(rs.GetResource().GetAttributes())
+				if tc.expectDBSystem == "" {
+					assert.NotContains(t, attrs, "db.system")
+				} else {
+					assert.Equal(t, tc.expectDBSystem, attrs["db.system"])
+				}
+			}
+			spanAttrs := convertAttributesToMap(spans[1].Attributes)
+			if tc.expectDBSystem == "" {
+				assert.NotContains(t, spanAttrs, "db.system")
+			} else {
+				assert.Equal(t, tc.expectDBSystem, spanAttrs["db.system"])
+			}
+		})
+	}
+}
+
+func TestForwarder_DBSystemPerForwarder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	newForwarder := func(mapping map[string]string) (*Forwarder, *[]*tracepb.ResourceSpans) {
+		mockExporter := NewMockExporter(ctrl)
+		fw, err := NewForwarder("test-forwarder", ForwardConfig{
+			Traces:          &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+			DBSystemMapping: mapping,
+		}, map[string]Exporter{"test-exporter": mockExporter})
+		require.NoError(t, err)
+		var uploaded []*tracepb.ResourceSpans
+		mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				uploaded = append(uploaded, protoSpans...)
+				return nil
+			},
+		)
+		return fw, &uploaded
+	}
+	postgres, postgresUploaded := newForwarder(nil)
+	redshift, redshiftUploaded := newForwarder(map[string]string{"postgres": "redshift"})
+
+	// Both forwarders get the same spans, as uploadBatch hands them out.
+	spans := []*tracepb.Span{{
+		Name: "Query executed",
+		Attributes: []*commonpb.KeyValue{
+			{Key: "dbt.adapter_type", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "postgres"}}},
+		},
+	}}
+	require.NoError(t, postgres.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: spans}))
+	require.NoError(t, redshift.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: spans}))
+
+	require.Len(t, *postgresUploaded, 1)
+	require.Len(t, *redshiftUploaded, 1)
+	assert.Equal(t, "postgresql", convertAttributesToMap((*postgresUploaded)[0].ScopeSpans[0].Spans[0].Attributes)["db.system"])
+	assert.Equal(t, "redshift", convertAttributesToMap((*redshiftUploaded)[0].ScopeSpans[0].Spans[0].Attributes)["db.system"])
+	assert.NotContains(t, convertAttributesToMap(spans[0].Attributes), "db.system", "the shared span is not modified")
+}
+
+func TestForwarder_DropEmptyAttributes(t *testing.T) {
+	attrs := func() []*commonpb.KeyValue {
+		return []*commonpb.KeyValue{
+			{Key: "empty_string", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: ""}}},
+			{Key: "empty_array", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{}}}},
+			{Key: "null", Value: &commonpb.AnyValue{}},
+			{Key: "missing_value"},
+			{Key: "false", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: false}}},
+			{Key: "zero_int", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 0}}},
+			{Key: "zero_double", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0}}},
+			{Key: "text", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "value"}}},
+		}
+	}
+	keys := func(attrs []*commonpb.KeyValue) []string {
+		var out []string
+		for _, attr := range attrs {
+			out = append(out, attr.GetKey())
+		}
+		return out
+	}
+	kept := []string{"false", "zero_int", "zero_double", "text"}
+
+	for _, drop := range []bool{false, true} {
+		t.Run(map[bool]string{false: "disabled", true: "enabled"}[drop], func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Traces:              &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+				Logs:                &LogsForwardConfig{Exporters: []string{"test-exporter"}},
+				DropEmptyAttributes: drop,
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			expected := keys(attrs())
+			if drop {
+				expected = kept
+			}
+			mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+					span := protoSpans[0].ScopeSpans[0].Spans[0]
+					assert.Equal(t, expected, keys(span.Attributes))
+					assert.Equal(t, expected, keys(span.Events[0].Attributes))
+					return nil
+				},
+			)
+			mockExporter.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+					assert.Equal(t, expected, keys(protoLogs[0].ScopeLogs[0].LogRecords[0].Attributes))
+					return nil
+				},
+			)
+
+			ctx := context.Background()
+			require.NoError(t, fw.UploadTraces(ctx, &tracepb.ScopeSpans{Spans: []*tracepb.Span{{
+				Name:       "span",
+				Attributes: attrs(),
+				Events:     []*tracepb.Span_Event{{Name: "event", Attributes: attrs()}},
+			}}}))
+			require.NoError(t, fw.UploadLogs(ctx, &logspb.ScopeLogs{LogRecords: []*logspb.LogRecord{{Attributes: attrs()}}}))
+		})
+	}
+
+	t.Run("other forwarders keep empty attributes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		dropping, keeping := NewMockExporter(ctrl), NewMockExporter(ctrl)
+		newForwarder := func(exporter Exporter, drop bool) *Forwarder {
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Traces:              &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+				Logs:                &LogsForwardConfig{Exporters: []string{"test-exporter"}},
+				DropEmptyAttributes: drop,
+			}, map[string]Exporter{"test-exporter": exporter})
+			require.NoError(t, err)
+			return fw
+		}
+		dropping.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(nil)
+		dropping.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).Return(nil)
+		keeping.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				span := protoSpans[0].ScopeSpans[0].Spans[0]
+				assert.Equal(t, keys(attrs()), keys(span.Attributes))
+				assert.Equal(t, keys(attrs()), keys(span.Events[0].Attributes))
+				return nil
+			},
+		)
+		keeping.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+				assert.Equal(t, keys(attrs()), keys(protoLogs[0].ScopeLogs[0].LogRecords[0].Attributes))
+				return nil
+			},
+		)
+
+		// Both forwarders get the same records, as uploadBatch hands them out.
+		spans := []*tracepb.Span{{
+			Name:       "span",
+			Attributes: attrs(),
+			Events:     []*tracepb.Span_Event{{Name: "event", Attributes: attrs()}},
+		}}
+		logs := []*logspb.LogRecord{{Attributes: attrs()}}
+		ctx := context.Background()
+		for _, fw := range []*Forwarder{newForwarder(dropping, true), newForwarder(keeping, false)} {
+			require.NoError(t, fw.UploadTraces(ctx, &tracepb.ScopeSpans{Spans: spans}))
+			require.NoError(t, fw.UploadLogs(ctx, &logspb.ScopeLogs{LogRecords: logs}))
+		}
+	})
+}
+
+func TestForwarder_DurationFilter(t *testing.T) {
+	spans := func() []*tracepb.Span {
+		start := uint64(1772073188000000000)
+		return []*tracepb.Span{
+			{Name: "instant", StartTimeUnixNano: start, EndTimeUnixNano: start},
+			{Name: "100ms", StartTimeUnixNano: start, EndTimeUnixNano: start + uint64(100*time.Millisecond)},
+			{Name: "1s", StartTimeUnixNano: start, EndTimeUnixNano: start + uint64(time.Second)},
+			{Name: "1m", StartTimeUnixNano: start, EndTimeUnixNano: start + uint64(time.Minute)},
+		}
+	}
+	names := func(spans []*tracepb.Span) []string {
+		var out []string
+		for _, span := range spans {
+			out = append(out, span.GetName())
+		}
+		return out
+	}
+	ptr := func(d time.Duration) *time.Duration { return &d }
+
+	cases := []struct {
+		name     string
+		min, max *time.Duration
+		expected []string
+	}{
+		{name: "unset", expected: []string{"instant", "100ms", "1s", "1m"}},
+		{name: "min only", min: ptr(100 * time.Millisecond), expected: []string{"100ms", "1s", "1m"}},
+		{name: "max only", max: ptr(time.Second), expected: []string{"instant", "100ms", "1s"}},
+		{name: "range", min: ptr(time.Millisecond), max: ptr(10 * time.Second), expected: []string{"100ms", "1s"}},
+		{name: "nothing in range", min: ptr(time.Hour)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Traces: &TracesForwardConfig{Exporters: []string{"test-exporter"}, MinDuration: tc.min, MaxDuration: tc.max},
+				Logs:   &LogsForwardConfig{},
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			if tc.expected != nil {
+				mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+						assert.Equal(t, tc.expected, names(protoSpans[0].ScopeSpans[0].Spans))
+						return nil
+					},
+				)
+			}
+			shared := spans()
+			require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: shared}))
+			assert.Equal(t, []string{"instant", "100ms", "1s", "1m"}, names(shared), "spans shared with other forwarders are left intact")
+		})
+	}
+
+	var cfg TracesForwardConfig
+	require.NoError(t, yaml.Unmarshal([]byte("exporters: [test-exporter]\nmin_duration: 100ms\nmax_duration: 1m\n"), &cfg))
+	assert.Equal(t, ptr(100*time.Millisecond), cfg.MinDuration)
+	assert.Equal(t, ptr(time.Minute), cfg.MaxDuration)
+
+	invalid := []TracesForwardConfig{
+		{Exporters: []string{"test-exporter"}, MinDuration: ptr(-time.Second)},
+		{Exporters: []string{"test-exporter"}, MinDuration: ptr(time.Minute), MaxDuration: ptr(time.Second)},
+	}
+	for _, cfg := range invalid {
+		assert.Error(t, cfg.Validate(map[string]ExporterConfig{"test-exporter": {}}))
+	}
+}
+
+func TestForwarder_MaxSpansPerResource(t *testing.T) {
+	newSpans := func(n int) []*tracepb.Span {
+		spans := make([]*tracepb.Span, n)
+		for i := range spans {
+			spans[i] = &tracepb.Span{Name: fmt.Sprintf("span-%d", i)}
+		}
+		return spans
+	}
+	cases := []struct {
+		name     string
+		limit    int
+		spans    int
+		expected []int
+	}{
+		{name: "unset", limit: 0, spans: 5, expected: []int{5}},
+		{name: "under the limit", limit: 5, spans: 5, expected: []int{5}},
+		{name: "over the limit", limit: 2, spans: 5, expected: []int{2, 2, 1}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Resource: &ForwardResourceConfig{Attributes: map[string]any{"service.name": "dbt"}},
+				Traces:   &TracesForwardConfig{Exporters: []string{"test-exporter"}, MaxSpansPerResource: tc.limit},
+				Logs:     &LogsForwardConfig{},
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			scope := &commonpb.InstrumentationScope{Name: "dbt-traces"}
+			mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+					var sizes []int
+					var names []string
+					for _, rs := range protoSpans {
+						assert.Equal(t, "dbt", convertAttributesToMap(rs.Resource.Attributes)["service.name"], "every ResourceSpans has the resource")
+						require.Len(t, rs.ScopeSpans, 1)
+						assert.Equal(t, "dbt-traces", rs.ScopeSpans[0].Scope.GetName())
+						sizes = append(sizes, len(rs.ScopeSpans[0].Spans))
+						for _, span := range rs.ScopeSpans[0].Spans {
+							names = append(names, span.Name)
+						}
+					}
+					assert.Equal(t, tc.expected, sizes)
+					var want []string
+					for _, span := range newSpans(tc.spans) {
+						want = append(want, span.Name)
+					}
+					assert.Equal(t, want, names, "spans keep their order")
+					return nil
+				},
+			)
+			require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Scope: scope, Spans: newSpans(tc.spans)}))
+		})
+	}
+
+	assert.Error(t, (&TracesForwardConfig{MaxSpansPerResource: -1}).Validate(nil))
+}
+
+func TestForwarder_LogSampling(t *testing.T) {
+	var logs []*logspb.LogRecord
+	for range 100 {
+		logs = append(logs,
+			&logspb.LogRecord{SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG, SeverityText: "DEBUG"},
+			&logspb.LogRecord{SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, SeverityText: "ERROR"},
+			&logspb.LogRecord{SeverityText: "warning"},
+		)
+	}
+	count := func(records []*logspb.LogRecord) map[string]int {
+		counts := make(map[string]int)
+		for _, log := range records {
+			counts[log.GetSeverityText()]++
+		}
+		return counts
+	}
+
+	cases := []struct {
+		name     string
+		sampling *LogSamplingConfig
+		expected map[string]int
+	}{
+		{name: "unset", expected: map[string]int{"DEBUG": 100, "ERROR": 100, "warning": 100}},
+		{name: "errors only", sampling: &LogSamplingConfig{MinSeverity: "ERROR", Ratio: 0}, expected: map[string]int{"ERROR": 100}},
+		{name: "a quarter below warn", sampling: &LogSamplingConfig{MinSeverity: "warn", Ratio: 0.25}, expected: map[string]int{"DEBUG": 25, "ERROR": 100, "warning": 100}},
+		{name: "all", sampling: &LogSamplingConfig{MinSeverity: "FATAL", Ratio: 1}, expected: map[string]int{"DEBUG": 100, "ERROR": 100, "warning": 100}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Logs: &LogsForwardConfig{Exporters: []string{"test-exporter"}, Sampling: tc.sampling},
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+			// Draws cycle through 0, 0.01, ..., 0.99 so a ratio keeps exactly its share.
+			draws := 0
+			fw.sampleRand = func() float64 {
+				draws++
+				return float64((draws-1)%100) / 100
+			}
+
+			mockExporter.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+					assert.Equal(t, tc.expected, count(protoLogs[0].ScopeLogs[0].LogRecords))
+					return nil
+				},
+			)
+			shared := slices.Clone(logs)
+			require.NoError(t, fw.UploadLogs(context.Background(), &logspb.ScopeLogs{LogRecords: shared}))
+			assert.Equal(t, logs, shared, "records shared with other forwarders are left intact")
+		})
+	}
+
+	require.NoError(t, (&LogSamplingConfig{MinSeverity: "WARNING", Ratio: 0.5}).Validate())
+	assert.Error(t, (&LogSamplingConfig{MinSeverity: "NOTICE", Ratio: 0.5}).Validate())
+	assert.Error(t, (&LogSamplingConfig{MinSeverity: "INFO", Ratio: 1.5}).Validate())
+}
+
+func TestForwarder_DropWhen(t *testing.T) {
+	str := func(s string) *commonpb.AnyValue {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+	}
+	spans := []*tracepb.Span{
+		{Name: "model.a", Attributes: []*commonpb.KeyValue{{Key: "dbt.materialized", Value: str("table")}}},
+		{Name: "internal.cache", Attributes: []*commonpb.KeyValue{{Key: "dbt.materialized", Value: str("ephemeral")}}},
+		{Name: "internal.parse"},
+	}
+	names := func(spans []*tracepb.Span) []string {
+		var out []string
+		for _, span := range spans {
+			out = append(out, span.GetName())
+		}
+		return out
+	}
+	ptr := func(s string) *string { return &s }
+
+	cases := []struct {
+		name     string
+		dropWhen string
+		expected []string
+	}{
+		{name: "by name", dropWhen: `name.startsWith("internal.")`, expected: []string{"model.a"}},
+		{name: "failed evaluation keeps the span", dropWhen: `attributes["dbt.materialized"] == "ephemeral"`, expected: []string{"model.a", "internal.parse"}},
+		{name: "everything dropped", dropWhen: `true`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				Traces: &TracesForwardConfig{Exporters: []string{"test-exporter"}, DropWhen: ptr(tc.dropWhen)},
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			// Without expected spans nothing may be uploaded.
+			if tc.expected != nil {
+				mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+						assert.Equal(t, tc.expected, names(protoSpans[0].ScopeSpans[0].Spans))
+						return nil
+					},
+				)
+			}
+			shared := slices.Clone(spans)
+			require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: shared}))
+			assert.Equal(t, spans, shared, "spans shared with other forwarders are left intact")
+		})
+	}
+
+	t.Run("logs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockExporter := NewMockExporter(ctrl)
+
+		fw, err := NewForwarder("test-forwarder", ForwardConfig{
+			Logs: &LogsForwardConfig{
+				Exporters: []string{"test-exporter"},
+				DropWhen:  ptr(`severityText == "DEBUG"`),
+				Sampling:  &LogSamplingConfig{MinSeverity: "INFO", Ratio: 1},
+			},
+		}, map[string]Exporter{"test-exporter": mockExporter})
+		require.NoError(t, err)
+
+		mockExporter.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+				records := protoLogs[0].ScopeLogs[0].LogRecords
+				require.Len(t, records, 1)
+				assert.Equal(t, "INFO", records[0].GetSeverityText())
+				return nil
+			},
+		)
+		require.NoError(t, fw.UploadLogs(context.Background(), &logspb.ScopeLogs{LogRecords: []*logspb.LogRecord{
+			{SeverityText: "DEBUG"}, {SeverityText: "INFO"}, {SeverityText: "DEBUG"},
+		}}))
+	})
+
+	var cfg LogsForwardConfig
+	require.NoError(t, yaml.Unmarshal([]byte("exporters: [test-exporter]\ndrop_when: severityText == \"DEBUG\"\n"), &cfg))
+	assert.Equal(t, ptr(`severityText == "DEBUG"`), cfg.DropWhen)
+	assert.Error(t, (&TracesForwardConfig{Exporters: []string{"test-exporter"}, DropWhen: ptr("")}).Validate(map[string]ExporterConfig{"test-exporter": {}}))
+	assert.Error(t, (&LogsForwardConfig{Exporters: []string{"test-exporter"}, DropWhen: ptr("")}).Validate(map[string]ExporterConfig{"test-exporter": {}}))
+}
+
+func TestForwarder_UploadMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockExporter := NewMockExporter(ctrl)
+
+	when := `name == "dbt.rows_affected"`
+	fw, err := NewForwarder("test-forwarder", ForwardConfig{
+		Resource: &ForwardResourceConfig{Attributes: map[string]any{"service.name": "jaffle-shop"}},
+		Metrics: &MetricsForwardConfig{
+			Exporters:  []string{"test-exporter"},
+			Attributes: []AttributeModifierConfig{{Action: "set", When: &when, Key: "env", Value: "prod"}},
+		},
+	}, map[string]Exporter{"test-exporter": mockExporter})
+	require.NoError(t, err)
+
+	gauge := func(name string) *metricspb.Metric {
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1}}},
+		}}}
+	}
+	mockExporter.EXPECT().UploadMetrics(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoMetrics []*metricspb.ResourceMetrics) error {
+			require.Len(t, protoMetrics, 1)
+			assert.Equal(t, "jaffle-shop", convertAttributesToMap(protoMetrics[0].Resource.Attributes)["service.name"])
+			metrics := protoMetrics[0].ScopeMetrics[0].Metrics
+			require.Len(t, metrics, 2)
+			assert.Equal(t, map[string]any{"env": "prod"}, convertAttributesToMap(metrics[0].GetGauge().DataPoints[0].Attributes))
+			assert.Empty(t, metrics[1].GetGauge().DataPoints[0].Attributes, "the modifier only applies when its condition holds")
+			return nil
+		},
+	)
+	// Logs and traces have no exporters, so only metrics are uploaded.
+	require.NoError(t, fw.UploadMetrics(context.Background(), &metricspb.ScopeMetrics{
+		Metrics: []*metricspb.Metric{gauge("dbt.rows_affected"), gauge("dbt.node.duration")},
+	}))
+	require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: []*tracepb.Span{{Name: "span"}}}))
+
+	err = (&ForwardConfig{Metrics: &MetricsForwardConfig{Exporters: []string{"missing"}}}).Validate(map[string]ExporterConfig{})
+	assert.ErrorContains(t, err, "metrics.metrics exporter missing is not defined")
+}
+
+func TestForwarder_ReservedAttributes(t *testing.T) {
+	stringAttr := func(key, value string) *commonpb.KeyValue {
+		return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+	}
+	cases := []struct {
+		policy  string
+		prefix  string
+		want    map[string]any
+		warning bool
+	}{
+		{policy: "", want: map[string]any{"service.name": "orders", "team": "data", "dbt.unique_id": "model.a"}},
+		{policy: ReservedAttributesWarn, want: map[string]any{"service.name": "orders", "team": "data", "dbt.unique_id": "model.a"}, warning: true},
+		{policy: ReservedAttributesDrop, want: map[string]any{"dbt.unique_id": "model.a"}},
+		{policy: ReservedAttributesPrefix, want: map[string]any{"dbt.service.name": "orders", "dbt.team": "data", "dbt.unique_id": "model.a"}},
+		{policy: ReservedAttributesPrefix, prefix: "span.", want: map[string]any{"span.service.name": "orders", "span.team": "data", "dbt.unique_id": "model.a"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy+tc.prefix, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			saved := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logBuf, nil)))
+			t.Cleanup(func() { slog.SetDefault(saved) })
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockExporter := NewMockExporter(ctrl)
+			fw, err := NewForwarder("test-forwarder", ForwardConfig{
+				// team is reserved as a resource key of this forwarder.
+				Resource:                 &ForwardResourceConfig{Attributes: map[string]any{"team": "analytics"}},
+				Traces:                   &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+				ReservedAttributes:       tc.policy,
+				ReservedAttributesPrefix: tc.prefix,
+			}, map[string]Exporter{"test-exporter": mockExporter})
+			require.NoError(t, err)
+
+			mockExporter.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+					resource := convertAttributesToMap(protoSpans[0].Resource.Attributes)
+					assert.Equal(t, "dbt", resource["service.name"], "the resource is unchanged")
+					assert.Equal(t, tc.want, convertAttributesToMap(protoSpans[0].ScopeSpans[0].Spans[0].Attributes))
+					return nil
+				},
+			).Times(2)
+			for range 2 {
+				require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: []*tracepb.Span{{
+					Name: "model.a",
+					Attributes: []*commonpb.KeyValue{
+						stringAttr("service.name", "orders"),
+						stringAttr("team", "data"),
+						stringAttr("dbt.unique_id", "model.a"),
+					},
+				}}}))
+			}
+			if tc.warning {
+				assert.Equal(t, 1, strings.Count(logBuf.String(), "key=service.name"), "warned once per key")
+				assert.Equal(t, 1, strings.Count(logBuf.String(), "key=team"))
+			} else {
+				assert.NotContains(t, logBuf.String(), "reserved")
+			}
+		})
+	}
+}
+
+func TestForwarder_ReservedAttributesPerForwarder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dropping, keeping := NewMockExporter(ctrl), NewMockExporter(ctrl)
+	newForwarder := func(exporter Exporter, policy string) *Forwarder {
+		fw, err := NewForwarder("test-forwarder", ForwardConfig{
+			Traces:             &TracesForwardConfig{Exporters: []string{"test-exporter"}},
+			ReservedAttributes: policy,
+		}, map[string]Exporter{"test-exporter": exporter})
+		require.NoError(t, err)
+		return fw
+	}
+	dropping.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			assert.NotContains(t, convertAttributesToMap(protoSpans[0].ScopeSpans[0].Spans[0].Attributes), "service.name")
+			return nil
+		},
+	)
+	keeping.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			assert.Equal(t, "orders", convertAttributesToMap(protoSpans[0].ScopeSpans[0].Spans[0].Attributes)["service.name"])
+			return nil
+		},
+	)
+
+	// Both forwarders get the same span, as uploadBatch hands it out.
+	spans := []*tracepb.Span{{
+		Name: "model.a",
+		Attributes: []*commonpb.KeyValue{
+			{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "orders"}}},
+		},
+	}}
+	for _, fw := range []*Forwarder{newForwarder(dropping, ReservedAttributesDrop), newForwarder(keeping, "")} {
+		require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: spans}))
+	}
+}
+
+func TestForwarder_ReservedAttributesPrefixCollision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockExporter := NewMockExporter(ctrl)
+	fw, err := NewForwarder("test-forwarder", ForwardConfig{
+		Logs:               &LogsForwardConfig{Exporters: []string{"test-exporter"}},
+		ReservedAttributes: ReservedAttributesPrefix,
+	}, map[string]Exporter{"test-exporter": mockExporter})
+	require.NoError(t, err)
+
+	mockExporter.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			assert.Equal(t, map[string]any{"dbt.service.name": "kept"}, convertAttributesToMap(protoLogs[0].ScopeLogs[0].LogRecords[0].Attributes),
+				"an existing prefixed key wins over the renamed one")
+			return nil
+		},
+	)
+	require.NoError(t, fw.UploadLogs(context.Background(), &logspb.ScopeLogs{LogRecords: []*logspb.LogRecord{{
+		Attributes: convertAttributesFromMap(map[string]any{"service.name": "orders", "dbt.service.name": "kept"}),
+	}}}))
+
+	require.Error(t, (&ForwardConfig{ReservedAttributes: "rename"}).Validate(nil))
+}
+
+func TestNewForwarders_DisabledExporter(t *testing.T) {
+	dir := t.TempDir()
+	enabledPath := filepath.Join(dir, "enabled.jsonl")
+	disabledPath := filepath.Join(dir, "disabled.jsonl")
+	disabled := false
+	ctx := context.Background()
+	forwarders := newForwarders(ctx, &Config{
+		Exporters: map[string]ExporterConfig{
+			"enabled":  {Type: "file", File: FileExporterConfig{Path: enabledPath}},
+			"disabled": {Type: "file", Enabled: &disabled, File: FileExporterConfig{Path: disabledPath}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"enabled", "disabled"}}},
+		},
+	}, nil)
+	require.Len(t, forwarders, 1, "a forwarder referencing a disabled exporter still starts")
+
+	require.NoError(t, forwarders[0].UploadTraces(ctx, &tracepb.ScopeSpans{Spans: []*tracepb.Span{{Name: "model.a"}}}))
+	require.NoError(t, forwarders[0].Stop(ctx))
+
+	b, err := os.ReadFile(enabledPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "model.a")
+	_, err = os.Stat(disabledPath)
+	assert.ErrorIs(t, err, os.ErrNotExist, "the disabled exporter received nothing")
+}
+
+func TestAttributeModifier_ApplyValueTypeMismatch(t *testing.T) {
+	var logBuf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	env, err := NewSpanEnv()
+	require.NoError(t, err)
+	modifier, err := newAttributeModifier(AttributeModifierConfig{Action: "set", Key: "retries", ValueExpr: `"three"`, ValueType: "int"}, env)
+	require.NoError(t, err)
+	for range 2 {
+		attrs, err := modifier.Apply(map[string]any{}, map[string]any{})
+		require.NoError(t, err)
+		assert.Equal(t, "three", attrs["retries"], "the value is still set")
+	}
+	assert.Equal(t, 1, strings.Count(logBuf.String(), "value_expr result is not of the declared value_type"), "warned once")
+	assert.Contains(t, logBuf.String(), "key=retries value_type=int type=string")
+
+	modifier, err = newAttributeModifier(AttributeModifierConfig{Action: "set", Key: "retries", ValueExpr: `3`, ValueType: "int"}, env)
+	require.NoError(t, err)
+	logBuf.Reset()
+	_, err = modifier.Apply(map[string]any{}, map[string]any{})
+	require.NoError(t, err)
+	assert.Empty(t, logBuf.String())
+
+	// Integers declared as double are set as doubles.
+	for _, cfg := range []AttributeModifierConfig{
+		{Action: "set", Key: "ratio", Value: uint64(1), ValueType: "double"},
+		{Action: "set", Key: "ratio", ValueExpr: `1`, ValueType: "double"},
+	} {
+		modifier, err = newAttributeModifier(cfg, env)
+		require.NoError(t, err)
+		attrs, err := modifier.Apply(map[string]any{}, map[string]any{})
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), attrs["ratio"])
+	}
+	assert.Empty(t, logBuf.String())
 }
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultGzipAutoThreshold is the payload size above which `gzip: auto`
+// compresses, when gzip_auto_threshold is not set.
+const defaultGzipAutoThreshold = 1024
+
+// GzipMode is the value of a `gzip` setting: true, false or auto.
+type GzipMode string
+
+const (
+	GzipModeOn   GzipMode = "true"
+	GzipModeOff  GzipMode = "false"
+	GzipModeAuto GzipMode = "auto"
+)
+
+func (m *GzipMode) UnmarshalYAML(b []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(b)), `"'`)
+	if s == string(GzipModeAuto) {
+		*m = GzipModeAuto
+		return nil
+	}
+	enabled, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("gzip must be true, false or auto, got %q", s)
+	}
+	*m = GzipModeOff
+	if enabled {
+		*m = GzipModeOn
+	}
+	return nil
+}
+
+// GzipExporter holds one client without compression and one with it, and
+// sends each upload through one of them according to the signal's gzip mode.
+// In auto mode only payloads larger than Threshold are compressed, so tiny
+// payloads do not pay for compression.
+type GzipExporter struct {
+	Plain     Exporter
+	Gzip      Exporter
+	Traces    GzipMode
+	Logs      GzipMode
+	Metrics   GzipMode
+	Threshold int
+}
+
+func NewGzipExporter(plain, gzip Exporter, cfg OtlpExporterConfig) *GzipExporter {
+	traces, logs := cfg.gzipModes()
+	threshold := cfg.GzipAutoThreshold
+	if threshold <= 0 {
+		threshold = defaultGzipAutoThreshold
+	}
+	// Metrics have no signal section and follow the exporter wide setting.
+	metrics := GzipModeOff
+	if cfg.Gzip != nil {
+		metrics = *cfg.Gzip
+	}
+	return &GzipExporter{Plain: plain, Gzip: gzip, Traces: traces, Logs: logs, Metrics: metrics, Threshold: threshold}
+}
+
+func (e *GzipExporter) Start(ctx context.Context) error {
+	if err := e.Plain.Start(ctx); err != nil {
+		return err
+	}
+	return e.Gzip.Start(ctx)
+}
+
+func (e *GzipExporter) Stop(ctx context.Context) error {
+	return errors.Join(e.Plain.Stop(ctx), e.Gzip.Stop(ctx))
+}
+
+func (e *GzipExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	size := 0
+	if e.Logs == GzipModeAuto {
+		for _, rl := range protoLogs {
+			size += proto.Size(rl)
+		}
+	}
+	return e.choose(e.Logs, size).UploadLogs(ctx, protoLogs)
+}
+
+func (e *GzipExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	size := 0
+	if e.Traces == GzipModeAuto {
+		for _, rs := range protoSpans {
+			size += proto.Size(rs)
+		}
+	}
+	return e.choose(e.Traces, size).UploadTraces(ctx, protoSpans)
+}
+
+func (e *GzipExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	size := 0
+	if e.Metrics == GzipModeAuto {
+		for _, rm := range protoMetrics {
+			size += proto.Size(rm)
+		}
+	}
+	return e.choose(e.Metrics, size).UploadMetrics(ctx, protoMetrics)
+}
+
+func (e *GzipExporter) choose(mode GzipMode, size int) Exporter {
+	switch mode {
+	case GzipModeOn:
+		return e.Gzip
+	case GzipModeAuto:
+		if size > e.Threshold {
+			return e.Gzip
+		}
+	}
+	return e.Plain
+}
+
+// gzipTransport compresses OTLP/HTTP request bodies, which the otlp helper
+// sends uncompressed.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	compressed := buf.Bytes()
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", "gzip")
+	return t.base.RoundTrip(req)
+}
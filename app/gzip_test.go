@@ -0,0 +1,133 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestGzipMode_UnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		input     string
+		expected  GzipMode
+		expectErr bool
+	}{
+		{input: "gzip: true", expected: GzipModeOn},
+		{input: "gzip: false", expected: GzipModeOff},
+		{input: "gzip: auto", expected: GzipModeAuto},
+		{input: `gzip: "auto"`, expected: GzipModeAuto},
+		{input: "gzip: sometimes", expectErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			var cfg OtlpExporterConfig
+			err := yaml.Unmarshal([]byte(tc.input), &cfg)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, cfg.Gzip)
+			assert.Equal(t, tc.expected, *cfg.Gzip)
+		})
+	}
+}
+
+func TestGzipExporter(t *testing.T) {
+	type request struct {
+		path     string
+		encoding string
+	}
+	var mu sync.Mutex
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, data, "the server must see the protobuf payload")
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.Path, encoding: r.Header.Get("Content-Encoding")})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	auto, on := GzipModeAuto, GzipModeOn
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type:        "otlp",
+		MaxAttempts: 1,
+		Otlp: OtlpExporterConfig{
+			Endpoint:          srv.URL,
+			Protocol:          "http/protobuf",
+			Gzip:              &auto,
+			GzipAutoThreshold: 512,
+			Logs:              &OtlpSignalConfig{Gzip: &on},
+		},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, exp.Start(ctx))
+	defer exp.Stop(ctx)
+
+	uploadSpan := func(name string) {
+		require.NoError(t, exp.UploadTraces(ctx, []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: name}}}},
+		}}))
+	}
+	uploadSpan("small")
+	uploadSpan(strings.Repeat("large", 200))
+	require.NoError(t, exp.UploadLogs(ctx, []*logspb.ResourceLogs{{
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{SeverityText: "INFO"}}}},
+	}}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []request{
+		{path: "/v1/traces", encoding: ""},
+		{path: "/v1/traces", encoding: "gzip"},
+		{path: "/v1/logs", encoding: "gzip"},
+	}, requests, "auto compresses only the payload above the threshold; gzip: true always compresses")
+}
+
+func TestOtlpExporterConfig_GzipModes(t *testing.T) {
+	on, off, auto := GzipModeOn, GzipModeOff, GzipModeAuto
+	cases := []struct {
+		name         string
+		cfg          OtlpExporterConfig
+		traces, logs GzipMode
+		usesGzip     bool
+	}{
+		{name: "unset", cfg: OtlpExporterConfig{}, traces: off, logs: off},
+		{name: "global", cfg: OtlpExporterConfig{Gzip: &auto}, traces: auto, logs: auto, usesGzip: true},
+		{name: "signal override", cfg: OtlpExporterConfig{Gzip: &on, Traces: &OtlpSignalConfig{Gzip: &off}}, traces: off, logs: on, usesGzip: true},
+		{name: "all off", cfg: OtlpExporterConfig{Gzip: &off}, traces: off, logs: off},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			traces, logs := tc.cfg.gzipModes()
+			assert.Equal(t, tc.traces, traces)
+			assert.Equal(t, tc.logs, logs)
+			assert.Equal(t, tc.usesGzip, tc.cfg.UsesGzip())
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerTemplateRe matches `${cel:<expr>}` placeholders in header values.
+// Environment expansion at config load leaves these untouched.
+var headerTemplateRe = regexp.MustCompile(`\$\{cel:([^}]+)\}`)
+
+func hasHeaderTemplate(headers map[string]string) bool {
+	for _, v := range headers {
+		if headerTemplateRe.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewHeaderEnv returns the CEL environment for header templates. It only
+// exposes side-effect free helpers: `signal` ("traces" or "logs"), `now`
+// (upload time) and `uuid()`.
+func NewHeaderEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("signal", cel.StringType),
+		cel.Variable("now", cel.TimestampType),
+		cel.Function("uuid",
+			cel.Overload("uuid", []*cel.Type{}, cel.StringType,
+				cel.FunctionBinding(func(...ref.Val) ref.Val {
+					return types.String(newUUID())
+				}),
+			),
+		),
+	)
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// headerTemplates holds header values whose `${cel:...}` parts are evaluated per upload.
+type headerTemplates struct {
+	values   map[string]string
+	programs map[string]cel.Program
+}
+
+func newHeaderTemplates(env *cel.Env, headers map[string]string) (*headerTemplates, error) {
+	t := &headerTemplates{
+		values:   headers,
+		programs: make(map[string]cel.Program),
+	}
+	for key, value := range headers {
+		for _, m := range headerTemplateRe.FindAllStringSubmatch(value, -1) {
+			expr := m[1]
+			if _, ok := t.programs[expr]; ok {
+				continue
+			}
+			ast, issues := env.Compile(expr)
+			if issues != nil && issues.Err() != nil {
+				return nil, fmt.Errorf("header %s: %w", key, issues.Err())
+			}
+			prog, err := env.Program(ast)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %w", key, err)
+			}
+			t.programs[expr] = prog
+		}
+	}
+	return t, nil
+}
+
+func (t *headerTemplates) resolve(vars map[string]any, dst map[string]string) error {
+	var firstErr error
+	for key, value := range t.values {
+		dst[key] = headerTemplateRe.ReplaceAllStringFunc(value, func(m string) string {
+			expr := headerTemplateRe.FindStringSubmatch(m)[1]
+			out, _, err := t.programs[expr].Eval(vars)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("header %s: %w", key, err)
+				}
+				return ""
+			}
+			if s, ok := out.Value().(string); ok {
+				return s
+			}
+			return fmt.Sprint(out.Value())
+		})
+	}
+	return firstErr
+}
+
+// DynamicHeadersExporter resolves header templates on every upload and passes
+// the result to the underlying client through the request context. The client
+// must be built without static headers, because gRPC would otherwise replace
+// the outgoing metadata set here.
+type DynamicHeadersExporter struct {
+	Exporter
+	headers       *headerTemplates
+	tracesHeaders *headerTemplates
+	logsHeaders   *headerTemplates
+}
+
+func NewDynamicHeadersExporter(exp Exporter, cfg OtlpExporterConfig) (*DynamicHeadersExporter, error) {
+	env, err := NewHeaderEnv()
+	if err != nil {
+		return nil, err
+	}
+	e := &DynamicHeadersExporter{Exporter: exp}
+	if e.headers, err = newHeaderTemplates(env, cfg.Headers); err != nil {
+		return nil, err
+	}
+	if cfg.Traces != nil {
+		if e.tracesHeaders, err = newHeaderTemplates(env, cfg.Traces.Headers); err != nil {
+			return nil, fmt.Errorf("traces.%w", err)
+		}
+	}
+	if cfg.Logs != nil {
+		if e.logsHeaders, err = newHeaderTemplates(env, cfg.Logs.Headers); err != nil {
+			return nil, fmt.Errorf("logs.%w", err)
+		}
+	}
+	return e, nil
+}
+
+func (e *DynamicHeadersExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	ctx, err := e.withHeaders(ctx, "logs", e.logsHeaders)
+	if err != nil {
+		return err
+	}
+	return e.Exporter.UploadLogs(ctx, protoLogs)
+}
+
+func (e *DynamicHeadersExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	ctx, err := e.withHeaders(ctx, "traces", e.tracesHeaders)
+	if err != nil {
+		return err
+	}
+	return e.Exporter.UploadTraces(ctx, protoSpans)
+}
+
+func (e *DynamicHeadersExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	ctx, err := e.withHeaders(ctx, "metrics", nil)
+	if err != nil {
+		return err
+	}
+	return e.Exporter.UploadMetrics(ctx, protoMetrics)
+}
+
+func (e *DynamicHeadersExporter) withHeaders(ctx context.Context, signal string, signalHeaders *headerTemplates) (context.Context, error) {
+	vars := map[string]any{
+		"signal": signal,
+		"now":    time.Now(),
+	}
+	headers := make(map[string]string)
+	if err := e.headers.resolve(vars, headers); err != nil {
+		return ctx, fmt.Errorf("resolve headers: %w", err)
+	}
+	if signalHeaders != nil {
+		if err := signalHeaders.resolve(vars, headers); err != nil {
+			return ctx, fmt.Errorf("resolve %s headers: %w", signal, err)
+		}
+	}
+	ctx = context.WithValue(ctx, requestHeadersKey{}, headers)
+	return metadata.NewOutgoingContext(ctx, metadata.New(headers)), nil
+}
+
+type requestHeadersKey struct{}
+
+// requestHeadersTransport copies headers resolved by DynamicHeadersExporter
+// onto outgoing HTTP requests.
+type requestHeadersTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers, ok := req.Context().Value(requestHeadersKey{}).(map[string]string)
+	if ok && len(headers) > 0 {
+		req = req.Clone(req.Context())
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
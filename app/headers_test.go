@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestDynamicHeadersExporter_ChangesAcrossUploads(t *testing.T) {
+	var mu sync.Mutex
+	var received []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type:        "otlp",
+		MaxAttempts: 1,
+		Otlp: OtlpExporterConfig{
+			Endpoint: srv.URL,
+			Protocol: "http/protobuf",
+			Headers: map[string]string{
+				"Authorization": "Bearer static-token",
+				"X-Request-Id":  "${cel:uuid()}",
+				"X-Signal":      "dbt-${cel:signal}",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background()))
+	defer exp.Stop(context.Background())
+
+	for i := 0; i < 2; i++ {
+		err := exp.UploadTraces(context.Background(), []*tracepb.ResourceSpans{{}})
+		require.NoError(t, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	for _, h := range received {
+		assert.Equal(t, "Bearer static-token", h.Get("Authorization"))
+		assert.Equal(t, "dbt-traces", h.Get("X-Signal"))
+		assert.Len(t, h.Get("X-Request-Id"), 36)
+	}
+	assert.NotEqual(t, received[0].Get("X-Request-Id"), received[1].Get("X-Request-Id"))
+}
+
+func TestOtlpExporterConfig_ValidateHeaderTemplates(t *testing.T) {
+	cfg := OtlpExporterConfig{
+		Endpoint: "http://localhost:4318",
+		Headers: map[string]string{
+			"X-Request-Id": "${cel:uuid(}",
+		},
+	}
+	require.Error(t, cfg.Validate())
+
+	cfg.Headers["X-Request-Id"] = "${cel:string(now)}"
+	require.NoError(t, cfg.Validate())
+}
+
+func TestExpandWithDefaultAndError_KeepsHeaderTemplates(t *testing.T) {
+	result, err := expandWithDefaultAndError(`x-request-id: "${cel:uuid()}" token: "${TOKEN:-abc}"`)
+	require.NoError(t, err)
+	assert.Equal(t, `x-request-id: "${cel:uuid()}" token: "abc"`, result)
+}
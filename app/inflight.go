@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/proto"
+)
+
+// inFlightGate limits the total size of the batches being decoded and
+// uploaded at once. A batch is reserved before it is decoded, by whoever
+// reads it, so waiting for earlier uploads holds up reading more. A batch
+// larger than the limit is admitted once nothing else is in flight. A nil
+// gate does not limit anything.
+type inFlightGate struct {
+	sem   *semaphore.Weighted
+	limit int64
+}
+
+func newInFlightGate(limit int64) *inFlightGate {
+	if limit <= 0 {
+		return nil
+	}
+	return &inFlightGate{sem: semaphore.NewWeighted(limit), limit: limit}
+}
+
+// acquire blocks until n bytes are free and returns a function releasing
+// them. It does not give up: the uploads holding the bytes are bounded by the
+// upload timeout, and giving up would drop the batch.
+func (g *inFlightGate) acquire(n int64) (release func()) {
+	if g == nil {
+		return func() {}
+	}
+	if n < 1 {
+		n = 1
+	}
+	if n > g.limit {
+		n = g.limit
+	}
+	// Acquire only fails once the context is done.
+	_ = g.sem.Acquire(context.Background(), n)
+	return func() { g.sem.Release(n) }
+}
+
+// linesSize returns the size of OTEL lines not decoded yet.
+func linesSize(lines []otelLine) int64 {
+	var n int64
+	for _, line := range lines {
+		n += int64(len(line.text))
+	}
+	return n
+}
+
+// recordsSize returns the serialized size of decoded records.
+func recordsSize(spans []*tracepb.Span, logs []*logspb.LogRecord, metrics []*metricspb.Metric) int64 {
+	return spansSize(spans) + logsSize(logs) + metricsSize(metrics)
+}
+
+func spansSize(spans []*tracepb.Span) int64 {
+	var n int64
+	for _, span := range spans {
+		n += int64(proto.Size(span))
+	}
+	return n
+}
+
+func metricsSize(metrics []*metricspb.Metric) int64 {
+	var n int64
+	for _, metric := range metrics {
+		n += int64(proto.Size(metric))
+	}
+	return n
+}
+
+func logsSize(logs []*logspb.LogRecord) int64 {
+	var n int64
+	for _, log := range logs {
+		n += int64(proto.Size(log))
+	}
+	return n
+}
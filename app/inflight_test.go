@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func TestFlushAndUpload_InFlightGateBlocksFlush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	var uploaded atomic.Int64
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploaded.Add(int64(len(protoSpans[0].ScopeSpans[0].Spans)))
+			return nil
+		},
+	).Times(2)
+
+	a := newTestApp()
+	a.inFlight = newInFlightGate(1000)
+	// Another upload, e.g. of a spooled batch, holds all the in-flight memory.
+	release := a.inFlight.acquire(1000)
+
+	lines := make(chan otelLine)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := a.flushAndUpload(context.Background(), lines, newMockForwarder(t, mock), 0, RunParams{
+			FlushTimeout: 5 * time.Second,
+		})
+		assert.NoError(t, err)
+	}()
+	// 100 lines trigger a flush, which waits for the memory before decoding.
+	for _, line := range spanLines(0, 50) {
+		lines <- otelLine{text: line}
+	}
+	select {
+	case lines <- otelLine{text: spanLines(50, 1)[0]}:
+		t.Fatal("the read loop took a line while its flush waited for in-flight memory")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Zero(t, uploaded.Load(), "nothing is uploaded while the memory is held")
+	assert.Zero(t, a.pending.Load(), "the buffered lines are not decoded yet")
+
+	release()
+	for _, line := range spanLines(50, 1) {
+		lines <- otelLine{text: line}
+	}
+	close(lines)
+	<-done
+	assert.Equal(t, int64(51), uploaded.Load(), "nothing is dropped for waiting")
+}
+
+func TestInFlightGate_OversizedBatchRunsAlone(t *testing.T) {
+	gate := newInFlightGate(100)
+
+	release := gate.acquire(1000)
+
+	acquired := make(chan func())
+	go func() { acquired <- gate.acquire(1) }()
+	select {
+	case <-acquired:
+		t.Fatal("nothing else fits while a batch larger than the limit is in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting batch is admitted once the large one is released")
+	}
+}
+
+func TestInFlightGate_Disabled(t *testing.T) {
+	gate := newInFlightGate(0)
+	assert.Nil(t, gate)
+	release := gate.acquire(1 << 40)
+	release()
+}
+
+func TestSpansSize(t *testing.T) {
+	spans := []*tracepb.Span{{Name: "a"}, {Name: "bb"}}
+	assert.Equal(t, int64(3+4), spansSize(spans), "sum of serialized span sizes")
+	assert.Zero(t, spansSize(nil))
+}
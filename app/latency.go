@@ -0,0 +1,83 @@
+package app
+
+import (
+	"time"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// decodeLatencyMetricName names the histogram of how long spans stay pending
+// in the decoder, from their first line being read until they are emitted.
+const decodeLatencyMetricName = "dbt.forwarder.span.decode_latency_ms"
+
+// decodeLatencyBounds are the bucket bounds of the decode latency histogram,
+// in milliseconds: from a flush interval up to an hour long model.
+var decodeLatencyBounds = []float64{10, 50, 100, 500, 1000, 5000, 10000, 30000, 60000, 300000, 900000, 3600000}
+
+// latencyHistogram is a cumulative explicit bucket histogram of latencies in
+// milliseconds.
+type latencyHistogram struct {
+	start   time.Time
+	counts  []uint64 // one more than the bounds, for the overflow bucket
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	changed bool // observed since the last metric
+}
+
+func newLatencyHistogram(start time.Time) *latencyHistogram {
+	return &latencyHistogram{
+		start:  start,
+		counts: make([]uint64, len(decodeLatencyBounds)+1),
+	}
+}
+
+func (h *latencyHistogram) observe(latency time.Duration) {
+	ms := float64(max(latency, 0)) / float64(time.Millisecond)
+	bucket := len(decodeLatencyBounds)
+	for i, bound := range decodeLatencyBounds {
+		if ms <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.counts[bucket]++
+	if h.count == 0 || ms < h.min {
+		h.min = ms
+	}
+	if h.count == 0 || ms > h.max {
+		h.max = ms
+	}
+	h.count++
+	h.sum += ms
+	h.changed = true
+}
+
+// metric returns the histogram as of now with cumulative temporality, or nil
+// if nothing was observed since the last call.
+func (h *latencyHistogram) metric(now time.Time) *metricspb.Metric {
+	if !h.changed {
+		return nil
+	}
+	h.changed = false
+	sum, minimum, maximum := h.sum, h.min, h.max
+	return &metricspb.Metric{
+		Name:        decodeLatencyMetricName,
+		Description: "Time from the first line of a span being read until the span is complete",
+		Unit:        "ms",
+		Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				StartTimeUnixNano: uint64(h.start.UnixNano()),
+				TimeUnixNano:      uint64(now.UnixNano()),
+				Count:             h.count,
+				Sum:               &sum,
+				Min:               &minimum,
+				Max:               &maximum,
+				BucketCounts:      append([]uint64(nil), h.counts...),
+				ExplicitBounds:    decodeLatencyBounds,
+			}},
+		}},
+	}
+}
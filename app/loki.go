@@ -0,0 +1,212 @@
+package app
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// defaultLokiLabels is used when no labels are configured.
+var defaultLokiLabels = map[string]string{"service_name": "service.name"}
+
+// lokiLabelName is the syntax Loki accepts for label names.
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiExporter pushes log records to Grafana Loki. Records are grouped into
+// streams by the configured labels and the body becomes the log line. There
+// is no trace or metric ingestion, so spans and metrics are dropped with a
+// warning.
+type LokiExporter struct {
+	url             string
+	labels          map[string]string
+	username        string
+	password        string
+	tenantID        string
+	httpClient      *http.Client
+	warnOnce        sync.Once
+	metricsWarnOnce sync.Once
+}
+
+func NewLokiExporter(cfg LokiExporterConfig) *LokiExporter {
+	labels := cfg.Labels
+	if len(labels) == 0 {
+		labels = defaultLokiLabels
+	}
+	return &LokiExporter{
+		url:        strings.TrimRight(cfg.URL, "/"),
+		labels:     labels,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		tenantID:   cfg.TenantID,
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (e *LokiExporter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (e *LokiExporter) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (e *LokiExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	e.warnOnce.Do(func() {
+		slog.Warn("loki exporter does not support traces, dropping them", "url", e.url)
+	})
+	return nil
+}
+
+func (e *LokiExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	e.metricsWarnOnce.Do(func() {
+		slog.Warn("loki exporter does not support metrics, dropping them", "url", e.url)
+	})
+	return nil
+}
+
+func (e *LokiExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	push := buildLokiPushRequest(e.labels, protoLogs)
+	if len(push.Streams) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("loki: marshal push request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("loki: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+	if e.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", e.tenantID)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("loki: push logs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("loki: push logs: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// buildLokiPushRequest groups log records into streams by their label values.
+// labels maps a label name to the attribute it is read from, looked up in the
+// record's attributes and then in the resource; severity_text reads the
+// record's severity. Labels without a value are left out. Streams are ordered
+// by their labels and lines by time, as older Loki versions reject
+// out-of-order lines.
+func buildLokiPushRequest(labels map[string]string, protoLogs []*otlp.ResourceLogs) *lokiPushRequest {
+	streams := make(map[string]*lokiStream)
+	for _, rl := range protoLogs {
+		resource := convertAttributesToMap(rl.GetResource().GetAttributes())
+		for _, sl := range rl.GetScopeLogs() {
+			for _, log := range sl.GetLogRecords() {
+				stream := lokiStreamLabels(labels, log, resource)
+				key := lokiStreamKey(stream)
+				if streams[key] == nil {
+					streams[key] = &lokiStream{Stream: stream}
+				}
+				streams[key].Values = append(streams[key].Values, [2]string{lokiTimestamp(log), lokiLine(log)})
+			}
+		}
+	}
+	push := &lokiPushRequest{Streams: make([]*lokiStream, 0, len(streams))}
+	for _, key := range slices.Sorted(maps.Keys(streams)) {
+		stream := streams[key]
+		slices.SortStableFunc(stream.Values, func(a, b [2]string) int {
+			x, _ := strconv.ParseUint(a[0], 10, 64)
+			y, _ := strconv.ParseUint(b[0], 10, 64)
+			return cmp.Compare(x, y)
+		})
+		push.Streams = append(push.Streams, stream)
+	}
+	return push
+}
+
+func lokiStreamLabels(labels map[string]string, log *logspb.LogRecord, resource map[string]any) map[string]string {
+	attrs := convertAttributesToMap(log.GetAttributes())
+	stream := make(map[string]string, len(labels))
+	for name, key := range labels {
+		var value any
+		if v, ok := attrs[key]; ok {
+			value = v
+		} else if v, ok := resource[key]; ok {
+			value = v
+		} else if key == "severity_text" {
+			value = log.GetSeverityText()
+		}
+		if value == nil || value == "" {
+			continue
+		}
+		stream[name] = fmt.Sprint(value)
+	}
+	if len(stream) == 0 {
+		// Loki rejects streams without labels.
+		stream["service_name"] = "unknown_service"
+	}
+	return stream
+}
+
+// lokiStreamKey renders a label set in Loki's selector syntax, which is
+// unique per label set.
+func lokiStreamKey(stream map[string]string) string {
+	pairs := make([]string, 0, len(stream))
+	for _, name := range slices.Sorted(maps.Keys(stream)) {
+		pairs = append(pairs, name+"="+strconv.Quote(stream[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func lokiTimestamp(log *logspb.LogRecord) string {
+	ts := log.GetTimeUnixNano()
+	if ts == 0 {
+		ts = log.GetObservedTimeUnixNano()
+	}
+	return strconv.FormatUint(ts, 10)
+}
+
+// lokiLine returns the record's body as the log line; structured bodies are
+// written as JSON, which Loki's json parser can read.
+func lokiLine(log *logspb.LogRecord) string {
+	switch body := getAttributeValue(log.GetBody()).(type) {
+	case nil:
+		return ""
+	case string:
+		return body
+	default:
+		if b, err := json.Marshal(body); err == nil {
+			return string(b)
+		}
+		return fmt.Sprint(body)
+	}
+}
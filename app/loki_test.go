@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func testLokiResourceLogs() []*otlp.ResourceLogs {
+	return []*otlp.ResourceLogs{{
+		Resource: &resourcepb.Resource{
+			Attributes: convertAttributesFromMap(map[string]any{"service.name": "dbt"}),
+		},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			LogRecords: []*logspb.LogRecord{
+				{
+					TimeUnixNano: 1772073189000000000,
+					SeverityText: "WARN",
+					Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+						Values: convertAttributesFromMap(map[string]any{"rows": "3"}),
+					}}},
+				},
+				{
+					TimeUnixNano: 1772073188916175000,
+					SeverityText: "INFO",
+					Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "Loading packages.yml"}},
+					Attributes:   convertAttributesFromMap(map[string]any{"dbt.phase": "parse"}),
+				},
+				{
+					TimeUnixNano: 1772073188000000000,
+					SeverityText: "INFO",
+					Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "Running with dbt"}},
+				},
+			},
+		}},
+	}}
+}
+
+func TestBuildLokiPushRequest(t *testing.T) {
+	push := buildLokiPushRequest(map[string]string{
+		"service_name": "service.name",
+		"level":        "severity_text",
+		"phase":        "dbt.phase",
+	}, testLokiResourceLogs())
+
+	require.Len(t, push.Streams, 3)
+	assert.Equal(t, map[string]string{"service_name": "dbt", "level": "INFO", "phase": "parse"}, push.Streams[0].Stream)
+	assert.Equal(t, [][2]string{{"1772073188916175000", "Loading packages.yml"}}, push.Streams[0].Values)
+	assert.Equal(t, map[string]string{"service_name": "dbt", "level": "INFO"}, push.Streams[1].Stream, "labels without a value are left out")
+	assert.Equal(t, [][2]string{{"1772073188000000000", "Running with dbt"}}, push.Streams[1].Values)
+	assert.Equal(t, map[string]string{"service_name": "dbt", "level": "WARN"}, push.Streams[2].Stream)
+	assert.Equal(t, [][2]string{{"1772073189000000000", `{"rows":"3"}`}}, push.Streams[2].Values, "structured bodies are written as JSON")
+
+	push = buildLokiPushRequest(map[string]string{"service_name": "service.name"}, testLokiResourceLogs())
+	require.Len(t, push.Streams, 1)
+	assert.Equal(t, []string{"1772073188000000000", "1772073188916175000", "1772073189000000000"},
+		[]string{push.Streams[0].Values[0][0], push.Streams[0].Values[1][0], push.Streams[0].Values[2][0]}, "lines are ordered by time")
+
+	push = buildLokiPushRequest(map[string]string{"job": "missing"}, testLokiResourceLogs())
+	require.Len(t, push.Streams, 1)
+	assert.Equal(t, map[string]string{"service_name": "unknown_service"}, push.Streams[0].Stream, "streams always have a label")
+}
+
+func TestLokiExporter_UploadLogs(t *testing.T) {
+	var gotPath, gotContentType, gotAuth, gotTenant, gotBody string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotContentType = r.Header.Get("Content-Type")
+		gotAuth = r.Header.Get("Authorization")
+		gotTenant = r.Header.Get("X-Scope-OrgID")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(status)
+		if status != http.StatusNoContent {
+			_, _ = io.WriteString(w, "entry out of order\n")
+		}
+	}))
+	defer srv.Close()
+
+	exp := NewLokiExporter(LokiExporterConfig{URL: srv.URL + "/", Username: "123456", Password: "glc_token", TenantID: "team-a"})
+	require.NoError(t, exp.Start(context.Background()))
+	require.NoError(t, exp.UploadLogs(context.Background(), testLokiResourceLogs()))
+	assert.Equal(t, "/loki/api/v1/push", gotPath)
+	assert.Equal(t, "application/json", gotContentType)
+	assert.Equal(t, "Basic MTIzNDU2OmdsY190b2tlbg==", gotAuth)
+	assert.Equal(t, "team-a", gotTenant)
+	assert.JSONEq(t, `{"streams":[{"stream":{"service_name":"dbt"},"values":[
+		["1772073188000000000","Running with dbt"],
+		["1772073188916175000","Loading packages.yml"],
+		["1772073189000000000","{\"rows\":\"3\"}"]
+	]}]}`, gotBody, "service_name is the default label")
+
+	status = http.StatusBadRequest
+	err := exp.UploadLogs(context.Background(), testLokiResourceLogs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 400: entry out of order")
+
+	gotPath = ""
+	require.NoError(t, exp.UploadLogs(context.Background(), []*otlp.ResourceLogs{{}}))
+	assert.Empty(t, gotPath, "nothing is sent without log records")
+	require.NoError(t, exp.UploadTraces(context.Background(), []*otlp.ResourceSpans{{}}), "traces are dropped without error")
+}
+
+func TestLokiExporterConfig(t *testing.T) {
+	var cfg ExporterConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+type: loki
+url: http://localhost:3100
+labels:
+  service_name: service.name
+  level: severity_text
+tenant_id: team-a
+`), &cfg))
+	assert.Equal(t, LokiExporterConfig{
+		URL:      "http://localhost:3100",
+		Labels:   map[string]string{"service_name": "service.name", "level": "severity_text"},
+		TenantID: "team-a",
+	}, cfg.Loki)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Loki.Labels["service.name"] = "service.name"
+	require.Error(t, cfg.Validate(), "label names may not contain dots")
+	require.Error(t, (&ExporterConfig{Type: "loki"}).Validate(), "url is required")
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMultiplexExporter_SlowChildTimesOut(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The slow child ignores its context, as a hung connection might.
+	release := make(chan struct{})
+	defer close(release)
+	slow := NewMockExporter(ctrl)
+	slow.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+			<-release
+			return nil
+		},
+	)
+	fastDone := make(chan struct{})
+	fast := NewMockExporter(ctrl)
+	fast.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+			close(fastDone)
+			return nil
+		},
+	)
+	failing := NewMockExporter(ctrl)
+	failing.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(errors.New("rejected"))
+
+	exp := NewMultiplexExporter(&TimeoutExporter{Exporter: slow, Timeout: 100 * time.Millisecond}, fast, failing)
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- exp.UploadTraces(context.Background(), nil) }()
+
+	select {
+	case <-fastDone:
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("the fast child was held up by the slow one")
+	}
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "exporter 1 of 3 timed out after 100ms")
+		assert.Contains(t, err.Error(), "rejected", "errors of the other children are joined")
+		assert.Less(t, time.Since(start), time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("the upload waited for the hung child past its timeout")
+	}
+}
+
+func TestMultiplexExporter_NoTimeoutWaitsForChildren(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+			_, ok := ctx.Deadline()
+			assert.False(t, ok, "children without a timeout get the caller's context")
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+	).Times(2)
+
+	exp := NewMultiplexExporter(mock, mock)
+	require.NoError(t, exp.UploadLogs(context.Background(), nil))
+}
+
+func TestNewExporter_WrapsTimeout(t *testing.T) {
+	timeout := 10 * time.Second
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type:    "stdout",
+		Timeout: &timeout,
+	})
+	require.NoError(t, err)
+	wrapped, ok := exp.(*TimeoutExporter)
+	require.True(t, ok, "expected TimeoutExporter, got %T", exp)
+	assert.Equal(t, timeout, wrapped.Timeout)
+	_, ok = wrapped.Exporter.(*RetryExporter)
+	assert.True(t, ok, "the timeout bounds the retries too")
+
+	timeout = 0
+	require.Error(t, (&ExporterConfig{Type: "stdout", Timeout: &timeout}).Validate())
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpEnvPrefix prefixes the standard OTLP exporter environment variables.
+const otlpEnvPrefix = "OTEL_EXPORTER_OTLP_"
+
+// withEnvDefaults returns a copy of the config with the fields it leaves empty
+// taken from the standard OTEL_EXPORTER_OTLP_ENDPOINT, _PROTOCOL, _HEADERS and
+// _TIMEOUT environment variables. Signal variants such as
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT apply when neither the signal nor the
+// exporter sets the field, overriding the generic variables for the signal.
+// The config always wins over the environment.
+func (cfg OtlpExporterConfig) withEnvDefaults() (OtlpExporterConfig, error) {
+	resolved := cfg
+	for _, s := range []struct {
+		name   string
+		signal **OtlpSignalConfig
+	}{{"TRACES_", &resolved.Traces}, {"LOGS_", &resolved.Logs}} {
+		signal := &OtlpSignalConfig{}
+		if *s.signal != nil {
+			copied := **s.signal
+			signal = &copied
+		}
+		changed, err := signal.envDefaults(otlpEnvPrefix+s.name, cfg)
+		if err != nil {
+			return cfg, err
+		}
+		if changed || *s.signal != nil {
+			*s.signal = signal
+		}
+	}
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = os.Getenv(otlpEnvPrefix + "ENDPOINT")
+	}
+	if resolved.Protocol == "" {
+		resolved.Protocol = os.Getenv(otlpEnvPrefix + "PROTOCOL")
+	}
+	if len(resolved.Headers) == 0 {
+		headers, err := envHeaders(otlpEnvPrefix + "HEADERS")
+		if err != nil {
+			return cfg, err
+		}
+		resolved.Headers = headers
+	}
+	if resolved.ExportTimeout == nil {
+		timeout, err := envTimeout(otlpEnvPrefix + "TIMEOUT")
+		if err != nil {
+			return cfg, err
+		}
+		resolved.ExportTimeout = timeout
+	}
+	return resolved, nil
+}
+
+// envDefaults fills the fields that neither the signal nor the exporter
+// sets from the signal's environment variables, and reports whether any was
+// filled.
+func (s *OtlpSignalConfig) envDefaults(prefix string, exporter OtlpExporterConfig) (bool, error) {
+	changed := false
+	if s.Endpoint == "" && exporter.Endpoint == "" {
+		s.Endpoint = os.Getenv(prefix + "ENDPOINT")
+		changed = changed || s.Endpoint != ""
+	}
+	if s.Protocol == "" && exporter.Protocol == "" {
+		s.Protocol = os.Getenv(prefix + "PROTOCOL")
+		changed = changed || s.Protocol != ""
+	}
+	if len(s.Headers) == 0 && len(exporter.Headers) == 0 {
+		headers, err := envHeaders(prefix + "HEADERS")
+		if err != nil {
+			return false, err
+		}
+		s.Headers = headers
+		changed = changed || len(headers) > 0
+	}
+	if s.ExportTimeout == nil && exporter.ExportTimeout == nil {
+		timeout, err := envTimeout(prefix + "TIMEOUT")
+		if err != nil {
+			return false, err
+		}
+		s.ExportTimeout = timeout
+		changed = changed || timeout != nil
+	}
+	return changed, nil
+}
+
+// envHeaders parses an OTLP headers variable, a comma separated list of
+// key=value pairs with URL encoded values. It returns nil if it is unset.
+func envHeaders(name string) (map[string]string, error) {
+	value := os.Getenv(name)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s: invalid header %q, want key=value", name, pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%s: header %s: %w", name, key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// envTimeout parses an OTLP timeout variable, in milliseconds as the
+// specification defines or as a Go duration such as 10s. It returns nil if it
+// is unset.
+func envTimeout(name string) (*time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil, nil
+	}
+	var timeout time.Duration
+	if ms, err := strconv.Atoi(value); err == nil {
+		timeout = time.Duration(ms) * time.Millisecond
+	} else if timeout, err = time.ParseDuration(value); err != nil {
+		return nil, fmt.Errorf("%s: invalid timeout %q, want milliseconds or a duration", name, value)
+	}
+	return &timeout, nil
+}
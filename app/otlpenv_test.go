@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestEnvHeaders(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+		err   string
+	}{
+		{value: "", want: nil},
+		{value: "api-key=secret,x-tenant=dbt", want: map[string]string{"api-key": "secret", "x-tenant": "dbt"}},
+		{value: " authorization = Bearer%20token ,", want: map[string]string{"authorization": "Bearer token"}},
+		{value: "a=b=c", want: map[string]string{"a": "b=c"}},
+		{value: "api-key", err: "invalid header"},
+		{value: "=value", err: "invalid header"},
+		{value: "a=%zz", err: "header a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", tt.value)
+			got, err := envHeaders("OTEL_EXPORTER_OTLP_HEADERS")
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOtlpExporterConfig_EnvDefaults(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2500")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "api-key=traces-secret")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_TIMEOUT", "10s")
+
+	resolved, err := (&OtlpExporterConfig{}).withEnvDefaults()
+	require.NoError(t, err)
+	assert.Equal(t, "http://collector:4318", resolved.Endpoint)
+	assert.Equal(t, "http/protobuf", resolved.Protocol)
+	assert.Equal(t, map[string]string{"api-key": "secret"}, resolved.Headers)
+	require.NotNil(t, resolved.ExportTimeout)
+	assert.Equal(t, 2500*time.Millisecond, *resolved.ExportTimeout)
+	require.NotNil(t, resolved.Traces)
+	assert.Equal(t, "http://traces:4318", resolved.Traces.Endpoint, "signal variables override the generic ones")
+	assert.Equal(t, map[string]string{"api-key": "traces-secret"}, resolved.Traces.Headers)
+	require.NotNil(t, resolved.Logs)
+	assert.Equal(t, 10*time.Second, *resolved.Logs.ExportTimeout)
+	assert.Empty(t, resolved.Logs.Endpoint)
+
+	// The config wins over the environment, at either level.
+	timeout := time.Second
+	cfg := OtlpExporterConfig{
+		Endpoint:      "http://configured:4318",
+		Headers:       map[string]string{"authorization": "token"},
+		ExportTimeout: &timeout,
+		Logs:          &OtlpSignalConfig{Protocol: "grpc"},
+	}
+	resolved, err = cfg.withEnvDefaults()
+	require.NoError(t, err)
+	assert.Equal(t, "http://configured:4318", resolved.Endpoint)
+	assert.Equal(t, "http/protobuf", resolved.Protocol)
+	assert.Equal(t, map[string]string{"authorization": "token"}, resolved.Headers)
+	assert.Equal(t, time.Second, *resolved.ExportTimeout)
+	assert.Nil(t, resolved.Traces, "signal variables do not override the configured endpoint and headers")
+	assert.Equal(t, &OtlpSignalConfig{Protocol: "grpc"}, resolved.Logs)
+	assert.Equal(t, &OtlpSignalConfig{Protocol: "grpc"}, cfg.Logs, "the config is not modified")
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "soon")
+	assert.ErrorContains(t, (&OtlpExporterConfig{}).Validate(), "OTEL_EXPORTER_OTLP_TIMEOUT")
+}
+
+func TestOtlpExporterConfig_ValidateSignalEndpoints(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "")
+	assert.ErrorContains(t, (&OtlpExporterConfig{}).Validate(), "endpoint is required", "logs have no endpoint")
+
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "http://logs:4318")
+	assert.NoError(t, (&OtlpExporterConfig{}).Validate(), "every signal has an endpoint from the environment")
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	assert.NoError(t, (&OtlpExporterConfig{Traces: &OtlpSignalConfig{Endpoint: "http://traces:4318"}}).Validate(), "or from the config")
+}
+
+func TestNewExporter_OtlpEnvDefaults(t *testing.T) {
+	var apiKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("api-key")
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	// Only the traces endpoint reaches the server.
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=from-env")
+
+	cfg := ExporterConfig{Type: "otlp", MaxAttempts: 1}
+	require.NoError(t, cfg.Validate(), "the endpoint may come from the environment")
+	exp, err := NewExporter(context.Background(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background()))
+	defer exp.Stop(context.Background())
+	require.NoError(t, exp.UploadTraces(context.Background(), []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "span"}}}},
+	}}))
+	assert.Equal(t, "from-env", apiKey)
+}
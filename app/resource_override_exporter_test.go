@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func TestResourceOverrideExporter_PerExporterResource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock1 := NewMockExporter(ctrl)
+	mock2 := NewMockExporter(ctrl)
+	exporters := map[string]Exporter{
+		"exporter1": mock1,
+		"exporter2": &ResourceOverrideExporter{
+			Exporter: mock2,
+			Overrides: map[string]any{
+				"service":      "dbt",
+				"service.name": nil,
+			},
+		},
+	}
+
+	cfg := ForwardConfig{
+		Traces: &TracesForwardConfig{
+			Exporters: []string{"exporter1", "exporter2"},
+		},
+		Logs: &LogsForwardConfig{
+			Exporters: []string{"exporter1", "exporter2"},
+		},
+	}
+	fw, err := NewForwarder("test-forwarder", cfg, exporters)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	mock1.EXPECT().UploadTraces(ctx, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			attrs := convertAttributesToMap(protoSpans[0].Resource.Attributes)
+			assert.Equal(t, "dbt", attrs["service.name"])
+			assert.NotContains(t, attrs, "service")
+			assert.Len(t, protoSpans[0].ScopeSpans[0].Spans, 1)
+			return nil
+		},
+	)
+	mock2.EXPECT().UploadTraces(ctx, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			attrs := convertAttributesToMap(protoSpans[0].Resource.Attributes)
+			assert.Equal(t, "dbt", attrs["service"])
+			assert.NotContains(t, attrs, "service.name")
+			assert.Len(t, protoSpans[0].ScopeSpans[0].Spans, 1)
+			return nil
+		},
+	)
+	err = fw.UploadTraces(ctx, &tracepb.ScopeSpans{
+		Spans: []*tracepb.Span{{Name: "test-span"}},
+	})
+	require.NoError(t, err)
+
+	mock1.EXPECT().UploadLogs(ctx, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			attrs := convertAttributesToMap(protoLogs[0].Resource.Attributes)
+			assert.Equal(t, "dbt", attrs["service.name"])
+			return nil
+		},
+	)
+	mock2.EXPECT().UploadLogs(ctx, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			attrs := convertAttributesToMap(protoLogs[0].Resource.Attributes)
+			assert.Equal(t, "dbt", attrs["service"])
+			assert.NotContains(t, attrs, "service.name")
+			return nil
+		},
+	)
+	err = fw.UploadLogs(ctx, &logspb.ScopeLogs{
+		LogRecords: []*logspb.LogRecord{{SeverityText: "INFO"}},
+	})
+	require.NoError(t, err)
+}
+
+func TestNewExporter_WrapsResourceOverrides(t *testing.T) {
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type:        "otlp",
+		MaxAttempts: 1,
+		ResourceOverrides: map[string]any{
+			"service": "dbt",
+		},
+		Otlp: OtlpExporterConfig{
+			Endpoint: "http://localhost:4318",
+		},
+	})
+	require.NoError(t, err)
+	override, ok := exp.(*ResourceOverrideExporter)
+	require.True(t, ok, "expected ResourceOverrideExporter, got %T", exp)
+	assert.Equal(t, "dbt", override.Overrides["service"])
+}
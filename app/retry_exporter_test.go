@@ -3,12 +3,21 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	yaml "github.com/goccy/go-yaml"
+	"github.com/mashiike/go-otlp-helper/otlp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestRetryExporter_UploadTraces_SucceedsAfterRetry(t *testing.T) {
@@ -83,3 +92,138 @@ func TestRetryExporter_NoRetryWhenMaxAttemptsIsOne(t *testing.T) {
 	err := exp.UploadLogs(context.Background(), nil)
 	require.Error(t, err)
 }
+
+func TestRetryExporter_Backoff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var calls []time.Time
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+			calls = append(calls, time.Now())
+			if len(calls) < 4 {
+				return errors.New("unexpected status code: 503")
+			}
+			return nil
+		},
+	).Times(4)
+
+	exp := &RetryExporter{
+		Exporter:      mock,
+		MaxAttempts:   5,
+		RetryInterval: 20 * time.Millisecond,
+		MaxInterval:   50 * time.Millisecond,
+		Multiplier:    2,
+		Retryable:     isTransientOTLPError,
+	}
+	require.NoError(t, exp.UploadTraces(context.Background(), nil))
+	// Waits are 20ms, 40ms and 50ms (capped), each jittered by ±20%.
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond} {
+		got := calls[i+1].Sub(calls[i])
+		assert.GreaterOrEqual(t, got, want*8/10, "wait %d", i+1)
+	}
+}
+
+func TestRetryExporter_PermanentErrorIsNotRetried(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).Return(errors.New("unexpected status code: 400")).Times(1)
+
+	exp := &RetryExporter{
+		Exporter:      mock,
+		MaxAttempts:   5,
+		RetryInterval: time.Millisecond,
+		Multiplier:    2,
+		Retryable:     isTransientOTLPError,
+	}
+	require.Error(t, exp.UploadLogs(context.Background(), nil))
+}
+
+func TestRetryExporter_StopsAtDeadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(errors.New("unexpected status code: 503")).Times(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	exp := &RetryExporter{
+		Exporter:      mock,
+		MaxAttempts:   5,
+		RetryInterval: time.Second,
+		Multiplier:    2,
+	}
+	start := time.Now()
+	require.Error(t, exp.UploadTraces(ctx, nil))
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "a retry past the deadline is not waited for")
+}
+
+func TestIsTransientOTLPError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, "connection refused"), true},
+		{status.Error(codes.ResourceExhausted, "slow down"), true},
+		{status.Error(codes.InvalidArgument, "bad span"), false},
+		{status.Error(codes.Unauthenticated, "bad token"), false},
+		{errors.New("unexpected status code: 429"), true},
+		{errors.New("unexpected status code: 503"), true},
+		{errors.New("unexpected status code: 400"), false},
+		{errors.New("unexpected status code: 401"), false},
+		{fmt.Errorf("failed to send request: %w", errors.New("dial tcp: connection refused")), true},
+		{fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), true},
+		{errors.New("failed to export 3 spans: invalid"), false},
+		{errors.New("failed to marshal body"), false},
+	} {
+		assert.Equal(t, tc.want, isTransientOTLPError(tc.err), tc.err.Error())
+	}
+}
+
+func TestNewExporter_OtlpRetry(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	var cfg ExporterConfig
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+type: otlp
+endpoint: %s
+protocol: http/protobuf
+retry:
+  initial_interval: 10ms
+  max_interval: 20ms
+`, srv.URL)), &cfg))
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, &RetryConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}, cfg.Otlp.Retry)
+
+	exp, err := NewExporter(context.Background(), cfg)
+	require.NoError(t, err)
+	retry, ok := exp.(*RetryExporter)
+	require.True(t, ok, "expected RetryExporter, got %T", exp)
+	assert.Equal(t, 5, retry.MaxAttempts, "defaults fill unset fields")
+	assert.Equal(t, 2.0, retry.Multiplier)
+
+	require.NoError(t, exp.Start(context.Background()))
+	require.NoError(t, exp.UploadTraces(context.Background(), []*otlp.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "span"}}}},
+	}}))
+	assert.Equal(t, int32(3), requests.Load(), "503 responses are retried")
+
+	cfg.MaxAttempts = 3
+	require.Error(t, cfg.Validate(), "retry replaces max_attempts")
+	cfg.MaxAttempts = 0
+	cfg.Otlp.Retry.Multiplier = 0.5
+	require.Error(t, cfg.Validate())
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"log/slog"
+	"slices"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// forwardRouter holds the forwarders of a run that have a match expression,
+// so that the others can tell which records no forwarder claimed.
+type forwardRouter struct {
+	matchers []*Forwarder
+}
+
+// routeForwarders links the forwarders of a run for routing by their match
+// expressions. Without any match expression every forwarder uploads every
+// record, and nothing is linked.
+func routeForwarders(forwarders []*Forwarder) {
+	r := &forwardRouter{}
+	for _, f := range forwarders {
+		if f.matchProg != nil {
+			r.matchers = append(r.matchers, f)
+		}
+	}
+	if len(r.matchers) == 0 {
+		return
+	}
+	for _, f := range forwarders {
+		f.router = r
+	}
+}
+
+// matches reports whether the match expression is true for obj. Records
+// for which it fails, e.g. for lacking a variable, do not match.
+func (f *Forwarder) matches(obj any) bool {
+	out, _, err := f.matchProg.Eval(obj)
+	if err != nil {
+		slog.Debug("match expression failed, the record does not match", "forwarder", f.name, "error", err)
+		return false
+	}
+	match, ok := out.Value().(bool)
+	return ok && match
+}
+
+// routeRecords returns the records f uploads: those its match expression is
+// true for, or for a forwarder without one, those no match expression is
+// true for.
+func routeRecords[T any](f *Forwarder, records []T, forEval func(T) any) []T {
+	if f.router == nil {
+		return records
+	}
+	routed := make([]T, 0, len(records))
+	for _, record := range records {
+		obj := forEval(record)
+		if f.matchProg != nil {
+			if f.matches(obj) {
+				routed = append(routed, record)
+			}
+			continue
+		}
+		if !slices.ContainsFunc(f.router.matchers, func(m *Forwarder) bool { return m.matches(obj) }) {
+			routed = append(routed, record)
+		}
+	}
+	return routed
+}
+
+func (f *Forwarder) routeSpans(spans []*tracepb.Span) []*tracepb.Span {
+	return routeRecords(f, spans, SpanForEval)
+}
+
+func (f *Forwarder) routeLogs(logs []*logspb.LogRecord) []*logspb.LogRecord {
+	return routeRecords(f, logs, LogForEval)
+}
+
+func (f *Forwarder) routeMetrics(metrics []*metricspb.Metric) []*metricspb.Metric {
+	return routeRecords(f, metrics, func(metric *metricspb.Metric) any {
+		var dp *metricspb.NumberDataPoint
+		if points := metric.GetGauge().GetDataPoints(); len(points) > 0 {
+			dp = points[0]
+		}
+		return MetricForEval(metric, dp)
+	})
+}
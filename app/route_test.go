@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUpload_MatchRoutesRecords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploadedSpans := make(map[string][]string)
+	uploadedLogs := make(map[string][]string)
+	newForwarder := func(name string, match *string) *Forwarder {
+		mock := NewMockExporter(ctrl)
+		mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+				for _, span := range protoSpans[0].ScopeSpans[0].Spans {
+					uploadedSpans[name] = append(uploadedSpans[name], span.Name)
+				}
+				return nil
+			},
+		).AnyTimes()
+		mock.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+				for _, log := range protoLogs[0].ScopeLogs[0].LogRecords {
+					uploadedLogs[name] = append(uploadedLogs[name], log.SeverityText)
+				}
+				return nil
+			},
+		).AnyTimes()
+		fw, err := NewForwarder(name, ForwardConfig{
+			Match:  match,
+			Traces: &TracesForwardConfig{Exporters: []string{"mock"}},
+			Logs:   &LogsForwardConfig{Exporters: []string{"mock"}},
+		}, map[string]Exporter{"mock": mock})
+		require.NoError(t, err)
+		return fw
+	}
+	failures := `attributes["dbt.node_type"] == "test" && status.code == "ERROR"`
+	models := `attributes["dbt.node_type"] == "model"`
+	slack := newForwarder("slack", &failures)
+	modelsFw := newForwarder("models", &models)
+	apm := newForwarder("apm", nil)
+	forwarders := []*Forwarder{slack, modelsFw, apm}
+	routeForwarders(forwarders)
+
+	nodeType := func(value string) []*commonpb.KeyValue {
+		return []*commonpb.KeyValue{{Key: "dbt.node_type", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}}
+	}
+	spans := []*tracepb.Span{
+		{Name: "failed test", Attributes: nodeType("test"), Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}},
+		{Name: "passed test", Attributes: nodeType("test")},
+		{Name: "model", Attributes: nodeType("model")},
+		{Name: "invocation"},
+	}
+	logs := []*logspb.LogRecord{
+		{SeverityText: "model log", Attributes: nodeType("model")},
+		// Logs have no status, so the failures expression fails and does not match.
+		{SeverityText: "test log", Attributes: nodeType("test")},
+	}
+	a := newTestApp()
+	a.upload(spans, logs, nil, forwarders, RunParams{FlushTimeout: 5 * time.Second}, 0)
+
+	assert.Equal(t, map[string][]string{
+		"slack":  {"failed test"},
+		"models": {"model"},
+		"apm":    {"passed test", "invocation"},
+	}, uploadedSpans)
+	assert.Equal(t, map[string][]string{
+		"models": {"model log"},
+		"apm":    {"test log"},
+	}, uploadedLogs)
+
+	// Retries and spool replays pass only some forwarders; the default one
+	// still leaves the records the others match to them.
+	clear(uploadedSpans)
+	a.upload(spans, nil, nil, []*Forwarder{apm}, RunParams{FlushTimeout: 5 * time.Second}, 0)
+	assert.Equal(t, map[string][]string{"apm": {"passed test", "invocation"}}, uploadedSpans)
+}
+
+func TestNewForwarder_InvalidMatch(t *testing.T) {
+	match := `attributes[`
+	_, err := NewForwarder("broken", ForwardConfig{Match: &match}, map[string]Exporter{})
+	require.ErrorContains(t, err, "invalid match")
+	assert.ErrorContains(t, (&ForwardConfig{Match: &match}).Validate(nil), "invalid match")
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+// sampledTraceID returns a trace ID in the middle of the i-th of n equal
+// parts of the ID space, so that a ratio keeps a predictable share of n IDs.
+func sampledTraceID(i, n int) []byte {
+	id := make([]byte, 16)
+	step := ^uint64(0) / uint64(n)
+	binary.BigEndian.PutUint64(id[8:], uint64(i)*step+step/2)
+	return id
+}
+
+func TestSamplingExporter_PerExporterRatio(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := NewMockExporter(ctrl)
+	cheap := NewMockExporter(ctrl)
+	exporters := map[string]Exporter{
+		"primary": primary,
+		"cheap":   &SamplingExporter{Exporter: cheap, Ratio: 0.25},
+	}
+	cfg := ForwardConfig{
+		Traces: &TracesForwardConfig{Exporters: []string{"primary", "cheap"}},
+		Logs:   &LogsForwardConfig{Exporters: []string{"primary", "cheap"}},
+	}
+	fw, err := NewForwarder("test-forwarder", cfg, exporters)
+	require.NoError(t, err)
+
+	const n = 100
+	spans := make([]*tracepb.Span, n)
+	for i := range spans {
+		spans[i] = &tracepb.Span{Name: "span", TraceId: sampledTraceID(i, n)}
+	}
+	countSpans := func(count *int) func(context.Context, []*tracepb.ResourceSpans) error {
+		return func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			for _, rs := range protoSpans {
+				for _, ss := range rs.GetScopeSpans() {
+					*count += len(ss.GetSpans())
+				}
+			}
+			return nil
+		}
+	}
+	var primaryCount, cheapCount int
+	primary.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(countSpans(&primaryCount))
+	cheap.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(countSpans(&cheapCount))
+	require.NoError(t, fw.UploadTraces(context.Background(), &tracepb.ScopeSpans{Spans: spans}))
+	assert.Equal(t, n, primaryCount)
+	assert.Equal(t, n/4, cheapCount)
+
+	// Log records follow their trace; records without one are always sent.
+	logs := []*logspb.LogRecord{
+		{SeverityText: "INFO", TraceId: sampledTraceID(0, n)},
+		{SeverityText: "INFO", TraceId: sampledTraceID(n-1, n)},
+		{SeverityText: "INFO"},
+	}
+	primary.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			assert.Len(t, protoLogs[0].ScopeLogs[0].LogRecords, 3)
+			return nil
+		},
+	)
+	cheap.EXPECT().UploadLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+			records := protoLogs[0].ScopeLogs[0].LogRecords
+			require.Len(t, records, 2)
+			assert.Equal(t, sampledTraceID(0, n), records[0].TraceId)
+			assert.Empty(t, records[1].TraceId)
+			return nil
+		},
+	)
+	require.NoError(t, fw.UploadLogs(context.Background(), &logspb.ScopeLogs{LogRecords: logs}))
+}
+
+func TestNewExporter_WrapsSampling(t *testing.T) {
+	var memory bytes.Buffer
+	ratio := 0.0
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type:        "stdout",
+		SampleRatio: &ratio,
+		Stdout:      StdoutExporterConfig{Writer: &memory},
+	})
+	require.NoError(t, err)
+	require.NoError(t, exp.UploadTraces(context.Background(), []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "span", TraceId: sampledTraceID(1, 2)}}}},
+	}}))
+	assert.Empty(t, memory.String(), "nothing is uploaded when every span is sampled out")
+
+	ratio = 1.5
+	assert.ErrorContains(t, (&ExporterConfig{Type: "stdout", SampleRatio: &ratio}).Validate(), "sample_ratio must be between 0 and 1")
+}
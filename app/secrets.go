@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SecretResolver resolves `${<scheme>:<ref>}` references while the config is
+// loaded, e.g. `${ssm:/dbt/otel/api-key}`.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{
+		"ssm":            &ssmResolver{},
+		"secretsmanager": &secretsManagerResolver{},
+	}
+)
+
+// RegisterSecretResolver makes references with the given scheme resolve with r,
+// replacing any resolver registered for it. A nil r unregisters the scheme.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	if r == nil {
+		delete(secretResolvers, scheme)
+		return
+	}
+	secretResolvers[scheme] = r
+}
+
+func lookupSecretResolver(scheme string) (SecretResolver, bool) {
+	secretResolversMu.RLock()
+	defer secretResolversMu.RUnlock()
+	r, ok := secretResolvers[scheme]
+	return r, ok
+}
+
+// awsConfig loads the default AWS config once, on the first AWS reference, so
+// configs without such references never need AWS credentials.
+var awsConfig = sync.OnceValues(func() (aws.Config, error) {
+	return awsconfig.LoadDefaultConfig(context.Background())
+})
+
+// ssmResolver reads a parameter from AWS Systems Manager Parameter Store.
+// SecureString parameters are decrypted.
+type ssmResolver struct{}
+
+func (r *ssmResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	cfg, err := awsConfig()
+	if err != nil {
+		return "", fmt.Errorf("load aws config: %w", err)
+	}
+	out, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(ref),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+// secretsManagerResolver reads the string value of an AWS Secrets Manager secret.
+type secretsManagerResolver struct{}
+
+func (r *secretsManagerResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	cfg, err := awsConfig()
+	if err != nil {
+		return "", fmt.Errorf("load aws config: %w", err)
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", ref)
+	}
+	return *out.SecretString, nil
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// selfTestName names the synthetic span and is the body of the synthetic log.
+const selfTestName = "dbt-fusion-otel-forwarder self-test"
+
+// SelfTest checks the telemetry setup without running dbt: it sends a
+// synthetic span and log record through every forward rule to each of its
+// exporters, one exporter at a time, and reports each result to Stdout. Each
+// upload is bounded by UploadTimeout. It returns 0 if every upload succeeded
+// and 1 otherwise.
+func (a *App) SelfTest(ctx context.Context, params RunParams) int {
+	cfg := a.forwarderConfig()
+	if len(cfg.Forward) == 0 {
+		fmt.Fprintln(a.Stdout, "self-test failed: no forward rules are configured")
+		return 1
+	}
+	exporters := NewExporters(ctx, cfg.Exporters)
+	defer func() {
+		for name, exp := range exporters {
+			if err := exp.Stop(context.WithoutCancel(ctx)); err != nil {
+				a.Logger.Warn("failed to stop exporter", "exporter", name, "error", err)
+			}
+		}
+	}()
+
+	var total, failed int
+	report := func(signal, forwarder, exporter string, err error) {
+		total++
+		if err != nil {
+			failed++
+			fmt.Fprintf(a.Stdout, "%s %s -> %s: FAILED: %v\n", signal, forwarder, exporter, err)
+			return
+		}
+		fmt.Fprintf(a.Stdout, "%s %s -> %s: ok\n", signal, forwarder, exporter)
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Forward)) {
+		fwCfg := cfg.Forward[name]
+		if fwCfg.Traces != nil {
+			for _, expName := range fwCfg.Traces.Exporters {
+				single := fwCfg
+				traces := *fwCfg.Traces
+				traces.Exporters = []string{expName}
+				single.Traces, single.Logs, single.Metrics = &traces, nil, nil
+				report("traces", name, expName, a.selfTestUpload(ctx, name, expName, single, exporters, params, func(ctx context.Context, fw *Forwarder) error {
+					return fw.UploadTraces(ctx, &tracepb.ScopeSpans{
+						Scope:     a.cfg.Scope.Traces.scope(),
+						SchemaUrl: a.cfg.Scope.Traces.schemaURL(),
+						Spans:     []*tracepb.Span{a.selfTestSpan()},
+					})
+				}))
+			}
+		}
+		if fwCfg.Logs != nil {
+			for _, expName := range fwCfg.Logs.Exporters {
+				single := fwCfg
+				logs := *fwCfg.Logs
+				logs.Exporters = []string{expName}
+				single.Traces, single.Logs, single.Metrics = nil, &logs, nil
+				report("logs", name, expName, a.selfTestUpload(ctx, name, expName, single, exporters, params, func(ctx context.Context, fw *Forwarder) error {
+					return fw.UploadLogs(ctx, &logspb.ScopeLogs{
+						Scope:      a.cfg.Scope.Logs.scope(),
+						SchemaUrl:  a.cfg.Scope.Logs.schemaURL(),
+						LogRecords: []*logspb.LogRecord{a.selfTestLog()},
+					})
+				}))
+			}
+		}
+	}
+	if total == 0 {
+		fmt.Fprintln(a.Stdout, "self-test failed: no forward rule sends traces or logs to an exporter")
+		return 1
+	}
+	if failed > 0 {
+		fmt.Fprintf(a.Stdout, "self-test failed: %d of %d uploads failed\n", failed, total)
+		return 1
+	}
+	fmt.Fprintf(a.Stdout, "self-test passed: %d uploads succeeded\n", total)
+	return 0
+}
+
+// selfTestUpload runs one upload through a forwarder built for a single
+// exporter, so that the forward rule's resource and attribute modifiers apply.
+func (a *App) selfTestUpload(ctx context.Context, name, expName string, cfg ForwardConfig, exporters map[string]Exporter, params RunParams, upload func(context.Context, *Forwarder) error) error {
+	if _, ok := exporters[expName]; !ok {
+		return errors.New("exporter is not defined")
+	}
+	fw, err := NewForwarder(name, cfg, exporters)
+	if err != nil {
+		return err
+	}
+	if err := fw.Start(ctx); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	uploadCtx, cancel := context.WithTimeout(ctx, params.uploadTimeout())
+	defer cancel()
+	return upload(uploadCtx, fw)
+}
+
+func (a *App) selfTestSpan() *tracepb.Span {
+	traceID, spanID := make([]byte, 16), make([]byte, 8)
+	_, _ = rand.Read(traceID)
+	_, _ = rand.Read(spanID)
+	now := uint64(a.Now().UnixNano())
+	return &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		Name:              selfTestName,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: now - 1_000_000,
+		EndTimeUnixNano:   now,
+		Attributes:        selfTestAttributes(),
+	}
+}
+
+func (a *App) selfTestLog() *logspb.LogRecord {
+	now := uint64(a.Now().UnixNano())
+	return &logspb.LogRecord{
+		TimeUnixNano:         now,
+		ObservedTimeUnixNano: now,
+		SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+		SeverityText:         "INFO",
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: selfTestName}},
+		Attributes:           selfTestAttributes(),
+	}
+}
+
+func selfTestAttributes() []*commonpb.KeyValue {
+	return []*commonpb.KeyValue{{
+		Key:   "dbt.forwarder.selftest",
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}},
+	}}
+}
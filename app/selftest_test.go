@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	var report, memory bytes.Buffer
+	a := newTestApp()
+	a.Stdout = &report
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &memory}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {
+				Resource: &ForwardResourceConfig{Attributes: map[string]any{"service.name": "dbt"}},
+				Traces:   &TracesForwardConfig{Exporters: []string{"memory"}},
+				Logs:     &LogsForwardConfig{Exporters: []string{"memory"}},
+			},
+		},
+	}
+
+	code := a.SelfTest(context.Background(), RunParams{FlushTimeout: 5 * time.Second})
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `traces default -> memory: ok
+logs default -> memory: ok
+self-test passed: 2 uploads succeeded
+`, report.String())
+	assert.Contains(t, memory.String(), "traces: 1 spans\n  span dbt-fusion-otel-forwarder self-test ")
+	assert.Contains(t, memory.String(), `logs: 1 log records
+  log INFO "dbt-fusion-otel-forwarder self-test" dbt.forwarder.selftest=true`)
+}
+
+func TestSelfTest_Failure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var report bytes.Buffer
+	a := newTestApp()
+	a.Stdout = &report
+	a.cfg = &Config{
+		Exporters: map[string]ExporterConfig{
+			"otlp":   {Type: "otlp", MaxAttempts: 1, Otlp: OtlpExporterConfig{Endpoint: srv.URL, Protocol: "http/protobuf"}},
+			"memory": {Type: "stdout", Stdout: StdoutExporterConfig{Writer: &bytes.Buffer{}}},
+		},
+		Forward: map[string]ForwardConfig{
+			"default": {Traces: &TracesForwardConfig{Exporters: []string{"memory", "otlp"}}},
+		},
+	}
+
+	code := a.SelfTest(context.Background(), RunParams{FlushTimeout: 5 * time.Second})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, report.String(), "traces default -> memory: ok\n")
+	assert.Contains(t, report.String(), "traces default -> otlp: FAILED: ")
+	assert.Contains(t, report.String(), "self-test failed: 1 of 2 uploads failed\n")
+
+	report.Reset()
+	a.cfg = &Config{}
+	assert.Equal(t, 1, a.SelfTest(context.Background(), RunParams{FlushTimeout: 5 * time.Second}))
+	assert.Equal(t, "self-test failed: no forward rules are configured\n", report.String())
+}
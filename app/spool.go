@@ -0,0 +1,234 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// DefaultSpoolMaxBytes bounds the spool directory when no limit is given.
+const DefaultSpoolMaxBytes = 64 << 20
+
+const spoolFileExt = ".json"
+
+// spool persists batches while they are uploaded, so that telemetry decoded
+// before the wrapper is killed or an upload fails is sent by the next run.
+// Each batch is a file named by its creation time, so names sort oldest
+// first. Files are removed once every forwarder uploaded the batch; on
+// failure only the forwarders that failed are kept for the replay. The
+// directory is bounded by maxBytes by evicting the oldest files. A nil spool
+// persists nothing.
+type spool struct {
+	dir      string
+	maxBytes int64
+	seq      atomic.Uint64
+	mu       sync.Mutex // serializes eviction
+}
+
+// spoolBatch is the file format of a spooled batch. Records are stored as
+// OTLP JSON without resource and scope, which forwarders add on upload.
+type spoolBatch struct {
+	Forwarders []string        `json:"forwarders"`
+	Traces     json.RawMessage `json:"traces,omitempty"`
+	Logs       json.RawMessage `json:"logs,omitempty"`
+	Metrics    json.RawMessage `json:"metrics,omitempty"`
+
+	spans   []*tracepb.Span
+	logs    []*logspb.LogRecord
+	metrics []*metricspb.Metric
+}
+
+func newSpool(dir string, maxBytes int64) (*spool, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool: create directory: %w", err)
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpoolMaxBytes
+	}
+	return &spool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// save writes a batch for the forwarders and returns its path.
+func (s *spool) save(batch *spoolBatch) (string, error) {
+	b, err := batch.marshal()
+	if err != nil {
+		return "", err
+	}
+	// The pid keeps names unique across processes sharing the directory.
+	name := fmt.Sprintf("%020d-%d-%d%s", time.Now().UnixNano(), os.Getpid(), s.seq.Add(1), spoolFileExt)
+	path := filepath.Join(s.dir, name)
+	if err := writeFileAtomic(path, b); err != nil {
+		return "", err
+	}
+	s.evict()
+	return path, nil
+}
+
+// settle removes a batch that every forwarder uploaded, or keeps only the
+// forwarders in failed for the next replay.
+func (s *spool) settle(path string, batch *spoolBatch, failed []string) error {
+	if len(failed) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("spool: remove: %w", err)
+		}
+		return nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		// Evicted while it was uploaded.
+		return nil
+	}
+	kept := *batch
+	kept.Forwarders = failed
+	b, err := kept.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// pending returns the paths of the spooled batches, oldest first.
+func (s *spool) pending() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool: read directory: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), spoolFileExt) {
+			paths = append(paths, filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// load reads a spooled batch.
+func (s *spool) load(path string) (*spoolBatch, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("spool: read: %w", err)
+	}
+	var batch spoolBatch
+	if err := json.Unmarshal(b, &batch); err != nil {
+		return nil, fmt.Errorf("spool: decode %s: %w", filepath.Base(path), err)
+	}
+	if err := batch.unmarshalRecords(); err != nil {
+		return nil, fmt.Errorf("spool: decode %s: %w", filepath.Base(path), err)
+	}
+	return &batch, nil
+}
+
+// evict removes the oldest batches until the spool fits in maxBytes.
+func (s *spool) evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := s.pending()
+	if err != nil {
+		return
+	}
+	sizes := make([]int64, len(paths))
+	var total int64
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > s.maxBytes && i < len(paths); i++ {
+		if err := os.Remove(paths[i]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		total -= sizes[i]
+		slog.Warn("spool is full, dropped the oldest batch", "path", paths[i], "max_bytes", s.maxBytes)
+	}
+}
+
+func (b *spoolBatch) marshal() ([]byte, error) {
+	var err error
+	if len(b.spans) > 0 {
+		b.Traces, err = protojson.Marshal(&tracepb.ResourceSpans{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: b.spans}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("spool: marshal spans: %w", err)
+		}
+	}
+	if len(b.logs) > 0 {
+		b.Logs, err = protojson.Marshal(&logspb.ResourceLogs{
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: b.logs}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("spool: marshal logs: %w", err)
+		}
+	}
+	if len(b.metrics) > 0 {
+		b.Metrics, err = protojson.Marshal(&metricspb.ResourceMetrics{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: b.metrics}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("spool: marshal metrics: %w", err)
+		}
+	}
+	return json.Marshal(b)
+}
+
+func (b *spoolBatch) unmarshalRecords() error {
+	if len(b.Traces) > 0 {
+		var rs tracepb.ResourceSpans
+		if err := protojson.Unmarshal(b.Traces, &rs); err != nil {
+			return err
+		}
+		for _, ss := range rs.GetScopeSpans() {
+			b.spans = append(b.spans, ss.GetSpans()...)
+		}
+	}
+	if len(b.Logs) > 0 {
+		var rl logspb.ResourceLogs
+		if err := protojson.Unmarshal(b.Logs, &rl); err != nil {
+			return err
+		}
+		for _, sl := range rl.GetScopeLogs() {
+			b.logs = append(b.logs, sl.GetLogRecords()...)
+		}
+	}
+	if len(b.Metrics) > 0 {
+		var rm metricspb.ResourceMetrics
+		if err := protojson.Unmarshal(b.Metrics, &rm); err != nil {
+			return err
+		}
+		for _, sm := range rm.GetScopeMetrics() {
+			b.metrics = append(b.metrics, sm.GetMetrics()...)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes through a temporary file, so that a crash never
+// leaves a partial batch behind.
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("spool: write: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("spool: write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSpool(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	sp, err := newSpool(dir, 0)
+	require.NoError(t, err)
+
+	batch := &spoolBatch{
+		Forwarders: []string{"a", "b"},
+		spans:      []*tracepb.Span{{Name: "span-0", TraceId: []byte{1}, SpanId: []byte{2}}},
+		logs:       []*logspb.LogRecord{{SeverityText: "INFO"}},
+	}
+	path, err := sp.save(batch)
+	require.NoError(t, err)
+	require.NoError(t, sp.settle(path, batch, []string{"b"}))
+
+	// A new process finds the batch left behind.
+	sp, err = newSpool(dir, 0)
+	require.NoError(t, err)
+	paths, err := sp.pending()
+	require.NoError(t, err)
+	require.Equal(t, []string{path}, paths)
+	loaded, err := sp.load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, loaded.Forwarders, "only failed forwarders are replayed")
+	require.Len(t, loaded.spans, 1)
+	assert.True(t, proto.Equal(batch.spans[0], loaded.spans[0]))
+	require.Len(t, loaded.logs, 1)
+	assert.Equal(t, "INFO", loaded.logs[0].GetSeverityText())
+	assert.Empty(t, loaded.metrics)
+
+	require.NoError(t, sp.settle(path, loaded, nil))
+	paths, err = sp.pending()
+	require.NoError(t, err)
+	assert.Empty(t, paths, "uploaded batches are removed")
+}
+
+func TestSpool_EvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	batch := func(name string) *spoolBatch {
+		return &spoolBatch{Forwarders: []string{"a"}, spans: []*tracepb.Span{{Name: name}}}
+	}
+	sp, err := newSpool(dir, 1<<20)
+	require.NoError(t, err)
+	first, err := sp.save(batch("first"))
+	require.NoError(t, err)
+	info, err := os.Stat(first)
+	require.NoError(t, err)
+
+	sp.maxBytes = 2*info.Size() + 1
+	_, err = sp.save(batch("secnd"))
+	require.NoError(t, err)
+	third, err := sp.save(batch("third"))
+	require.NoError(t, err)
+
+	paths, err := sp.pending()
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	assert.NotContains(t, paths, first, "the oldest batch is evicted")
+	assert.Equal(t, third, paths[1], "batches are listed oldest first")
+	require.NoError(t, sp.settle(first, batch("first"), []string{"a"}), "an evicted batch is not written back")
+	paths, err = sp.pending()
+	require.NoError(t, err)
+	assert.Len(t, paths, 2)
+}
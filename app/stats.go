@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+)
+
+// statsToStdout as the stats file path writes the statistics to Stdout.
+const statsToStdout = "-"
+
+// runStats collects the statistics of a run written to the stats file.
+type runStats struct {
+	mu        sync.Mutex
+	decoded   RecordCounts
+	uploaded  RecordCounts
+	errors    int64
+	exporters map[string]*ExporterStats
+}
+
+// RunStats is the JSON summary of a run written by --stats-file.
+type RunStats struct {
+	LinesRead       int64                     `json:"lines_read"`
+	Decoded         RecordCounts              `json:"decoded"`
+	Uploaded        RecordCounts              `json:"uploaded"`
+	Errors          int64                     `json:"errors"`
+	Exporters       map[string]*ExporterStats `json:"exporters"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	ExitCode        int                       `json:"exit_code"`
+}
+
+// RecordCounts counts records by signal.
+type RecordCounts struct {
+	Spans   int64 `json:"spans"`
+	Logs    int64 `json:"logs"`
+	Metrics int64 `json:"metrics"`
+}
+
+// ExporterStats counts the uploads of an exporter.
+type ExporterStats struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+func newRunStats() *runStats {
+	return &runStats{exporters: make(map[string]*ExporterStats)}
+}
+
+// addDecoded counts records handed to the forwarders. A nil runStats counts
+// nothing, as do the other methods.
+func (s *runStats) addDecoded(spans, logs, metrics int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decoded.add(spans, logs, metrics)
+}
+
+// addUploaded counts records uploaded by every forwarder.
+func (s *runStats) addUploaded(spans, logs, metrics int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploaded.add(spans, logs, metrics)
+}
+
+// addErrors counts failed forwarder uploads.
+func (s *runStats) addErrors(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors += int64(n)
+}
+
+func (s *runStats) addUpload(exporter string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.exporters[exporter]
+	if stats == nil {
+		stats = &ExporterStats{}
+		s.exporters[exporter] = stats
+	}
+	if err != nil {
+		stats.Failed++
+	} else {
+		stats.Succeeded++
+	}
+}
+
+// wrapExporters wraps each exporter to count its uploads.
+func (s *runStats) wrapExporters(exporters map[string]Exporter) {
+	if s == nil {
+		return
+	}
+	for name, exp := range exporters {
+		exporters[name] = &statsExporter{Exporter: exp, name: name, stats: s}
+	}
+}
+
+func (s *runStats) summary(linesRead int64, duration time.Duration, exitCode int) RunStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exporters := make(map[string]*ExporterStats, len(s.exporters))
+	for name, stats := range s.exporters {
+		copied := *stats
+		exporters[name] = &copied
+	}
+	return RunStats{
+		LinesRead:       linesRead,
+		Decoded:         s.decoded,
+		Uploaded:        s.uploaded,
+		Errors:          s.errors,
+		Exporters:       exporters,
+		DurationSeconds: duration.Seconds(),
+		ExitCode:        exitCode,
+	}
+}
+
+func (c *RecordCounts) add(spans, logs, metrics int) {
+	c.Spans += int64(spans)
+	c.Logs += int64(logs)
+	c.Metrics += int64(metrics)
+}
+
+// writeStats writes the run statistics to path, or to Stdout for "-".
+func (a *App) writeStats(path string, started time.Time, exitCode int) {
+	b, err := json.MarshalIndent(a.stats.summary(a.linesRead.Load(), a.Now().Sub(started), exitCode), "", "  ")
+	if err != nil {
+		a.Logger.Warn("failed to encode run statistics", "error", err)
+		return
+	}
+	b = append(b, '\n')
+	if path == statsToStdout {
+		a.Stdout.Write(b)
+		return
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		a.Logger.Warn("failed to write run statistics", "path", path, "error", err)
+	}
+}
+
+// statsExporter counts the uploads of an exporter in the run statistics.
+type statsExporter struct {
+	Exporter
+	name  string
+	stats *runStats
+}
+
+func (e *statsExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	err := e.Exporter.UploadTraces(ctx, protoSpans)
+	e.stats.addUpload(e.name, err)
+	return err
+}
+
+func (e *statsExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	err := e.Exporter.UploadLogs(ctx, protoLogs)
+	e.stats.addUpload(e.name, err)
+	return err
+}
+
+func (e *statsExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	err := e.Exporter.UploadMetrics(ctx, protoMetrics)
+	e.stats.addUpload(e.name, err)
+	return err
+}
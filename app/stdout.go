@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mashiike/go-otlp-helper/otlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// stdoutMaxAttributes is how many attributes of each record are printed.
+const stdoutMaxAttributes = 3
+
+// StdoutExporter prints a summary of every uploaded batch, for trying out a
+// config without a backend: the record counts and one line per span, log
+// record or metric with its first few attributes. With verbose, the batch is
+// also dumped as indented OTLP JSON.
+type StdoutExporter struct {
+	w       io.Writer
+	verbose bool
+
+	mu sync.Mutex
+}
+
+// NewStdoutExporter returns an exporter printing to cfg.Writer, or to the
+// process's stdout or stderr as selected by cfg.Output.
+func NewStdoutExporter(cfg StdoutExporterConfig) *StdoutExporter {
+	w := cfg.Writer
+	if w == nil {
+		w = os.Stdout
+		if cfg.Output == StdoutOutputStderr {
+			w = os.Stderr
+		}
+	}
+	return &StdoutExporter{w: w, verbose: cfg.Verbose}
+}
+
+func (e *StdoutExporter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (e *StdoutExporter) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (e *StdoutExporter) UploadTraces(ctx context.Context, protoSpans []*otlp.ResourceSpans) error {
+	var b strings.Builder
+	count := 0
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				count++
+				duration := time.Duration(span.GetEndTimeUnixNano() - span.GetStartTimeUnixNano())
+				fmt.Fprintf(&b, "  span %s trace_id=%s span_id=%s duration=%s%s\n",
+					span.GetName(), hex.EncodeToString(span.GetTraceId()), hex.EncodeToString(span.GetSpanId()),
+					duration, stdoutAttributes(span.GetAttributes()))
+			}
+		}
+	}
+	return e.print(fmt.Sprintf("traces: %d spans", count), b.String(), &coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+}
+
+func (e *StdoutExporter) UploadLogs(ctx context.Context, protoLogs []*otlp.ResourceLogs) error {
+	var b strings.Builder
+	count := 0
+	for _, rl := range protoLogs {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, log := range sl.GetLogRecords() {
+				count++
+				fmt.Fprintf(&b, "  log %s %s%s\n",
+					log.GetSeverityText(), stdoutValue(getAttributeValue(log.GetBody())), stdoutAttributes(log.GetAttributes()))
+			}
+		}
+	}
+	return e.print(fmt.Sprintf("logs: %d log records", count), b.String(), &collogspb.ExportLogsServiceRequest{ResourceLogs: protoLogs})
+}
+
+func (e *StdoutExporter) UploadMetrics(ctx context.Context, protoMetrics []*otlp.ResourceMetrics) error {
+	var b strings.Builder
+	count := 0
+	for _, rm := range protoMetrics {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				count++
+				for _, dp := range metric.GetGauge().GetDataPoints() {
+					value := any(dp.GetAsDouble())
+					if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+						value = v.AsInt
+					}
+					fmt.Fprintf(&b, "  metric %s value=%v unit=%q%s\n", metric.GetName(), value, metric.GetUnit(), stdoutAttributes(dp.GetAttributes()))
+				}
+				for _, dp := range metric.GetHistogram().GetDataPoints() {
+					fmt.Fprintf(&b, "  metric %s count=%d sum=%v unit=%q%s\n", metric.GetName(), dp.GetCount(), dp.GetSum(), metric.GetUnit(), stdoutAttributes(dp.GetAttributes()))
+				}
+			}
+		}
+	}
+	return e.print(fmt.Sprintf("metrics: %d metrics", count), b.String(), &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: protoMetrics})
+}
+
+// print writes a batch as one block, so that batches uploaded concurrently
+// are not interleaved.
+func (e *StdoutExporter) print(header, body string, req proto.Message) error {
+	var dump []byte
+	if e.verbose {
+		var err error
+		dump, err = protojson.MarshalOptions{Indent: "  "}.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("stdout: marshal: %w", err)
+		}
+		dump = append(dump, '\n')
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := io.WriteString(e.w, header+"\n"+body); err != nil {
+		return fmt.Errorf("stdout: write: %w", err)
+	}
+	if _, err := e.w.Write(dump); err != nil {
+		return fmt.Errorf("stdout: write: %w", err)
+	}
+	return nil
+}
+
+// stdoutAttributes renders the first few attributes, noting how many more
+// there are.
+func stdoutAttributes(attrs []*commonpb.KeyValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, stdoutMaxAttributes+1)
+	for i, kv := range attrs {
+		if i == stdoutMaxAttributes {
+			parts = append(parts, fmt.Sprintf("(+%d more)", len(attrs)-i))
+			break
+		}
+		parts = append(parts, kv.GetKey()+"="+stdoutValue(getAttributeValue(kv.GetValue())))
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+// stdoutValue renders a value as JSON, so strings are quoted and structured
+// values are readable.
+func stdoutValue(v any) string {
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/mashiike/go-otlp-helper/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exp := NewStdoutExporter(StdoutExporterConfig{Writer: &buf})
+	require.NoError(t, exp.Start(context.Background()))
+	require.NoError(t, exp.UploadTraces(context.Background(), []*otlp.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{
+			{
+				Name:              "model.jaffle_shop.orders",
+				TraceId:           []byte{0x01},
+				SpanId:            []byte{0x02},
+				StartTimeUnixNano: 1000000000,
+				EndTimeUnixNano:   2500000000,
+				Attributes: []*commonpb.KeyValue{
+					{Key: "dbt.unique_id", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "model.jaffle_shop.orders"}}},
+					{Key: "dbt.rows", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 3}}},
+					{Key: "dbt.phase", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "run"}}},
+					{Key: "dbt.status", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "success"}}},
+					{Key: "dbt.skipped", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: false}}},
+				},
+			},
+			{Name: "dbt build"},
+		}}},
+	}}))
+	require.NoError(t, exp.UploadLogs(context.Background(), testLokiResourceLogs()[:1]))
+	require.NoError(t, exp.UploadMetrics(context.Background(), []*otlp.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "dbt.rows_affected",
+			Unit: "{row}",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 42}},
+			}}},
+		}}}},
+	}}))
+	require.NoError(t, exp.Stop(context.Background()))
+
+	assert.Equal(t, `traces: 2 spans
+  span model.jaffle_shop.orders trace_id=01 span_id=02 duration=1.5s dbt.unique_id="model.jaffle_shop.orders" dbt.rows=3 dbt.phase="run" (+2 more)
+  span dbt build trace_id= span_id= duration=0s
+logs: 3 log records
+  log WARN {"rows":"3"}
+  log INFO "Loading packages.yml" dbt.phase="parse"
+  log INFO "Running with dbt"
+metrics: 1 metrics
+  metric dbt.rows_affected value=42 unit="{row}"
+`, buf.String())
+}
+
+func TestStdoutExporter_Verbose(t *testing.T) {
+	var buf bytes.Buffer
+	exp := NewStdoutExporter(StdoutExporterConfig{Writer: &buf, Verbose: true})
+	require.NoError(t, exp.UploadTraces(context.Background(), []*otlp.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "dbt build"}}}},
+	}}))
+	header, dump, ok := strings.Cut(buf.String(), "  span dbt build trace_id= span_id= duration=0s\n")
+	require.True(t, ok, buf.String())
+	assert.Equal(t, "traces: 1 spans\n", header)
+	var req map[string]any
+	require.NoError(t, json.Unmarshal([]byte(dump), &req), "the batch is dumped as OTLP JSON")
+	assert.Contains(t, req, "resourceSpans")
+}
+
+func TestStdoutExporterConfig(t *testing.T) {
+	var cfg ExporterConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+type: debug
+output: stderr
+verbose: true
+`), &cfg))
+	assert.Equal(t, StdoutExporterConfig{Output: "stderr", Verbose: true}, cfg.Stdout)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Stdout.Output = "syslog"
+	require.Error(t, cfg.Validate())
+	require.NoError(t, (&ExporterConfig{Type: "stdout"}).Validate(), "no option is required")
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// streamAndUpload is the streaming alternative to tailOTELFile + flushAndUpload.
+// Each tailed line is decoded immediately and only decoded records are batched,
+// avoiding the line channel and the intermediate []string buffer.
+func (a *App) streamAndUpload(ctx context.Context, path string, forwarders []*Forwarder, cutoffTimeNano uint64, params RunParams) {
+	if params.ControlFile != "" {
+		a.Logger.Warn("control file is not supported with streaming decode, ignoring", "path", params.ControlFile)
+	}
+	if params.InProgressAfter > 0 {
+		a.Logger.Warn("in-progress span snapshots are not supported with streaming decode, ignoring")
+	}
+	if params.FlushSpanCount > 0 || params.FlushLogCount > 0 {
+		a.Logger.Warn("flush span and log counts are not supported with streaming decode, ignoring", "flush_span_count", params.FlushSpanCount, "flush_log_count", params.FlushLogCount)
+	}
+	if _, batchers := splitBatchedForwarders(forwarders); len(batchers) > 0 {
+		names := make([]string, len(batchers))
+		for i, b := range batchers {
+			names[i] = b.forwarder.name
+		}
+		a.Logger.Warn("forwarder batch settings are not supported with streaming decode, uploading with the shared batches", "forwarders", names)
+	}
+	if params.cancelDrainLimit() != DefaultCancelDrainLimit {
+		// Lines are decoded as they are read, so there is no queue to drain.
+		a.Logger.Warn("cancel drain limit does not apply with streaming decode, ignoring", "cancel_drain_limit", params.CancelDrainLimit)
+	}
+	decoder := a.newDecoder(cutoffTimeNano, params)
+	retries := 0 // set for the final flush, once the tail and the ticker stopped
+	batcher := newRecordBatcher(params.batchSize(), func(spans []*tracepb.Span, logs []*logspb.LogRecord, metrics []*metricspb.Metric) {
+		a.Logger.Debug("flushing batch", "span_count", len(spans), "log_count", len(logs), "metric_count", len(metrics))
+		// Waiting holds up the tail, which decodes and flushes as it reads.
+		release := a.inFlight.acquire(recordsSize(spans, logs, metrics))
+		defer release()
+		a.upload(spans, logs, metrics, forwarders, params, retries)
+	})
+	batcher.debounce = newDebouncer(a.cfg.DebounceMax, a.cfg.DebounceDelay, a.Now)
+
+	tickerCtx, stopTicker := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(params.flushInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				batcher.Tick()
+			case <-a.flushRequests:
+				a.Logger.Debug("flush requested")
+				batcher.Flush()
+			case <-tickerCtx.Done():
+				return
+			}
+		}
+	}()
+
+	a.followOTELFile(ctx, path, params.NoExec, func(line otelLine) bool {
+		batcher.Add(decoder.decodeOTELLine(line))
+		batcher.AddMetrics(decoder.Metrics())
+		return true
+	})
+	stopTicker()
+	wg.Wait()
+	a.Logger.Debug("tail finished, final flush")
+	retries = params.FinalFlushRetries
+	batcher.Flush()
+}
+
+// recordBatcher collects decoded spans, logs and metrics and passes them to
+// flush once size records are pending or Flush is called.
+type recordBatcher struct {
+	mu      sync.Mutex
+	size    int
+	spans   []*tracepb.Span
+	logs    []*logspb.LogRecord
+	metrics []*metricspb.Metric
+
+	flushMu  sync.Mutex // serializes uploads between the tail and the ticker
+	flush    func([]*tracepb.Span, []*logspb.LogRecord, []*metricspb.Metric)
+	debounce *debouncer
+}
+
+func newRecordBatcher(size int, flush func([]*tracepb.Span, []*logspb.LogRecord, []*metricspb.Metric)) *recordBatcher {
+	return &recordBatcher{
+		size:  size,
+		flush: flush,
+	}
+}
+
+// Add appends the non-nil records and flushes when the batch is full.
+func (b *recordBatcher) Add(span *tracepb.Span, log *logspb.LogRecord) {
+	if span == nil && log == nil {
+		return
+	}
+	b.mu.Lock()
+	if span != nil {
+		b.spans = append(b.spans, span)
+	}
+	if log != nil {
+		b.logs = append(b.logs, log)
+	}
+	full := b.pending() >= b.size
+	b.mu.Unlock()
+	if full {
+		b.Tick()
+	}
+}
+
+// AddMetrics appends metrics and flushes when the batch is full.
+func (b *recordBatcher) AddMetrics(metrics []*metricspb.Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.metrics = append(b.metrics, metrics...)
+	full := b.pending() >= b.size
+	b.mu.Unlock()
+	if full {
+		b.Tick()
+	}
+}
+
+// pending returns the number of pending records; b.mu must be held.
+func (b *recordBatcher) pending() int {
+	return len(b.spans) + len(b.logs) + len(b.metrics)
+}
+
+// Flush hands all pending records, sorted like DecodeLines output, to the flush function.
+func (b *recordBatcher) Flush() {
+	b.flushPending(true)
+}
+
+// Tick flushes pending records unless debouncing holds them back.
+func (b *recordBatcher) Tick() {
+	b.flushPending(false)
+}
+
+func (b *recordBatcher) flushPending(final bool) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	if !final && b.debounce.hold(b.pending()) {
+		b.mu.Unlock()
+		return
+	}
+	spans, logs, metrics := b.spans, b.logs, b.metrics
+	b.spans, b.logs, b.metrics = nil, nil, nil
+	b.mu.Unlock()
+	if len(spans) == 0 && len(logs) == 0 && len(metrics) == 0 {
+		return
+	}
+	sortSpansByStartTime(spans)
+	sortLogsByTime(logs)
+	b.flush(spans, logs, metrics)
+}
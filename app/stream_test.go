@@ -0,0 +1,182 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sebdah/goldie/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/mock/gomock"
+)
+
+func readTestdataLines(tb testing.TB, path string) []string {
+	tb.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatalf("failed to open testdata: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 4*1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		tb.Fatalf("failed to scan testdata: %v", err)
+	}
+	return lines
+}
+
+func TestDecodeLine_StreamingMatchesGolden(t *testing.T) {
+	lines := readTestdataLines(t, "testdata/otel.jsonl")
+	g := goldie.New(t,
+		goldie.WithFixtureDir("testdata"),
+		goldie.WithNameSuffix(".golden.jsonl"),
+	)
+
+	var spans []*tracepb.Span
+	var logs []*logspb.LogRecord
+	batcher := newRecordBatcher(7, func(s []*tracepb.Span, l []*logspb.LogRecord, _ []*metricspb.Metric) {
+		spans = append(spans, s...)
+		logs = append(logs, l...)
+	})
+	decoder := NewDecoder(0)
+	for _, line := range lines {
+		batcher.Add(decoder.DecodeLine(line))
+	}
+	batcher.Flush()
+
+	// Batches are sorted individually; sort globally to compare with DecodeLines output.
+	sortSpansByStartTime(spans)
+	sortLogsByTime(logs)
+	g.Assert(t, "decode_without_cutoff.spans", serializeSpansToJSONL(t, spans))
+	g.Assert(t, "decode_without_cutoff.logs", serializeLogsToJSONL(t, logs))
+}
+
+func TestRecordBatcher_FlushesWhenFull(t *testing.T) {
+	var flushed [][]*tracepb.Span
+	batcher := newRecordBatcher(2, func(s []*tracepb.Span, _ []*logspb.LogRecord, _ []*metricspb.Metric) {
+		flushed = append(flushed, s)
+	})
+	batcher.Add(nil, nil)
+	batcher.Add(&tracepb.Span{Name: "b", StartTimeUnixNano: 2}, nil)
+	assert.Empty(t, flushed)
+	batcher.Add(&tracepb.Span{Name: "a", StartTimeUnixNano: 1}, nil)
+	require.Len(t, flushed, 1)
+	assert.Equal(t, "a", flushed[0][0].Name, "batch should be sorted by start time")
+	batcher.Flush()
+	assert.Len(t, flushed, 1, "empty flush should not call flush func")
+}
+
+func TestStreamAndUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+
+	path := filepath.Join(t.TempDir(), "otel.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(spanLines(0, 100), "\n")+"\n"), 0o600))
+
+	var uploaded atomic.Int64
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+			uploaded.Add(int64(len(protoSpans[0].ScopeSpans[0].Spans)))
+			return nil
+		},
+	).MinTimes(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newTestApp().streamAndUpload(ctx, path, newMockForwarder(t, mock), 0, RunParams{FlushTimeout: 5 * time.Second})
+	}()
+	// 100 decoded spans fill one batch, so they are uploaded without waiting for the ticker.
+	require.Eventually(t, func() bool { return uploaded.Load() == 100 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int64(100), uploaded.Load())
+}
+
+func TestStreamAndUpload_WarnsUnsupportedOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockExporter(ctrl)
+	mock.EXPECT().UploadTraces(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	fw, err := NewForwarder("batched", ForwardConfig{
+		Traces: &TracesForwardConfig{Exporters: []string{"mock"}},
+		Batch:  &ForwardBatchConfig{Size: 10},
+	}, map[string]Exporter{"mock": mock})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "otel.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(spanLines(0, 1), "\n")+"\n"), 0o600))
+	var logBuf bytes.Buffer
+	a := newTestApp()
+	a.Logger = slog.New(slog.NewTextHandler(&logBuf, nil))
+	a.streamAndUpload(context.Background(), path, []*Forwarder{fw}, 0, RunParams{
+		FlushTimeout:     5 * time.Second,
+		NoExec:           true,
+		FlushSpanCount:   10,
+		CancelDrainLimit: -1,
+	})
+	for _, warning := range []string{
+		"flush span and log counts are not supported with streaming decode",
+		"forwarder batch settings are not supported with streaming decode",
+		"cancel drain limit does not apply with streaming decode",
+	} {
+		assert.Contains(t, logBuf.String(), warning)
+	}
+}
+
+func BenchmarkPipeline_BufferedLines(b *testing.B) {
+	lines := readTestdataLines(b, "testdata/otel.jsonl")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ch := make(chan string, 1000)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			decoder := NewDecoder(0)
+			buffer := make([]string, 0, 100)
+			for line := range ch {
+				buffer = append(buffer, line)
+				if len(buffer) >= 100 {
+					_, _, _ = decoder.DecodeLines(buffer)
+					buffer = buffer[:0]
+				}
+			}
+			_, _, _ = decoder.DecodeLines(buffer)
+		}()
+		for _, line := range lines {
+			ch <- line
+		}
+		close(ch)
+		<-done
+	}
+}
+
+func BenchmarkPipeline_Streaming(b *testing.B) {
+	lines := readTestdataLines(b, "testdata/otel.jsonl")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder := NewDecoder(0)
+		batcher := newRecordBatcher(100, func([]*tracepb.Span, []*logspb.LogRecord, []*metricspb.Metric) {})
+		for _, line := range lines {
+			batcher.Add(decoder.DecodeLine(line))
+		}
+		batcher.Flush()
+	}
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Warmer is implemented by exporters that can establish connections before
+// the first upload, so that dbt's startup time hides the TCP/TLS handshake.
+type Warmer interface {
+	Warmup(ctx context.Context) error
+}
+
+func warmupExporter(ctx context.Context, exp Exporter) error {
+	if w, ok := exp.(Warmer); ok {
+		return w.Warmup(ctx)
+	}
+	return nil
+}
+
+// HTTPWarmupExporter opens connections to OTLP/HTTP endpoints with a HEAD
+// request. The otlp client sends through http.DefaultTransport, so the idle
+// connection left in its pool is reused by the first upload. gRPC endpoints
+// are not warmed up, as the client connects lazily on the first call.
+type HTTPWarmupExporter struct {
+	Exporter
+	client    *http.Client
+	endpoints []string
+}
+
+func NewHTTPWarmupExporter(exp Exporter, cfg OtlpExporterConfig) *HTTPWarmupExporter {
+	return &HTTPWarmupExporter{
+		Exporter:  exp,
+		client:    http.DefaultClient,
+		endpoints: cfg.httpEndpoints(),
+	}
+}
+
+func (e *HTTPWarmupExporter) Warmup(ctx context.Context) error {
+	var errs []error
+	for _, endpoint := range e.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := e.client.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Any status is fine; draining the body keeps the connection reusable.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// httpEndpoints returns one endpoint per host used by an OTLP/HTTP signal.
+// Signals with tls are skipped: they are sent through their own transport,
+// whose pool a warmup through http.DefaultClient would not fill.
+func (cfg *OtlpExporterConfig) httpEndpoints() []string {
+	var endpoints []string
+	seen := make(map[string]bool)
+	add := func(signal *OtlpSignalConfig) {
+		protocol, endpoint, tlsCfg := cfg.Protocol, cfg.Endpoint, cfg.TLS
+		if signal != nil && signal.TLS != nil {
+			tlsCfg = signal.TLS
+		}
+		if tlsCfg != nil {
+			return
+		}
+		if signal != nil && signal.Protocol != "" {
+			protocol = signal.Protocol
+		}
+		if signal != nil && signal.Endpoint != "" {
+			endpoint = signal.Endpoint
+		}
+		if !strings.HasPrefix(protocol, "http/") {
+			return
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" || seen[u.Host] {
+			return
+		}
+		seen[u.Host] = true
+		endpoints = append(endpoints, endpoint)
+	}
+	add(cfg.Traces)
+	add(cfg.Logs)
+	return endpoints
+}
+
+func (e *OonceStartExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *TimeoutExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *RetryExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *ResourceOverrideExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *SamplingExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *DynamicHeadersExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *statsExporter) Warmup(ctx context.Context) error {
+	return warmupExporter(ctx, e.Exporter)
+}
+
+func (e *MultiplexExporter) Warmup(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(e.exporters))
+	for _, exporter := range e.exporters {
+		wg.Add(1)
+		go func(exp Exporter) {
+			defer wg.Done()
+			if err := warmupExporter(ctx, exp); err != nil {
+				errCh <- err
+			}
+		}(exporter)
+	}
+	wg.Wait()
+	close(errCh)
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestHTTPWarmupExporter_ConnectsBeforeFirstUpload(t *testing.T) {
+	var newConns, uploads atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			uploads.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	exp, err := NewExporter(context.Background(), ExporterConfig{
+		Type: "otlp",
+		Otlp: OtlpExporterConfig{
+			Endpoint: srv.URL,
+			Protocol: "http/protobuf",
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background()))
+	defer exp.Stop(context.Background())
+
+	require.NoError(t, warmupExporter(context.Background(), exp))
+	assert.Equal(t, int64(1), newConns.Load(), "warmup should open a connection")
+	assert.Equal(t, int64(0), uploads.Load(), "warmup should not upload anything")
+
+	require.NoError(t, exp.UploadTraces(context.Background(), []*tracepb.ResourceSpans{{}}))
+	assert.Equal(t, int64(1), uploads.Load())
+	assert.Equal(t, int64(1), newConns.Load(), "first upload should reuse the warmed up connection")
+}
+
+func TestOtlpExporterConfig_HTTPEndpoints(t *testing.T) {
+	cfg := OtlpExporterConfig{Endpoint: "localhost:4317"}
+	assert.Empty(t, cfg.httpEndpoints(), "grpc endpoints are not warmed up")
+
+	cfg = OtlpExporterConfig{
+		Endpoint: "https://otlp.example.com",
+		Protocol: "http/protobuf",
+		Logs:     &OtlpSignalConfig{Endpoint: "https://logs.example.com/v1/logs"},
+	}
+	assert.Equal(t, []string{"https://otlp.example.com", "https://logs.example.com/v1/logs"}, cfg.httpEndpoints())
+
+	cfg.Logs = &OtlpSignalConfig{Endpoint: "https://otlp.example.com/v1/logs"}
+	assert.Equal(t, []string{"https://otlp.example.com"}, cfg.httpEndpoints(), "one connection per host")
+
+	cfg.Logs = &OtlpSignalConfig{Endpoint: "https://logs.example.com/v1/logs", TLS: &TLSConfig{CAFile: "ca.pem"}}
+	assert.Equal(t, []string{"https://otlp.example.com"}, cfg.httpEndpoints(), "signals with tls use their own transport")
+}
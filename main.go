@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,21 +24,97 @@ func main() {
 func run() int {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	fs, parse, targetArgs := newFlagSet()
+	fs, parse, targetArgs, command := newFlagSet()
 	var (
-		logDir       = getenv("DBT_LOG_PATH", "logs")
-		otelFile     = getenv("DBT_OTEL_FILE_NAME", "otel.jsonl")
-		logFmt       = getenv("LOG_FORMAT", "json")
-		logLevel     = getenv("LOG_LEVEL", "info")
-		flushTimeout = getenv("DBT_OTEL_FLUSH_TIMEOUT", "5m")
-		config       = getenv("DBT_OTEL_FORWARDER_CONFIG", "dbt-fusion-otel-forwarder-config.yml")
+		logDir           = getenv("DBT_LOG_PATH", "logs")
+		otelFile         = getenv("DBT_OTEL_FILE_NAME", "otel.jsonl")
+		logFmt           = getenv("LOG_FORMAT", "json")
+		logLevel         = getenv("LOG_LEVEL", "info")
+		flushTimeout     = getenv("DBT_OTEL_FLUSH_TIMEOUT", "5m")
+		config           = getenv("DBT_OTEL_FORWARDER_CONFIG", "dbt-fusion-otel-forwarder-config.yml")
+		controlFile      = getenv("DBT_OTEL_CONTROL_FILE", "")
+		strictTimestamps = getenvBool("DBT_OTEL_STRICT_TIMESTAMPS", false)
+		explicitOK       = getenvBool("DBT_OTEL_EXPLICIT_OK_STATUS", false)
+		streamingDecode  = getenvBool("DBT_OTEL_STREAMING_DECODE", false)
+		invocationCutoff = getenvBool("DBT_OTEL_INVOCATION_CUTOFF", false)
+		commentPrefix    = getenv("DBT_OTEL_COMMENT_PREFIX", "")
+		maxRuntime       = getenv("DBT_OTEL_MAX_RUNTIME", "")
+		profile          = getenv("DBT_OTEL_PROFILE", "")
+		flushSpanCount   = getenvInt("DBT_OTEL_FLUSH_SPAN_COUNT", 0)
+		flushLogCount    = getenvInt("DBT_OTEL_FLUSH_LOG_COUNT", 0)
+		exitCodeMode     = getenv("DBT_OTEL_EXIT_CODE_MODE", app.ExitCodeModePassthrough)
+		forwarderVersion = getenvBool("DBT_OTEL_FORWARDER_VERSION_ATTRIBUTE", false)
+		synthesizeIDs    = getenvBool("DBT_OTEL_SYNTHESIZE_IDS", false)
+		traceParent      = getenv("TRACEPARENT", "")
+		noExec           = getenvBool("DBT_OTEL_NO_EXEC", false)
+		onDuplicate      = getenv("DBT_OTEL_ON_DUPLICATE", app.OnDuplicateDrop)
+		spanNameFields   = getenv("DBT_OTEL_SPAN_NAME_FIELDS", "span_name")
+		eventSummary     = getenvBool("DBT_OTEL_SPAN_EVENT_SUMMARY", false)
+		stacktraceFields = getenv("DBT_OTEL_STACKTRACE_FIELDS", "traceback,stacktrace")
+		resolveLogSpans  = getenvBool("DBT_OTEL_RESOLVE_LOG_SPANS", false)
+		inProgressAfter  = getenv("DBT_OTEL_IN_PROGRESS_SPANS_AFTER", "")
+		spoolDir         = getenv("DBT_OTEL_SPOOL_DIR", "")
+		spoolMaxBytes    = getenvInt("DBT_OTEL_SPOOL_MAX_BYTES", app.DefaultSpoolMaxBytes)
+		selfTest         = getenvBool("DBT_OTEL_SELFTEST", false)
+		finalRetries     = getenvInt("DBT_OTEL_FINAL_FLUSH_RETRIES", 0)
+		cutoff           = getenv("DBT_OTEL_CUTOFF", "")
+		flushInterval    = getenv("DBT_OTEL_FLUSH_INTERVAL", "5s")
+		uploadTimeout    = getenv("DBT_OTEL_UPLOAD_TIMEOUT", "30s")
+		batchSize        = getenvInt("DBT_OTEL_BATCH_SIZE", app.DefaultBatchSize)
+		cancelDrain      = getenvInt("DBT_OTEL_CANCEL_DRAIN_LIMIT", app.DefaultCancelDrainLimit)
+		flushOnSignal    = getenvBool("DBT_OTEL_FLUSH_ON_SIGNAL", false)
+		dryRun           = getenvBool("DBT_OTEL_DRY_RUN", false)
+		elapsedUnit      = getenv("DBT_OTEL_ELAPSED_UNIT", app.ElapsedUnitAuto)
+		markReplayed     = getenvBool("DBT_OTEL_MARK_REPLAYED", false)
+		replayID         = getenv("DBT_OTEL_REPLAY_ID", "")
+		statsFile        = getenv("DBT_OTEL_STATS_FILE", "")
+		replayFile       = getenv("DBT_OTEL_REPLAY_FILE", "")
+		since            = getenv("DBT_OTEL_SINCE", "")
 	)
 	fs.StringVar(&logDir, "log-path", logDir, "Directory where dbt writes logs (defaults to dbt's log path)")
 	fs.StringVar(&otelFile, "otel-file", otelFile, "OTEL log file name (relative to log-path unless absolute)")
-	fs.StringVar(&config, "config", config, "Path to forward config (JSON)")
+	fs.StringVar(&config, "config", config, "Path to forward config (YAML, or JSON for a .json file)")
+	fs.StringVar(&profile, "profile", profile, "Config profile to merge over the base exporters and forward rules. Default from DBT_OTEL_PROFILE")
 	fs.StringVar(&logLevel, "log-level", logLevel, "Log level (debug, info, warn, error). Default from LOG_LEVEL or info")
 	fs.StringVar(&logFmt, "log-format", logFmt, "Log format (json or text). Default from LOG_FORMAT or json")
 	fs.StringVar(&flushTimeout, "flush-timeout", flushTimeout, "Maximum time to wait for flushing OTEL data on exit. Default from DBT_OTEL_FLUSH_TIMEOUT or 5m")
+	fs.StringVar(&uploadTimeout, "upload-timeout", uploadTimeout, "Maximum time for each upload, including retries; capped by the flush timeout. Default from DBT_OTEL_UPLOAD_TIMEOUT or 30s")
+	fs.StringVar(&controlFile, "control-file", controlFile, "Pause uploads while this file exists (content \"resume\" resumes). Default from DBT_OTEL_CONTROL_FILE")
+	fs.BoolVar(&strictTimestamps, "strict-timestamps", strictTimestamps, "Drop spans with unparseable timestamps instead of falling back to now. Default from DBT_OTEL_STRICT_TIMESTAMPS")
+	fs.BoolVar(&explicitOK, "explicit-ok-status", explicitOK, "Set OK status on spans of successfully evaluated nodes. Default from DBT_OTEL_EXPLICIT_OK_STATUS")
+	fs.BoolVar(&streamingDecode, "streaming-decode", streamingDecode, "Decode lines as they are tailed and batch decoded records instead of buffering raw lines. Default from DBT_OTEL_STREAMING_DECODE")
+	fs.BoolVar(&invocationCutoff, "invocation-cutoff", invocationCutoff, "Skip records until dbt's invocation start record and forward only that invocation. Default from DBT_OTEL_INVOCATION_CUTOFF")
+	fs.StringVar(&commentPrefix, "comment-prefix", commentPrefix, "Skip otel file lines starting with this prefix (e.g. #). Default from DBT_OTEL_COMMENT_PREFIX")
+	fs.StringVar(&maxRuntime, "max-runtime", maxRuntime, "Terminate dbt (SIGTERM, then SIGKILL) if it runs longer than this duration and exit with 124. Default from DBT_OTEL_MAX_RUNTIME")
+	fs.IntVar(&flushSpanCount, "flush-span-count", flushSpanCount, "Upload as soon as this many spans are decoded (0 disables). Default from DBT_OTEL_FLUSH_SPAN_COUNT")
+	fs.IntVar(&flushLogCount, "flush-log-count", flushLogCount, "Upload as soon as this many log records are decoded (0 disables). Default from DBT_OTEL_FLUSH_LOG_COUNT")
+	fs.StringVar(&exitCodeMode, "exit-code-mode", exitCodeMode, "Exit code to return: passthrough (dbt's), always-zero, or forwarder-aware (dbt's, or 3 if dbt succeeded but forwarding failed). Default from DBT_OTEL_EXIT_CODE_MODE or passthrough")
+	fs.BoolVar(&forwarderVersion, "forwarder-version-attribute", forwarderVersion, "Add dbt.forwarder.version to every span and log record. Default from DBT_OTEL_FORWARDER_VERSION_ATTRIBUTE")
+	fs.BoolVar(&synthesizeIDs, "synthesize-ids", synthesizeIDs, "Derive deterministic ids for records lacking trace_id/span_id instead of skipping them. Default from DBT_OTEL_SYNTHESIZE_IDS")
+	fs.StringVar(&traceParent, "traceparent", traceParent, "W3C traceparent to nest the dbt trace under (e.g. from an orchestrator). Default from TRACEPARENT")
+	fs.BoolVar(&noExec, "no-exec", noExec, "Do not run dbt; forward the existing OTEL file to its end and exit (for pipeline tests). Default from DBT_OTEL_NO_EXEC")
+	fs.BoolVar(&markReplayed, "mark-replayed", markReplayed, "With --no-exec or replay, add dbt.replayed=true to every span and log record so backends can tell replayed data apart. Default from DBT_OTEL_MARK_REPLAYED")
+	fs.StringVar(&replayID, "replay-id", replayID, "With --no-exec or replay, add dbt.replay_id with this value to every span and log record; implies --mark-replayed. Default from DBT_OTEL_REPLAY_ID")
+	fs.StringVar(&elapsedUnit, "elapsed-unit", elapsedUnit, "Unit of the elapsed field that gives a span's end time when its records have none: auto, s, ms or ns. Default from DBT_OTEL_ELAPSED_UNIT or auto")
+	fs.StringVar(&onDuplicate, "on-duplicate", onDuplicate, "Handling of records of an already emitted span id: drop or merge. Default from DBT_OTEL_ON_DUPLICATE or drop")
+	fs.StringVar(&spanNameFields, "span-name-fields", spanNameFields, "Comma separated record fields tried in order for the span name (attributes.<key> reads an attribute); falls back to the node unique_id. Default from DBT_OTEL_SPAN_NAME_FIELDS or span_name")
+	fs.BoolVar(&eventSummary, "span-event-summary", eventSummary, "Add dbt.span.event_count and dbt.span.error (true if an exception event exists) to every span. Default from DBT_OTEL_SPAN_EVENT_SUMMARY")
+	fs.StringVar(&stacktraceFields, "stacktrace-fields", stacktraceFields, "Comma separated record attributes tried in order for exception.stacktrace of failed nodes. Default from DBT_OTEL_STACKTRACE_FIELDS or traceback,stacktrace")
+	fs.BoolVar(&resolveLogSpans, "resolve-log-spans", resolveLogSpans, "Re-correlate log records with an unknown span id to the innermost span running at their time. Default from DBT_OTEL_RESOLVE_LOG_SPANS")
+	fs.StringVar(&inProgressAfter, "in-progress-spans-after", inProgressAfter, "Upload snapshots with dbt.span.in_progress=true of spans open longer than this duration at each flush. Default from DBT_OTEL_IN_PROGRESS_SPANS_AFTER")
+	fs.StringVar(&spoolDir, "spool-dir", spoolDir, "Persist batches in this directory until uploaded and replay the ones left by earlier runs. Default from DBT_OTEL_SPOOL_DIR")
+	fs.IntVar(&spoolMaxBytes, "spool-max-bytes", spoolMaxBytes, "Bound of the spool directory; the oldest batches are dropped beyond it. Default from DBT_OTEL_SPOOL_MAX_BYTES or 64MiB")
+	fs.IntVar(&finalRetries, "final-flush-retries", finalRetries, "Retry the final upload this many times for forwarders that failed, waiting another flush timeout each time. Default from DBT_OTEL_FINAL_FLUSH_RETRIES")
+	fs.StringVar(&flushInterval, "flush-interval", flushInterval, "Upload buffered records this often while dbt runs. Default from DBT_OTEL_FLUSH_INTERVAL or 5s")
+	fs.IntVar(&batchSize, "batch-size", batchSize, "Upload as soon as this many lines (decoded records with --streaming-decode) are buffered. Default from DBT_OTEL_BATCH_SIZE or 100")
+	fs.BoolVar(&flushOnSignal, "flush-on-signal", flushOnSignal, "Upload buffered records immediately when the forwarder receives SIGUSR1 (not on Windows). Default from DBT_OTEL_FLUSH_ON_SIGNAL or false")
+	fs.IntVar(&cancelDrain, "cancel-drain-limit", cancelDrain, "When the upload is cancelled, forward up to this many lines already read but not yet buffered; 0 forwards none. Default from DBT_OTEL_CANCEL_DRAIN_LIMIT or 10000")
+	fs.StringVar(&cutoff, "cutoff", cutoff, "Skip records older than the start of the run (now) or forward every record (none). Default from DBT_OTEL_CUTOFF, or none with --no-exec and now otherwise")
+	fs.BoolVar(&dryRun, "dry-run", dryRun, "Read and decode the OTEL file as usual but upload nothing; print the span, error span, trace and log record counts to stderr at the end. Default from DBT_OTEL_DRY_RUN")
+	fs.StringVar(&statsFile, "stats-file", statsFile, "Write the run statistics as JSON to this file at the end, or to stdout for -: lines read, records decoded and uploaded, upload errors, uploads per exporter, duration and exit code. Default from DBT_OTEL_STATS_FILE")
+	fs.StringVar(&replayFile, "replay", replayFile, "Do not run dbt; forward this previously captured OTEL file with the configured forward rules and exit, ignoring --cutoff. Same as the replay <file> subcommand. Default from DBT_OTEL_REPLAY_FILE")
+	fs.StringVar(&since, "since", since, "With --replay, skip records older than this RFC 3339 time or duration ago, e.g. 2025-01-02T15:04:05Z or 6h. Default from DBT_OTEL_SINCE")
+	fs.BoolVar(&selfTest, "selftest", selfTest, "Do not run dbt; send a synthetic span and log through every forward rule, report each exporter's result and exit with 1 if any failed. Default from DBT_OTEL_SELFTEST")
 	if err := parse(); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to parse flags: %v\n", err)
 		return 1
@@ -47,6 +125,34 @@ func run() int {
 		minLevel = slog.LevelInfo
 		warnings = append(warnings, fmt.Sprintf("invalid log level: %s, fallback to info", logLevel))
 	}
+	if !app.ValidExitCodeMode(exitCodeMode) {
+		warnings = append(warnings, fmt.Sprintf("invalid exit code mode: %s, fallback to passthrough", exitCodeMode))
+		exitCodeMode = app.ExitCodeModePassthrough
+	}
+	if !app.ValidElapsedUnit(elapsedUnit) {
+		warnings = append(warnings, fmt.Sprintf("invalid elapsed unit: %s, fallback to auto", elapsedUnit))
+		elapsedUnit = app.ElapsedUnitAuto
+	}
+	if !app.ValidOnDuplicate(onDuplicate) {
+		warnings = append(warnings, fmt.Sprintf("invalid on-duplicate mode: %s, fallback to drop", onDuplicate))
+		onDuplicate = app.OnDuplicateDrop
+	}
+	if replayID != "" {
+		markReplayed = true
+	}
+	if markReplayed && !noExec && command != replayCommand && replayFile == "" {
+		warnings = append(warnings, "mark-replayed and replay-id only apply with no-exec or replay, ignoring them")
+	}
+	if cutoff != "" && !app.ValidCutoff(cutoff) {
+		warnings = append(warnings, fmt.Sprintf("invalid cutoff: %s, fallback to the mode's default", cutoff))
+		cutoff = ""
+	}
+	if traceParent != "" {
+		if _, _, err := app.ParseTraceParent(traceParent); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v, spans are not re-rooted", err))
+			traceParent = ""
+		}
+	}
 	if logFmt != "json" && logFmt != "text" {
 		warnings = append(warnings, fmt.Sprintf("invalid log format: %s, fallback to json", logFmt))
 		logFmt = "json"
@@ -68,11 +174,56 @@ func run() int {
 		logger.Warn("invalid flush timeout, fallback to 5m", "value", flushTimeout)
 		flushTimeoutDuration = 5 * time.Minute
 	}
+	uploadTimeoutDuration, err := time.ParseDuration(uploadTimeout)
+	if err != nil || uploadTimeoutDuration <= 0 {
+		logger.Warn("invalid upload timeout, fallback to 30s", "value", uploadTimeout)
+		uploadTimeoutDuration = app.DefaultUploadTimeout
+	}
+	flushIntervalDuration, err := time.ParseDuration(flushInterval)
+	if err != nil || flushIntervalDuration <= 0 {
+		logger.Warn("invalid flush interval, fallback to 5s", "value", flushInterval)
+		flushIntervalDuration = app.DefaultFlushInterval
+	}
+	if batchSize <= 0 {
+		logger.Warn("invalid batch size, fallback to 100", "value", batchSize)
+		batchSize = app.DefaultBatchSize
+	}
+	if cancelDrain < 0 {
+		logger.Warn("invalid cancel drain limit, fallback to 10000", "value", cancelDrain)
+		cancelDrain = app.DefaultCancelDrainLimit
+	}
+	if cancelDrain == 0 {
+		// RunParams treats 0 as the default.
+		cancelDrain = -1
+	}
+	var maxRuntimeDuration time.Duration
+	if maxRuntime != "" {
+		maxRuntimeDuration, err = time.ParseDuration(maxRuntime)
+		if err != nil {
+			logger.Warn("invalid max runtime, watchdog disabled", "value", maxRuntime)
+			maxRuntimeDuration = 0
+		}
+	}
+	var inProgressAfterDuration time.Duration
+	if inProgressAfter != "" {
+		inProgressAfterDuration, err = time.ParseDuration(inProgressAfter)
+		if err != nil {
+			logger.Warn("invalid in-progress spans duration, snapshots disabled", "value", inProgressAfter)
+			inProgressAfterDuration = 0
+		}
+	}
 
-	if len(targetArgs) == 0 {
+	if command == replayCommand {
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "usage: %s %s [flags] <file>\n", appName, replayCommand)
+			return 1
+		}
+		replayFile = fs.Arg(0)
+	}
+	if len(targetArgs) == 0 && replayFile == "" {
 		if fs.NArg() > 0 {
 			targetArgs = fs.Args()
-		} else {
+		} else if !noExec && !selfTest {
 			fs.Usage()
 			return 1
 		}
@@ -86,30 +237,94 @@ func run() int {
 		}
 		cfg = loaded
 	}
+	if profile != "" {
+		// dbt runs either way; without the profile's rules nothing is forwarded.
+		if cfg == nil {
+			slog.Warn("profile requires a config, running without forwarding", "profile", profile)
+		} else if err := cfg.ApplyProfile(profile); err != nil {
+			slog.Warn("failed to apply profile, running without forwarding", "error", err)
+			cfg = nil
+		}
+	}
 	a, err := app.New(ctx, cfg)
 	if err != nil {
 		slog.Error("failed to create app", "error", err)
 		return 1
 	}
 
+	var sinceTime time.Time
+	if since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			sinceTime = t
+		} else if d, err := time.ParseDuration(since); err == nil && d > 0 {
+			sinceTime = a.Now().Add(-d)
+		} else {
+			logger.Warn("invalid since, forwarding every record", "value", since)
+		}
+	}
+
 	params := app.RunParams{
-		LogPath:      logDir,
-		OtelFile:     otelFile,
-		TargetCmd:    targetArgs,
-		FlushTimeout: flushTimeoutDuration,
+		LogPath:           logDir,
+		OtelFile:          otelFile,
+		TargetCmd:         targetArgs,
+		FlushTimeout:      flushTimeoutDuration,
+		UploadTimeout:     uploadTimeoutDuration,
+		ControlFile:       controlFile,
+		StrictTimestamps:  strictTimestamps,
+		ExplicitOKStatus:  explicitOK,
+		StreamingDecode:   streamingDecode,
+		InvocationCutoff:  invocationCutoff,
+		CommentPrefix:     commentPrefix,
+		MaxRuntime:        maxRuntimeDuration,
+		FlushSpanCount:    flushSpanCount,
+		FlushLogCount:     flushLogCount,
+		ExitCodeMode:      exitCodeMode,
+		ForwarderVersion:  forwarderVersion,
+		SynthesizeIDs:     synthesizeIDs,
+		TraceParent:       traceParent,
+		NoExec:            noExec,
+		OnDuplicate:       onDuplicate,
+		SpanNameFields:    splitList(spanNameFields),
+		EventSummary:      eventSummary,
+		StacktraceFields:  splitList(stacktraceFields),
+		ResolveLogSpans:   resolveLogSpans,
+		InProgressAfter:   inProgressAfterDuration,
+		SpoolDir:          spoolDir,
+		SpoolMaxBytes:     int64(spoolMaxBytes),
+		FinalFlushRetries: finalRetries,
+		Cutoff:            cutoff,
+		FlushInterval:     flushIntervalDuration,
+		BatchSize:         batchSize,
+		CancelDrainLimit:  cancelDrain,
+		FlushOnSignal:     flushOnSignal,
+		DryRun:            dryRun,
+		ElapsedUnit:       elapsedUnit,
+		MarkReplayed:      markReplayed,
+		ReplayID:          replayID,
+		StatsFile:         statsFile,
+		Since:             sinceTime,
 	}
 
+	if selfTest {
+		return a.SelfTest(ctx, params)
+	}
+	if replayFile != "" {
+		return a.Replay(ctx, replayFile, params)
+	}
 	return a.Run(ctx, params)
 }
 
 const (
 	appName          = "dbt-fusion-otel-forwarder"
 	optionTerminator = "--"
+	replayCommand    = "replay"
 )
 
-func newFlagSet() (*flag.FlagSet, func() error, []string) {
+// newFlagSet splits the arguments at the option terminator. A leading replay
+// subcommand is returned as command and not parsed as a flag.
+func newFlagSet() (fs *flag.FlagSet, parse func() error, targetCmd []string, command string) {
 	wrapperArgs := make([]string, 0, len(os.Args))
-	targetCmd := make([]string, 0)
+	targetCmd = make([]string, 0)
 	for i, arg := range os.Args {
 		if arg == optionTerminator {
 			targetCmd = os.Args[i+1:]
@@ -117,11 +332,29 @@ func newFlagSet() (*flag.FlagSet, func() error, []string) {
 		}
 		wrapperArgs = append(wrapperArgs, arg)
 	}
-	fs := flag.NewFlagSet(appName, flag.ExitOnError)
+	if len(wrapperArgs) > 1 && wrapperArgs[1] == replayCommand {
+		command = replayCommand
+		wrapperArgs = append(wrapperArgs[:1], wrapperArgs[2:]...)
+	}
+	fs = flag.NewFlagSet(appName, flag.ExitOnError)
 	fs.SetOutput(os.Stderr)
 	return fs, func() error {
 		return fs.Parse(wrapperArgs[1:])
-	}, targetCmd
+	}, targetCmd, command
+}
+
+func getenvBool(key string, fallback bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func getenvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
 }
 
 func getenv(key, fallback string) string {
@@ -130,3 +363,14 @@ func getenv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}